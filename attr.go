@@ -0,0 +1,770 @@
+package htmlformat
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/net/html"
+)
+
+// QuoteStyle controls how attribute values are quoted.
+type QuoteStyle int
+
+const (
+	// DoubleQuotes writes every attribute value in double quotes.
+	DoubleQuotes QuoteStyle = iota
+	// SingleQuotes writes attribute values in single quotes, unless they
+	// contain a single quote and no double quotes.
+	SingleQuotes
+	// OriginalQuotes keeps the quoting that each attribute value has in the
+	// input. Values of nodes that were not parsed by the Formatter are
+	// written in double quotes.
+	OriginalQuotes
+	// MinimalQuotes omits the quotes around attribute values that can be
+	// written without them, and writes the rest in double quotes.
+	MinimalQuotes
+)
+
+var quoteStyleNames = []string{
+	DoubleQuotes:   "double",
+	SingleQuotes:   "single",
+	OriginalQuotes: "preserve",
+	MinimalQuotes:  "minimal",
+}
+
+// String returns the name of the quote style: "double", "single", "preserve"
+// or "minimal".
+func (q QuoteStyle) String() string {
+	if q < 0 || int(q) >= len(quoteStyleNames) {
+		return fmt.Sprintf("QuoteStyle(%d)", int(q))
+	}
+	return quoteStyleNames[q]
+}
+
+// Set sets the quote style from its name, so that it can be used as a
+// flag.Value.
+func (q *QuoteStyle) Set(name string) error {
+	for i, n := range quoteStyleNames {
+		if n == name {
+			*q = QuoteStyle(i)
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown quote style %q", name)
+}
+
+// BooleanStyle controls how boolean attributes, such as disabled, are
+// written.
+type BooleanStyle int
+
+const (
+	// KeepBooleans writes boolean attributes with the value they have in the
+	// input, so that <input disabled> is written as <input disabled="">.
+	KeepBooleans BooleanStyle = iota
+	// MinimalBooleans writes boolean attributes without a value, e.g.
+	// <input disabled>.
+	MinimalBooleans
+	// ExplicitBooleans writes boolean attributes with their name as their
+	// value, as XHTML requires, e.g. <input disabled="disabled">.
+	ExplicitBooleans
+)
+
+var booleanStyleNames = []string{
+	KeepBooleans:     "keep",
+	MinimalBooleans:  "minimal",
+	ExplicitBooleans: "explicit",
+}
+
+// String returns the name of the boolean style: "keep", "minimal" or
+// "explicit".
+func (b BooleanStyle) String() string {
+	if b < 0 || int(b) >= len(booleanStyleNames) {
+		return fmt.Sprintf("BooleanStyle(%d)", int(b))
+	}
+	return booleanStyleNames[b]
+}
+
+// Set sets the boolean style from its name, so that it can be used as a
+// flag.Value.
+func (b *BooleanStyle) Set(name string) error {
+	for i, n := range booleanStyleNames {
+		if n == name {
+			*b = BooleanStyle(i)
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown boolean style %q", name)
+}
+
+// DuplicateStyle controls what is written for attributes that appear more
+// than once on an element, such as two class attributes.
+type DuplicateStyle int
+
+const (
+	// KeepDuplicates writes every attribute, including duplicates.
+	KeepDuplicates DuplicateStyle = iota
+	// FirstDuplicate writes only the first of the attributes with the same
+	// name, which is the one that browsers use.
+	FirstDuplicate
+	// LastDuplicate writes only the last of the attributes with the same
+	// name, in the place of the first.
+	LastDuplicate
+	// RejectDuplicates returns a *RepairError for input with duplicate
+	// attributes instead of formatting it.
+	RejectDuplicates
+)
+
+var duplicateStyleNames = []string{
+	KeepDuplicates:   "keep",
+	FirstDuplicate:   "first",
+	LastDuplicate:    "last",
+	RejectDuplicates: "error",
+}
+
+// String returns the name of the duplicate style: "keep", "first", "last" or
+// "error".
+func (d DuplicateStyle) String() string {
+	if d < 0 || int(d) >= len(duplicateStyleNames) {
+		return fmt.Sprintf("DuplicateStyle(%d)", int(d))
+	}
+	return duplicateStyleNames[d]
+}
+
+// Set sets the duplicate style from its name, so that it can be used as a
+// flag.Value.
+func (d *DuplicateStyle) Set(name string) error {
+	for i, n := range duplicateStyleNames {
+		if n == name {
+			*d = DuplicateStyle(i)
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown duplicate style %q", name)
+}
+
+// AttributeAlignment controls how the attributes of a start tag that does not
+// fit within the print width are laid out.
+type AttributeAlignment int
+
+const (
+	// IndentAttributes writes each attribute on a line of its own, indented
+	// one level further than the tag, and the end of the tag on a line of
+	// its own, as Prettier does.
+	IndentAttributes AttributeAlignment = iota
+	// AlignAttributes writes the first attribute on the line of the tag, and
+	// the rest on lines of their own aligned under it, with the end of the
+	// tag after the last, as djLint does.
+	AlignAttributes
+)
+
+var attributeAlignmentNames = []string{
+	IndentAttributes: "indent",
+	AlignAttributes:  "align",
+}
+
+// String returns the name of the attribute alignment: "indent" or "align".
+func (a AttributeAlignment) String() string {
+	if a < 0 || int(a) >= len(attributeAlignmentNames) {
+		return fmt.Sprintf("AttributeAlignment(%d)", int(a))
+	}
+	return attributeAlignmentNames[a]
+}
+
+// Set sets the attribute alignment from its name, so that it can be used as a
+// flag.Value.
+func (a *AttributeAlignment) Set(name string) error {
+	for i, n := range attributeAlignmentNames {
+		if n == name {
+			*a = AttributeAlignment(i)
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown attribute alignment %q", name)
+}
+
+// dedupeAttributes returns attrs with the duplicates that DuplicateAttributes
+// leaves out removed. Attributes whose names hold template actions are never
+// duplicates. The input slice is not modified.
+func (f *Formatter) dedupeAttributes(attrs []html.Attribute) []html.Attribute {
+	if f.DuplicateAttributes != FirstDuplicate && f.DuplicateAttributes != LastDuplicate || len(attrs) < 2 {
+		return attrs
+	}
+	index := make(map[string]int, len(attrs))
+	deduped := make([]html.Attribute, 0, len(attrs))
+	for _, a := range attrs {
+		name := attributeName(a)
+		if strings.ContainsRune(name, placeholderStart) {
+			deduped = append(deduped, a)
+			continue
+		}
+		i, ok := index[name]
+		switch {
+		case !ok:
+			index[name] = len(deduped)
+			deduped = append(deduped, a)
+		case f.DuplicateAttributes == LastDuplicate:
+			deduped[i] = a
+		}
+	}
+	return deduped
+}
+
+// duplicateAttributes returns the names of the attributes in attrs that
+// appear more than once, in the order of their second appearance.
+func duplicateAttributes(attrs []html.Attribute) (names []string) {
+	seen := make(map[string]int, len(attrs))
+	for _, a := range attrs {
+		if strings.ContainsRune(a.Key, placeholderStart) {
+			continue
+		}
+		if seen[a.Key]++; seen[a.Key] == 2 {
+			names = append(names, a.Key)
+		}
+	}
+	return names
+}
+
+// booleanAttributes are the attributes of HTML elements whose presence alone
+// means true.
+// https://html.spec.whatwg.org/multipage/indices.html#attributes-3
+var booleanAttributes = map[string]bool{
+	"allowfullscreen": true, "async": true, "autofocus": true,
+	"autoplay": true, "checked": true, "controls": true, "default": true,
+	"defer": true, "disabled": true, "formnovalidate": true, "inert": true,
+	"ismap": true, "itemscope": true, "loop": true, "multiple": true,
+	"muted": true, "nomodule": true, "novalidate": true, "open": true,
+	"playsinline": true, "readonly": true, "required": true,
+	"reversed": true, "selected": true, "shadowrootclonable": true,
+	"shadowrootdelegatesfocus": true, "shadowrootserializable": true,
+	// hidden also has the value "until-found", which is left as it is.
+	"hidden": true,
+}
+
+// isBooleanAttribute reports whether a is a boolean attribute of the HTML
+// element n that is set to true, so that its value can be dropped or
+// replaced by its name.
+func isBooleanAttribute(n *html.Node, a html.Attribute) bool {
+	return n.Namespace == "" && a.Namespace == "" && booleanAttributes[a.Key] &&
+		(a.Val == "" || strings.EqualFold(a.Val, a.Key))
+}
+
+// attributes returns the attributes of n as they are written in a start tag.
+func (p *printer) attributes(n *html.Node) (attrs []string) {
+	for _, a := range p.startTagAttributes(n) {
+		name, quote, val, ok := p.attribute(n, a)
+		if !ok {
+			attrs = append(attrs, name)
+			continue
+		}
+		attrs = append(attrs, name+"="+quote+val+quote)
+	}
+	return attrs
+}
+
+// attribute returns the name of the attribute a of n as it is written in a
+// start tag, and its escaped value and the quote that delimits it. Attributes
+// that are written without a value are returned with ok false.
+func (p *printer) attribute(n *html.Node, a html.Attribute) (name, quote, val string, ok bool) {
+	if a.Val == "" && strings.ContainsRune(a.Key, placeholderStart) {
+		// Template actions in place of attributes, such as
+		// {{ if .X }}disabled{{ end }}, have no value.
+		return a.Key, "", "", false
+	}
+	if a.Val == "" && !p.XHTML && isFrameworkAttribute(p.restoreActions(a.Key)) {
+		// Directives such as v-else and x-cloak are written without one.
+		return p.attributeName(n, a), "", "", false
+	}
+	if p.SortClasses && isClassAttribute(a) {
+		a.Val = sortClasses(a.Val)
+	}
+	if p.NormalizeStyles && isStyleAttribute(a) {
+		a.Val = p.normalizeStyle(a.Val)
+	}
+	if p.FormatSrcdoc && isSrcdocAttribute(n, a) {
+		a.Val = p.srcdoc(a.Val)
+	}
+	if p.Booleans != KeepBooleans && isBooleanAttribute(n, a) {
+		if p.Booleans == MinimalBooleans {
+			return p.attributeName(n, a), "", "", false
+		}
+		a.Val = a.Key
+	}
+	quote, val = p.quoteAttribute(n, a)
+	return p.attributeName(n, a), quote, val, true
+}
+
+// writeAttributes writes the attributes of n to w, each preceded by a space.
+func (p *printer) writeAttributes(w io.Writer, n *html.Node) (err error) {
+	for _, a := range p.startTagAttributes(n) {
+		name, quote, val, ok := p.attribute(n, a)
+		if !ok {
+			_, err = write(w, " ", name)
+		} else {
+			_, err = write(w, " ", name, "=", quote, val, quote)
+		}
+		if err != nil {
+			return
+		}
+	}
+	return
+}
+
+// isClassAttribute reports whether a is a class attribute, whose value is a
+// set of names separated by whitespace.
+func isClassAttribute(a html.Attribute) bool {
+	return a.Namespace == "" && a.Key == "class"
+}
+
+// sortClasses returns the class names in val sorted, without duplicates.
+// Values containing template actions are returned as they are, as the order
+// of the actions matters.
+func sortClasses(val string) string {
+	if strings.ContainsRune(val, placeholderStart) {
+		return val
+	}
+	names := strings.Fields(val)
+	sort.Strings(names)
+	unique := names[:0]
+	for i, name := range names {
+		if i == 0 || name != names[i-1] {
+			unique = append(unique, name)
+		}
+	}
+	return strings.Join(unique, " ")
+}
+
+// listAttributes are the attributes whose values are lists separated by
+// commas, which are wrapped with one item on each line.
+var listAttributes = map[string]func(string) []string{
+	"srcset":      splitSrcset,
+	"imagesrcset": splitSrcset,
+	"sizes":       splitSizes,
+	"imagesizes":  splitSizes,
+}
+
+// wrapAttribute returns the attribute attr, as written by attributes, on
+// lines that fit within the print width where possible when it is indented
+// to level. The values of class attributes are wrapped between class names,
+// those of list attributes such as srcset after each item, and those of
+// style attributes, when NormalizeStyles is set, after each declaration. The
+// lines after the first are indented one level further.
+func (p *printer) wrapAttribute(a html.Attribute, attr string, level int) []string {
+	indent := utf8.RuneCountInString(p.indent())
+	split := listAttributes[a.Key]
+	style := p.NormalizeStyles && isStyleAttribute(a) && !strings.ContainsRune(a.Val, placeholderStart)
+	if !p.WrapAttributeValues || a.Namespace != "" || !isClassAttribute(a) && split == nil && !style ||
+		level*indent+utf8.RuneCountInString(attr) <= p.PrintWidth {
+		return []string{attr}
+	}
+	start := strings.IndexAny(attr, `"'`)
+	if start < 0 || attr[len(attr)-1] != attr[start] {
+		return []string{attr}
+	}
+	prefix, val, quote := attr[:start+1], attr[start+1:len(attr)-1], attr[start:start+1]
+	if style {
+		decls := styleDeclarations(a.Val)
+		if len(decls) < 2 {
+			return []string{attr}
+		}
+		lines := make([]string, len(decls))
+		for i, decl := range decls {
+			lines[i] = p.escapeAttribute(decl, quote[0]) + ";"
+		}
+		lines[0] = prefix + lines[0]
+		if !p.styleSemicolon(a.Val) {
+			lines[len(lines)-1] = strings.TrimSuffix(lines[len(lines)-1], ";")
+		}
+		lines[len(lines)-1] += quote
+		return lines
+	}
+	if split != nil {
+		items := split(val)
+		if len(items) < 2 {
+			return []string{attr}
+		}
+		lines := make([]string, len(items))
+		for i, item := range items {
+			lines[i] = item + ","
+		}
+		lines[0] = prefix + lines[0]
+		lines[len(lines)-1] = items[len(items)-1] + quote
+		return lines
+	}
+	names := strings.Fields(val)
+	if len(names) == 0 {
+		return []string{attr}
+	}
+	lines := []string{prefix + names[0]}
+	width := level*indent + utf8.RuneCountInString(lines[0])
+	for _, name := range names[1:] {
+		if width+1+utf8.RuneCountInString(name) > p.PrintWidth {
+			lines = append(lines, name)
+			width = (level+1)*indent + utf8.RuneCountInString(name)
+			continue
+		}
+		lines[len(lines)-1] += " " + name
+		width += 1 + utf8.RuneCountInString(name)
+	}
+	lines[len(lines)-1] += quote
+	return lines
+}
+
+// splitSrcset returns the image candidates of a srcset value, without the
+// commas between them. URLs may contain commas, so a comma only separates
+// candidates at the end of a URL or after its descriptors.
+// https://html.spec.whatwg.org/multipage/images.html#parse-a-srcset-attribute
+func splitSrcset(val string) (candidates []string) {
+	isSpace := func(c byte) bool {
+		return c == ' ' || c == '\t' || c == '\n' || c == '\f' || c == '\r'
+	}
+	i := 0
+	for {
+		for i < len(val) && (isSpace(val[i]) || val[i] == ',') {
+			i++
+		}
+		if i >= len(val) {
+			return candidates
+		}
+		start := i
+		for i < len(val) && !isSpace(val[i]) {
+			i++
+		}
+		if val[i-1] == ',' {
+			candidates = append(candidates, strings.TrimRight(val[start:i], ","))
+			continue
+		}
+		var depth int
+		for ; i < len(val) && (val[i] != ',' || depth > 0); i++ {
+			switch val[i] {
+			case '(':
+				depth++
+			case ')':
+				depth--
+			}
+		}
+		candidates = append(candidates, strings.TrimRightFunc(val[start:i], unicode.IsSpace))
+	}
+}
+
+// splitSizes returns the source sizes of a sizes value, which are separated
+// by commas outside parentheses.
+func splitSizes(val string) (sizes []string) {
+	var depth, start int
+	for i := 0; i <= len(val); i++ {
+		if i < len(val) {
+			switch val[i] {
+			case '(':
+				depth++
+				continue
+			case ')':
+				depth--
+				continue
+			case ',':
+				if depth > 0 {
+					continue
+				}
+			default:
+				continue
+			}
+		}
+		if size := strings.TrimSpace(val[start:i]); size != "" {
+			sizes = append(sizes, size)
+		}
+		start = i + 1
+	}
+	return sizes
+}
+
+// quoteAttribute returns the escaped value of the attribute a of n, and the
+// quote that delimits it, which is empty if it is written without quotes.
+func (p *printer) quoteAttribute(n *html.Node, a html.Attribute) (quote, val string) {
+	q := byte('"')
+	if a.Namespace == "" && isFrameworkAttribute(p.restoreActions(a.Key)) {
+		return p.quoteExpression(a.Val)
+	}
+	if p.FormatSrcdoc && isSrcdocAttribute(n, a) {
+		// Formatted documents are only escaped where they must be, so that
+		// their markup can be read.
+		return p.quoteExpression(a.Val)
+	}
+	if p.Component != nil && p.Component.UnquotedActions && isAction(a.Val) {
+		return "", p.escapeAttribute(a.Val, 0)
+	}
+	switch p.Quotes {
+	case DoubleQuotes:
+		return `"`, p.escapeAttribute(a.Val, q)
+	case SingleQuotes:
+		q = '\''
+		if strings.ContainsRune(a.Val, '\'') && !strings.ContainsRune(a.Val, '"') {
+			q = '"'
+		}
+	case OriginalQuotes:
+		key := strings.ToLower(attributeName(a))
+		if oq, ok := p.quotes[n][key]; ok {
+			q = oq
+		}
+	case MinimalQuotes:
+		q = 0
+	}
+	if q == 0 {
+		if isUnquotable(a.Val) {
+			return "", p.escapeAttribute(a.Val, 0)
+		}
+		q = '"'
+	}
+	return string(rune(q)), p.escapeAttribute(a.Val, q)
+}
+
+// escapeAttribute returns the attribute value val escaped to be written
+// between the quotes q, or without quotes if q is 0. Only the quote that
+// delimits the value needs to be escaped, but with DoubleQuotes both are, as
+// html.Render does.
+func (p *printer) escapeAttribute(val string, q byte) string {
+	val = p.encodeEntities(attributeEscaper.Replace(val))
+	switch {
+	case q == 0 || p.Quotes == DoubleQuotes:
+		return val
+	case q == '"':
+		return strings.ReplaceAll(val, "&#39;", "'")
+	}
+	return strings.ReplaceAll(val, "&#34;", `"`)
+}
+
+// frameworkPrefixes start the names of the attributes that frameworks such as
+// Vue, Alpine.js, Angular and htmx give meaning to.
+var frameworkPrefixes = []string{"@", ":", "#", "*", "[", "(", ".", "v-", "x-", "ng-", "hx-"}
+
+// isFrameworkAttribute reports whether the attribute called name holds an
+// expression or directive of a framework, such as @click, :class, x-on:click,
+// [value] or Svelte's bind:value, whose value is written with only the
+// escaping that it needs so that it reads as it was written, and whose case
+// is kept.
+func isFrameworkAttribute(name string) bool {
+	for _, prefix := range frameworkPrefixes {
+		if strings.HasPrefix(name, prefix) {
+			return true
+		}
+	}
+	i := strings.IndexByte(name, ':')
+	return i > 0 && !strings.HasPrefix(name, "xml") && !strings.HasPrefix(name, "xlink:")
+}
+
+// quoteExpression returns the value of a framework attribute val escaped
+// only where it must be: ampersands that would start a character reference,
+// and the quote that delimits it, which is chosen to avoid escaping if it can
+// be.
+func (p *printer) quoteExpression(val string) (quote, escaped string) {
+	q := byte('"')
+	switch p.Quotes {
+	case SingleQuotes:
+		q = '\''
+	case MinimalQuotes:
+		if isUnquotable(val) {
+			q = 0
+		}
+	}
+	if p.Component != nil && p.Component.UnquotedActions && isAction(val) {
+		q = 0
+	}
+	other := byte('\'')
+	if q == '\'' {
+		other = '"'
+	}
+	if q != 0 && strings.IndexByte(val, q) >= 0 && strings.IndexByte(val, other) < 0 {
+		q = other
+	}
+	var sb strings.Builder
+	for i := 0; i < len(val); i++ {
+		switch c := val[i]; {
+		case c == '&' && i+1 < len(val) && (isASCIILetter(val[i+1]) || val[i+1] == '#' || '0' <= val[i+1] && val[i+1] <= '9'):
+			sb.WriteString("&amp;")
+		case q != 0 && c == q && c == '"':
+			sb.WriteString("&#34;")
+		case q != 0 && c == q:
+			sb.WriteString("&#39;")
+		default:
+			sb.WriteByte(c)
+		}
+	}
+	if q == 0 {
+		return "", sb.String()
+	}
+	return string(rune(q)), sb.String()
+}
+
+// isUnquotable reports whether the attribute value val can be written without
+// quotes.
+// https://html.spec.whatwg.org/multipage/syntax.html#unquoted
+func isUnquotable(val string) bool {
+	return val != "" && !strings.ContainsAny(val, " \t\n\f\r\"'=<>`")
+}
+
+// attributeQuotes returns the quote character of each attribute in the raw
+// start tag, or 0 for those that are unquoted. Attributes without a value are
+// not included.
+func attributeQuotes(raw []byte) map[string]byte {
+	quotes := make(map[string]byte)
+	scanAttributes(raw, func(name []byte, quote byte, value bool) {
+		key := strings.ToLower(string(name))
+		if _, ok := quotes[key]; !ok && value {
+			quotes[key] = quote
+		}
+	})
+	return quotes
+}
+
+// attributeCases returns the names of the attributes in the raw start tag
+// that have uppercase letters, as they appear in it, by their lowercase
+// names.
+func attributeCases(raw []byte) map[string]string {
+	var names map[string]string
+	scanAttributes(raw, func(name []byte, quote byte, value bool) {
+		key := strings.ToLower(string(name))
+		if _, ok := names[key]; !ok && key != string(name) {
+			if names == nil {
+				names = make(map[string]string)
+			}
+			names[key] = string(name)
+		}
+	})
+	return names
+}
+
+// scanAttributes calls fn with the name of each attribute in the raw start
+// tag, as it appears in it, the quote character of its value, or 0 if it is
+// unquoted, and whether it has a value.
+func scanAttributes(raw []byte, fn func(name []byte, quote byte, value bool)) {
+	isSpace := func(c byte) bool {
+		return c == ' ' || c == '\t' || c == '\n' || c == '\f' || c == '\r'
+	}
+	i := 1
+	for i < len(raw) && !isSpace(raw[i]) && raw[i] != '/' && raw[i] != '>' {
+		i++
+	}
+	for i < len(raw) {
+		for i < len(raw) && (isSpace(raw[i]) || raw[i] == '/') {
+			i++
+		}
+		start := i
+		if i < len(raw) && raw[i] == '=' {
+			// An equals sign at the start of a name is part of it.
+			i++
+		}
+		for i < len(raw) && !isSpace(raw[i]) && raw[i] != '/' && raw[i] != '>' && raw[i] != '=' {
+			i++
+		}
+		if i == start {
+			break
+		}
+		name := raw[start:i]
+		if i >= len(raw) || raw[i] == '>' {
+			fn(name, 0, false)
+			break
+		}
+		for i < len(raw) && isSpace(raw[i]) {
+			i++
+		}
+		if i >= len(raw) || raw[i] != '=' {
+			fn(name, 0, false)
+			continue
+		}
+		i++
+		for i < len(raw) && isSpace(raw[i]) {
+			i++
+		}
+		if i >= len(raw) {
+			break
+		}
+		var quote byte
+		if c := raw[i]; c == '"' || c == '\'' {
+			quote = c
+			end := bytes.IndexByte(raw[i+1:], c)
+			if end < 0 {
+				break
+			}
+			i += end + 2
+		} else {
+			for i < len(raw) && !isSpace(raw[i]) && raw[i] != '>' {
+				i++
+			}
+		}
+		fn(name, quote, true)
+	}
+}
+
+// emptyAttributes are the attributes other than boolean attributes whose
+// empty values are meaningful, and are kept by DropEmptyAttributes.
+var emptyAttributes = map[string]bool{
+	"action": true, "alt": true, "download": true, "href": true,
+	"title": true, "value": true,
+}
+
+// isDroppable reports whether the attribute a of n has an empty value that
+// DropEmptyAttributes removes. Template actions in place of attributes,
+// data attributes and the attributes of foreign elements are kept.
+func isDroppable(n *html.Node, a html.Attribute) bool {
+	return a.Val == "" && n.Namespace == "" && a.Namespace == "" &&
+		!booleanAttributes[a.Key] && !emptyAttributes[a.Key] &&
+		!strings.HasPrefix(a.Key, "data-") && !strings.ContainsRune(a.Key, placeholderStart)
+}
+
+// startTagAttributes returns the attributes of n that are written in its
+// start tag, in the order that they are written.
+func (p *printer) startTagAttributes(n *html.Node) []html.Attribute {
+	attrs := p.dedupeAttributes(p.withNamespaces(n, n.Attr))
+	if p.DropEmptyAttributes {
+		all := attrs
+		attrs = nil
+		for _, a := range all {
+			if !isDroppable(n, a) {
+				attrs = append(attrs, a)
+			}
+		}
+	}
+	return p.orderAttributes(attrs)
+}
+
+// orderAttributes returns attrs in the order configured by SortAttributes and
+// AttributePriority. The input slice is not modified.
+func (f *Formatter) orderAttributes(attrs []html.Attribute) []html.Attribute {
+	if !f.SortAttributes && len(f.AttributePriority) == 0 {
+		return attrs
+	}
+	sorted := make([]html.Attribute, len(attrs))
+	copy(sorted, attrs)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		ri, rj := f.attributeRank(sorted[i].Key), f.attributeRank(sorted[j].Key)
+		if ri != rj {
+			return ri < rj
+		}
+		return f.SortAttributes && sorted[i].Key < sorted[j].Key
+	})
+	return sorted
+}
+
+// attributeRank returns the position in AttributePriority of the first entry
+// matching key.
+func (f *Formatter) attributeRank(key string) int {
+	rest := len(f.AttributePriority)
+	for i, p := range f.AttributePriority {
+		if p == "*" {
+			rest = i
+			continue
+		}
+		if prefix, ok := strings.CutSuffix(p, "*"); ok {
+			if strings.HasPrefix(key, prefix) {
+				return i
+			}
+			continue
+		}
+		if p == key {
+			return i
+		}
+	}
+	return rest
+}
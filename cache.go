@@ -0,0 +1,153 @@
+package htmlformat
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sync"
+)
+
+// Cache stores formatted output by a key that identifies both the input and
+// the settings it was formatted with, so that formatting unchanged input
+// again is a lookup. Its methods may be called concurrently.
+type Cache interface {
+	// Get returns the output stored for key, if there is any.
+	Get(key string) (output []byte, ok bool)
+	// Put stores the output for key.
+	Put(key string, output []byte)
+}
+
+// NewMemoryCache returns a Cache that holds output in memory, for a process
+// that formats the same files repeatedly, such as a watch loop.
+func NewMemoryCache() Cache {
+	return &memoryCache{entries: make(map[string][]byte)}
+}
+
+type memoryCache struct {
+	mu      sync.RWMutex
+	entries map[string][]byte
+}
+
+func (c *memoryCache) Get(key string) ([]byte, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	output, ok := c.entries[key]
+	return output, ok
+}
+
+func (c *memoryCache) Put(key string, output []byte) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries[key] = output
+}
+
+// DirCache is a Cache that stores output in files within a directory, so that
+// it is kept between runs. The directory is created when output is first
+// stored. Errors reading or writing it are treated as cache misses.
+type DirCache string
+
+// Get returns the output stored for key.
+func (dir DirCache) Get(key string) ([]byte, bool) {
+	output, err := os.ReadFile(filepath.Join(string(dir), key))
+	return output, err == nil
+}
+
+// Put stores the output for key, replacing the file that holds it atomically
+// so that concurrent readers see either none or all of it.
+func (dir DirCache) Put(key string, output []byte) {
+	if err := os.MkdirAll(string(dir), 0o755); err != nil {
+		return
+	}
+	tmp, err := os.CreateTemp(string(dir), "."+key+".*.tmp")
+	if err != nil {
+		return
+	}
+	_, err = tmp.Write(output)
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), filepath.Join(string(dir), key))
+	}
+	if err != nil {
+		_ = os.Remove(tmp.Name())
+	}
+}
+
+// cachesOutput reports whether output is looked up in and stored in Cache.
+// The behavior of hooks and embedded formatters cannot be part of the key,
+// so output formatted with them is not cached.
+func (f *Formatter) cachesOutput() bool {
+	return f.Cache != nil && f.OnNode == nil && f.OnProgress == nil && f.CSS == nil && f.JS == nil && f.Sanitizer == nil
+}
+
+// cached writes the output that format writes for the input read from r,
+// looking it up in Cache by a key made from kind, the settings and the input,
+// and storing it there if it is missing.
+func (f *Formatter) cached(w io.Writer, r io.Reader, kind string, format func(w io.Writer, r io.Reader) error) error {
+	w = newOutputWriter(w)
+	if f.MaxBytes > 0 {
+		r = &limitReader{r: r, max: f.MaxBytes}
+	}
+	src, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	key := f.cacheKey(kind, src)
+	if output, ok := f.Cache.Get(key); ok {
+		_, err = w.Write(output)
+		return err
+	}
+	var out bytes.Buffer
+	if err = format(&out, bytes.NewReader(src)); err != nil {
+		return err
+	}
+	f.Cache.Put(key, out.Bytes())
+	_, err = w.Write(out.Bytes())
+	return err
+}
+
+// formatVersion identifies the formatting that this version of the package
+// does, so that output cached by a version that formats differently is not
+// used. It must be incremented whenever a change alters any output.
+const formatVersion = 4
+
+// cacheKey returns the hex encoded SHA-256 hash of formatVersion, kind, the
+// settings of f and src.
+func (f *Formatter) cacheKey(kind string, src []byte) string {
+	h := sha256.New()
+	settings := *f
+	settings.Cache = nil
+	settings.Template, settings.Component = nil, nil
+	fmt.Fprintf(h, "%d\x00%s\x00%#v\x00", formatVersion, kind, settings)
+	writeTemplateSyntax(h, f.Template)
+	if f.Component != nil {
+		fmt.Fprintf(h, "%q %v\x00", f.Component.Markup, f.Component.UnquotedActions)
+		writeTemplateSyntax(h, f.Component.Template)
+	}
+	h.Write(src)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// writeTemplateSyntax writes t to the hash h, without the addresses of its
+// regular expressions.
+func writeTemplateSyntax(h io.Writer, t *TemplateSyntax) {
+	if t == nil {
+		fmt.Fprint(h, "<nil>\x00")
+		return
+	}
+	fmt.Fprintf(h, "%#v", t.Delimiters)
+	for _, re := range []*regexp.Regexp{t.Open, t.Middle, t.Close} {
+		if re != nil {
+			fmt.Fprintf(h, " %q", re.String())
+		} else {
+			fmt.Fprint(h, " <nil>")
+		}
+	}
+	fmt.Fprint(h, "\x00")
+}
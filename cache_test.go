@@ -0,0 +1,70 @@
+package htmlformat
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"golang.org/x/net/html"
+)
+
+// countingCache counts the lookups of a Cache that miss.
+type countingCache struct {
+	Cache
+	misses int
+}
+
+func (c *countingCache) Get(key string) ([]byte, bool) {
+	output, ok := c.Cache.Get(key)
+	if !ok {
+		c.misses++
+	}
+	return output, ok
+}
+
+func TestCache(t *testing.T) {
+	cache := &countingCache{Cache: NewMemoryCache()}
+	format := func(f *Formatter, s string) string {
+		t.Helper()
+		out, err := f.FragmentString(s)
+		if err != nil {
+			t.Fatalf("failed to format: %v", err)
+		}
+		return out
+	}
+	f := &Formatter{Cache: cache}
+	expected := "<ul>\n <li>a</li>\n</ul>\n"
+	for i := 0; i < 2; i++ {
+		if diff := cmp.Diff(expected, format(f, "<ul><li>a</li></ul>")); diff != "" {
+			t.Error(diff)
+		}
+	}
+	if cache.misses != 1 {
+		t.Errorf("expected unchanged input to be formatted once, got %d misses", cache.misses)
+	}
+	minify := &Formatter{Cache: cache, Mode: Minify}
+	if diff := cmp.Diff("<ul><li>a</li></ul>", format(minify, "<ul><li>a</li></ul>")); diff != "" {
+		t.Error(diff)
+	}
+	_ = format(&Formatter{Cache: cache, Template: GoTemplate}, "<ul><li>a</li></ul>")
+	_ = format(f, "<ul><li>b</li></ul>")
+	if cache.misses != 4 {
+		t.Errorf("expected other settings and input to miss, got %d misses", cache.misses)
+	}
+	hooked := &Formatter{Cache: cache, OnNode: func(*html.Node) NodeAction { return KeepNode }}
+	_ = format(hooked, "<ul><li>a</li></ul>")
+	if cache.misses != 4 {
+		t.Errorf("expected output formatted with hooks not to be looked up, got %d misses", cache.misses)
+	}
+}
+
+func TestDirCache(t *testing.T) {
+	cache := DirCache(t.TempDir() + "/cache")
+	if _, ok := cache.Get("a"); ok {
+		t.Error("expected an empty cache to miss")
+	}
+	cache.Put("a", []byte("b"))
+	output, ok := cache.Get("a")
+	if !ok || string(output) != "b" {
+		t.Errorf("expected %q, got %q, %v", "b", output, ok)
+	}
+}
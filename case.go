@@ -0,0 +1,77 @@
+package htmlformat
+
+import (
+	"fmt"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// CaseStyle controls the case that tag and attribute names are written in.
+type CaseStyle int
+
+const (
+	// LowercaseNames writes tag and attribute names in lowercase, as the
+	// parser reads them.
+	LowercaseNames CaseStyle = iota
+	// OriginalCase keeps the case that each tag and attribute name has in
+	// the input. Names of nodes that were not parsed by the Formatter, and
+	// the names written by Stream, are written in lowercase.
+	OriginalCase
+	// UppercaseTags writes the names of HTML elements in uppercase, e.g.
+	// <DIV>, and attribute names and the names of SVG and MathML elements
+	// as the parser reads them.
+	UppercaseTags
+)
+
+var caseStyleNames = []string{
+	LowercaseNames: "lower",
+	OriginalCase:   "preserve",
+	UppercaseTags:  "upper",
+}
+
+// String returns the name of the case style: "lower", "preserve" or "upper".
+func (c CaseStyle) String() string {
+	if c < 0 || int(c) >= len(caseStyleNames) {
+		return fmt.Sprintf("CaseStyle(%d)", int(c))
+	}
+	return caseStyleNames[c]
+}
+
+// Set sets the case style from its name, so that it can be used as a
+// flag.Value.
+func (c *CaseStyle) Set(name string) error {
+	for i, n := range caseStyleNames {
+		if n == name {
+			*c = CaseStyle(i)
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown case style %q", name)
+}
+
+// tagName returns the name of the element n as it is written in its tags.
+func (p *printer) tagName(n *html.Node) string {
+	switch p.Case {
+	case OriginalCase:
+		if name, ok := p.names[n]; ok {
+			return name
+		}
+	case UppercaseTags:
+		if n.Namespace == "" {
+			return strings.ToUpper(n.Data)
+		}
+	}
+	return n.Data
+}
+
+// attributeName returns the name of the attribute a of n as it is written,
+// in the case it has in the input with OriginalCase.
+func (p *printer) attributeName(n *html.Node, a html.Attribute) string {
+	if p.Case == OriginalCase && a.Namespace == "" {
+		if name, ok := p.attrNames[n][strings.ToLower(a.Key)]; ok {
+			return name
+		}
+	}
+	return attributeName(a)
+}
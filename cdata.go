@@ -0,0 +1,113 @@
+package htmlformat
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// extractCDATA replaces each CDATA section in src with a placeholder comment,
+// so that it is written exactly as it appears in the input rather than as a
+// comment, or as text that is escaped. Sections within comments, attribute
+// values and raw text elements such as <script> are part of their content,
+// and are left as they are.
+func (p *printer) extractCDATA(src []byte) []byte {
+	if !bytes.Contains(src, []byte("<![CDATA[")) {
+		return src
+	}
+	var out bytes.Buffer
+	var m offsetMap
+	var last int
+	// foreign counts the open <svg> and <math> elements.
+	var foreign int
+	for i := 0; i < len(src); {
+		j := bytes.IndexByte(src[i:], '<')
+		if j < 0 {
+			break
+		}
+		i += j
+		rest := src[i:]
+		switch {
+		case bytes.HasPrefix(rest, []byte("<![CDATA[")):
+			end := bytes.Index(rest, []byte("]]>"))
+			if end < 0 {
+				end = len(rest)
+			} else {
+				end += len("]]>")
+			}
+			out.Write(src[last:i])
+			start := out.Len()
+			fmt.Fprintf(&out, "<!--%s%d-->", p.verbatimPrefix, len(p.verbatim))
+			p.replaced(&m, start, out.Len(), i, i+end)
+			p.verbatim = append(p.verbatim, string(rest[:end]))
+			i += end
+			last = i
+		case bytes.HasPrefix(rest, []byte("<!--")):
+			end := bytes.Index(rest[4:], []byte("-->"))
+			if end < 0 {
+				i = len(src)
+				break
+			}
+			i += 4 + end + 3
+		case len(rest) > 2 && rest[1] == '/' && isASCIILetter(rest[2]):
+			if name, _ := tagName(rest); (name == "svg" || name == "math") && foreign > 0 {
+				foreign--
+			}
+			i = p.tagEnd(src, i)
+		case len(rest) > 1 && isASCIILetter(rest[1]):
+			// The whole tag is skipped, so that a section in an attribute
+			// value is left as it is.
+			name, _ := tagName(rest)
+			end := p.tagEnd(src, i)
+			if (name == "svg" || name == "math") && src[end-1] == '>' && src[end-2] != '/' {
+				foreign++
+			}
+			i = end
+			// Elements in SVG and MathML content are not raw text.
+			if foreign > 0 || !isRawTextElementName(name) {
+				break
+			}
+			// Skip to the end tag of the raw text element.
+			for {
+				k := bytes.Index(src[end:], []byte("</"))
+				if k < 0 {
+					end = len(src)
+					break
+				}
+				end += k
+				if hasEndTag(src[end:], name) {
+					break
+				}
+				end += 2
+			}
+			i = end
+		default:
+			i++
+		}
+	}
+	out.Write(src[last:])
+	p.offsetMaps = append(p.offsetMaps, m)
+	return out.Bytes()
+}
+
+// wrapCDATA returns the content s of the <script> or <style> element n
+// wrapped in a CDATA section, as XHTML requires, if WrapCDATA is set. The
+// markers are commented out, so that HTML parsers ignore them. Scripts that
+// are not JavaScript, such as JSON data, content that already has a CDATA
+// section and content that ends with the start of an end tag, which the
+// closing marker would complete, are not wrapped.
+func (p *printer) wrapCDATA(n *html.Node, s string) string {
+	if !p.WrapCDATA || strings.Contains(s, "<![CDATA[") || endsWithEndTagOpen(n, s) {
+		return s
+	}
+	switch {
+	case n.DataAtom == atom.Style:
+		return "/*<![CDATA[*/\n" + s + "\n/*]]>*/"
+	case n.DataAtom == atom.Script && isJavaScript(n):
+		return "//<![CDATA[\n" + s + "\n//]]>"
+	}
+	return s
+}
@@ -0,0 +1,136 @@
+package htmlformat
+
+import (
+	"fmt"
+	"io"
+	"mime"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+	"golang.org/x/net/html/charset"
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/transform"
+)
+
+// CharsetStyle controls how the character encoding of the input is
+// determined, and the encoding of the output.
+type CharsetStyle int
+
+const (
+	// AssumeUTF8 reads and writes UTF-8, whatever the input declares.
+	AssumeUTF8 CharsetStyle = iota
+	// OriginalCharset detects the encoding of the input from its byte order
+	// mark, the charset parameter of ContentType or a <meta> declaration, and
+	// writes the output in the same encoding. Characters that the encoding
+	// cannot represent are written as numeric character references.
+	OriginalCharset
+	// TranscodeCharset detects the encoding of the input like
+	// OriginalCharset, and writes the output in UTF-8, changing the charset
+	// of any <meta> declaration to match.
+	TranscodeCharset
+)
+
+var charsetStyleNames = []string{
+	AssumeUTF8:       "utf-8",
+	OriginalCharset:  "preserve",
+	TranscodeCharset: "transcode",
+}
+
+// String returns the name of the charset style: "utf-8", "preserve" or
+// "transcode".
+func (c CharsetStyle) String() string {
+	if c < 0 || int(c) >= len(charsetStyleNames) {
+		return fmt.Sprintf("CharsetStyle(%d)", int(c))
+	}
+	return charsetStyleNames[c]
+}
+
+// Set sets the charset style from its name, so that it can be used as a
+// flag.Value.
+func (c *CharsetStyle) Set(name string) error {
+	for i, n := range charsetStyleNames {
+		if n == name {
+			*c = CharsetStyle(i)
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown charset style %q", name)
+}
+
+// detectEncoding returns the encoding of the input that starts with content,
+// or nil if it is UTF-8. Without a byte order mark or a declaration, input
+// that is valid UTF-8 is taken to be UTF-8 rather than windows-1252, which is
+// what browsers would otherwise assume.
+func (f *Formatter) detectEncoding(content []byte) encoding.Encoding {
+	e, name, certain := charset.DetermineEncoding(content, f.ContentType)
+	if name == "utf-8" || !certain && name == "windows-1252" && utf8.Valid(content) {
+		return nil
+	}
+	return e
+}
+
+// decode returns src decoded from the encoding of the input, and sets the
+// encoding of the output.
+func (p *printer) decode(src []byte) ([]byte, error) {
+	e := p.detectEncoding(src)
+	if e == nil {
+		return src, nil
+	}
+	if p.Charset == OriginalCharset {
+		p.encoding = e
+	}
+	src, _, err := transform.Bytes(e.NewDecoder(), src)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode input: %w", err)
+	}
+	return src, nil
+}
+
+// encoder returns w wrapped to write the output in the encoding of the input,
+// and a function that flushes it.
+func (p *printer) encoder(w io.Writer) (io.Writer, func() error) {
+	if p.encoding == nil {
+		return w, func() error { return nil }
+	}
+	tw := transform.NewWriter(w, p.encoding.NewEncoder())
+	return tw, tw.Close
+}
+
+// setMetaCharset changes the charset declared by the <meta> element n, if
+// any, to UTF-8.
+func setMetaCharset(n *html.Node) {
+	if n.Type != html.ElementNode || n.DataAtom != atom.Meta || n.Namespace != "" {
+		return
+	}
+	var contentType bool
+	for _, a := range n.Attr {
+		if a.Key == "http-equiv" && strings.EqualFold(a.Val, "content-type") {
+			contentType = true
+		}
+	}
+	for i, a := range n.Attr {
+		switch {
+		case a.Key == "charset":
+			n.Attr[i].Val = "utf-8"
+		case a.Key == "content" && contentType:
+			mediaType, params, err := mime.ParseMediaType(a.Val)
+			if err != nil {
+				break
+			}
+			if _, ok := params["charset"]; ok {
+				params["charset"] = "utf-8"
+				n.Attr[i].Val = mime.FormatMediaType(mediaType, params)
+			}
+		}
+	}
+}
+
+// transcodeMetaCharsets calls setMetaCharset on n and its descendants.
+func transcodeMetaCharsets(n *html.Node) {
+	setMetaCharset(n)
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		transcodeMetaCharsets(c)
+	}
+}
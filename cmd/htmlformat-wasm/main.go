@@ -0,0 +1,103 @@
+//go:build js && wasm
+
+// Command htmlformat-wasm exposes the formatter to JavaScript when built for
+// WebAssembly, so that it runs in browsers and Node.js:
+//
+//	GOOS=js GOARCH=wasm go build -o htmlformat.wasm ./cmd/htmlformat-wasm
+//
+// Once the module has been started with Go's wasm_exec.js, the global
+// htmlformat object has formatDocument(src, options) and
+// formatFragment(src, options) functions, which return the formatted string,
+// or an Error if it cannot be formatted. options is optional, and holds
+// .htmlformat.toml settings, such as {print_width: 80, template: "go"}.
+package main
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"strings"
+	"syscall/js"
+
+	"github.com/a-h/htmlformat"
+)
+
+func main() {
+	js.Global().Set("htmlformat", js.ValueOf(map[string]any{
+		"formatDocument": js.FuncOf(func(this js.Value, args []js.Value) any {
+			return format(args, (*htmlformat.Formatter).Document)
+		}),
+		"formatFragment": js.FuncOf(func(this js.Value, args []js.Value) any {
+			return format(args, (*htmlformat.Formatter).Fragment)
+		}),
+	}))
+	// The functions can be called for as long as the program runs.
+	select {}
+}
+
+// format formats the string args[0] with the settings in the object args[1],
+// if there is one, returning the output or a JavaScript Error.
+func format(args []js.Value, fn func(f *htmlformat.Formatter, w io.Writer, r io.Reader) error) any {
+	if len(args) == 0 || args[0].Type() != js.TypeString {
+		return jsError(fmt.Errorf("expected the HTML to format as a string"))
+	}
+	f := new(htmlformat.Formatter)
+	if len(args) > 1 && args[1].Type() == js.TypeObject {
+		if err := setOptions(f, args[1]); err != nil {
+			return jsError(err)
+		}
+	}
+	var sb strings.Builder
+	if err := fn(f, &sb, strings.NewReader(args[0].String())); err != nil {
+		return jsError(err)
+	}
+	return sb.String()
+}
+
+// setOptions applies the settings held by the properties of options to f.
+func setOptions(f *htmlformat.Formatter, options js.Value) error {
+	keys := js.Global().Get("Object").Call("keys", options)
+	for i := 0; i < keys.Length(); i++ {
+		key := keys.Index(i).String()
+		v, err := optionValue(options.Get(key))
+		if err != nil {
+			return fmt.Errorf("%s: %w", key, err)
+		}
+		if err = f.SetOption(key, v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// optionValue converts a JavaScript value to the Go value of a setting.
+func optionValue(v js.Value) (any, error) {
+	switch v.Type() {
+	case js.TypeBoolean:
+		return v.Bool(), nil
+	case js.TypeString:
+		return v.String(), nil
+	case js.TypeNumber:
+		n := v.Float()
+		if n != math.Trunc(n) {
+			return nil, fmt.Errorf("expected an integer, got %v", n)
+		}
+		return int(n), nil
+	case js.TypeObject:
+		if js.Global().Get("Array").Call("isArray", v).Bool() {
+			ss := make([]string, v.Length())
+			for i := range ss {
+				if v.Index(i).Type() != js.TypeString {
+					return nil, fmt.Errorf("expected an array of strings")
+				}
+				ss[i] = v.Index(i).String()
+			}
+			return ss, nil
+		}
+	}
+	return nil, fmt.Errorf("unexpected %s value", v.Type())
+}
+
+func jsError(err error) js.Value {
+	return js.Global().Get("Error").New(err.Error())
+}
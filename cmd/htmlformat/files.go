@@ -0,0 +1,133 @@
+package main
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// expandPaths resolves the command line arguments to the list of files to
+// format. Arguments may be files, directories, which are walked recursively
+// for files with one of the given extensions, or glob patterns matching
+// either.
+func expandPaths(args []string, exts []string) (paths []string, err error) {
+	for _, arg := range args {
+		matches := []string{arg}
+		if arg != "-" && hasGlobMeta(arg) {
+			if matches, err = filepath.Glob(arg); err != nil {
+				return nil, err
+			}
+		}
+		for _, m := range matches {
+			if m == "-" {
+				paths = append(paths, m)
+				continue
+			}
+			fi, err := os.Stat(m)
+			if err != nil {
+				return nil, err
+			}
+			if !fi.IsDir() {
+				paths = append(paths, m)
+				continue
+			}
+			err = filepath.WalkDir(m, func(path string, d fs.DirEntry, err error) error {
+				if err != nil {
+					return err
+				}
+				if !d.IsDir() && hasExtension(path, exts) {
+					paths = append(paths, path)
+				}
+				return nil
+			})
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+	return paths, nil
+}
+
+func hasGlobMeta(path string) bool {
+	return strings.ContainsAny(path, `*?[`)
+}
+
+func hasExtension(path string, exts []string) bool {
+	ext := filepath.Ext(path)
+	for _, e := range exts {
+		if strings.EqualFold(ext, e) {
+			return true
+		}
+	}
+	return false
+}
+
+// xmlExtensions holds the extensions of the files that are formatted as XML.
+var xmlExtensions = []string{".xml", ".svg", ".xsl", ".xslt"}
+
+// isXML reports whether the file at path, or stdin if path is "-", is
+// formatted as XML.
+func isXML(path string) bool {
+	return *xmlFlag || hasExtension(displayName(path), xmlExtensions)
+}
+
+// isGoSource reports whether the file at path, or stdin if path is "-", is Go
+// source, whose HTML string literals are formatted.
+func isGoSource(path string) bool {
+	return hasExtension(displayName(path), []string{".go"})
+}
+
+// isMarkdown reports whether the file at path, or stdin if path is "-", is
+// Markdown, whose HTML blocks are formatted.
+func isMarkdown(path string) bool {
+	return hasExtension(displayName(path), []string{".md", ".markdown"})
+}
+
+// parseExtensions splits a comma separated list of extensions, adding the
+// leading dot where it has been left off.
+func parseExtensions(s string) (exts []string) {
+	for _, e := range strings.Split(s, ",") {
+		e = strings.TrimSpace(e)
+		if e == "" {
+			continue
+		}
+		if !strings.HasPrefix(e, ".") {
+			e = "." + e
+		}
+		exts = append(exts, e)
+	}
+	return exts
+}
+
+// writeFileAtomic replaces the contents of path with data by writing to a
+// temporary file in the same directory and renaming it over the original, so
+// that readers never observe a partially written file. The permissions of the
+// original file are preserved.
+func writeFileAtomic(path string, data []byte) (err error) {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			os.Remove(tmp.Name())
+		}
+	}()
+	if _, err = tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err = tmp.Chmod(fi.Mode().Perm()); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err = tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestWriteFileAtomic(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "a.html")
+	if err := os.WriteFile(path, []byte("<p>old</p>"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := writeFileAtomic(path, []byte("<p>new</p>\n")); err != nil {
+		t.Fatalf("failed to write: %v", err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "<p>new</p>\n" {
+		t.Errorf("expected the file to be replaced, got %q", data)
+	}
+	fi, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fi.Mode().Perm() != 0o600 {
+		t.Errorf("expected mode %v to be kept, got %v", os.FileMode(0o600), fi.Mode().Perm())
+	}
+	expectFiles(t, dir, "a.html")
+}
+
+func TestWriteFileAtomicError(t *testing.T) {
+	dir := t.TempDir()
+	// A file cannot be renamed over a directory that is not empty.
+	path := filepath.Join(dir, "a.html")
+	if err := os.MkdirAll(filepath.Join(path, "b"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := writeFileAtomic(path, []byte("<p>new</p>\n")); err == nil {
+		t.Fatal("expected an error")
+	}
+	expectFiles(t, dir, "a.html")
+
+	if err := writeFileAtomic(filepath.Join(dir, "missing.html"), nil); err == nil {
+		t.Fatal("expected an error for a file that does not exist")
+	}
+	expectFiles(t, dir, "a.html")
+}
+
+// expectFiles reports an error unless the files in dir, which include any
+// temporary files left behind, are those named.
+func expectFiles(t *testing.T, dir string, names ...string) {
+	t.Helper()
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, e := range entries {
+		got = append(got, e.Name())
+	}
+	if len(got) != len(names) {
+		t.Fatalf("expected the files %q, got %q", names, got)
+	}
+	for i := range names {
+		if got[i] != names[i] {
+			t.Errorf("expected the files %q, got %q", names, got)
+		}
+	}
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// changedPaths returns the files with one of the given extensions that have
+// been added, copied, modified or renamed in git: those that are staged for
+// commit if staged is true, or otherwise those that differ in the working
+// tree from the commit since. Deleted files are left out. The paths are
+// relative to the current directory, and are limited to those within it and
+// to the pathspecs in args, if any.
+func changedPaths(args []string, exts []string, staged bool, since string) (paths []string, err error) {
+	gitArgs := []string{"diff", "--name-only", "-z", "--relative", "--diff-filter=ACMR"}
+	if staged {
+		gitArgs = append(gitArgs, "--cached")
+	} else {
+		gitArgs = append(gitArgs, since)
+	}
+	gitArgs = append(gitArgs, "--")
+	gitArgs = append(gitArgs, args...)
+	cmd := exec.Command("git", gitArgs...)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		var ee *exec.ExitError
+		if errors.As(err, &ee) {
+			return nil, fmt.Errorf("git diff failed: %s", strings.TrimSpace(stderr.String()))
+		}
+		return nil, err
+	}
+	for _, path := range strings.Split(string(out), "\x00") {
+		if path != "" && hasExtension(path, exts) {
+			paths = append(paths, path)
+		}
+	}
+	return paths, nil
+}
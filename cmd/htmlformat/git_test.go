@@ -0,0 +1,96 @@
+package main
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestChangedPaths(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+	dir := t.TempDir()
+	git := func(args ...string) {
+		t.Helper()
+		cmd := exec.Command("git", append([]string{"-c", "user.name=test", "-c", "user.email=test@example.com"}, args...)...)
+		cmd.Dir = dir
+		cmd.Env = append(os.Environ(), "GIT_CONFIG_GLOBAL="+os.DevNull, "GIT_CONFIG_NOSYSTEM=1")
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("git %v failed: %v\n%s", args, err, out)
+		}
+	}
+	write := func(name, content string) {
+		t.Helper()
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	git("init", "-q")
+	write("sub/modified.html", "<p>a</p>\n")
+	write("sub/deleted.html", "<p>b</p>\n")
+	write("sub/old.html", "<p>renamed</p>\n")
+	write("sub/notes.txt", "a\n")
+	write("outside.html", "<p>c</p>\n")
+	git("add", "-A")
+	git("commit", "-q", "-m", "first")
+
+	write("sub/modified.html", "<p>changed</p>\n")
+	write("sub/added.html", "<p>d</p>\n")
+	write("sub/notes.txt", "b\n")
+	write("outside.html", "<p>changed</p>\n")
+	git("mv", "sub/old.html", "sub/new.html")
+	git("rm", "-q", "sub/deleted.html")
+	git("add", "-A")
+
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = os.Chdir(filepath.Join(dir, "sub")); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if err := os.Chdir(wd); err != nil {
+			t.Error(err)
+		}
+	})
+	exts := []string{".html"}
+	expected := []string{"added.html", "modified.html", "new.html"}
+
+	paths, err := changedPaths(nil, exts, true, "")
+	if err != nil {
+		t.Fatalf("failed to list staged files: %v", err)
+	}
+	if diff := cmp.Diff(expected, paths); diff != "" {
+		t.Errorf("staged files: %s", diff)
+	}
+
+	git("commit", "-q", "-m", "second")
+	paths, err = changedPaths(nil, exts, false, "HEAD~1")
+	if err != nil {
+		t.Fatalf("failed to list changed files: %v", err)
+	}
+	if diff := cmp.Diff(expected, paths); diff != "" {
+		t.Errorf("files changed since HEAD~1: %s", diff)
+	}
+
+	paths, err = changedPaths([]string{"new.html"}, exts, false, "HEAD~1")
+	if err != nil {
+		t.Fatalf("failed to list changed files: %v", err)
+	}
+	if diff := cmp.Diff([]string{"new.html"}, paths); diff != "" {
+		t.Errorf("files changed since HEAD~1 within a pathspec: %s", diff)
+	}
+
+	if _, err = changedPaths(nil, exts, false, "missing"); err == nil {
+		t.Error("expected an error for a commit that does not exist")
+	}
+}
@@ -0,0 +1,291 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/textproto"
+	"net/url"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// JSON-RPC error codes.
+const (
+	parseError     = -32700
+	invalidRequest = -32600
+	methodNotFound = -32601
+	invalidParams  = -32602
+	requestFailed  = -32803
+)
+
+// lspMessage is a JSON-RPC request or notification from the editor.
+type lspMessage struct {
+	ID     json.RawMessage `json:"id,omitempty"`
+	Method string          `json:"method"`
+	Params json.RawMessage `json:"params,omitempty"`
+}
+
+// lspResponse is the response to a request. Result is omitted if there is an
+// error, and null rather than omitted otherwise.
+type lspResponse struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id"`
+	Result  json.RawMessage `json:"result,omitempty"`
+	Error   *lspError       `json:"error,omitempty"`
+}
+
+type lspError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+type lspPosition struct {
+	Line      int `json:"line"`
+	Character int `json:"character"`
+}
+
+type lspTextEdit struct {
+	Range struct {
+		Start lspPosition `json:"start"`
+		End   lspPosition `json:"end"`
+	} `json:"range"`
+	NewText string `json:"newText"`
+}
+
+type lspTextDocument struct {
+	URI  string `json:"uri"`
+	Text string `json:"text"`
+}
+
+// lspServer formats the documents that an editor has open, as a Language
+// Server Protocol server.
+type lspServer struct {
+	r *bufio.Reader
+	w io.Writer
+	// documents holds the text of the open documents by URI.
+	documents map[string]string
+	shutdown  bool
+}
+
+// serveLSP serves the Language Server Protocol on r and w until the editor
+// sends the exit notification. Documents are kept in sync in full, and
+// formatted with the configuration that applies to their paths.
+func serveLSP(r io.Reader, w io.Writer) error {
+	s := &lspServer{r: bufio.NewReader(r), w: w, documents: map[string]string{}}
+	for {
+		m, err := s.read()
+		var se *json.SyntaxError
+		var te *json.UnmarshalTypeError
+		switch {
+		case errors.As(err, &se), errors.As(err, &te):
+			// The ID of a message that cannot be read is not known, and
+			// is null in the response.
+			code := parseError
+			if te != nil {
+				code = invalidRequest
+			}
+			if err = s.write(lspResponse{JSONRPC: "2.0", Error: &lspError{Code: code, Message: err.Error()}}); err != nil {
+				return err
+			}
+			continue
+		case err != nil:
+			return err
+		}
+		if m.Method == "exit" {
+			if !s.shutdown {
+				return errors.New("exit before shutdown")
+			}
+			return nil
+		}
+		result, rerr := s.handle(m)
+		if m.ID == nil {
+			// Notifications have no response.
+			continue
+		}
+		resp := lspResponse{JSONRPC: "2.0", ID: m.ID, Error: rerr}
+		if rerr == nil {
+			if resp.Result, err = json.Marshal(result); err != nil {
+				return err
+			}
+		}
+		if err = s.write(resp); err != nil {
+			return err
+		}
+	}
+}
+
+func (s *lspServer) handle(m lspMessage) (result any, err *lspError) {
+	switch m.Method {
+	case "initialize":
+		return map[string]any{
+			"capabilities": map[string]any{
+				// Documents are sent in full when they change.
+				"textDocumentSync":           1,
+				"documentFormattingProvider": true,
+			},
+			"serverInfo": map[string]string{"name": "htmlformat"},
+		}, nil
+	case "shutdown":
+		s.shutdown = true
+		return nil, nil
+	case "textDocument/didOpen":
+		var params struct {
+			TextDocument lspTextDocument `json:"textDocument"`
+		}
+		if err := json.Unmarshal(m.Params, &params); err != nil {
+			return nil, &lspError{Code: invalidParams, Message: err.Error()}
+		}
+		s.documents[params.TextDocument.URI] = params.TextDocument.Text
+	case "textDocument/didChange":
+		var params struct {
+			TextDocument   lspTextDocument `json:"textDocument"`
+			ContentChanges []struct {
+				Text string `json:"text"`
+			} `json:"contentChanges"`
+		}
+		if err := json.Unmarshal(m.Params, &params); err != nil {
+			return nil, &lspError{Code: invalidParams, Message: err.Error()}
+		}
+		if n := len(params.ContentChanges); n > 0 {
+			s.documents[params.TextDocument.URI] = params.ContentChanges[n-1].Text
+		}
+	case "textDocument/didClose":
+		var params struct {
+			TextDocument lspTextDocument `json:"textDocument"`
+		}
+		if err := json.Unmarshal(m.Params, &params); err != nil {
+			return nil, &lspError{Code: invalidParams, Message: err.Error()}
+		}
+		delete(s.documents, params.TextDocument.URI)
+	case "textDocument/formatting":
+		return s.format(m.Params)
+	default:
+		if m.ID != nil && !strings.HasPrefix(m.Method, "$/") {
+			return nil, &lspError{Code: methodNotFound, Message: "method not found: " + m.Method}
+		}
+	}
+	return nil, nil
+}
+
+// format returns the edit that formats a document, or none if it is already
+// formatted.
+func (s *lspServer) format(raw json.RawMessage) (edits []lspTextEdit, lerr *lspError) {
+	var params struct {
+		TextDocument lspTextDocument `json:"textDocument"`
+		Options      struct {
+			TabSize      int  `json:"tabSize"`
+			InsertSpaces bool `json:"insertSpaces"`
+		} `json:"options"`
+	}
+	if err := json.Unmarshal(raw, &params); err != nil {
+		return nil, &lspError{Code: invalidParams, Message: err.Error()}
+	}
+	src, ok := s.documents[params.TextDocument.URI]
+	if !ok {
+		return nil, &lspError{Code: invalidParams, Message: "unknown document: " + params.TextDocument.URI}
+	}
+	path := documentPath(params.TextDocument.URI)
+	f, err := newFormatter(path)
+	if err != nil {
+		return nil, &lspError{Code: requestFailed, Message: fmt.Sprintf("failed to load configuration: %v", err)}
+	}
+	if f.Indent == "" {
+		// The editor's settings apply when the project does not set an
+		// indent of its own.
+		switch {
+		case !params.Options.InsertSpaces:
+			f.Indent = "\t"
+		case params.Options.TabSize > 0:
+			f.Indent = strings.Repeat(" ", params.Options.TabSize)
+		}
+	}
+	var out bytes.Buffer
+	if err = format(f, &out, strings.NewReader(src), path); err != nil {
+		return nil, &lspError{Code: requestFailed, Message: err.Error()}
+	}
+	if out.String() == src {
+		return []lspTextEdit{}, nil
+	}
+	var edit lspTextEdit
+	edit.Range.End = endPosition(src)
+	edit.NewText = out.String()
+	return []lspTextEdit{edit}, nil
+}
+
+// documentPath returns the path of the file that a document URI refers to,
+// or "-" for documents that are not files, whose configuration is that of
+// the current directory.
+func documentPath(uri string) string {
+	u, err := url.Parse(uri)
+	if err != nil || u.Scheme != "file" {
+		return "-"
+	}
+	path := u.Path
+	if runtime.GOOS == "windows" && len(path) >= 3 && path[0] == '/' && isDriveLetter(path[1]) && path[2] == ':' {
+		// file:///C:/x.html has the path /C:/x.html.
+		path = path[1:]
+	}
+	return filepath.FromSlash(path)
+}
+
+func isDriveLetter(c byte) bool {
+	return 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z'
+}
+
+// endPosition returns the position of the end of text, with characters
+// counted in UTF-16 code units as the protocol requires.
+func endPosition(text string) (pos lspPosition) {
+	for i := 0; i < len(text); {
+		switch {
+		case strings.HasPrefix(text[i:], "\r\n"):
+			pos.Line, pos.Character = pos.Line+1, 0
+			i += 2
+		case text[i] == '\n' || text[i] == '\r':
+			pos.Line, pos.Character = pos.Line+1, 0
+			i++
+		default:
+			r, size := utf8.DecodeRuneInString(text[i:])
+			pos.Character += len(utf16.Encode([]rune{r}))
+			i += size
+		}
+	}
+	return pos
+}
+
+// read reads a message, which is preceded by a Content-Length header.
+func (s *lspServer) read() (m lspMessage, err error) {
+	header, err := textproto.NewReader(s.r).ReadMIMEHeader()
+	if err != nil {
+		return m, err
+	}
+	length, err := strconv.Atoi(header.Get("Content-Length"))
+	if err != nil {
+		return m, fmt.Errorf("invalid Content-Length: %w", err)
+	}
+	body := make([]byte, length)
+	if _, err = io.ReadFull(s.r, body); err != nil {
+		return m, err
+	}
+	err = json.Unmarshal(body, &m)
+	return m, err
+}
+
+func (s *lspServer) write(resp lspResponse) error {
+	body, err := json.Marshal(resp)
+	if err != nil {
+		return err
+	}
+	if _, err = fmt.Fprintf(s.w, "Content-Length: %d\r\n\r\n", len(body)); err != nil {
+		return err
+	}
+	_, err = s.w.Write(body)
+	return err
+}
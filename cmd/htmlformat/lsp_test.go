@@ -0,0 +1,197 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/textproto"
+	"net/url"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+// lspClient sends messages to a server and reads its responses.
+type lspClient struct {
+	t  *testing.T
+	w  io.Writer
+	r  *bufio.Reader
+	id int
+}
+
+func (c *lspClient) send(id any, method string, params any) {
+	c.t.Helper()
+	m := map[string]any{"jsonrpc": "2.0", "method": method, "params": params}
+	if id != nil {
+		m["id"] = id
+	}
+	body, err := json.Marshal(m)
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	c.write(body)
+}
+
+// write sends body as it is, whether or not it is valid JSON.
+func (c *lspClient) write(body []byte) {
+	c.t.Helper()
+	if _, err := fmt.Fprintf(c.w, "Content-Length: %d\r\n\r\n%s", len(body), body); err != nil {
+		c.t.Fatal(err)
+	}
+}
+
+// notify sends a notification, which has no response.
+func (c *lspClient) notify(method string, params any) {
+	c.t.Helper()
+	c.send(nil, method, params)
+}
+
+type lspTestResponse struct {
+	ID     *int            `json:"id"`
+	Result json.RawMessage `json:"result"`
+	Error  *lspError       `json:"error"`
+}
+
+// call sends a request and returns its response.
+func (c *lspClient) call(method string, params any) lspTestResponse {
+	c.t.Helper()
+	c.id++
+	c.send(c.id, method, params)
+	resp := c.receive()
+	if resp.ID == nil || *resp.ID != c.id {
+		c.t.Errorf("expected the response to request %d, got %v", c.id, resp.ID)
+	}
+	return resp
+}
+
+// receive reads a response.
+func (c *lspClient) receive() (resp lspTestResponse) {
+	c.t.Helper()
+	header, err := textproto.NewReader(c.r).ReadMIMEHeader()
+	if err != nil {
+		c.t.Fatalf("failed to read a response: %v", err)
+	}
+	length, err := strconv.Atoi(header.Get("Content-Length"))
+	if err != nil {
+		c.t.Fatalf("invalid Content-Length: %v", err)
+	}
+	body := make([]byte, length)
+	if _, err = io.ReadFull(c.r, body); err != nil {
+		c.t.Fatal(err)
+	}
+	if err = json.Unmarshal(body, &resp); err != nil {
+		c.t.Fatal(err)
+	}
+	return resp
+}
+
+func TestServeLSP(t *testing.T) {
+	dir := t.TempDir()
+	uri := func(name string) string {
+		return (&url.URL{Scheme: "file", Path: filepath.ToSlash(filepath.Join(dir, name))}).String()
+	}
+	inr, inw := io.Pipe()
+	outr, outw := io.Pipe()
+	done := make(chan error, 1)
+	go func() {
+		done <- serveLSP(inr, outw)
+		outw.Close()
+	}()
+	c := &lspClient{t: t, w: inw, r: bufio.NewReader(outr)}
+
+	resp := c.call("initialize", map[string]any{"capabilities": map[string]any{}})
+	if resp.Error != nil {
+		t.Fatalf("failed to initialize: %v", resp.Error.Message)
+	}
+	var initialized struct {
+		Capabilities struct {
+			DocumentFormattingProvider bool `json:"documentFormattingProvider"`
+		} `json:"capabilities"`
+	}
+	if err := json.Unmarshal(resp.Result, &initialized); err != nil {
+		t.Fatal(err)
+	}
+	if !initialized.Capabilities.DocumentFormattingProvider {
+		t.Error("expected the server to provide formatting")
+	}
+	c.notify("initialized", map[string]any{})
+
+	// Messages that are not valid JSON are answered with an error, and the
+	// server carries on.
+	c.write([]byte(`{"jsonrpc": "2.0", "id": 9, "method": `))
+	resp = c.receive()
+	if resp.Error == nil || resp.Error.Code != parseError {
+		t.Errorf("expected a parse error, got %+v", resp.Error)
+	}
+	if resp.ID != nil {
+		t.Errorf("expected a null ID, got %d", *resp.ID)
+	}
+	c.write([]byte(`{"jsonrpc": "2.0", "id": 9, "method": 1}`))
+	if resp = c.receive(); resp.Error == nil || resp.Error.Code != invalidRequest {
+		t.Errorf("expected an invalid request error, got %+v", resp.Error)
+	}
+
+	c.notify("textDocument/didOpen", map[string]any{"textDocument": map[string]any{
+		"uri": uri("a.html"), "languageId": "html", "version": 1, "text": "<div><p>a</p>\n</div>",
+	}})
+	options := map[string]any{"tabSize": 2, "insertSpaces": true}
+	resp = c.call("textDocument/formatting", map[string]any{
+		"textDocument": map[string]any{"uri": uri("a.html")}, "options": options,
+	})
+	if resp.Error != nil {
+		t.Fatalf("failed to format: %v", resp.Error.Message)
+	}
+	var edits []lspTextEdit
+	if err := json.Unmarshal(resp.Result, &edits); err != nil {
+		t.Fatal(err)
+	}
+	var edit lspTextEdit
+	edit.Range.End = lspPosition{Line: 1, Character: 6}
+	edit.NewText = "<div>\n  <p>a</p>\n</div>\n"
+	if diff := cmp.Diff([]lspTextEdit{edit}, edits); diff != "" {
+		t.Error(diff)
+	}
+
+	// A document that is already formatted needs no edits.
+	c.notify("textDocument/didChange", map[string]any{
+		"textDocument":   map[string]any{"uri": uri("a.html"), "version": 2},
+		"contentChanges": []map[string]any{{"text": edit.NewText}},
+	})
+	resp = c.call("textDocument/formatting", map[string]any{
+		"textDocument": map[string]any{"uri": uri("a.html")}, "options": options,
+	})
+	if resp.Error != nil {
+		t.Fatalf("failed to format: %v", resp.Error.Message)
+	}
+	if string(resp.Result) != "[]" {
+		t.Errorf("expected no edits, got %s", resp.Result)
+	}
+
+	// Input that does not parse is reported as an error.
+	c.notify("textDocument/didOpen", map[string]any{"textDocument": map[string]any{
+		"uri": uri("a.xml"), "languageId": "xml", "version": 1, "text": "<a><b></a>",
+	}})
+	resp = c.call("textDocument/formatting", map[string]any{
+		"textDocument": map[string]any{"uri": uri("a.xml")}, "options": options,
+	})
+	if resp.Error == nil {
+		t.Fatalf("expected an error, got %s", resp.Result)
+	}
+	if resp.Error.Code != requestFailed {
+		t.Errorf("expected error code %d, got %d: %s", requestFailed, resp.Error.Code, resp.Error.Message)
+	}
+	if resp.Result != nil {
+		t.Errorf("expected no result with an error, got %s", resp.Result)
+	}
+
+	if resp = c.call("shutdown", nil); resp.Error != nil {
+		t.Fatalf("failed to shut down: %v", resp.Error.Message)
+	}
+	c.notify("exit", nil)
+	if err := <-done; err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
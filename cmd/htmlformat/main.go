@@ -1,25 +1,593 @@
 package main
 
 import (
+	"bytes"
+	"errors"
 	"flag"
+	"fmt"
+	"io"
 	"log"
 	"os"
+	"runtime"
+	"strconv"
+	"strings"
 
 	"github.com/a-h/htmlformat"
+	"github.com/a-h/htmlformat/internal/diff"
 )
 
 var parseDocumentFlag = flag.Bool("document", false, "Set to true to parse a whole document")
+var contextFlag = flag.String("context", "", "Parse fragments as the content of this element, such as tbody for table rows")
+var minifyFlag = flag.Bool("minify", false, "Set to true to minify instead of pretty-printing")
+var newlineFlag = flag.String("newline", "", "End lines with lf, crlf or cr, or with the newline that the input uses if auto")
+var normalizeNewlinesFlag = flag.Bool("normalize-newlines", false, "Also end the lines of <pre> content and other content written as it is with -newline")
+var widthFlag = flag.Int("width", 0, "Keep lines within this many characters where possible, writing short elements on one line and long start tags one attribute per line, or 0 for no limit")
+var blankLinesFlag = flag.Int("blank-lines", 0, "Keep up to this many consecutive blank lines between sibling elements")
+var flatDocumentFlag = flag.Bool("flat-document", false, "Do not indent the children of <html>, <head> and <body>")
+var wrapCommentsFlag = flag.Bool("wrap-comments", false, "Wrap comment lines that are longer than -width")
+var wrapTextFlag = flag.Bool("wrap-text", false, "Wrap text that is longer than -width at spaces")
+var sortAttributesFlag = flag.Bool("sort-attributes", false, "Write attributes in alphabetical order")
+var dropEmptyFlag = flag.Bool("drop-empty", false, "Remove attributes with empty values, such as class=\"\", apart from those where an empty value is meaningful, such as alt=\"\"")
+var bracketSameLineFlag = flag.Bool("bracket-same-line", false, "Write the > of start tags whose attributes are on lines of their own at the end of the last attribute")
+var sortClassesFlag = flag.Bool("sort-classes", false, "Write the names in class attributes in alphabetical order, without duplicates")
+var normalizeStylesFlag = flag.Bool("normalize-styles", false, "Write the declarations of style attributes as \"property: value\", separated by \"; \"")
+var wrapAttributesFlag = flag.Bool("wrap-attributes", false, "Wrap class, srcset and sizes attribute values that are longer than -width across several lines")
+var srcdocFlag = flag.Bool("srcdoc", false, "Format the documents in the srcdoc attributes of <iframe> elements")
+var selfCloseFlag = flag.Bool("self-close", false, "Write void elements in the XHTML style, e.g. <br />")
+var omitEndTagsFlag = flag.Bool("omit-end-tags", false, "Omit the end tags that HTML allows to be left out, such as </li> and </p>")
+var xmlFlag = flag.Bool("xml", false, "Format the input as a generic XML document, as files ending in .xml, .svg, .xsl and .xslt are")
+var xhtmlFlag = flag.Bool("xhtml", false, "Write well-formed XHTML that HTML parsers read the same way, for XML toolchains and EPUB")
+var emailFlag = flag.Bool("email", false, "Format HTML email: keep the whitespace in tables, write non-breaking spaces as &nbsp; and never self-close elements")
+var omitImpliedFlag = flag.Bool("omit-implied", false, "Omit the <html>, <head>, <body> and <tbody> elements that the parser adds where the input has none")
+var streamFlag = flag.Bool("stream", false, "Format large inputs with bounded memory, approximating some layout decisions")
+var inlineFlag = flag.Bool("inline", false, "Keep phrasing elements such as <a>, <em> and <code> within the text around them")
+var singleLineFlag = flag.Bool("single-line", false, "Write elements such as <title>, <option> and <button> on one line when they hold only text and phrasing elements")
+var entitiesFlag = flag.Bool("entities", false, "Write characters that have a named character reference, such as the non-breaking space, as that reference, e.g. &nbsp;")
+var stripCommentsFlag = flag.Bool("strip-comments", false, "Leave out comments, apart from conditional comments and those that start with one of -keep-comments")
+var preserveFlag = flag.String("preserve", "", "CSS selectors, such as 'pre.highlight, .raw', of elements to write as they are rather than formatting them")
+var keepCommentsFlag = flag.String("keep-comments", "", "Comma separated list of prefixes of the comments that -strip-comments keeps, such as ! for license banners")
+var printDepthFlag = flag.Int("print-depth", 0, "Write elements only this deep, replacing the content of deeper ones with a comment that says how much was left out, or 0 for no limit")
+var sanitizeFlag = flag.Bool("sanitize", false, "Remove markup that is unsafe in user generated content, such as scripts, event handler attributes and javascript: URLs")
+var cdataFlag = flag.Bool("cdata", false, "Wrap the content of <script> and <style> elements in CDATA sections for XHTML")
+var formatJSONFlag = flag.Bool("format-json", false, "Pretty-print the JSON in <script> elements such as JSON-LD and import maps")
+var keepInvalidJSONFlag = flag.Bool("keep-invalid-json", false, "Leave JSON that -format-json cannot parse as it is, rather than failing")
+var minifiedLineLengthFlag = flag.Int("minified-line-length", 0, "Write <script> and <style> content with lines longer than this as it is")
+var maxBytesFlag = flag.Int("max-bytes", 0, "Refuse to format inputs larger than this many bytes, or 0 for no limit")
+var maxDepthFlag = flag.Int("max-depth", 0, "Refuse to format inputs with elements nested more than this deep, or 0 for no limit")
+var maxNodesFlag = flag.Int("max-nodes", 0, "Refuse to format inputs with more than this many elements, text and comments, or 0 for no limit")
+var verifyFlag = flag.Bool("verify", false, "Parse the output again, and report an error instead of writing it if formatting changed the content")
+var strictFlag = flag.Bool("strict", false, "Report markup that the parser would have to repair, such as missing end tags, instead of formatting it")
+var templateFlag = flag.String("template", "", "Preserve the actions of a template language in the input: go, jinja, liquid, erb, handlebars, vue or svelte")
+var writeFlag = flag.Bool("w", false, "Write the result to the source file instead of stdout")
+var listFlag = flag.Bool("l", false, "List files whose formatting differs, and exit with a non-zero status if there are any")
+var diffFlag = flag.Bool("d", false, "Print a unified diff of the formatting changes instead of the formatted output")
+var componentFlag = flag.String("component", "", "Format the input as a single-file component, vue or svelte, leaving its script and style blocks as they are")
+var stdinFilepathFlag = flag.String("stdin-filepath", "", "The path of the file that stdin holds, which selects the configuration and template syntax that apply to it and names it in messages")
+var watchFlag = flag.Bool("watch", false, "Format the files in the paths given in place whenever they change, until stopped")
+var stagedFlag = flag.Bool("staged", false, "Format only the files that are staged for commit in git, within the paths given if any")
+var sinceFlag = flag.String("since", "", "Format only the files that have changed in git since this commit, within the paths given if any")
+var jobsFlag = flag.Int("j", runtime.GOMAXPROCS(0), "Format up to this many files at once; files are formatted one at a time with -stream")
+var cacheFlag = flag.String("cache", "", "Directory to cache formatted output in, so that files that have not changed since they were last formatted with the same settings are not formatted again")
+var voidFlag = flag.String("void", "", "Comma separated list of elements to write as void elements, such as legacy tags like spacer")
+var extFlag = flag.String("ext", ".html,.htm,.vue,.svelte", "Comma separated list of file extensions to format when walking directories")
+
+var quotesFlag htmlformat.QuoteStyle
+var caseFlag htmlformat.CaseStyle
+var booleansFlag htmlformat.BooleanStyle
+var duplicatesFlag htmlformat.DuplicateStyle
+var alignmentFlag htmlformat.AttributeAlignment
+var whitespaceFlag htmlformat.WhitespaceSensitivity
+var doctypeFlag htmlformat.DoctypeStyle
+var charsetFlag htmlformat.CharsetStyle
+var trailingNewlineFlag htmlformat.TrailingNewlineStyle
+var styleSemicolonFlag htmlformat.SemicolonStyle
+var elementsFlag = elements{}
+var childIndentFlag = childIndent{}
+
+// elements is a flag.Value that registers the behavior of an element each
+// time it is set, e.g. -element my-icon=void.
+type elements map[string]htmlformat.ElementBehavior
+
+func (e elements) String() string {
+	return ""
+}
+
+func (e elements) Set(s string) error {
+	name, behavior, ok := strings.Cut(s, "=")
+	if !ok || name == "" {
+		return fmt.Errorf("expected name=behavior, got %q", s)
+	}
+	var b htmlformat.ElementBehavior
+	if err := b.Set(behavior); err != nil {
+		return err
+	}
+	e[name] = b
+	return nil
+}
+
+// childIndent is a flag.Value that sets the indentation of the children of
+// an element each time it is set, e.g. -child-indent ul=0.
+type childIndent map[string]int
+
+func (c childIndent) String() string {
+	return ""
+}
+
+func (c childIndent) Set(s string) error {
+	name, levels, ok := strings.Cut(s, "=")
+	if !ok || name == "" {
+		return fmt.Errorf("expected name=levels, got %q", s)
+	}
+	n, err := strconv.Atoi(levels)
+	if err != nil {
+		return fmt.Errorf("invalid number of levels %q", levels)
+	}
+	c[name] = n
+	return nil
+}
+
+func init() {
+	flag.Var(&charsetFlag, "charset", "Assume the input is UTF-8, or detect its declared encoding and write the output in the same encoding or in UTF-8: utf-8, preserve or transcode")
+	flag.Var(&booleansFlag, "booleans", "Write boolean attributes such as disabled as they are, without a value, or with their name as their value: keep, minimal or explicit")
+	flag.Var(&whitespaceFlag, "whitespace", "Choose which whitespace is significant: default, css (around phrasing elements), strict (around every element) or ignore")
+	flag.Var(&alignmentFlag, "attribute-alignment", "Write the attributes of tags longer than -width on lines of their own indented one level, or aligned under the first: indent or align")
+	flag.Var(&duplicatesFlag, "duplicates", "Write all of the attributes that appear more than once on an element, only the first or last of them, or fail: keep, first, last or error")
+	flag.Var(childIndentFlag, "child-indent", "Indent the children of an element by a number of levels other than one, as name=levels; may be repeated")
+	flag.Var(elementsFlag, "element", "Register how an element is formatted, as name=behavior where behavior is block, void, preformatted, inline or raw-text; may be repeated")
+	flag.Var(&doctypeFlag, "doctype", "Write DOCTYPE declarations in the standard style, replace them with <!DOCTYPE html>, or preserve them: standard, html5 or preserve")
+	flag.Var(&styleSemicolonFlag, "style-semicolon", "End the last declaration of style attributes with a semicolon always, never, or when the input does: require, forbid or preserve")
+	flag.Var(&trailingNewlineFlag, "trailing-newline", "End the output with a newline when pretty-printing, always, never, or when the input does: default, require, forbid or preserve")
+	flag.Var(&quotesFlag, "quotes", "Quote attribute values with double or single quotes, preserve the quotes of the input, or omit them where possible: double, single, preserve or minimal")
+	flag.Var(&caseFlag, "case", "Write tag and attribute names in lowercase, preserve their case in the input, or write HTML tag names in uppercase: lower, preserve or upper")
+}
+
+func usage() {
+	fmt.Fprintf(flag.CommandLine.Output(), "usage: htmlformat [flags] [path ...]\n")
+	fmt.Fprintf(flag.CommandLine.Output(), "       htmlformat [flags] lsp\n\n")
+	fmt.Fprintf(flag.CommandLine.Output(), "Formats the HTML in each path, or stdin if no paths are given, and writes it to stdout.\n")
+	fmt.Fprintf(flag.CommandLine.Output(), "Paths may be files, directories or glob patterns.\n")
+	fmt.Fprintf(flag.CommandLine.Output(), "The lsp command serves the Language Server Protocol on stdin and stdout, for editors.\n")
+	fmt.Fprintf(flag.CommandLine.Output(), "Settings are read from .editorconfig and %s files, and overridden by flags.\n\n", htmlformat.ConfigFileName)
+	flag.PrintDefaults()
+}
 
 func main() {
+	flag.Usage = usage
 	flag.Parse()
 
-	var err error
-	if *parseDocumentFlag {
-		err = htmlformat.Document(os.Stdout, os.Stdin)
+	if flag.NArg() == 1 && flag.Arg(0) == "lsp" {
+		if err := serveLSP(os.Stdin, os.Stdout); err != nil && !errors.Is(err, io.EOF) {
+			log.Fatal(err)
+		}
+		return
+	}
+	if *watchFlag {
+		if flag.NArg() == 0 {
+			log.Fatal("-watch needs paths to watch")
+		}
+		*writeFlag = true
+		watch(flag.Args(), parseExtensions(*extFlag), pollInterval, nil)
+	}
+
+	paths := []string{"-"}
+	switch {
+	case *stagedFlag && *sinceFlag != "":
+		log.Fatal("cannot use -staged with -since")
+	case *stagedFlag || *sinceFlag != "":
+		var err error
+		paths, err = changedPaths(flag.Args(), parseExtensions(*extFlag), *stagedFlag, *sinceFlag)
+		if err != nil {
+			log.Fatal(err)
+		}
+	case flag.NArg() > 0:
+		var err error
+		paths, err = expandPaths(flag.Args(), parseExtensions(*extFlag))
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+	var failed, unformatted, malformed bool
+	report := func(path string, r result) {
+		var re *htmlformat.RepairError
+		var pe *htmlformat.ParseError
+		switch {
+		case errors.As(r.err, &re):
+			printRepairs(path, re)
+			malformed = true
+		case errors.As(r.err, &pe):
+			printParseError(path, pe)
+			malformed = true
+		case r.err != nil:
+			log.Print(r.err)
+			failed = true
+		case r.changed && *listFlag:
+			fmt.Println(displayName(path))
+			unformatted = true
+		}
+	}
+	jobs := *jobsFlag
+	if *streamFlag || jobs < 1 {
+		// Streamed output is written as it is formatted, rather than held
+		// until the files before it are written.
+		jobs = 1
+	}
+	if jobs == 1 || len(paths) == 1 {
+		for _, path := range paths {
+			report(path, formatPath(os.Stdout, path))
+		}
+	} else {
+		formatPaths(paths, jobs, report)
+	}
+	if failed {
+		os.Exit(1)
+	}
+	if malformed {
+		os.Exit(2)
+	}
+	if unformatted {
+		os.Exit(1)
+	}
+}
+
+// printRepairs reports the repairs that the file at path needs.
+func printRepairs(path string, re *htmlformat.RepairError) {
+	for _, repair := range re.Repairs {
+		fmt.Fprintf(os.Stderr, "%s:%s\n", displayName(path), repair)
+	}
+}
+
+// printParseError reports the error that the file at path could not be
+// parsed with.
+func printParseError(path string, pe *htmlformat.ParseError) {
+	switch {
+	case pe.Line > 0 && pe.Column > 0:
+		fmt.Fprintf(os.Stderr, "%s:%d:%d: %v\n", displayName(path), pe.Line, pe.Column, pe.Err)
+	case pe.Line > 0:
+		fmt.Fprintf(os.Stderr, "%s:%d: %v\n", displayName(path), pe.Line, pe.Err)
+	default:
+		fmt.Fprintf(os.Stderr, "%s: %v\n", displayName(path), pe.Err)
+	}
+}
+
+// result is the outcome of formatting a file.
+type result struct {
+	changed bool
+	err     error
+}
+
+// formatPath formats the file at path with the configuration that applies to
+// it, writing the output to w.
+func formatPath(w io.Writer, path string) (r result) {
+	f, err := newFormatter(path)
+	if err != nil {
+		return result{err: fmt.Errorf("failed to load configuration for %s: %w", displayName(path), err)}
+	}
+	if r.changed, r.err = formatFile(f, w, path); r.err != nil {
+		var re *htmlformat.RepairError
+		if !errors.As(r.err, &re) {
+			r.err = fmt.Errorf("failed to format %s: %w", displayName(path), r.err)
+		}
+	}
+	return r
+}
+
+// formatPaths formats the files at paths with up to jobs of them at once.
+// The output of each file is held until those before it have been written,
+// and report is called for each file in turn, so that the output is the same
+// as if they were formatted one at a time.
+func formatPaths(paths []string, jobs int, report func(path string, r result)) {
+	outputs := make([]bytes.Buffer, len(paths))
+	results := make([]result, len(paths))
+	done := make([]chan struct{}, len(paths))
+	for i := range done {
+		done[i] = make(chan struct{})
+	}
+	queue := make(chan int)
+	for j := 0; j < jobs; j++ {
+		go func() {
+			for i := range queue {
+				results[i] = formatPath(&outputs[i], paths[i])
+				close(done[i])
+			}
+		}()
+	}
+	go func() {
+		for i := range paths {
+			queue <- i
+		}
+		close(queue)
+	}()
+	for i, path := range paths {
+		<-done[i]
+		if _, err := os.Stdout.Write(outputs[i].Bytes()); err != nil && results[i].err == nil {
+			results[i].err = err
+		}
+		outputs[i] = bytes.Buffer{}
+		report(path, results[i])
+	}
+}
+
+// newFormatter returns a formatter for the file at path, configured by the
+// project configuration files that apply to it and any flags that have been
+// set on the command line.
+func newFormatter(path string) (f *htmlformat.Formatter, err error) {
+	if path == "-" {
+		// Settings for stdin come from the configuration of the path that it
+		// is said to hold, or of the current directory.
+		path = "stdin"
+		if *stdinFilepathFlag != "" {
+			path = *stdinFilepathFlag
+		}
+	}
+	config, err := htmlformat.LoadConfig(path)
+	if err != nil {
+		return nil, err
+	}
+	f = &config
+	flag.Visit(func(fl *flag.Flag) {
+		switch fl.Name {
+		case "minify":
+			f.Mode = htmlformat.Pretty
+			if *minifyFlag {
+				f.Mode = htmlformat.Minify
+			}
+		case "newline":
+			switch *newlineFlag {
+			case "lf":
+				f.Newline = "\n"
+			case "crlf":
+				f.Newline = "\r\n"
+			case "cr":
+				f.Newline = "\r"
+			case "auto":
+				f.Newline = htmlformat.DetectNewline
+			default:
+				err = fmt.Errorf("unknown newline %q", *newlineFlag)
+			}
+		case "normalize-newlines":
+			f.NormalizeNewlines = *normalizeNewlinesFlag
+		case "width":
+			f.PrintWidth = *widthFlag
+		case "blank-lines":
+			f.MaxBlankLines = *blankLinesFlag
+		case "flat-document":
+			f.FlatDocument = *flatDocumentFlag
+		case "wrap-comments":
+			f.WrapComments = *wrapCommentsFlag
+		case "wrap-text":
+			f.WrapText = *wrapTextFlag
+		case "sort-attributes":
+			f.SortAttributes = *sortAttributesFlag
+		case "drop-empty":
+			f.DropEmptyAttributes = *dropEmptyFlag
+		case "sort-classes":
+			f.SortClasses = *sortClassesFlag
+		case "normalize-styles":
+			f.NormalizeStyles = *normalizeStylesFlag
+		case "style-semicolon":
+			f.StyleSemicolon = styleSemicolonFlag
+		case "wrap-attributes":
+			f.WrapAttributeValues = *wrapAttributesFlag
+		case "srcdoc":
+			f.FormatSrcdoc = *srcdocFlag
+		case "self-close":
+			f.SelfClose = *selfCloseFlag
+		case "omit-end-tags":
+			f.OmitEndTags = *omitEndTagsFlag
+		case "omit-implied":
+			f.OmitImplied = *omitImpliedFlag
+		case "xhtml":
+			f.XHTML = *xhtmlFlag
+		case "email":
+			f.Email = *emailFlag
+		case "cache":
+			if *cacheFlag != "" {
+				f.Cache = htmlformat.DirCache(*cacheFlag)
+			}
+		case "strict":
+			f.Strict = *strictFlag
+		case "max-bytes":
+			f.MaxBytes = *maxBytesFlag
+		case "max-depth":
+			f.MaxDepth = *maxDepthFlag
+		case "max-nodes":
+			f.MaxNodes = *maxNodesFlag
+		case "verify":
+			f.Verify = *verifyFlag
+		case "cdata":
+			f.WrapCDATA = *cdataFlag
+		case "format-json":
+			f.FormatJSON = *formatJSONFlag
+		case "keep-invalid-json":
+			f.KeepInvalidJSON = *keepInvalidJSONFlag
+		case "minified-line-length":
+			f.MinifiedLineLength = *minifiedLineLengthFlag
+		case "strip-comments":
+			f.StripComments = *stripCommentsFlag
+		case "keep-comments":
+			f.KeepComments = nil
+			if *keepCommentsFlag != "" {
+				f.KeepComments = strings.Split(*keepCommentsFlag, ",")
+			}
+		case "print-depth":
+			f.MaxPrintDepth = *printDepthFlag
+		case "preserve":
+			f.Preserve = nil
+			if *preserveFlag != "" {
+				f.Preserve = []string{*preserveFlag}
+			}
+		case "sanitize":
+			f.Sanitizer = nil
+			if *sanitizeFlag {
+				f.Sanitizer = htmlformat.UGCPolicy()
+			}
+		case "entities":
+			f.NamedEntities = *entitiesFlag
+		case "inline":
+			f.InlineElements = nil
+			if *inlineFlag {
+				f.InlineElements = htmlformat.DefaultInlineElements
+			}
+		case "single-line":
+			f.SingleLineElements = nil
+			if *singleLineFlag {
+				f.SingleLineElements = htmlformat.DefaultSingleLineElements
+			}
+		case "whitespace":
+			f.Whitespace = whitespaceFlag
+		case "quotes":
+			f.Quotes = quotesFlag
+		case "case":
+			f.Case = caseFlag
+		case "booleans":
+			f.Booleans = booleansFlag
+		case "bracket-same-line":
+			f.BracketSameLine = *bracketSameLineFlag
+		case "attribute-alignment":
+			f.AttributeAlignment = alignmentFlag
+		case "duplicates":
+			f.DuplicateAttributes = duplicatesFlag
+		case "doctype":
+			f.Doctype = doctypeFlag
+		case "charset":
+			f.Charset = charsetFlag
+		case "trailing-newline":
+			f.TrailingNewline = trailingNewlineFlag
+		case "element":
+			elements := make(map[string]htmlformat.ElementBehavior, len(f.Elements)+len(elementsFlag))
+			for name, b := range f.Elements {
+				elements[name] = b
+			}
+			for name, b := range elementsFlag {
+				elements[name] = b
+			}
+			f.Elements = elements
+		case "void":
+			elements := make(map[string]htmlformat.ElementBehavior, len(f.Elements))
+			for name, b := range f.Elements {
+				elements[name] = b
+			}
+			for _, name := range strings.Split(*voidFlag, ",") {
+				if name = strings.TrimSpace(name); name != "" {
+					elements[name] = htmlformat.VoidElement
+				}
+			}
+			f.Elements = elements
+		case "child-indent":
+			levels := make(map[string]int, len(f.ChildIndent)+len(childIndentFlag))
+			for name, n := range f.ChildIndent {
+				levels[name] = n
+			}
+			for name, n := range childIndentFlag {
+				levels[name] = n
+			}
+			f.ChildIndent = levels
+		case "template":
+			f.Template = nil
+			if *templateFlag != "" {
+				ts, ok := htmlformat.LookupTemplateSyntax(*templateFlag)
+				if !ok {
+					err = fmt.Errorf("unknown template syntax %q", *templateFlag)
+				}
+				f.Template = ts
+			}
+		case "component":
+			f.Component = nil
+			if *componentFlag != "" {
+				cs, ok := htmlformat.LookupComponentSyntax(*componentFlag)
+				if !ok {
+					err = fmt.Errorf("unknown component syntax %q", *componentFlag)
+				}
+				f.Component = cs
+			}
+		}
+	})
+	return f, err
+}
+
+func displayName(path string) string {
+	if path == "-" && *stdinFilepathFlag != "" {
+		return *stdinFilepathFlag
+	}
+	if path == "-" {
+		return "<standard input>"
+	}
+	return path
+}
+
+// formatFile formats the file at path, or stdin if path is "-", and reports
+// whether the formatted output differs from the input.
+func formatFile(f *htmlformat.Formatter, w io.Writer, path string) (changed bool, err error) {
+	if *streamFlag && !*writeFlag && !*listFlag && !*diffFlag {
+		return false, streamFile(f, w, path)
+	}
+	var src []byte
+	if path == "-" {
+		if *writeFlag {
+			return false, errors.New("cannot use -w with standard input")
+		}
+		src, err = io.ReadAll(os.Stdin)
 	} else {
-		err = htmlformat.Fragment(os.Stdout, os.Stdin)
+		src, err = os.ReadFile(path)
 	}
 	if err != nil {
-		log.Fatalf("failed to format: %v", err)
+		return false, err
+	}
+	var out bytes.Buffer
+	if err = format(f, &out, bytes.NewReader(src), path); err != nil {
+		return false, err
+	}
+	changed = !bytes.Equal(src, out.Bytes())
+	if *writeFlag && changed {
+		if err = writeFileAtomic(path, out.Bytes()); err != nil {
+			return changed, err
+		}
+	}
+	if *diffFlag {
+		if changed {
+			name := displayName(path)
+			_, err = w.Write(diff.Unified(name+".orig", name, src, out.Bytes()))
+		}
+		return changed, err
+	}
+	if *listFlag || *writeFlag {
+		return changed, nil
+	}
+	_, err = w.Write(out.Bytes())
+	return changed, err
+}
+
+// streamFile formats the file at path, or stdin if path is "-", without
+// reading it into memory, unless it is XML or Go source.
+func streamFile(f *htmlformat.Formatter, w io.Writer, path string) (err error) {
+	r := os.Stdin
+	if path != "-" {
+		if r, err = os.Open(path); err != nil {
+			return err
+		}
+		defer r.Close()
+	}
+	return format(f, w, r, path)
+}
+
+func format(f *htmlformat.Formatter, w io.Writer, r io.Reader, path string) (err error) {
+	if isXML(path) {
+		return f.XML(w, r)
+	}
+	if isGoSource(path) {
+		return f.GoSource(w, r)
+	}
+	if isMarkdown(path) {
+		return f.Markdown(w, r)
+	}
+	if *streamFlag {
+		return f.Stream(w, r)
+	}
+	if *parseDocumentFlag {
+		return f.Document(w, r)
+	}
+	if *contextFlag != "" {
+		return f.FragmentInContext(w, r, *contextFlag)
 	}
+	return f.Fragment(w, r)
 }
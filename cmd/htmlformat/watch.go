@@ -0,0 +1,81 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"log"
+	"os"
+	"time"
+
+	"github.com/a-h/htmlformat"
+)
+
+// pollInterval is how often watch checks for changed files.
+const pollInterval = 500 * time.Millisecond
+
+// watch formats the files that args expand to in place whenever they change,
+// until stop is closed. Files are polled every interval for changes to their
+// modification times, and formatted once they have stayed the same for one
+// poll, so that files are not read while an editor is still writing them.
+// Errors are reported and watching continues.
+func watch(args []string, exts []string, interval time.Duration, stop <-chan struct{}) {
+	// formatted holds the modification time of each file when it was last
+	// formatted, or when watching started.
+	formatted := map[string]time.Time{}
+	// pending holds the modification time of each file that has changed
+	// since, when it was last polled.
+	pending := map[string]time.Time{}
+	for first := true; ; first = false {
+		paths, err := expandPaths(args, exts)
+		if err != nil {
+			log.Print(err)
+		}
+		for _, path := range paths {
+			fi, err := os.Stat(path)
+			if err != nil {
+				continue
+			}
+			mtime := fi.ModTime()
+			switch {
+			case first:
+				formatted[path] = mtime
+			case formatted[path].Equal(mtime):
+				delete(pending, path)
+			case !pending[path].Equal(mtime):
+				pending[path] = mtime
+			default:
+				delete(pending, path)
+				formatted[path] = mtime
+				if watchFile(path) {
+					if fi, err = os.Stat(path); err == nil {
+						formatted[path] = fi.ModTime()
+					}
+				}
+			}
+		}
+		select {
+		case <-stop:
+			return
+		case <-time.After(interval):
+		}
+	}
+}
+
+// watchFile formats the file at path in place, and reports whether it was
+// changed.
+func watchFile(path string) (changed bool) {
+	r := formatPath(io.Discard, path)
+	var re *htmlformat.RepairError
+	var pe *htmlformat.ParseError
+	switch {
+	case errors.As(r.err, &re):
+		printRepairs(path, re)
+	case errors.As(r.err, &pe):
+		printParseError(path, pe)
+	case r.err != nil:
+		log.Print(r.err)
+	case r.changed:
+		log.Printf("formatted %s", displayName(path))
+	}
+	return r.changed
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"bytes"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWatch(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "a.html")
+	formatted := "<div>\n <p>a</p>\n</div>\n"
+	if err := os.WriteFile(path, []byte(formatted), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	defer func(w bool) { *writeFlag = w }(*writeFlag)
+	*writeFlag = true
+	var logs bytes.Buffer
+	defer func(flags int) {
+		log.SetOutput(os.Stderr)
+		log.SetFlags(flags)
+	}(log.Flags())
+	log.SetOutput(&logs)
+	log.SetFlags(0)
+
+	const interval = 10 * time.Millisecond
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		watch([]string{dir}, []string{".html"}, interval, stop)
+		close(done)
+	}()
+	stopped := false
+	stopWatching := func() {
+		if !stopped {
+			stopped = true
+			close(stop)
+			<-done
+		}
+	}
+	defer stopWatching()
+	// Let the first poll find the file as it is.
+	time.Sleep(10 * interval)
+	if err := os.WriteFile(path, []byte("<div><p>a</p></div>"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	for deadline := time.Now().Add(5 * time.Second); ; time.Sleep(interval) {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(data) == formatted {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("expected the file to be formatted, got %q", data)
+		}
+	}
+	// Formatting the file changes it, which must not format it again.
+	time.Sleep(10 * interval)
+	stopWatching()
+
+	if n := strings.Count(logs.String(), "formatted "); n != 1 {
+		t.Errorf("expected the file to be formatted once, got %d times:\n%s", n, logs.String())
+	}
+}
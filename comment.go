@@ -0,0 +1,202 @@
+package htmlformat
+
+import (
+	"bytes"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/net/html"
+)
+
+// comment returns the comment with the content data as it is written at
+// level. The lines after the first are indented one level further than the
+// comment, keeping their indentation relative to each other, and the end of
+// a comment that was on its own line is aligned with the start.
+func (p *printer) comment(data string, level int) string {
+	lines := strings.Split(data, "\n")
+	last := len(lines) - 1
+	for i := range lines[:last] {
+		lines[i] = strings.TrimRightFunc(lines[i], unicode.IsSpace)
+	}
+	var ownLine bool
+	if last > 0 && strings.TrimSpace(lines[last]) == "" {
+		ownLine = true
+		lines = lines[:last]
+	}
+
+	indent := p.indent()
+	start := level * utf8.RuneCountInString(indent)
+	body := start + utf8.RuneCountInString(indent)
+	out := p.wrapComment(lines[0], start+len("<!--"), body, false)
+	for _, l := range dedent(lines[1:]) {
+		out = append(out, p.wrapComment(l, body, body, true)...)
+	}
+
+	var sb strings.Builder
+	sb.WriteString("<!--")
+	for i, l := range out {
+		if i > 0 {
+			sb.WriteString(p.newline())
+			if l != "" {
+				sb.WriteString(strings.Repeat(indent, level+1))
+			}
+		}
+		sb.WriteString(l)
+	}
+	if ownLine {
+		sb.WriteString(p.newline())
+		sb.WriteString(strings.Repeat(indent, level))
+	}
+	sb.WriteString("-->")
+	return sb.String()
+}
+
+// fixEOFComment empties the comment that the parser reads from <!> at the end
+// of the input, which is the last of the parsed nodes. Its content is ">",
+// rather than nothing as HTML would have it, and cannot be written back, as
+// <!-->--> ends a comment at its start.
+func fixEOFComment(nodes []*html.Node) {
+	if len(nodes) == 0 {
+		return
+	}
+	n := nodes[len(nodes)-1]
+	for n.LastChild != nil {
+		n = n.LastChild
+	}
+	if n.Type == html.CommentNode && n.Data == ">" {
+		n.Data = ""
+	}
+}
+
+// escapeComments escapes the ampersands in the comments of src, as the parser
+// unescapes character references in comments, which would otherwise turn
+// <!--&amp;--> into <!--&-->, and <!&gt;--> into a comment that ends at its
+// start when it is written. The tokens are read as the parser would read
+// them outside of foreign content, where comments are escaped the same way.
+func (p *printer) escapeComments(src []byte) []byte {
+	if !bytes.Contains(src, []byte("&")) {
+		return src
+	}
+	z := html.NewTokenizer(bytes.NewReader(src))
+	var out bytes.Buffer
+	var m offsetMap
+	var offset int
+	for {
+		tt := z.Next()
+		if tt == html.ErrorToken {
+			break
+		}
+		raw := z.Raw()
+		if tt == html.CommentToken && bytes.Contains(raw, []byte("&")) && !bytes.HasPrefix(raw, []byte("<![CDATA[")) {
+			start := out.Len()
+			out.Write(bytes.ReplaceAll(raw, []byte("&"), []byte("&amp;")))
+			p.replaced(&m, start, out.Len(), offset, offset+len(raw))
+		} else {
+			out.Write(raw)
+		}
+		offset += len(raw)
+	}
+	out.Write(src[offset:])
+	p.offsetMaps = append(p.offsetMaps, m)
+	return out.Bytes()
+}
+
+// dedent removes the indentation that all of the lines that are not blank
+// have in common.
+func dedent(lines []string) []string {
+	common := -1
+	for _, l := range lines {
+		if l == "" {
+			continue
+		}
+		n := len(l) - len(strings.TrimLeft(l, " \t"))
+		if common < 0 || n < common {
+			common = n
+		}
+	}
+	out := make([]string, len(lines))
+	for i, l := range lines {
+		if l != "" {
+			out[i] = l[common:]
+		}
+	}
+	return out
+}
+
+// wrapComment splits the comment line l, which starts at column first, into
+// lines that fit within the print width if WrapComments is set. The lines
+// after the first start at column rest, and also keep the indentation of l
+// if keepLead is set. Words longer than the width are not split.
+func (p *printer) wrapComment(l string, first, rest int, keepLead bool) []string {
+	if !p.WrapComments || p.PrintWidth <= 0 || first+utf8.RuneCountInString(l) <= p.PrintWidth {
+		return []string{l}
+	}
+	lead := l[:len(l)-len(strings.TrimLeft(l, " \t"))]
+	next := ""
+	if keepLead {
+		next = lead
+	}
+	var lines []string
+	line, width := lead, first+len(lead)
+	for _, word := range strings.Fields(l) {
+		n := utf8.RuneCountInString(word)
+		if strings.TrimSpace(line) != "" && width+1+n > p.PrintWidth {
+			lines = append(lines, line)
+			line, width = next, rest+len(next)
+		}
+		if strings.TrimSpace(line) != "" {
+			line += " "
+			width++
+		}
+		line += word
+		width += n
+	}
+	trail := l[len(strings.TrimRight(l, " \t")):]
+	return append(lines, line+trail)
+}
+
+// keepsComment reports whether StripComments keeps the comment with the
+// content data: conditional comments, and those that start with one of
+// KeepComments.
+func (f *Formatter) keepsComment(data string) bool {
+	if strings.HasPrefix(data, "[if") || strings.HasSuffix(data, "[endif]") {
+		return true
+	}
+	data = strings.TrimLeftFunc(data, unicode.IsSpace)
+	for _, prefix := range f.KeepComments {
+		if strings.HasPrefix(data, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// stripComments removes the comments that StripComments does not keep from
+// the children of n, joining the text on either side of them.
+func (p *printer) stripComments(n *html.Node) {
+	for c := n.FirstChild; c != nil; {
+		next := c.NextSibling
+		if c.Type != html.CommentNode {
+			p.stripComments(c)
+			c = next
+			continue
+		}
+		if _, ok := p.verbatimSource(c); ok {
+			c = next
+			continue
+		}
+		if _, ok := p.templateAction(c); ok || p.keepsComment(c.Data) {
+			c = next
+			continue
+		}
+		n.RemoveChild(c)
+		if next != nil && next.Type == html.TextNode && next.PrevSibling != nil && next.PrevSibling.Type == html.TextNode {
+			text := next
+			next = text.NextSibling
+			text.PrevSibling.Data += text.Data
+			n.RemoveChild(text)
+		}
+		c = next
+	}
+}
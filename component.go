@@ -0,0 +1,448 @@
+package htmlformat
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// ComponentSyntax describes the single-file components of a framework such as
+// Vue or Svelte, which hold markup together with <script> and <style> blocks.
+// When set on a Formatter, only the markup is formatted. The blocks are
+// written as they are, or formatted by the Formatter's JS and CSS formatters
+// if their lang attribute, if any, is "js" or "css". The case of element
+// names is kept, and elements are written self-closing if they are in the
+// input, as the frameworks allow.
+type ComponentSyntax struct {
+	// Template is the syntax of the expressions in the markup, which is used
+	// if the Formatter has no Template of its own.
+	Template *TemplateSyntax
+	// Markup, if set, is the name of the top-level element that holds the
+	// markup, such as "template", and the other top-level elements are
+	// blocks. Otherwise, the top-level <script> and <style> elements are
+	// blocks, and the rest is markup.
+	Markup string
+	// UnquotedActions writes attribute values that are a single expression,
+	// such as value={x}, without quotes.
+	UnquotedActions bool
+}
+
+// Vue is the syntax of the expressions in Vue templates.
+var Vue = &TemplateSyntax{
+	Delimiters: []TemplateDelimiter{{Left: "{{", Right: "}}"}},
+}
+
+// Svelte is the syntax of the expressions and blocks in Svelte markup.
+var Svelte = &TemplateSyntax{
+	Delimiters: []TemplateDelimiter{{Left: "{", Right: "}", Nested: true}},
+	Open:       regexp.MustCompile(`^#`),
+	Middle:     regexp.MustCompile(`^:`),
+	Close:      regexp.MustCompile(`^/`),
+}
+
+// VueComponent is the syntax of Vue single-file components, whose markup is
+// within a top-level <template> element.
+var VueComponent = &ComponentSyntax{Template: Vue, Markup: "template"}
+
+// SvelteComponent is the syntax of Svelte components.
+var SvelteComponent = &ComponentSyntax{Template: Svelte, UnquotedActions: true}
+
+// LookupComponentSyntax returns the component syntax with the given name, as
+// used in configuration files and on the command line: "vue" or "svelte".
+func LookupComponentSyntax(name string) (cs *ComponentSyntax, ok bool) {
+	switch name {
+	case "vue":
+		return VueComponent, true
+	case "svelte":
+		return SvelteComponent, true
+	}
+	return nil, false
+}
+
+// componentExtensions are the file extensions of single-file components.
+var componentExtensions = map[string]*ComponentSyntax{
+	".vue":    VueComponent,
+	".svelte": SvelteComponent,
+}
+
+// componentTagPrefix starts the names that replace the names of elements
+// whose case the parser would lose, or that are self-closing, in the input of
+// the parser. They are followed by an index into the printer's
+// componentNames, and by "-self" for self-closing elements.
+const componentTagPrefix = "htmlformat-component-"
+
+// component formats the input as a single-file component, writing its blocks
+// and the formatted markup in the order that they appear in the input,
+// separated by blank lines.
+func (p *printer) component(w io.Writer, r io.Reader) (err error) {
+	src, err := p.readInput(p.trackReading(r))
+	if err != nil {
+		return err
+	}
+	if p.Charset != AssumeUTF8 {
+		if src, err = p.decode(src); err != nil {
+			return err
+		}
+	}
+	p.inputNewline = bytes.HasSuffix(src, []byte("\n"))
+	p.detectNewlines(src)
+	var parts []string
+	for _, s := range p.componentSections(src) {
+		var part string
+		if s.block != nil {
+			part, err = p.componentBlock(src[s.start:s.end], s.block)
+		} else {
+			part, err = p.componentMarkup(src, s.start, s.end)
+		}
+		if err != nil {
+			return err
+		}
+		if part = strings.TrimRight(part, "\r\n"); strings.TrimSpace(part) != "" {
+			parts = append(parts, part)
+		}
+	}
+	if len(parts) > 0 {
+		w, end := p.trailingNewline(w)
+		separator, last := p.newline()+p.newline(), p.newline()
+		if p.Mode == Minify {
+			separator, last = p.newline(), ""
+		}
+		if _, err = write(w, strings.Join(parts, separator), last); err != nil {
+			return err
+		}
+		if err = end(); err != nil {
+			return err
+		}
+	}
+	p.reportProgress()
+	return nil
+}
+
+// componentSection is a part of a component: a block, or markup if block is
+// nil.
+type componentSection struct {
+	start, end int
+	block      *html.Node
+}
+
+// componentSections splits src into its blocks and the markup between them.
+func (p *printer) componentSections(src []byte) (sections []componentSection) {
+	z := html.NewTokenizer(bytes.NewReader(src))
+	var offset, depth, last int
+	var block *componentSection
+	for {
+		tt := z.Next()
+		if tt == html.ErrorToken {
+			break
+		}
+		start := offset
+		offset += len(z.Raw())
+		switch tt {
+		case html.StartTagToken:
+			tok := z.Token()
+			if depth == 0 && p.isComponentBlock(tok.Data) {
+				if last < start {
+					sections = append(sections, componentSection{start: last, end: start})
+				}
+				block = &componentSection{start: start, block: &html.Node{
+					Type: html.ElementNode, Data: tok.Data, DataAtom: tok.DataAtom, Attr: tok.Attr,
+				}}
+			}
+			if !p.isVoidElementName(tok.Data) {
+				depth++
+			}
+		case html.EndTagToken:
+			if depth > 0 {
+				depth--
+			}
+			if depth == 0 && block != nil {
+				block.end = offset
+				sections = append(sections, *block)
+				block, last = nil, offset
+			}
+		}
+	}
+	if block != nil {
+		// A block without an end tag runs to the end of the input.
+		block.end = len(src)
+		return append(sections, *block)
+	}
+	if last < len(src) {
+		sections = append(sections, componentSection{start: last, end: len(src)})
+	}
+	return sections
+}
+
+// isComponentBlock reports whether top-level elements called name are blocks
+// rather than markup.
+func (p *printer) isComponentBlock(name string) bool {
+	if p.Component.Markup != "" {
+		return name != p.Component.Markup
+	}
+	return name == "script" || name == "style"
+}
+
+// componentBlock returns the block src, whose element is n, formatted by the
+// JS or CSS formatter if there is one for it, or as it is otherwise.
+func (p *printer) componentBlock(src []byte, n *html.Node) (string, error) {
+	ef := p.embeddedFormatter(n)
+	for _, a := range n.Attr {
+		if a.Key == "lang" && a.Val != "js" && a.Val != "css" {
+			ef = nil
+		}
+	}
+	open := bytes.IndexByte(src, '>') + 1
+	close := bytes.LastIndex(src, []byte("</"))
+	if ef == nil || open <= 0 || close < open {
+		return string(src), nil
+	}
+	content, err := ef.Format(n, dedentText(string(src[open:close])))
+	if err != nil {
+		return "", fmt.Errorf("failed to format <%s> content: %w", n.Data, err)
+	}
+	content = strings.Trim(content, "\r\n")
+	return string(src[:open]) + p.newline() + p.newlines(content) + p.newline() + string(src[close:]), nil
+}
+
+// componentMarkup returns the markup in src[start:end] formatted as a
+// fragment. The offsets of repairs are those in src.
+func (p *printer) componentMarkup(src []byte, start, end int) (string, error) {
+	f := *p.Formatter
+	f.Charset = AssumeUTF8
+	f.TrailingNewline = DefaultTrailingNewline
+	// The progress of the markup is reported as part of the component's.
+	f.OnProgress = nil
+	if f.Template == nil {
+		f.Template = p.Component.Template
+	}
+	q := f.newPrinter()
+	q.markup = true
+	q.ctx = p.ctx
+	var out bytes.Buffer
+	err := q.fragment(&out, bytes.NewReader(src[start:end]), "")
+	p.wrote(q.progress.NodesWritten)
+	if re, ok := err.(*RepairError); ok {
+		for i, r := range re.Repairs {
+			r.Offset += start
+			r.Line, r.Column = position(src, r.Offset)
+			re.Repairs[i] = r
+		}
+	}
+	return out.String(), err
+}
+
+// protectNames replaces the names of framework attributes in src that have
+// upper case letters, which the parser would lower, with placeholders as
+// template actions are. For components, the names of all such attributes
+// are replaced, and so are the names of the elements whose case matters, and
+// of self-closing elements, with names that the parser keeps as they are and
+// has no rules for. Self-closing elements are given end tags. The names of
+// elements are restored by restoreComponentTags once src has been parsed.
+func (p *printer) protectNames(src []byte) []byte {
+	var edits []componentEdit
+	// foreign counts the open <svg> and <math> elements, within which the
+	// parser keeps self-closing tags and the case of names.
+	var foreign int
+	names := map[string]int{}
+	for i := 0; i < len(src); {
+		j := bytes.IndexByte(src[i:], '<')
+		if j < 0 {
+			break
+		}
+		i += j
+		rest := src[i:]
+		if bytes.HasPrefix(rest, []byte("<!--")) {
+			end := bytes.Index(rest[4:], []byte("-->"))
+			if end < 0 {
+				break
+			}
+			i += 4 + end + 3
+			continue
+		}
+		if len(rest) < 2 || !isASCIILetter(rest[1]) && !(rest[1] == '/' && len(rest) > 2 && isASCIILetter(rest[2])) {
+			i++
+			continue
+		}
+		end := p.tagEnd(src, i)
+		name, closing := tagName(rest)
+		nameStart := i + 1
+		if closing {
+			nameStart++
+		}
+		raw := string(src[nameStart : nameStart+len(name)])
+		selfClosing := !closing && bytes.HasSuffix(src[i:end], []byte("/>"))
+		if name == "svg" || name == "math" {
+			if closing && foreign > 0 {
+				foreign--
+			} else if !closing && !selfClosing {
+				foreign++
+			}
+		}
+		if !closing {
+			edits = append(edits, p.attributeNameEdits(src, nameStart+len(name), end, foreign > 0)...)
+		}
+		if foreign > 0 || p.Component == nil {
+			i = end
+			continue
+		}
+		if selfClosing && end-2 > nameStart+len(name) && !isSpace(src[end-3]) {
+			// The parser would take the slash to be part of an unquoted
+			// value, such as that of <Child value={x}/>.
+			edits = append(edits, componentEdit{start: end - 2, end: end - 2, s: " "})
+		}
+		selfClosing = selfClosing && !p.isVoidElementName(name)
+		if raw != name || selfClosing {
+			index, ok := names[raw]
+			if !ok {
+				index = len(p.componentNames)
+				names[raw] = index
+				p.componentNames = append(p.componentNames, raw)
+			}
+			placeholder := componentTagPrefix + strconv.Itoa(index)
+			if selfClosing {
+				placeholder += "-self"
+				edits = append(edits, componentEdit{start: end, end: end, s: "</" + placeholder + ">"})
+			}
+			edits = append(edits, componentEdit{start: nameStart, end: nameStart + len(raw), s: placeholder})
+		}
+		i = end
+		if !closing && !selfClosing && isRawTextElementName(name) {
+			// The content is text, up to the end tag.
+			for i < len(src) && !(src[i] == '<' && hasEndTag(src[i:], name)) {
+				i++
+			}
+		}
+	}
+	if len(edits) == 0 {
+		return src
+	}
+	sort.SliceStable(edits, func(i, j int) bool { return edits[i].start < edits[j].start })
+	var out bytes.Buffer
+	var m offsetMap
+	var last int
+	for _, e := range edits {
+		out.Write(src[last:e.start])
+		start := out.Len()
+		out.WriteString(e.s)
+		p.replaced(&m, start, out.Len(), e.start, e.end)
+		last = e.end
+	}
+	out.Write(src[last:])
+	p.offsetMaps = append(p.offsetMaps, m)
+	return out.Bytes()
+}
+
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\f' || c == '\r'
+}
+
+// isAction reports whether the attribute value val is a single template
+// action.
+func isAction(val string) bool {
+	return strings.IndexRune(val, placeholderStart) == 0 &&
+		strings.IndexRune(val, placeholderEnd) == len(val)-utf8.RuneLen(placeholderEnd)
+}
+
+// componentEdit replaces src[start:end] with s.
+type componentEdit struct {
+	start, end int
+	s          string
+}
+
+// attributeNameEdits returns the edits that replace the names of the
+// attributes in src[i:end], the rest of a start tag, that have upper case
+// letters with placeholders, as the parser would lower their case. Only the
+// names of framework attributes are replaced outside components, and within
+// foreign elements, where the parser keeps the case of the names it knows.
+func (p *printer) attributeNameEdits(src []byte, i, end int, foreign bool) (edits []componentEdit) {
+	for i < end {
+		if c := src[i]; isSpace(c) || c == '/' || c == '>' {
+			i++
+			continue
+		}
+		if p.Template != nil {
+			if _, aend, ok := p.scanAction(src, i); ok {
+				i = aend
+				continue
+			}
+		}
+		// The name runs to the first space, '/', '>' or '=' after it.
+		start := i
+		for i++; i < end && !isSpace(src[i]) && src[i] != '/' && src[i] != '>' && src[i] != '='; i++ {
+		}
+		name := string(src[start:i])
+		if name != strings.ToLower(name) && (p.Component != nil && !foreign || isFrameworkAttribute(name)) {
+			p.actions = append(p.actions, action{src: name})
+			edits = append(edits, componentEdit{start: start, end: i, s: placeholder(len(p.actions) - 1)})
+		}
+		for i < end && isSpace(src[i]) {
+			i++
+		}
+		if i >= end || src[i] != '=' {
+			continue
+		}
+		// Skip the value.
+		for i++; i < end && isSpace(src[i]); i++ {
+		}
+		switch {
+		case i >= end:
+		case src[i] == '"' || src[i] == '\'':
+			if k := bytes.IndexByte(src[i+1:end], src[i]); k >= 0 {
+				i += k + 2
+			} else {
+				i = end
+			}
+		default:
+			for i < end && !isSpace(src[i]) && src[i] != '>' {
+				if p.Template != nil {
+					if _, aend, ok := p.scanAction(src, i); ok {
+						i = aend
+						continue
+					}
+				}
+				i++
+			}
+		}
+	}
+	return edits
+}
+
+// restoreComponentTags restores the names of elements that protectNames replaced
+// in nodes and their descendants, and records the elements that are written
+// self-closing.
+func (p *printer) restoreComponentTags(nodes []*html.Node) {
+	if len(p.componentNames) == 0 {
+		return
+	}
+	for _, n := range nodes {
+		// Restoring names does not fail.
+		_ = walk(n, func(n *html.Node) (bool, error) {
+			s, ok := strings.CutPrefix(n.Data, componentTagPrefix)
+			if n.Type != html.ElementNode || !ok {
+				return true, nil
+			}
+			s, selfClosing := strings.CutSuffix(s, "-self")
+			i, err := strconv.Atoi(s)
+			if err != nil || i < 0 || i >= len(p.componentNames) {
+				return true, nil
+			}
+			n.Data = p.componentNames[i]
+			n.DataAtom = atom.Lookup([]byte(n.Data))
+			if selfClosing && n.FirstChild == nil {
+				if p.selfClosing == nil {
+					p.selfClosing = map[*html.Node]bool{}
+				}
+				p.selfClosing[n] = true
+			}
+			return true, nil
+		}, func(*html.Node) error { return nil })
+	}
+}
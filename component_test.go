@@ -0,0 +1,125 @@
+package htmlformat
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"golang.org/x/net/html"
+)
+
+func TestComponent(t *testing.T) {
+	tests := []struct {
+		name      string
+		formatter Formatter
+		input     string
+		expected  string
+	}{
+		{
+			name:      "only the template of a Vue component is formatted",
+			formatter: Formatter{Component: VueComponent},
+			input: `<template><div :fooBar="x" @click="go"><MyComp v-if="a"/><span>{{ msg }}</span></div></template>
+<script setup>
+const   a = 1
+</script>
+<style scoped>
+.a{color:red}
+</style>
+`,
+			expected: `<template>
+ <div :fooBar="x" @click="go">
+  <MyComp v-if="a" />
+  <span>{{ msg }}</span>
+ </div>
+</template>
+
+<script setup>
+const   a = 1
+</script>
+
+<style scoped>
+.a{color:red}
+</style>
+`,
+		},
+		{
+			name:      "custom blocks of Vue components are written as they are",
+			formatter: Formatter{Component: VueComponent},
+			input:     "<i18n lang=\"json\">\n{ \"en\": {} }\n</i18n>\n<template><p>x</p></template>\n",
+			expected:  "<i18n lang=\"json\">\n{ \"en\": {} }\n</i18n>\n\n<template>\n <p>x</p>\n</template>\n",
+		},
+		{
+			name:      "Svelte blocks and expressions are preserved",
+			formatter: Formatter{Component: SvelteComponent},
+			input: `<script>
+  let x = {a: 1};
+</script>
+{#if x.a > 0}<p on:click={() => { x = {a: 2} }}>hi {x.a}</p>{:else}<Child value={x}/>{/if}
+`,
+			expected: `<script>
+  let x = {a: 1};
+</script>
+
+{#if x.a > 0}
+ <p on:click={() => { x = {a: 2} }}>hi {x.a}</p>
+{:else}
+ <Child value={x} />
+{/if}
+`,
+		},
+		{
+			name: "blocks are passed to the embedded formatters",
+			formatter: Formatter{
+				Component: SvelteComponent,
+				JS: EmbeddedFormatterFunc(func(n *html.Node, content string) (string, error) {
+					return "  " + strings.Join(strings.Fields(content), " "), nil
+				}),
+			},
+			input:    "<script>\nlet   a\n</script>\n<script lang=\"ts\">\nlet   b\n</script>\n<p>x</p>",
+			expected: "<script>\n  let a\n</script>\n\n<script lang=\"ts\">\nlet   b\n</script>\n\n<p>x</p>\n",
+		},
+		{
+			name:      "component names within SVG are left to the parser",
+			formatter: Formatter{Component: VueComponent},
+			input:     `<template><svg viewBox="0 0 1 1"><linearGradient id="g"/></svg></template>`,
+			expected: `<template>
+ <svg viewBox="0 0 1 1">
+  <linearGradient id="g" />
+ </svg>
+</template>
+`,
+		},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			f := test.formatter
+			f.Verify = true
+			out, err := f.CheckDocument([]byte(test.input))
+			if out == nil {
+				t.Fatalf("failed to format: %v", err)
+			}
+			if diff := cmp.Diff(test.expected, string(out)); diff != "" {
+				t.Error(diff)
+			}
+			if err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+func TestComponentRepairOffsets(t *testing.T) {
+	f := Formatter{Component: VueComponent, Strict: true}
+	_, err := f.DocumentString("<script>\nlet a\n</script>\n<template>\n<div>\n</template>\n")
+	re, ok := err.(*RepairError)
+	if !ok {
+		t.Fatalf("expected a *RepairError, got %v", err)
+	}
+	if len(re.Repairs) == 0 || re.Repairs[0].Line != 5 {
+		t.Errorf("expected a repair on line 5, got %+v", re.Repairs)
+	}
+}
@@ -0,0 +1,720 @@
+package htmlformat
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// ConfigFileName is the name of the project configuration file read by
+// LoadConfig.
+const ConfigFileName = ".htmlformat.toml"
+
+// LoadConfig returns a Formatter configured for the file at path, which need
+// not exist.
+//
+// Settings are read from the .editorconfig files in the directory of path and
+// its parents, stopping at one that sets root = true, and then from the
+// nearest .htmlformat.toml file, which takes precedence. The supported
+// .editorconfig properties are indent_style, indent_size, tab_width,
+// end_of_line and max_line_length. The keys of .htmlformat.toml are listed in
+// the README. The template syntax of files with extensions such as .gohtml,
+// .j2, .liquid, .erb and .hbs is set from the extension, as is the component
+// syntax of .vue and .svelte files, unless the project configuration sets
+// another.
+func LoadConfig(path string) (f Formatter, err error) {
+	path, err = filepath.Abs(path)
+	if err != nil {
+		return f, err
+	}
+	var editorConfigs []string
+	var projectConfig string
+	for dir := filepath.Dir(path); ; dir = filepath.Dir(dir) {
+		if projectConfig == "" {
+			if name := filepath.Join(dir, ConfigFileName); fileExists(name) {
+				projectConfig = name
+			}
+		}
+		if name := filepath.Join(dir, ".editorconfig"); fileExists(name) {
+			editorConfigs = append(editorConfigs, name)
+		}
+		if filepath.Dir(dir) == dir {
+			break
+		}
+	}
+
+	props := map[string]string{}
+	var roots int
+	for i, name := range editorConfigs {
+		root, err := isEditorConfigRoot(name)
+		if err != nil {
+			return f, err
+		}
+		if root {
+			roots = i + 1
+			break
+		}
+	}
+	if roots > 0 {
+		editorConfigs = editorConfigs[:roots]
+	}
+	for i := len(editorConfigs) - 1; i >= 0; i-- {
+		if err = readEditorConfig(editorConfigs[i], path, props); err != nil {
+			return f, err
+		}
+	}
+	f.applyEditorConfig(props)
+	f.Template = templateExtensions[strings.ToLower(filepath.Ext(path))]
+	f.Component = componentExtensions[strings.ToLower(filepath.Ext(path))]
+
+	if projectConfig != "" {
+		if err = f.readProjectConfig(projectConfig); err != nil {
+			return f, err
+		}
+	}
+	return f, nil
+}
+
+func fileExists(name string) bool {
+	fi, err := os.Stat(name)
+	return err == nil && !fi.IsDir()
+}
+
+// An iniLine is a line of an .editorconfig file, or a .htmlformat.toml file,
+// which use the same basic syntax.
+type iniLine struct {
+	number  int
+	section string
+	key     string
+	value   string
+}
+
+// readINI reads the sections and key value pairs in the file called name.
+func readINI(name string) (lines []iniLine, err error) {
+	file, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	scanner := bufio.NewScanner(file)
+	var section string
+	for number := 1; scanner.Scan(); number++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || line[0] == '#' || line[0] == ';' {
+			continue
+		}
+		if line[0] == '[' {
+			// A section header may be followed by a comment, such as
+			// [elements] # how custom elements are formatted.
+			if header := stripTOMLComment(line); header[len(header)-1] == ']' {
+				section = header[1 : len(header)-1]
+				continue
+			}
+		}
+		key, value, ok := strings.Cut(line, "=")
+		if !ok {
+			return nil, fmt.Errorf("%s:%d: expected key = value", name, number)
+		}
+		lines = append(lines, iniLine{
+			number:  number,
+			section: section,
+			key:     strings.TrimSpace(key),
+			value:   strings.TrimSpace(value),
+		})
+	}
+	return lines, scanner.Err()
+}
+
+func isEditorConfigRoot(name string) (bool, error) {
+	lines, err := readINI(name)
+	if err != nil {
+		return false, err
+	}
+	for _, l := range lines {
+		if l.section == "" && strings.EqualFold(l.key, "root") {
+			return strings.EqualFold(l.value, "true"), nil
+		}
+	}
+	return false, nil
+}
+
+// readEditorConfig sets props to the values of the properties in the
+// .editorconfig file called name that apply to path.
+func readEditorConfig(name, path string, props map[string]string) error {
+	lines, err := readINI(name)
+	if err != nil {
+		return err
+	}
+	rel, err := filepath.Rel(filepath.Dir(name), path)
+	if err != nil {
+		return err
+	}
+	rel = filepath.ToSlash(rel)
+	matches := map[string]bool{}
+	for _, l := range lines {
+		if l.section == "" {
+			continue
+		}
+		match, ok := matches[l.section]
+		if !ok {
+			re, err := editorConfigPattern(l.section)
+			if err != nil {
+				return fmt.Errorf("%s:%d: %w", name, l.number, err)
+			}
+			match = re.MatchString(rel)
+			matches[l.section] = match
+		}
+		if match {
+			props[strings.ToLower(l.key)] = strings.ToLower(l.value)
+		}
+	}
+	return nil
+}
+
+// editorConfigPattern converts an .editorconfig section glob to a regular
+// expression matching paths relative to the directory of the file.
+// https://spec.editorconfig.org/#glob-expressions
+func editorConfigPattern(glob string) (*regexp.Regexp, error) {
+	var sb strings.Builder
+	sb.WriteString("^")
+	if !strings.Contains(glob, "/") {
+		sb.WriteString("(?:.*/)?")
+	}
+	glob = strings.TrimPrefix(glob, "/")
+	var braces int
+	for i := 0; i < len(glob); i++ {
+		c := glob[i]
+		switch {
+		case c == '\\' && i+1 < len(glob):
+			i++
+			sb.WriteString(regexp.QuoteMeta(glob[i : i+1]))
+		case c == '*' && strings.HasPrefix(glob[i:], "**"):
+			i++
+			sb.WriteString(".*")
+		case c == '*':
+			sb.WriteString("[^/]*")
+		case c == '?':
+			sb.WriteString("[^/]")
+		case c == '[':
+			end := strings.IndexByte(glob[i:], ']')
+			if end < 0 {
+				sb.WriteString(`\[`)
+				continue
+			}
+			class := glob[i+1 : i+end]
+			if strings.HasPrefix(class, "!") {
+				class = "^" + class[1:]
+			}
+			sb.WriteString("[" + class + "]")
+			i += end
+		case c == '{':
+			end := strings.IndexByte(glob[i:], '}')
+			if end > 0 && isNumericRange(glob[i+1:i+end]) {
+				// Numeric ranges match any integer.
+				sb.WriteString("[+-]?[0-9]+")
+				i += end
+				continue
+			}
+			braces++
+			sb.WriteString("(?:")
+		case c == '}' && braces > 0:
+			braces--
+			sb.WriteString(")")
+		case c == ',' && braces > 0:
+			sb.WriteString("|")
+		default:
+			sb.WriteString(regexp.QuoteMeta(glob[i : i+1]))
+		}
+	}
+	if braces > 0 {
+		return nil, fmt.Errorf("unclosed brace in section %q", glob)
+	}
+	sb.WriteString("$")
+	return regexp.Compile(sb.String())
+}
+
+func isNumericRange(s string) bool {
+	lo, hi, ok := strings.Cut(s, "..")
+	if !ok {
+		return false
+	}
+	_, errLo := strconv.Atoi(lo)
+	_, errHi := strconv.Atoi(hi)
+	return errLo == nil && errHi == nil
+}
+
+func (f *Formatter) applyEditorConfig(props map[string]string) {
+	size := props["indent_size"]
+	if size == "tab" {
+		size = props["tab_width"]
+	}
+	switch props["indent_style"] {
+	case "tab":
+		f.Indent = "\t"
+	case "space", "":
+		if n, err := strconv.Atoi(size); err == nil && n > 0 {
+			f.Indent = strings.Repeat(" ", n)
+		}
+	}
+	if eol, ok := newlines[props["end_of_line"]]; ok {
+		f.Newline = eol
+	}
+	if n, err := strconv.Atoi(props["max_line_length"]); err == nil && n > 0 {
+		f.PrintWidth = n
+	}
+}
+
+var newlines = map[string]string{
+	"lf":   "\n",
+	"crlf": "\r\n",
+	"cr":   "\r",
+}
+
+var errConfigType = errors.New("unexpected value type")
+
+// readProjectConfig applies the settings in the .htmlformat.toml file called
+// name. Only the subset of TOML needed for the settings is supported: strings,
+// integers, booleans and single line arrays of strings.
+func (f *Formatter) readProjectConfig(name string) error {
+	lines, err := readINI(name)
+	if err != nil {
+		return err
+	}
+	for _, l := range lines {
+		if l.section != "" && l.section != "elements" && l.section != "child_indent" {
+			return fmt.Errorf("%s:%d: unexpected table [%s]", name, l.number, l.section)
+		}
+		v, err := parseTOMLValue(l.value)
+		switch {
+		case err != nil:
+		case l.section == "elements":
+			err = f.setElementBehavior(l.key, v)
+		case l.section == "child_indent":
+			err = f.setChildIndent(l.key, v)
+		default:
+			err = f.setConfigValue(l.key, v)
+		}
+		if err != nil {
+			return fmt.Errorf("%s:%d: %s: %w", name, l.number, l.key, err)
+		}
+	}
+	return nil
+}
+
+// SetOption applies the .htmlformat.toml setting called key, such as
+// "print_width", to f, so that settings can be read from elsewhere, such as
+// the options object of the JavaScript bindings. value is a string, int, bool
+// or []string, as the value would be in the file.
+func (f *Formatter) SetOption(key string, value any) error {
+	if err := f.setConfigValue(key, value); err != nil {
+		return fmt.Errorf("%s: %w", key, err)
+	}
+	return nil
+}
+
+func (f *Formatter) setConfigValue(key string, v any) (err error) {
+	switch key {
+	case "mode":
+		var s string
+		if s, err = configString(v); err != nil {
+			return err
+		}
+		switch s {
+		case "pretty":
+			f.Mode = Pretty
+		case "minify":
+			f.Mode = Minify
+		default:
+			return fmt.Errorf("unknown mode %q", s)
+		}
+	case "indent":
+		if n, ok := v.(int); ok {
+			f.Indent = strings.Repeat(" ", n)
+			return nil
+		}
+		f.Indent, err = configString(v)
+	case "newline":
+		var s string
+		if s, err = configString(v); err != nil {
+			return err
+		}
+		if strings.EqualFold(s, DetectNewline) {
+			f.Newline = DetectNewline
+			return nil
+		}
+		eol, ok := newlines[strings.ToLower(s)]
+		if !ok {
+			return fmt.Errorf("unknown newline %q", s)
+		}
+		f.Newline = eol
+	case "normalize_newlines":
+		f.NormalizeNewlines, err = configBool(v)
+	case "print_width":
+		f.PrintWidth, err = configInt(v)
+	case "max_blank_lines":
+		f.MaxBlankLines, err = configInt(v)
+	case "flat_document":
+		f.FlatDocument, err = configBool(v)
+	case "wrap_comments":
+		f.WrapComments, err = configBool(v)
+	case "wrap_text":
+		f.WrapText, err = configBool(v)
+	case "sort_attributes":
+		f.SortAttributes, err = configBool(v)
+	case "attribute_priority":
+		f.AttributePriority, err = configStrings(v)
+	case "drop_empty_attributes":
+		f.DropEmptyAttributes, err = configBool(v)
+	case "sort_classes":
+		f.SortClasses, err = configBool(v)
+	case "normalize_styles":
+		f.NormalizeStyles, err = configBool(v)
+	case "style_semicolon":
+		var s string
+		if s, err = configString(v); err != nil {
+			return err
+		}
+		err = f.StyleSemicolon.Set(s)
+	case "wrap_attribute_values":
+		f.WrapAttributeValues, err = configBool(v)
+	case "format_srcdoc":
+		f.FormatSrcdoc, err = configBool(v)
+	case "self_close":
+		f.SelfClose, err = configBool(v)
+	case "omit_end_tags":
+		f.OmitEndTags, err = configBool(v)
+	case "omit_implied":
+		f.OmitImplied, err = configBool(v)
+	case "xhtml":
+		f.XHTML, err = configBool(v)
+	case "email":
+		f.Email, err = configBool(v)
+	case "quotes":
+		var s string
+		if s, err = configString(v); err != nil {
+			return err
+		}
+		err = f.Quotes.Set(s)
+	case "case":
+		var s string
+		if s, err = configString(v); err != nil {
+			return err
+		}
+		err = f.Case.Set(s)
+	case "boolean_attributes":
+		var s string
+		if s, err = configString(v); err != nil {
+			return err
+		}
+		err = f.Booleans.Set(s)
+	case "bracket_same_line":
+		f.BracketSameLine, err = configBool(v)
+	case "attribute_alignment":
+		var s string
+		if s, err = configString(v); err != nil {
+			return err
+		}
+		err = f.AttributeAlignment.Set(s)
+	case "duplicate_attributes":
+		var s string
+		if s, err = configString(v); err != nil {
+			return err
+		}
+		err = f.DuplicateAttributes.Set(s)
+	case "doctype":
+		var s string
+		if s, err = configString(v); err != nil {
+			return err
+		}
+		err = f.Doctype.Set(s)
+	case "trailing_newline":
+		var s string
+		if s, err = configString(v); err != nil {
+			return err
+		}
+		err = f.TrailingNewline.Set(s)
+	case "charset":
+		var s string
+		if s, err = configString(v); err != nil {
+			return err
+		}
+		err = f.Charset.Set(s)
+	case "strip_comments":
+		f.StripComments, err = configBool(v)
+	case "keep_comments":
+		f.KeepComments, err = configStrings(v)
+	case "max_print_depth":
+		f.MaxPrintDepth, err = configInt(v)
+	case "preserve":
+		f.Preserve, err = configStrings(v)
+	case "void_elements":
+		var names []string
+		if names, err = configStrings(v); err != nil {
+			return err
+		}
+		for _, name := range names {
+			if err = f.setElementBehavior(name, VoidElement.String()); err != nil {
+				return err
+			}
+		}
+	case "sanitize":
+		var sanitize bool
+		if sanitize, err = configBool(v); err == nil {
+			f.Sanitizer = nil
+			if sanitize {
+				f.Sanitizer = UGCPolicy()
+			}
+		}
+	case "max_bytes":
+		f.MaxBytes, err = configInt(v)
+	case "max_depth":
+		f.MaxDepth, err = configInt(v)
+	case "max_nodes":
+		f.MaxNodes, err = configInt(v)
+	case "verify":
+		f.Verify, err = configBool(v)
+	case "named_entities":
+		f.NamedEntities, err = configBool(v)
+	case "inline_elements":
+		if s, ok := v.(string); ok && s == "default" {
+			f.InlineElements = DefaultInlineElements
+			return nil
+		}
+		f.InlineElements, err = configStrings(v)
+	case "single_line_elements":
+		if s, ok := v.(string); ok && s == "default" {
+			f.SingleLineElements = DefaultSingleLineElements
+			return nil
+		}
+		f.SingleLineElements, err = configStrings(v)
+	case "whitespace_sensitivity":
+		var s string
+		if s, err = configString(v); err != nil {
+			return err
+		}
+		err = f.Whitespace.Set(s)
+	case "wrap_cdata":
+		f.WrapCDATA, err = configBool(v)
+	case "format_json":
+		f.FormatJSON, err = configBool(v)
+	case "keep_invalid_json":
+		f.KeepInvalidJSON, err = configBool(v)
+	case "minified_line_length":
+		f.MinifiedLineLength, err = configInt(v)
+	case "strict":
+		f.Strict, err = configBool(v)
+	case "template":
+		var s string
+		if s, err = configString(v); err != nil {
+			return err
+		}
+		ts, ok := LookupTemplateSyntax(s)
+		if !ok {
+			return fmt.Errorf("unknown template syntax %q", s)
+		}
+		f.Template = ts
+	case "component":
+		var s string
+		if s, err = configString(v); err != nil {
+			return err
+		}
+		cs, ok := LookupComponentSyntax(s)
+		if !ok {
+			return fmt.Errorf("unknown component syntax %q", s)
+		}
+		f.Component = cs
+	case "template_delimiters":
+		var pairs []string
+		if pairs, err = configStrings(v); err != nil {
+			return err
+		}
+		ts := f.customTemplate()
+		ts.Delimiters = nil
+		for _, pair := range pairs {
+			lr := strings.Fields(pair)
+			if len(lr) != 2 {
+				return fmt.Errorf("expected a left and right delimiter separated by a space, got %q", pair)
+			}
+			ts.Delimiters = append(ts.Delimiters, TemplateDelimiter{Left: lr[0], Right: lr[1]})
+		}
+	case "template_open", "template_middle", "template_close":
+		var s string
+		if s, err = configString(v); err != nil {
+			return err
+		}
+		re, err := regexp.Compile(s)
+		if err != nil {
+			return err
+		}
+		ts := f.customTemplate()
+		switch key {
+		case "template_open":
+			ts.Open = re
+		case "template_middle":
+			ts.Middle = re
+		case "template_close":
+			ts.Close = re
+		}
+	default:
+		return errors.New("unknown setting")
+	}
+	return err
+}
+
+// setElementBehavior registers the behavior of the element called name, from
+// a key of the [elements] table.
+func (f *Formatter) setElementBehavior(name string, v any) error {
+	s, err := configString(v)
+	if err != nil {
+		return err
+	}
+	var b ElementBehavior
+	if err = b.Set(s); err != nil {
+		return err
+	}
+	if f.Elements == nil {
+		f.Elements = make(map[string]ElementBehavior)
+	}
+	f.Elements[name] = b
+	return nil
+}
+
+func (f *Formatter) setChildIndent(name string, v any) error {
+	levels, err := configInt(v)
+	if err != nil {
+		return err
+	}
+	if f.ChildIndent == nil {
+		f.ChildIndent = make(map[string]int)
+	}
+	f.ChildIndent[name] = levels
+	return nil
+}
+
+// customTemplate returns a copy of the template syntax of f, which can be
+// modified without changing the predefined syntaxes, and sets it on f.
+func (f *Formatter) customTemplate() *TemplateSyntax {
+	ts := &TemplateSyntax{}
+	if f.Template != nil {
+		*ts = *f.Template
+	}
+	f.Template = ts
+	return ts
+}
+
+func configString(v any) (string, error) {
+	if s, ok := v.(string); ok {
+		return s, nil
+	}
+	return "", errConfigType
+}
+
+func configInt(v any) (int, error) {
+	if n, ok := v.(int); ok {
+		return n, nil
+	}
+	return 0, errConfigType
+}
+
+func configBool(v any) (bool, error) {
+	if b, ok := v.(bool); ok {
+		return b, nil
+	}
+	return false, errConfigType
+}
+
+func configStrings(v any) ([]string, error) {
+	if ss, ok := v.([]string); ok {
+		return ss, nil
+	}
+	return nil, errConfigType
+}
+
+// parseTOMLValue parses a string, integer, boolean, or array of strings.
+func parseTOMLValue(s string) (v any, err error) {
+	s = stripTOMLComment(s)
+	switch {
+	case s == "true":
+		return true, nil
+	case s == "false":
+		return false, nil
+	case strings.HasPrefix(s, "["):
+		if !strings.HasSuffix(s, "]") {
+			return nil, errors.New("arrays must be on a single line")
+		}
+		var ss []string
+		for _, item := range splitTOMLArray(s[1 : len(s)-1]) {
+			str, err := parseTOMLString(item)
+			if err != nil {
+				return nil, err
+			}
+			ss = append(ss, str)
+		}
+		return ss, nil
+	case strings.HasPrefix(s, `"`), strings.HasPrefix(s, "'"):
+		return parseTOMLString(s)
+	}
+	n, err := strconv.Atoi(strings.ReplaceAll(s, "_", ""))
+	if err != nil {
+		return nil, fmt.Errorf("invalid value %q", s)
+	}
+	return n, nil
+}
+
+func parseTOMLString(s string) (string, error) {
+	if len(s) >= 2 && s[0] == '\'' && s[len(s)-1] == '\'' {
+		return s[1 : len(s)-1], nil
+	}
+	str, err := strconv.Unquote(s)
+	if err != nil || !strings.HasPrefix(s, `"`) {
+		return "", fmt.Errorf("invalid string %s", s)
+	}
+	return str, nil
+}
+
+// stripTOMLComment removes a trailing comment from the value s.
+func stripTOMLComment(s string) string {
+	var quote byte
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case quote != 0 && c == '\\' && quote == '"':
+			i++
+		case quote != 0 && c == quote:
+			quote = 0
+		case quote == 0 && (c == '"' || c == '\''):
+			quote = c
+		case quote == 0 && c == '#':
+			return strings.TrimSpace(s[:i])
+		}
+	}
+	return s
+}
+
+// splitTOMLArray splits the items of an array, ignoring commas in strings and
+// a trailing comma.
+func splitTOMLArray(s string) (items []string) {
+	var quote byte
+	start := 0
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case quote != 0 && c == '\\' && quote == '"':
+			i++
+		case quote != 0 && c == quote:
+			quote = 0
+		case quote == 0 && (c == '"' || c == '\''):
+			quote = c
+		case quote == 0 && c == ',':
+			items = append(items, strings.TrimSpace(s[start:i]))
+			start = i + 1
+		}
+	}
+	if last := strings.TrimSpace(s[start:]); last != "" {
+		items = append(items, last)
+	}
+	return items
+}
@@ -0,0 +1,342 @@
+package htmlformat
+
+import (
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+)
+
+// formatterOptions compare Formatters, treating regular expressions as equal
+// if they have the same source.
+var formatterOptions = []cmp.Option{
+	cmpopts.IgnoreUnexported(Formatter{}),
+	cmp.Comparer(func(a, b *regexp.Regexp) bool {
+		return a == nil && b == nil || a != nil && b != nil && a.String() == b.String()
+	}),
+}
+
+func writeFiles(t *testing.T, files map[string]string) (dir string) {
+	t.Helper()
+	dir = t.TempDir()
+	for name, content := range files {
+		name = filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(name), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(name, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func TestLoadConfig(t *testing.T) {
+	tests := []struct {
+		name     string
+		files    map[string]string
+		path     string
+		expected Formatter
+	}{
+		{
+			name:     "no configuration files give the default settings",
+			files:    map[string]string{},
+			path:     "index.html",
+			expected: Formatter{},
+		},
+		{
+			name: "editorconfig sections matching the file are applied",
+			files: map[string]string{
+				".editorconfig": `root = true
+
+[*]
+indent_style = space
+indent_size = 4
+end_of_line = crlf
+
+[*.{html,htm}]
+indent_size = 2
+max_line_length = 100
+
+[*.go]
+indent_style = tab
+`,
+			},
+			path:     "web/index.html",
+			expected: Formatter{Indent: "  ", Newline: "\r\n", PrintWidth: 100},
+		},
+		{
+			name: "nearer editorconfig files take precedence until a root",
+			files: map[string]string{
+				".editorconfig":     "[*]\nindent_size = 8\nend_of_line = cr\n",
+				"a/.editorconfig":   "root = true\n[*]\nindent_size = 4\n",
+				"a/b/.editorconfig": "[*.html]\nindent_style = tab\n",
+			},
+			path:     "a/b/index.html",
+			expected: Formatter{Indent: "\t"},
+		},
+		{
+			name: "editorconfig path globs are relative to the file",
+			files: map[string]string{
+				".editorconfig": "[templates/**.html]\nindent_size = 3\n",
+			},
+			path:     "templates/a/index.html",
+			expected: Formatter{Indent: "   "},
+		},
+		{
+			name: "project configuration overrides editorconfig",
+			files: map[string]string{
+				".editorconfig": "[*]\nindent_size = 4\n",
+				ConfigFileName: `# House style.
+indent = "\t"
+newline = "crlf"
+normalize_newlines = true
+print_width = 120
+max_blank_lines = 1
+flat_document = true
+wrap_comments = true
+wrap_text = true
+sort_attributes = true
+attribute_priority = ["id", "class", '*', "data-*"] # data attributes last
+drop_empty_attributes = true
+sort_classes = true
+normalize_styles = true
+style_semicolon = "forbid"
+wrap_attribute_values = true
+format_srcdoc = true
+self_close = true
+omit_end_tags = true
+omit_implied = true
+xhtml = true
+email = true
+strict = true
+verify = true
+max_bytes = 1000000
+max_depth = 100
+max_nodes = 1000
+quotes = "single"
+case = "upper"
+boolean_attributes = "minimal"
+duplicate_attributes = "first"
+attribute_alignment = "align"
+bracket_same_line = true
+doctype = "html5"
+named_entities = true
+strip_comments = true
+keep_comments = ["!", "Copyright"]
+max_print_depth = 4
+preserve = ["pre.highlight", ".raw"]
+sanitize = true
+charset = "transcode"
+trailing_newline = "forbid"
+inline_elements = "default"
+single_line_elements = ["title", "button"]
+whitespace_sensitivity = "css"
+wrap_cdata = true
+format_json = true
+keep_invalid_json = true
+minified_line_length = 4096
+mode = "minify"
+template = "go"
+component = "svelte"
+void_elements = ["spacer"]
+
+[elements]
+my-icon = "void"
+code-block = "preformatted"
+
+[child_indent]
+ul = 0
+`,
+			},
+			path: "index.html",
+			expected: Formatter{
+				Mode:                Minify,
+				Indent:              "\t",
+				Newline:             "\r\n",
+				NormalizeNewlines:   true,
+				PrintWidth:          120,
+				MaxBlankLines:       1,
+				FlatDocument:        true,
+				WrapComments:        true,
+				WrapText:            true,
+				SortAttributes:      true,
+				AttributePriority:   []string{"id", "class", "*", "data-*"},
+				DropEmptyAttributes: true,
+				SortClasses:         true,
+				NormalizeStyles:     true,
+				StyleSemicolon:      ForbidSemicolon,
+				WrapAttributeValues: true,
+				FormatSrcdoc:        true,
+				SelfClose:           true,
+				OmitEndTags:         true,
+				OmitImplied:         true,
+				XHTML:               true,
+				Email:               true,
+				Template:            GoTemplate,
+				Component:           SvelteComponent,
+				Strict:              true,
+				Verify:              true,
+				MaxBytes:            1000000,
+				MaxDepth:            100,
+				MaxNodes:            1000,
+				Quotes:              SingleQuotes,
+				Case:                UppercaseTags,
+				Booleans:            MinimalBooleans,
+				DuplicateAttributes: FirstDuplicate,
+				AttributeAlignment:  AlignAttributes,
+				BracketSameLine:     true,
+				Doctype:             HTML5Doctype,
+				NamedEntities:       true,
+				StripComments:       true,
+				KeepComments:        []string{"!", "Copyright"},
+				MaxPrintDepth:       4,
+				Preserve:            []string{"pre.highlight", ".raw"},
+				Sanitizer:           UGCPolicy(),
+				Charset:             TranscodeCharset,
+				TrailingNewline:     ForbidTrailingNewline,
+				InlineElements:      DefaultInlineElements,
+				SingleLineElements:  []string{"title", "button"},
+				Whitespace:          CSSWhitespace,
+				WrapCDATA:           true,
+				FormatJSON:          true,
+				KeepInvalidJSON:     true,
+				MinifiedLineLength:  4096,
+				Elements:            map[string]ElementBehavior{"my-icon": VoidElement, "code-block": PreformattedElement, "spacer": VoidElement},
+				ChildIndent:         map[string]int{"ul": 0},
+			},
+		},
+		{
+			name: "template syntaxes can be described in project configuration",
+			files: map[string]string{
+				ConfigFileName: `template_delimiters = ["[[ ]]", "[% %]"]
+template_open = '^(if|for)\b'
+template_close = '^end$'
+`,
+			},
+			path: "index.html",
+			expected: Formatter{
+				Template: &TemplateSyntax{
+					Delimiters: []TemplateDelimiter{{Left: "[[", Right: "]]"}, {Left: "[%", Right: "%]"}},
+					Open:       regexp.MustCompile(`^(if|for)\b`),
+					Close:      regexp.MustCompile(`^end$`),
+				},
+			},
+		},
+		{
+			name:     "the template syntax is set from the file extension",
+			files:    map[string]string{},
+			path:     "views/index.html.erb",
+			expected: Formatter{Template: ERB},
+		},
+		{
+			name: "project configuration overrides the template syntax of the file extension",
+			files: map[string]string{
+				ConfigFileName: "template = \"jinja\"\n",
+			},
+			path:     "index.hbs",
+			expected: Formatter{Template: Jinja},
+		},
+		{
+			name:     "the component syntax is set from the file extension",
+			files:    map[string]string{},
+			path:     "src/App.vue",
+			expected: Formatter{Component: VueComponent},
+		},
+		{
+			name: "the nearest project configuration is used",
+			files: map[string]string{
+				ConfigFileName:           "indent = 4\n",
+				"site/" + ConfigFileName: "indent = 2\n",
+			},
+			path:     "site/index.html",
+			expected: Formatter{Indent: "  "},
+		},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			dir := writeFiles(t, test.files)
+			actual, err := LoadConfig(filepath.Join(dir, test.path))
+			if err != nil {
+				t.Fatalf("failed to load config: %v", err)
+			}
+			if diff := cmp.Diff(test.expected, actual, formatterOptions...); diff != "" {
+				t.Error(diff)
+			}
+		})
+	}
+}
+
+func TestLoadConfigErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		config string
+	}{
+		{
+			name:   "unknown settings",
+			config: "indnet = 2\n",
+		},
+		{
+			name:   "values of the wrong type",
+			config: "print_width = \"wide\"\n",
+		},
+		{
+			name:   "unknown modes",
+			config: "mode = \"ugly\"\n",
+		},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			dir := writeFiles(t, map[string]string{ConfigFileName: test.config})
+			if _, err := LoadConfig(filepath.Join(dir, "index.html")); err == nil {
+				t.Error("expected an error")
+			}
+		})
+	}
+}
+
+func TestLoadConfigREADMEExample(t *testing.T) {
+	readme, err := os.ReadFile("README.md")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The example is the TOML block that lists the settings, starting with
+	// the mode.
+	_, example, ok := strings.Cut(string(readme), "```toml\nmode = ")
+	if !ok {
+		t.Fatal("the README has no example configuration")
+	}
+	example, _, _ = strings.Cut(example, "```")
+	dir := writeFiles(t, map[string]string{ConfigFileName: "mode = " + example})
+	if _, err := LoadConfig(filepath.Join(dir, "index.html")); err != nil {
+		t.Errorf("failed to load the README example: %v", err)
+	}
+}
+
+func TestSetOption(t *testing.T) {
+	var f Formatter
+	for key, value := range map[string]any{"print_width": 80, "sort_attributes": true, "template": "go", "keep_comments": []string{"!"}} {
+		if err := f.SetOption(key, value); err != nil {
+			t.Fatalf("failed to set %s: %v", key, err)
+		}
+	}
+	expected := Formatter{PrintWidth: 80, SortAttributes: true, Template: GoTemplate, KeepComments: []string{"!"}}
+	if diff := cmp.Diff(expected, f, formatterOptions...); diff != "" {
+		t.Error(diff)
+	}
+	if err := f.SetOption("print_width", "80"); err == nil || err.Error() != "print_width: unexpected value type" {
+		t.Errorf("expected a type error, got %v", err)
+	}
+}
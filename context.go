@@ -0,0 +1,67 @@
+package htmlformat
+
+import (
+	"context"
+	"io"
+)
+
+// DocumentContext formats a HTML document with the default settings, unless
+// ctx is done first.
+func DocumentContext(ctx context.Context, w io.Writer, r io.Reader) (err error) {
+	return new(Formatter).DocumentContext(ctx, w, r)
+}
+
+// FragmentContext formats a fragment of a HTML document with the default
+// settings, unless ctx is done first.
+func FragmentContext(ctx context.Context, w io.Writer, r io.Reader) (err error) {
+	return new(Formatter).FragmentContext(ctx, w, r)
+}
+
+// StreamContext formats HTML read from r with bounded memory, using the
+// default settings, unless ctx is done first.
+func StreamContext(ctx context.Context, w io.Writer, r io.Reader) (err error) {
+	return new(Formatter).StreamContext(ctx, w, r)
+}
+
+// DocumentContext formats a HTML document like Document, checking ctx between
+// the stages of formatting and the nodes that are written, so that
+// pathological documents cannot hold up a server for long. If ctx is done
+// first, the error is ctx.Err(), and the output written by then is
+// incomplete.
+func (f *Formatter) DocumentContext(ctx context.Context, w io.Writer, r io.Reader) (err error) {
+	p := f.newPrinter()
+	p.ctx = ctx
+	return p.document(w, r)
+}
+
+// FragmentContext formats a fragment of a HTML document like Fragment,
+// unless ctx is done first, as DocumentContext does.
+func (f *Formatter) FragmentContext(ctx context.Context, w io.Writer, r io.Reader) (err error) {
+	p := f.newPrinter()
+	p.ctx = ctx
+	return p.fragment(w, r, "")
+}
+
+// FragmentInContextWithContext formats a fragment of a HTML document like
+// FragmentInContext, unless ctx is done first, as DocumentContext does.
+func (f *Formatter) FragmentInContextWithContext(ctx context.Context, w io.Writer, r io.Reader, contextTag string) (err error) {
+	p := f.newPrinter()
+	p.ctx = ctx
+	return p.fragment(w, r, contextTag)
+}
+
+// StreamContext formats HTML like Stream, checking ctx between tokens, unless
+// ctx is done first.
+func (f *Formatter) StreamContext(ctx context.Context, w io.Writer, r io.Reader) (err error) {
+	p := f.newPrinter()
+	p.ctx = ctx
+	return p.stream(w, r)
+}
+
+// checkContext returns the error of the printer's context, if it is done.
+func (p *printer) checkContext() error {
+	if p.ctx == nil {
+		return nil
+	}
+	return p.ctx.Err()
+}
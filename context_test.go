@@ -0,0 +1,86 @@
+package htmlformat
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"golang.org/x/net/html"
+)
+
+func TestContext(t *testing.T) {
+	src := strings.Repeat("<div><p>a</p></div>", 100)
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	tests := []struct {
+		name   string
+		format func(ctx context.Context) error
+	}{
+		{
+			name: "document",
+			format: func(ctx context.Context) error {
+				return DocumentContext(ctx, new(strings.Builder), strings.NewReader(src))
+			},
+		},
+		{
+			name: "fragment",
+			format: func(ctx context.Context) error {
+				return FragmentContext(ctx, new(strings.Builder), strings.NewReader(src))
+			},
+		},
+		{
+			name: "fragment in context",
+			format: func(ctx context.Context) error {
+				return new(Formatter).FragmentInContextWithContext(ctx, new(strings.Builder), strings.NewReader("<tr><td>a</td></tr>"), "tbody")
+			},
+		},
+		{
+			name: "minified fragment",
+			format: func(ctx context.Context) error {
+				f := Formatter{Mode: Minify}
+				return f.FragmentContext(ctx, new(strings.Builder), strings.NewReader(src))
+			},
+		},
+		{
+			name: "stream",
+			format: func(ctx context.Context) error {
+				return StreamContext(ctx, new(strings.Builder), strings.NewReader(src))
+			},
+		},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			if err := test.format(context.Background()); err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+			if err := test.format(cancelled); !errors.Is(err, context.Canceled) {
+				t.Errorf("expected context.Canceled, got %v", err)
+			}
+		})
+	}
+}
+
+func TestContextCancelledWhilePrinting(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	var visited int
+	f := Formatter{
+		OnNode: func(n *html.Node) NodeAction {
+			if visited++; visited == 10 {
+				cancel()
+			}
+			return KeepNode
+		},
+	}
+	var sb strings.Builder
+	err := f.FragmentContext(ctx, &sb, strings.NewReader(strings.Repeat("<p>a</p>", 100)))
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("expected context.Canceled, got %v", err)
+	}
+}
@@ -0,0 +1,88 @@
+package htmlformat
+
+import (
+	"bytes"
+	"io"
+
+	"github.com/a-h/htmlformat/internal/diff"
+)
+
+// Diff returns a unified diff of the lines of original and formatted, such as
+// a file and its formatted output, or nil if they are the same.
+func Diff(original, formatted io.Reader) ([]byte, error) {
+	a, err := io.ReadAll(original)
+	if err != nil {
+		return nil, err
+	}
+	b, err := io.ReadAll(formatted)
+	if err != nil {
+		return nil, err
+	}
+	return diff.Unified("original", "formatted", a, b), nil
+}
+
+// DiffDocument formats the HTML document src and returns a unified diff of
+// what formatting would change, or nil if src is already formatted. name is
+// used in the file headers of the diff, as name.orig and name.
+func (f *Formatter) DiffDocument(name string, src []byte) ([]byte, error) {
+	var out bytes.Buffer
+	if err := f.Document(&out, bytes.NewReader(src)); err != nil {
+		return nil, err
+	}
+	return diff.Unified(name+".orig", name, src, out.Bytes()), nil
+}
+
+// DiffFragment formats the fragment of a HTML document src and returns a
+// unified diff of what formatting would change, like DiffDocument.
+func (f *Formatter) DiffFragment(name string, src []byte) ([]byte, error) {
+	var out bytes.Buffer
+	if err := f.Fragment(&out, bytes.NewReader(src)); err != nil {
+		return nil, err
+	}
+	return diff.Unified(name+".orig", name, src, out.Bytes()), nil
+}
+
+// DocumentChanged reports whether formatting the HTML document read from r
+// would change it, comparing the output with the input as it is written
+// rather than holding both.
+func (f *Formatter) DocumentChanged(r io.Reader) (bool, error) {
+	return f.changed(r, f.Document)
+}
+
+// FragmentChanged reports whether formatting the fragment of a HTML document
+// read from r would change it, like DocumentChanged.
+func (f *Formatter) FragmentChanged(r io.Reader) (bool, error) {
+	return f.changed(r, f.Fragment)
+}
+
+func (f *Formatter) changed(r io.Reader, format func(w io.Writer, r io.Reader) error) (bool, error) {
+	if f.MaxBytes > 0 {
+		r = &limitReader{r: r, max: f.MaxBytes}
+	}
+	src, err := io.ReadAll(r)
+	if err != nil {
+		return false, err
+	}
+	cw := &compareWriter{src: src}
+	if err = format(cw, bytes.NewReader(src)); err != nil {
+		return false, err
+	}
+	return cw.differs || cw.n != len(src), nil
+}
+
+// compareWriter records whether what is written to it differs from src.
+type compareWriter struct {
+	src     []byte
+	n       int
+	differs bool
+}
+
+func (cw *compareWriter) Write(b []byte) (int, error) {
+	if !cw.differs {
+		if cw.n+len(b) > len(cw.src) || !bytes.Equal(b, cw.src[cw.n:cw.n+len(b)]) {
+			cw.differs = true
+		}
+		cw.n += len(b)
+	}
+	return len(b), nil
+}
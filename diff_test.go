@@ -0,0 +1,91 @@
+package htmlformat
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestDiff(t *testing.T) {
+	out, err := Diff(strings.NewReader("<p>a</p>\n<p>b</p>\n"), strings.NewReader("<p>a</p>\n<p>c</p>\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `--- original
++++ formatted
+@@ -1,2 +1,2 @@
+ <p>a</p>
+-<p>b</p>
++<p>c</p>
+`
+	if diff := cmp.Diff(expected, string(out)); diff != "" {
+		t.Error(diff)
+	}
+}
+
+func TestDiffFragment(t *testing.T) {
+	f := &Formatter{}
+	out, err := f.DiffFragment("a.html", []byte("<ul><li>a</li></ul>\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `--- a.html.orig
++++ a.html
+@@ -1 +1,3 @@
+-<ul><li>a</li></ul>
++<ul>
++ <li>a</li>
++</ul>
+`
+	if diff := cmp.Diff(expected, string(out)); diff != "" {
+		t.Error(diff)
+	}
+	if out, err = f.DiffFragment("a.html", []byte("<p>a</p>\n")); out != nil || err != nil {
+		t.Errorf("expected no diff for formatted input, got %q, %v", out, err)
+	}
+}
+
+func TestFragmentChanged(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected bool
+	}{
+		{
+			name:     "formatted input is unchanged",
+			input:    "<ul>\n <li>a</li>\n</ul>\n",
+			expected: false,
+		},
+		{
+			name:     "reindented input is changed",
+			input:    "<ul><li>a</li></ul>\n",
+			expected: true,
+		},
+		{
+			name:     "a prefix of the output is changed",
+			input:    "<p>a</p>",
+			expected: true,
+		},
+		{
+			name:     "trailing input is changed",
+			input:    "<p>a</p>\n\n\n",
+			expected: true,
+		},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			changed, err := new(Formatter).FragmentChanged(strings.NewReader(test.input))
+			if err != nil {
+				t.Fatalf("failed to format: %v", err)
+			}
+			if changed != test.expected {
+				t.Errorf("expected changed to be %v, got %v", test.expected, changed)
+			}
+		})
+	}
+}
@@ -0,0 +1,295 @@
+package htmlformat
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// Formatting is disabled between <!-- htmlformat:off --> and
+// <!-- htmlformat:on --> comments. The directives and everything between them
+// are written exactly as they appear in the input. A region must be balanced
+// within the element that the off directive is in: without an on directive
+// in that element, it ends at the element's end tag, or the end of the input.
+var (
+	offDirective = regexp.MustCompile(`^<!--\s*htmlformat:off\s*-->$`)
+	onDirective  = regexp.MustCompile(`^<!--\s*htmlformat:on\s*-->$`)
+)
+
+// baseVerbatimPrefix starts the content of the comments that stand in for
+// regions where formatting is disabled.
+const baseVerbatimPrefix = "htmlformat:verbatim:"
+
+// setVerbatimPrefix chooses the prefix of the placeholder comments for the
+// input src: baseVerbatimPrefix, followed by a number if it is needed for the
+// prefix not to appear in src, so that the input cannot have a comment that
+// is taken for a placeholder.
+func (p *printer) setVerbatimPrefix(src []byte) {
+	prefix := baseVerbatimPrefix
+	for i := 1; bytes.Contains(src, []byte(prefix)); i++ {
+		prefix = baseVerbatimPrefix + strconv.Itoa(i) + ":"
+	}
+	p.verbatimPrefix = prefix
+	p.verbatimComment = regexp.MustCompile(`<!--` + regexp.QuoteMeta(prefix) + `\d+-->`)
+}
+
+// headTags holds the elements that do not start the body of a document.
+var headTags = map[string]bool{
+	"html": true, "head": true, "base": true, "link": true, "meta": true, "noscript": true,
+	"script": true, "style": true, "template": true, "title": true,
+}
+
+// extractVerbatim replaces each region of src that formatting is disabled
+// for with a placeholder comment, so that the parser cannot alter it. The
+// elements open at each token are tracked, so that a region does not take
+// the end tags of the elements around it, which would move the content after
+// it into them. In a document, an off directive outside of the body, where
+// the parser would move the markup of the region, is an ordinary comment.
+func (p *printer) extractVerbatim(src []byte) []byte {
+	if !bytes.Contains(src, []byte("htmlformat:off")) {
+		return src
+	}
+	var out bytes.Buffer
+	var m offsetMap
+	// open holds the names of the elements open at the current token.
+	var open []string
+	body := p.context != nil
+	// next is the offset of the token after the current one, and written is
+	// the offset in src up to which the output has been written.
+	var next, written int
+	// region is the offset of the off directive of the current region, and
+	// depth the number of elements open at it, while region >= 0.
+	region, depth := -1, 0
+	endRegion := func(end int) {
+		out.Write(src[written:region])
+		start := out.Len()
+		fmt.Fprintf(&out, "<!--%s%d-->", p.verbatimPrefix, len(p.verbatim))
+		p.replaced(&m, start, out.Len(), region, end)
+		p.verbatim = append(p.verbatim, string(src[region:end]))
+		written, region = end, -1
+	}
+	z := html.NewTokenizer(bytes.NewReader(src))
+	for {
+		tt := z.Next()
+		if tt == html.ErrorToken {
+			break
+		}
+		raw := z.Raw()
+		offset := next
+		next += len(raw)
+		switch tt {
+		case html.StartTagToken:
+			name, _ := z.TagName()
+			if !headTags[string(name)] || string(name) == "body" {
+				body = true
+			}
+			if !p.isVoidElementName(string(name)) {
+				open = append(open, string(name))
+			}
+		case html.EndTagToken:
+			name, _ := z.TagName()
+			i := lastIndex(open, string(name))
+			// The end tag of an element that is open at the off directive
+			// ends the region, as do those of the body and the html
+			// element, which may have been inserted by the parser. The
+			// whitespace before the end tag is not part of the region, as
+			// the end tag is indented as usual.
+			if region >= 0 && (i >= 0 && i < depth || i < 0 && p.context == nil && (string(name) == "body" || string(name) == "html")) {
+				endRegion(region + len(bytes.TrimRight(src[region:offset], htmlSpace)))
+			}
+			if i >= 0 {
+				open = open[:i]
+			}
+		case html.CommentToken:
+			switch {
+			case region < 0 && body && offDirective.Match(raw):
+				region, depth = offset, len(open)
+			case region >= 0 && len(open) == depth && onDirective.Match(raw):
+				endRegion(next)
+			}
+		case html.TextToken:
+			if (len(open) == 0 || open[len(open)-1] == "html") && len(bytes.Trim(raw, htmlSpace)) > 0 {
+				body = true
+			}
+		}
+	}
+	if region >= 0 {
+		// The newline that ends the input is not part of a region that runs
+		// to the end of it, as the output is ended as configured.
+		endRegion(region + len(bytes.TrimRight(src[region:], "\r\n")))
+	}
+	out.Write(src[written:])
+	p.offsetMaps = append(p.offsetMaps, m)
+	return out.Bytes()
+}
+
+// lastIndex returns the index of the last of names that is name, or -1 if
+// there is none.
+func lastIndex(names []string, name string) int {
+	for i := len(names) - 1; i >= 0; i-- {
+		if names[i] == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// conditionalComment matches Internet Explorer conditional comments, which
+// email clients such as Outlook still use. A downlevel-hidden comment is
+// matched up to its endif, as it must be kept exactly as it is, while only
+// the markers of a downlevel-revealed comment are, as the markup between
+// them is formatted.
+var conditionalComment = regexp.MustCompile(`(?s)^(?:<!--\[if[^\]]*\]><!-->|<!--<!\[endif\]-->|<!--\[if[^\]]*\]>.*?<!\[endif\]-->|<!\[if[^\]]*\]>|<!\[endif\]>)$`)
+
+// downlevelHidden matches the start of a downlevel-hidden comment.
+var downlevelHidden = regexp.MustCompile(`^<!--\[if[^\]]*\]>`)
+
+// extractConditionalComments replaces each conditional comment in src with a
+// placeholder comment, so that it is written exactly as it appears in the
+// input. The markers of a downlevel-revealed comment are only replaced in
+// pairs: on its own, such as in the output of a bogus comment like
+// <!<![endif]>, a marker is an ordinary comment, which is written the same.
+func (p *printer) extractConditionalComments(src []byte) []byte {
+	if !bytes.Contains(src, []byte("[if")) && !bytes.Contains(src, []byte("[endif]")) {
+		return src
+	}
+	locs := pairRevealedMarkers(src, conditionalComments(src))
+	if len(locs) == 0 {
+		return src
+	}
+	var out bytes.Buffer
+	var m offsetMap
+	var last int
+	for _, loc := range locs {
+		out.Write(src[last:loc[0]])
+		start := out.Len()
+		fmt.Fprintf(&out, "<!--%s%d-->", p.verbatimPrefix, len(p.verbatim))
+		p.replaced(&m, start, out.Len(), loc[0], loc[1])
+		p.verbatim = append(p.verbatim, string(src[loc[0]:loc[1]]))
+		last = loc[1]
+	}
+	out.Write(src[last:])
+	p.offsetMaps = append(p.offsetMaps, m)
+	return out.Bytes()
+}
+
+// conditionalComments returns the locations of the conditional comments in
+// src. Only comments and markup declarations are matched, so that text like
+// a conditional comment in a script, a comment or an attribute value is not.
+func conditionalComments(src []byte) (locs [][]int) {
+	z := html.NewTokenizer(bytes.NewReader(src))
+	var offset int
+	for {
+		tt := z.Next()
+		if tt == html.ErrorToken {
+			return locs
+		}
+		raw := z.Raw()
+		start := offset
+		offset += len(raw)
+		if tt != html.CommentToken {
+			continue
+		}
+		if conditionalComment.Match(raw) {
+			locs = append(locs, []int{start, offset})
+			continue
+		}
+		// The content of a downlevel-hidden comment may hold comments of
+		// its own, which end the comment token before the endif.
+		if downlevelHidden.Match(raw) {
+			if end := bytes.Index(src[start:], []byte("<![endif]-->")); end >= 0 {
+				offset = start + end + len("<![endif]-->")
+				locs = append(locs, []int{start, offset})
+				z = html.NewTokenizer(bytes.NewReader(src[offset:]))
+			}
+		}
+	}
+}
+
+// pairRevealedMarkers returns the matches of conditionalComment in src
+// without the opening and closing markers of downlevel-revealed comments,
+// <!--[if IE]><!--> and <!--<![endif]-->, that have no partner.
+func pairRevealedMarkers(src []byte, locs [][]int) (paired [][]int) {
+	var opens []int
+	drop := make(map[int]bool)
+	for i, loc := range locs {
+		switch match := src[loc[0]:loc[1]]; {
+		case bytes.HasSuffix(match, []byte("]><!-->")):
+			opens = append(opens, i)
+		case bytes.Equal(match, []byte("<!--<![endif]-->")):
+			if len(opens) == 0 {
+				drop[i] = true
+				continue
+			}
+			opens = opens[:len(opens)-1]
+		}
+	}
+	for _, i := range opens {
+		drop[i] = true
+	}
+	for i, loc := range locs {
+		if !drop[i] {
+			paired = append(paired, loc)
+		}
+	}
+	return paired
+}
+
+// verbatimSource returns the input that the placeholder comment n stands in
+// for.
+func (p *printer) verbatimSource(n *html.Node) (src string, ok bool) {
+	s, ok := strings.CutPrefix(n.Data, p.verbatimPrefix)
+	if !ok || p.verbatimPrefix == "" {
+		return "", false
+	}
+	i, err := strconv.Atoi(s)
+	if err != nil || i < 0 || i >= len(p.verbatim) {
+		return "", false
+	}
+	return p.verbatim[i], true
+}
+
+// preserve replaces the elements among nodes and their descendants that
+// match the Preserve selectors with placeholder comments.
+func (p *printer) preserve(nodes []*html.Node) (preserved []*html.Node, err error) {
+	sel, err := parseSelectors(p.Preserve)
+	if err != nil {
+		return nil, err
+	}
+	preserved = withParent(nodes, func(parent *html.Node) {
+		err = p.preserveSelected(parent, sel)
+	})
+	return preserved, err
+}
+
+// preserveSelected replaces each descendant of n that matches sel with a
+// placeholder comment for its markup as html.Render writes it, so that it is
+// written as it is rather than formatted.
+func (p *printer) preserveSelected(n *html.Node, sel selector) (err error) {
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if !sel.match(c) {
+			if err = p.preserveSelected(c, sel); err != nil {
+				return err
+			}
+			continue
+		}
+		var sb strings.Builder
+		if err = html.Render(&sb, c); err != nil {
+			return err
+		}
+		src := p.verbatimComment.ReplaceAllStringFunc(sb.String(), func(s string) string {
+			src, _ := p.verbatimSource(&html.Node{Data: s[len("<!--") : len(s)-len("-->")]})
+			return src
+		})
+		placeholder := &html.Node{Type: html.CommentNode, Data: p.verbatimPrefix + strconv.Itoa(len(p.verbatim))}
+		p.verbatim = append(p.verbatim, src)
+		n.InsertBefore(placeholder, c)
+		n.RemoveChild(c)
+		c = placeholder
+	}
+	return nil
+}
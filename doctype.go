@@ -0,0 +1,86 @@
+package htmlformat
+
+import (
+	"fmt"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// DoctypeStyle controls how DOCTYPE declarations are written.
+type DoctypeStyle int
+
+const (
+	// StandardDoctype writes the DOCTYPE with the keyword in upper case and
+	// its public and system identifiers, if any, quoted, e.g.
+	// <!DOCTYPE html PUBLIC "-//W3C//DTD HTML 4.01//EN">.
+	StandardDoctype DoctypeStyle = iota
+	// HTML5Doctype replaces any DOCTYPE with <!DOCTYPE html>.
+	HTML5Doctype
+	// OriginalDoctype writes the DOCTYPE exactly as it appears in the input.
+	// DOCTYPEs of nodes that were not parsed by the Formatter are written in
+	// the standard style.
+	OriginalDoctype
+)
+
+var doctypeStyleNames = []string{
+	StandardDoctype: "standard",
+	HTML5Doctype:    "html5",
+	OriginalDoctype: "preserve",
+}
+
+// String returns the name of the DOCTYPE style: "standard", "html5" or
+// "preserve".
+func (d DoctypeStyle) String() string {
+	if d < 0 || int(d) >= len(doctypeStyleNames) {
+		return fmt.Sprintf("DoctypeStyle(%d)", int(d))
+	}
+	return doctypeStyleNames[d]
+}
+
+// Set sets the DOCTYPE style from its name, so that it can be used as a
+// flag.Value.
+func (d *DoctypeStyle) Set(name string) error {
+	for i, n := range doctypeStyleNames {
+		if n == name {
+			*d = DoctypeStyle(i)
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown doctype style %q", name)
+}
+
+// doctype returns the DOCTYPE declaration n as it is written.
+func (p *printer) doctype(n *html.Node) string {
+	switch p.Doctype {
+	case HTML5Doctype:
+		return "<!DOCTYPE html>"
+	case OriginalDoctype:
+		if raw, ok := p.rawDoctypes[n]; ok {
+			return raw
+		}
+	}
+	var public, system string
+	for _, a := range n.Attr {
+		switch a.Key {
+		case "public":
+			public = a.Val
+		case "system":
+			system = a.Val
+		}
+	}
+	var sb strings.Builder
+	sb.WriteString("<!DOCTYPE ")
+	sb.WriteString(n.Data)
+	switch {
+	case public != "":
+		sb.WriteString(` PUBLIC "` + public + `"`)
+		if system != "" {
+			sb.WriteString(` "` + system + `"`)
+		}
+	case system != "":
+		sb.WriteString(` SYSTEM "` + system + `"`)
+	}
+	sb.WriteString(">")
+	return sb.String()
+}
@@ -0,0 +1,162 @@
+package htmlformat
+
+import (
+	"fmt"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// ElementBehavior controls how the Formatter writes an element and its
+// content.
+type ElementBehavior int
+
+const (
+	// BlockElement writes the element's start and end tags, and each of its
+	// children, on their own lines.
+	BlockElement ElementBehavior = iota
+	// VoidElement writes the element without content or an end tag, like
+	// <br>. Content that the parser nests within it is written after it.
+	VoidElement
+	// PreformattedElement writes the element and its content exactly as they
+	// are parsed, like <pre>.
+	PreformattedElement
+	// InlineElement writes the element within the text around it, as if it
+	// were one of InlineElements.
+	InlineElement
+	// RawTextElement indents the text content of the element as a block,
+	// like the content of <script> and <style> elements.
+	RawTextElement
+)
+
+var elementBehaviorNames = []string{
+	BlockElement:        "block",
+	VoidElement:         "void",
+	PreformattedElement: "preformatted",
+	InlineElement:       "inline",
+	RawTextElement:      "raw-text",
+}
+
+// String returns the name of the behavior: "block", "void", "preformatted",
+// "inline" or "raw-text".
+func (b ElementBehavior) String() string {
+	if b < 0 || int(b) >= len(elementBehaviorNames) {
+		return fmt.Sprintf("ElementBehavior(%d)", int(b))
+	}
+	return elementBehaviorNames[b]
+}
+
+// Set sets the behavior from its name, so that it can be used as a
+// flag.Value.
+func (b *ElementBehavior) Set(name string) error {
+	for i, n := range elementBehaviorNames {
+		if n == name {
+			*b = ElementBehavior(i)
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown element behavior %q", name)
+}
+
+// standardElements are the behaviors of the HTML elements that are not
+// block elements. Inline elements are configured by InlineElements.
+// http://www.w3.org/TR/html-markup/syntax.html#syntax-elements
+var standardElements = map[atom.Atom]ElementBehavior{
+	atom.Area: VoidElement, atom.Base: VoidElement, atom.Br: VoidElement,
+	atom.Col: VoidElement, atom.Command: VoidElement, atom.Embed: VoidElement,
+	atom.Hr: VoidElement, atom.Img: VoidElement, atom.Input: VoidElement,
+	atom.Keygen: VoidElement, atom.Link: VoidElement, atom.Meta: VoidElement,
+	atom.Param: VoidElement, atom.Source: VoidElement, atom.Track: VoidElement,
+	atom.Wbr: VoidElement,
+	// Obsolete elements that the parser gives no content.
+	atom.Basefont: VoidElement, atom.Bgsound: VoidElement, atom.Frame: VoidElement,
+
+	atom.Pre: PreformattedElement, atom.Textarea: PreformattedElement,
+	atom.Listing: PreformattedElement,
+
+	atom.Script: RawTextElement, atom.Style: RawTextElement,
+}
+
+// elementBehavior returns the behavior of n that is registered in Elements,
+// or that of the standard element. Foreign elements are block elements,
+// except for the MathML token elements, whose text is preformatted.
+func (f *Formatter) elementBehavior(n *html.Node) ElementBehavior {
+	if n == nil || n.Type != html.ElementNode {
+		return BlockElement
+	}
+	if n.Namespace != "" {
+		if isMathTokenElement(n) {
+			return PreformattedElement
+		}
+		return BlockElement
+	}
+	if b, ok := f.Elements[n.Data]; ok {
+		return b
+	}
+	return standardElements[n.DataAtom]
+}
+
+// Is this node a tag with no end tag such as <meta> or <br>?
+func (f *Formatter) isVoidElement(n *html.Node) bool {
+	return f.elementBehavior(n) == VoidElement
+}
+
+func (f *Formatter) isVoidElementName(name string) bool {
+	return f.isVoidElement(&html.Node{Type: html.ElementNode, Data: name, DataAtom: atom.Lookup([]byte(name))})
+}
+
+// Is this an element whose content must be written exactly as parsed?
+func (f *Formatter) isPreformattedElement(n *html.Node) bool {
+	return f.elementBehavior(n) == PreformattedElement
+}
+
+func (f *Formatter) isSpecialContentElement(n *html.Node) bool {
+	return f.elementBehavior(n) == RawTextElement
+}
+
+// hasInlineElements reports whether any elements are written within the text
+// around them, either because InlineElements is set or because they are
+// registered as inline elements.
+func (f *Formatter) hasInlineElements() bool {
+	if f.inlineElements() != nil {
+		return true
+	}
+	for _, b := range f.Elements {
+		if b == InlineElement {
+			return true
+		}
+	}
+	return false
+}
+
+// hoistVoidChildren moves the children of the void elements within nodes to
+// after them, and returns nodes with those of any void elements among them.
+// The parser only knows the standard void elements, so it nests the content
+// that follows a registered one within it.
+func (f *Formatter) hoistVoidChildren(nodes []*html.Node) (hoisted []*html.Node) {
+	for _, n := range nodes {
+		hoisted = append(hoisted, n)
+		if f.isVoidElement(n) {
+			var children []*html.Node
+			for n.FirstChild != nil {
+				c := n.FirstChild
+				n.RemoveChild(c)
+				children = append(children, c)
+			}
+			hoisted = append(hoisted, f.hoistVoidChildren(children)...)
+			continue
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			if !f.isVoidElement(c) || c.FirstChild == nil {
+				f.hoistVoidChildren([]*html.Node{c})
+				continue
+			}
+			for c.LastChild != nil {
+				gc := c.LastChild
+				c.RemoveChild(gc)
+				n.InsertBefore(gc, c.NextSibling)
+			}
+		}
+	}
+	return hoisted
+}
@@ -0,0 +1,47 @@
+package htmlformat
+
+import (
+	"fmt"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// elide replaces the children of the elements that are MaxPrintDepth deep
+// below n, which is at depth, with a comment that says how many there were.
+// Elements whose content is only text and comments, such as <title> and
+// <script>, keep it, so that formatting the output again does not change it.
+func (p *printer) elide(n *html.Node, depth int) {
+	if depth >= p.MaxPrintDepth {
+		var count int
+		text := true
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			if c.Type != html.TextNode && c.Type != html.CommentNode {
+				text = false
+			}
+			if c.Type != html.TextNode || strings.TrimSpace(c.Data) != "" {
+				count++
+			}
+		}
+		if text {
+			return
+		}
+		for n.FirstChild != nil {
+			n.RemoveChild(n.FirstChild)
+		}
+		children := "children"
+		if count == 1 {
+			children = "child"
+		}
+		n.AppendChild(&html.Node{Type: html.CommentNode, Data: fmt.Sprintf(" %d %s elided ", count, children)})
+		return
+	}
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		switch c.Type {
+		case html.ElementNode:
+			p.elide(c, depth+1)
+		case html.DocumentNode:
+			p.elide(c, depth)
+		}
+	}
+}
@@ -0,0 +1,49 @@
+package htmlformat
+
+import (
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// email returns a copy of f with the settings that Email implies.
+func (f *Formatter) email() *Formatter {
+	e := *f
+	e.XHTML, e.SelfClose = false, false
+	e.OmitEndTags, e.OmitImplied = false, false
+	return &e
+}
+
+// strictWhitespace reports whether the whitespace around and within n is
+// significant, as it is with StrictWhitespace, or because n is within a
+// table of an email, where whitespace between cells and images can shift the
+// layout.
+func (f *Formatter) strictWhitespace(n *html.Node) bool {
+	if f.Whitespace == StrictWhitespace {
+		return true
+	}
+	if !f.Email {
+		return false
+	}
+	for ; n != nil; n = n.Parent {
+		if n.Type == html.ElementNode && n.Namespace == "" && n.DataAtom == atom.Table {
+			return true
+		}
+	}
+	return false
+}
+
+// encodeEntities returns s with the characters that are written as named
+// character references replaced by them.
+func (p *printer) encodeEntities(s string) string {
+	switch {
+	case p.NamedEntities:
+		return encodeNamedEntities(s)
+	case p.Email:
+		// Email clients that guess the encoding of a message can turn a bare
+		// non-breaking space into mojibake.
+		return strings.ReplaceAll(s, "\u00a0", "&nbsp;")
+	}
+	return s
+}
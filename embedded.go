@@ -0,0 +1,134 @@
+package htmlformat
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// EmbeddedFormatter formats the text content of elements such as <style> and
+// <script>, which are otherwise only re-indented line by line.
+type EmbeddedFormatter interface {
+	// Format returns the formatted form of content, the text of element n.
+	// The result is indented to the level of n by the caller.
+	Format(n *html.Node, content string) (string, error)
+}
+
+// EmbeddedFormatterFunc adapts a function to the EmbeddedFormatter interface.
+type EmbeddedFormatterFunc func(n *html.Node, content string) (string, error)
+
+// Format calls fn(n, content).
+func (fn EmbeddedFormatterFunc) Format(n *html.Node, content string) (string, error) {
+	return fn(n, content)
+}
+
+// embeddedFormatter returns the formatter registered for the content of n, or
+// nil if there isn't one.
+func (f *Formatter) embeddedFormatter(n *html.Node) EmbeddedFormatter {
+	if n == nil || n.Type != html.ElementNode {
+		return nil
+	}
+	switch n.Data {
+	case "style":
+		return f.CSS
+	case "script":
+		if f.FormatJSON && isJSON(n) {
+			return EmbeddedFormatterFunc(f.formatJSON)
+		}
+		if isJavaScript(n) {
+			return f.JS
+		}
+	}
+	return nil
+}
+
+// isMinified reports whether the text n is the content of a <script> or
+// <style> element with a line longer than MinifiedLineLength.
+func (f *Formatter) isMinified(n *html.Node) bool {
+	if f.MinifiedLineLength <= 0 || n.Parent == nil || n.Parent.Type != html.ElementNode || n.Parent.Namespace != "" ||
+		n.Parent.DataAtom != atom.Script && n.Parent.DataAtom != atom.Style {
+		return false
+	}
+	for s := n.Data; s != ""; {
+		line, rest, _ := strings.Cut(s, "\n")
+		if len(line) > f.MinifiedLineLength {
+			return true
+		}
+		s = rest
+	}
+	return false
+}
+
+// trimBlankLines returns s without the whitespace at its end, or the blank
+// lines at its start, keeping the indentation of its first line.
+func trimBlankLines(s string) string {
+	s = strings.TrimRight(s, htmlSpace)
+	if i := strings.LastIndexByte(s[:len(s)-len(strings.TrimLeft(s, htmlSpace))], '\n'); i >= 0 {
+		s = s[i+1:]
+	}
+	return s
+}
+
+// formatJSON indents the JSON content of the <script> element n.
+func (f *Formatter) formatJSON(n *html.Node, content string) (string, error) {
+	if strings.TrimSpace(content) == "" {
+		return content, nil
+	}
+	var buf bytes.Buffer
+	if err := json.Indent(&buf, []byte(content), "", f.indent()); err != nil {
+		if f.KeepInvalidJSON {
+			return content, nil
+		}
+		pe := &ParseError{Err: fmt.Errorf("invalid JSON: %w", err)}
+		var se *json.SyntaxError
+		if errors.As(err, &se) && se.Offset > 0 {
+			pe.Line, pe.Column = position([]byte(content), int(se.Offset)-1)
+		}
+		return "", pe
+	}
+	return buf.String(), nil
+}
+
+// isJSON reports whether the type attribute of the <script> element n marks
+// its content as JSON.
+func isJSON(n *html.Node) bool {
+	for _, a := range n.Attr {
+		if a.Namespace != "" || a.Key != "type" {
+			continue
+		}
+		t, _, _ := strings.Cut(a.Val, ";")
+		switch t = strings.ToLower(strings.TrimSpace(t)); t {
+		case "application/json", "text/json", "importmap", "speculationrules":
+			return true
+		}
+		return strings.HasPrefix(t, "application/") && strings.HasSuffix(t, "+json")
+	}
+	return false
+}
+
+// isJavaScript reports whether the type attribute of the <script> element n
+// marks its content as JavaScript.
+// https://html.spec.whatwg.org/multipage/scripting.html#attr-script-type
+func isJavaScript(n *html.Node) bool {
+	for _, a := range n.Attr {
+		if a.Namespace != "" || a.Key != "type" {
+			continue
+		}
+		t, _, _ := strings.Cut(a.Val, ";")
+		switch strings.ToLower(strings.TrimSpace(t)) {
+		case "", "module", "text/javascript", "application/javascript",
+			"application/ecmascript", "application/x-ecmascript", "application/x-javascript",
+			"text/ecmascript", "text/javascript1.0", "text/javascript1.1", "text/javascript1.2",
+			"text/javascript1.3", "text/javascript1.4", "text/javascript1.5", "text/jscript",
+			"text/livescript", "text/x-ecmascript", "text/x-javascript":
+			return true
+		}
+		return false
+	}
+	return true
+}
@@ -0,0 +1,66 @@
+package htmlformat
+
+import (
+	"fmt"
+	"io"
+)
+
+// ParseError is returned when input that must be well-formed, such as an XML
+// document, the JSON of a script or the Go source of GoSource, cannot be
+// parsed. HTML itself is never rejected, as the parser repairs it, unless
+// Strict is set, in which case a RepairError is returned.
+type ParseError struct {
+	// Line and Column are the 1-based position of the error in the input, or
+	// in the JSON of a script, if they are known, and zero otherwise.
+	Line, Column int
+	Err          error
+}
+
+func (e *ParseError) Error() string {
+	switch {
+	case e.Line > 0 && e.Column > 0:
+		return fmt.Sprintf("%d:%d: %v", e.Line, e.Column, e.Err)
+	case e.Line > 0:
+		return fmt.Sprintf("line %d: %v", e.Line, e.Err)
+	}
+	return e.Err.Error()
+}
+
+func (e *ParseError) Unwrap() error {
+	return e.Err
+}
+
+// WriteError is returned when the formatted output cannot be written, such
+// as when the disk is full, and wraps the error of the writer.
+type WriteError struct {
+	Err error
+}
+
+func (e *WriteError) Error() string {
+	return "failed to write output: " + e.Err.Error()
+}
+
+func (e *WriteError) Unwrap() error {
+	return e.Err
+}
+
+// outputWriter wraps the errors of the writer that output is written to in a
+// WriteError.
+type outputWriter struct {
+	w io.Writer
+}
+
+// newOutputWriter returns w wrapped in an outputWriter, unless it is one.
+func newOutputWriter(w io.Writer) io.Writer {
+	if _, ok := w.(*outputWriter); ok {
+		return w
+	}
+	return &outputWriter{w: w}
+}
+
+func (ow *outputWriter) Write(b []byte) (n int, err error) {
+	if n, err = ow.w.Write(b); err != nil {
+		err = &WriteError{Err: err}
+	}
+	return n, err
+}
@@ -0,0 +1,141 @@
+package htmlformat
+
+import (
+	"errors"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+var errDiskFull = errors.New("disk full")
+
+// fullWriter fails every write, as a writer to a full disk would.
+type fullWriter struct{}
+
+func (fullWriter) Write(b []byte) (int, error) {
+	return 0, errDiskFull
+}
+
+func TestWriteError(t *testing.T) {
+	tests := []struct {
+		name   string
+		format func(w io.Writer, r io.Reader) error
+	}{
+		{
+			name:   "document",
+			format: new(Formatter).Document,
+		},
+		{
+			name:   "fragment",
+			format: new(Formatter).Fragment,
+		},
+		{
+			name:   "verified fragment",
+			format: (&Formatter{Verify: true}).Fragment,
+		},
+		{
+			name:   "stream",
+			format: new(Formatter).Stream,
+		},
+		{
+			name:   "xml",
+			format: new(Formatter).XML,
+		},
+		{
+			name:   "markdown",
+			format: new(Formatter).Markdown,
+		},
+		{
+			name: "writer",
+			format: func(w io.Writer, r io.Reader) error {
+				fw := NewWriter(w)
+				if _, err := io.Copy(fw, r); err != nil {
+					return err
+				}
+				return fw.Close()
+			},
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			err := tt.format(fullWriter{}, strings.NewReader("<p>x</p>\n"))
+			var we *WriteError
+			if !errors.As(err, &we) {
+				t.Fatalf("expected a *WriteError, got %v", err)
+			}
+			if !errors.Is(err, errDiskFull) {
+				t.Errorf("expected the error to wrap the writer's error, got %v", err)
+			}
+		})
+	}
+}
+
+func TestParseError(t *testing.T) {
+	tests := []struct {
+		name     string
+		format   func(w io.Writer, r io.Reader) error
+		input    string
+		expected string
+	}{
+		{
+			name:     "xml with a mismatched end tag",
+			format:   new(Formatter).XML,
+			input:    "<a>\n<b>\n</a>",
+			expected: "line 3: unexpected end element </a>",
+		},
+		{
+			name:     "xml with an unexpected end tag",
+			format:   new(Formatter).XML,
+			input:    "<a/>\n</b>",
+			expected: "line 2: unexpected end element </b>",
+		},
+		{
+			name:     "xml with an unclosed element",
+			format:   new(Formatter).XML,
+			input:    "<a>\n<b/>\n",
+			expected: "line 3: unexpected EOF, <a> is not closed",
+		},
+		{
+			name:     "invalid json",
+			format:   (&Formatter{FormatJSON: true}).Fragment,
+			input:    "<script type=\"application/json\">\n{\n\"a\": 1,\n}\n</script>",
+			expected: "3:1: invalid JSON: invalid character '}' looking for beginning of object key string",
+		},
+		{
+			name:     "invalid go source",
+			format:   new(Formatter).GoSource,
+			input:    "package main\n\nfunc {",
+			expected: "3:6: expected 'IDENT', found '{'",
+		},
+		{
+			name:     "template action in place of a tag name",
+			format:   (&Formatter{Template: GoTemplate}).Fragment,
+			input:    `<{{.Tag}} class="a">x</{{.Tag}}>`,
+			expected: "template action in place of a tag name",
+		},
+		{
+			name:     "template action in place of an end tag name",
+			format:   (&Formatter{Template: GoTemplate, Strict: true}).Fragment,
+			input:    "<div>\n<p>x</{{.Tag}}>\n</div>",
+			expected: "2:5: template action in place of a tag name",
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			err := tt.format(io.Discard, strings.NewReader(tt.input))
+			var pe *ParseError
+			if !errors.As(err, &pe) {
+				t.Fatalf("expected a *ParseError, got %v", err)
+			}
+			if diff := cmp.Diff(tt.expected, pe.Error()); diff != "" {
+				t.Error(diff)
+			}
+		})
+	}
+}
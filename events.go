@@ -0,0 +1,274 @@
+package htmlformat
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// EventType is the kind of markup that an Event describes.
+type EventType int
+
+const (
+	// StartElementEvent is the start tag of an element.
+	StartElementEvent EventType = iota
+	// EndElementEvent is the end tag of an element.
+	EndElementEvent
+	// TextEvent is text.
+	TextEvent
+	// CommentEvent is a comment.
+	CommentEvent
+	// DoctypeEvent is a DOCTYPE declaration.
+	DoctypeEvent
+)
+
+var eventTypeNames = []string{
+	StartElementEvent: "start-element",
+	EndElementEvent:   "end-element",
+	TextEvent:         "text",
+	CommentEvent:      "comment",
+	DoctypeEvent:      "doctype",
+}
+
+// String returns the name of the event type.
+func (t EventType) String() string {
+	if t < 0 || int(t) >= len(eventTypeNames) {
+		return fmt.Sprintf("EventType(%d)", int(t))
+	}
+	return eventTypeNames[t]
+}
+
+// Event describes a piece of the formatted output, so that syntax
+// highlighters and serializers can follow the layout of the Formatter without
+// parsing its output.
+type Event struct {
+	Type EventType
+	// Data is the name of an element, with the case it is written in, or the
+	// unescaped content of text, a comment or a DOCTYPE declaration.
+	Data string
+	// Attr holds the attributes of a start tag, with unescaped values.
+	Attr []html.Attribute
+	// Raw is the markup as it is written. The whitespace that lays out
+	// pretty-printed output is not included, except within preformatted and
+	// raw text elements, where it is part of the content. It is empty for
+	// the end of an element whose end tag OmitEndTags has left out, which is
+	// at the offset of the markup that implies it.
+	Raw string
+	// Offset is the byte offset of Raw in the output.
+	Offset int
+	// Depth is the number of elements that the event is nested within.
+	Depth int
+	// StartsLine reports whether the event is at the start of a line, after
+	// Indent.
+	StartsLine bool
+	// Indent is the indentation that is written before the event, if it
+	// starts a line.
+	Indent string
+}
+
+// DocumentEvents formats a HTML document, and calls fn for each piece of the
+// formatted output in turn instead of writing it.
+func (f *Formatter) DocumentEvents(r io.Reader, fn func(e Event) error) (err error) {
+	var out bytes.Buffer
+	if err = f.Document(&out, r); err != nil {
+		return err
+	}
+	return f.events(out.Bytes(), true, fn)
+}
+
+// FragmentEvents formats a fragment of a HTML document, and calls fn for each
+// piece of the formatted output in turn instead of writing it.
+func (f *Formatter) FragmentEvents(r io.Reader, fn func(e Event) error) (err error) {
+	var out bytes.Buffer
+	if err = f.Fragment(&out, r); err != nil {
+		return err
+	}
+	return f.events(out.Bytes(), false, fn)
+}
+
+// events calls fn for the markup in the formatted output out, which is a
+// document if document is set. The end tags that OmitEndTags leaves out are
+// modelled as the parser would find them, so that each element has an end
+// event and depths are those of the tree.
+func (f *Formatter) events(out []byte, document bool, fn func(e Event) error) (err error) {
+	p := f.newPrinter()
+	z := html.NewTokenizer(bytes.NewReader(out))
+	var offset int
+	// open holds the elements that the tokens are within.
+	var open []eventElement
+	// verbatim is the depth of the outermost preformatted or raw text element
+	// that the tokens are within, or -1.
+	verbatim := -1
+	// quirks is set while a <table> in the output may be put inside an open
+	// <p>, as it is without a standard DOCTYPE, before the elements of a
+	// document.
+	quirks := document
+	// indent is the whitespace since the last newline, when there has been
+	// nothing else since it.
+	indent, startsLine := "", true
+	// end calls fn for the end of the innermost open element, whose end tag
+	// was left out before offset at.
+	end := func(at int) error {
+		e := open[len(open)-1]
+		open = open[:len(open)-1]
+		return fn(Event{Type: EndElementEvent, Data: e.data, Offset: at, Depth: len(open)})
+	}
+	for {
+		tt := z.Next()
+		if tt == html.ErrorToken {
+			if err = z.Err(); err != io.EOF {
+				return err
+			}
+			for len(open) > 0 {
+				if err = end(len(out)); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+		raw := string(z.Raw())
+		start := offset
+		offset += len(raw)
+		tok := z.Token()
+		e := Event{Data: tok.Data}
+		nextIndent, nextStartsLine := "", false
+		switch tt {
+		case html.TextToken:
+			e.Type, e.Depth = TextEvent, len(open)
+			if verbatim >= 0 {
+				break
+			}
+			// Split off the whitespace that lays out the output: the
+			// newlines on either side of the text, and the indentation
+			// that follows them.
+			const space = " \t\n\f\r"
+			lead := len(raw) - len(strings.TrimLeft(raw, space))
+			if i := strings.LastIndexByte(raw[:lead], '\n'); i >= 0 {
+				indent, startsLine = raw[i+1:lead], true
+			} else if startsLine {
+				indent += raw[:lead]
+			} else {
+				lead = 0
+			}
+			start += lead
+			raw = raw[lead:]
+			content := strings.TrimRight(raw, space)
+			if i := strings.LastIndexByte(raw[len(content):], '\n'); i >= 0 {
+				nextIndent, nextStartsLine = raw[len(content)+i+1:], true
+				raw = content
+			}
+			if raw == "" {
+				if nextStartsLine {
+					indent, startsLine = nextIndent, true
+				}
+				continue
+			}
+			e.Data = html.UnescapeString(raw)
+		case html.StartTagToken, html.SelfClosingTagToken:
+			e.Type = StartElementEvent
+			e.Data = raw[1 : 1+len(tok.Data)]
+			e.Attr = tok.Attr
+			if p.OmitEndTags && verbatim < 0 {
+				for i := len(open) - 1; i >= 0; i-- {
+					a := atom.Lookup([]byte(open[i].name))
+					if !hasOptionalEndTag(a) {
+						break
+					}
+					if !endsBefore(tok.DataAtom, a, quirks) {
+						continue
+					}
+					for len(open) > i {
+						if err = end(start); err != nil {
+							return err
+						}
+					}
+				}
+			}
+			e.Depth = len(open)
+			if tt == html.StartTagToken && !f.isVoidElementName(tok.Data) {
+				if verbatim < 0 && f.isVerbatimElementName(tok.Data) {
+					verbatim = len(open)
+				}
+				open = append(open, eventElement{name: tok.Data, data: e.Data})
+			}
+		case html.EndTagToken:
+			e.Type = EndElementEvent
+			e.Data = raw[2 : 2+len(tok.Data)]
+			i := len(open) - 1
+			for i >= 0 && open[i].name != tok.Data {
+				i--
+			}
+			// The end tags of the elements in it that were left out are
+			// implied by this one. A stray end tag closes nothing.
+			for i >= 0 && len(open) > i+1 {
+				if err = end(start); err != nil {
+					return err
+				}
+			}
+			if i >= 0 {
+				open = open[:i]
+			}
+			if len(open) == verbatim {
+				verbatim = -1
+			}
+			e.Depth = len(open)
+		case html.CommentToken:
+			e.Type, e.Depth = CommentEvent, len(open)
+		case html.DoctypeToken:
+			e.Type, e.Depth = DoctypeEvent, len(open)
+			quirks = !strings.EqualFold(tok.Data, "html")
+		}
+		e.Raw, e.Offset = raw, start
+		e.StartsLine, e.Indent = startsLine, ""
+		if startsLine {
+			e.Indent = indent
+		}
+		if err = fn(e); err != nil {
+			return err
+		}
+		indent, startsLine = nextIndent, nextStartsLine
+		if verbatim >= 0 && tt == html.TextToken {
+			// Within preformatted and raw text elements, whitespace is part
+			// of the text.
+			startsLine = strings.HasSuffix(raw, "\n")
+		}
+	}
+}
+
+// eventElement is an element that the tokens of the output are within.
+type eventElement struct {
+	// name is the lowercase name of the element, and data the name as it is
+	// written.
+	name, data string
+}
+
+// endsBefore reports whether the start of an element of type next closes an
+// open element of type open whose end tag OmitEndTags has left out.
+func endsBefore(next, open atom.Atom, quirks bool) bool {
+	switch open {
+	case atom.Thead, atom.Tbody:
+		if next == atom.Tbody || next == atom.Tfoot {
+			return true
+		}
+	case atom.Option, atom.Optgroup:
+		if next == atom.Hr {
+			return true
+		}
+	case atom.P:
+		if next == atom.Table && quirks {
+			return false
+		}
+	}
+	return impliesEnd(next, open)
+}
+
+// isVerbatimElementName reports whether the content of the elements called
+// name is written as it is, including its whitespace.
+func (f *Formatter) isVerbatimElementName(name string) bool {
+	n := &html.Node{Type: html.ElementNode, Data: name, DataAtom: atom.Lookup([]byte(name))}
+	return f.isPreformattedElement(n) || f.isSpecialContentElement(n)
+}
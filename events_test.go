@@ -0,0 +1,110 @@
+package htmlformat
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"golang.org/x/net/html"
+)
+
+func TestFragmentEvents(t *testing.T) {
+	f := Formatter{InlineElements: DefaultInlineElements}
+	input := "<div><!-- c --><p class=x>a &amp; <b>b</b></p><pre>\n x\n</pre><svg><linearGradient/></svg></div>"
+	// <div>
+	//  <!-- c -->
+	//  <p class="x">a &amp; <b>b</b></p>
+	//  <pre> x
+	// </pre>
+	//  <svg>
+	//   <linearGradient />
+	//  </svg>
+	// </div>
+	expected := []Event{
+		{Type: StartElementEvent, Data: "div", Raw: "<div>", Offset: 0, StartsLine: true},
+		{Type: CommentEvent, Data: " c ", Raw: "<!-- c -->", Offset: 7, Depth: 1, StartsLine: true, Indent: " "},
+		{Type: StartElementEvent, Data: "p", Attr: []html.Attribute{{Key: "class", Val: "x"}}, Raw: `<p class="x">`, Offset: 19, Depth: 1, StartsLine: true, Indent: " "},
+		{Type: TextEvent, Data: "a & ", Raw: "a &amp; ", Offset: 32, Depth: 2},
+		{Type: StartElementEvent, Data: "b", Raw: "<b>", Offset: 40, Depth: 2},
+		{Type: TextEvent, Data: "b", Raw: "b", Offset: 43, Depth: 3},
+		{Type: EndElementEvent, Data: "b", Raw: "</b>", Offset: 44, Depth: 2},
+		{Type: EndElementEvent, Data: "p", Raw: "</p>", Offset: 48, Depth: 1},
+		{Type: StartElementEvent, Data: "pre", Raw: "<pre>", Offset: 54, Depth: 1, StartsLine: true, Indent: " "},
+		{Type: TextEvent, Data: " x\n", Raw: " x\n", Offset: 59, Depth: 2},
+		{Type: EndElementEvent, Data: "pre", Raw: "</pre>", Offset: 62, Depth: 1, StartsLine: true},
+		{Type: StartElementEvent, Data: "svg", Raw: "<svg>", Offset: 70, Depth: 1, StartsLine: true, Indent: " "},
+		{Type: StartElementEvent, Data: "linearGradient", Raw: "<linearGradient />", Offset: 78, Depth: 2, StartsLine: true, Indent: "  "},
+		{Type: EndElementEvent, Data: "svg", Raw: "</svg>", Offset: 98, Depth: 1, StartsLine: true, Indent: " "},
+		{Type: EndElementEvent, Data: "div", Raw: "</div>", Offset: 105, StartsLine: true},
+	}
+	var events []Event
+	var out strings.Builder
+	err := f.FragmentEvents(strings.NewReader(input), func(e Event) error {
+		events = append(events, e)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("failed to format: %v", err)
+	}
+	if diff := cmp.Diff(expected, events); diff != "" {
+		t.Error(diff)
+	}
+	if err = f.Fragment(&out, strings.NewReader(input)); err != nil {
+		t.Fatalf("failed to format: %v", err)
+	}
+	for _, e := range events {
+		if got := out.String()[e.Offset : e.Offset+len(e.Raw)]; got != e.Raw {
+			t.Errorf("expected %q at offset %d, got %q", e.Raw, e.Offset, got)
+		}
+	}
+}
+
+func TestFragmentEventsOmitEndTags(t *testing.T) {
+	f := Formatter{OmitEndTags: true}
+	input := "<ul><li>a<li>b</ul><p>c"
+	// <ul>
+	//  <li>a
+	//  <li>b
+	// </ul>
+	// <p>c</p>
+	expected := []Event{
+		{Type: StartElementEvent, Data: "ul", Raw: "<ul>", Offset: 0, StartsLine: true},
+		{Type: StartElementEvent, Data: "li", Raw: "<li>", Offset: 6, Depth: 1, StartsLine: true, Indent: " "},
+		{Type: TextEvent, Data: "a", Raw: "a", Offset: 10, Depth: 2},
+		{Type: EndElementEvent, Data: "li", Offset: 13, Depth: 1},
+		{Type: StartElementEvent, Data: "li", Raw: "<li>", Offset: 13, Depth: 1, StartsLine: true, Indent: " "},
+		{Type: TextEvent, Data: "b", Raw: "b", Offset: 17, Depth: 2},
+		{Type: EndElementEvent, Data: "li", Offset: 19, Depth: 1},
+		{Type: EndElementEvent, Data: "ul", Raw: "</ul>", Offset: 19, StartsLine: true},
+		{Type: StartElementEvent, Data: "p", Raw: "<p>", Offset: 25, StartsLine: true},
+		{Type: TextEvent, Data: "c", Raw: "c", Offset: 28, Depth: 1},
+		{Type: EndElementEvent, Data: "p", Raw: "</p>", Offset: 29},
+	}
+	var events []Event
+	err := f.FragmentEvents(strings.NewReader(input), func(e Event) error {
+		events = append(events, e)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("failed to format: %v", err)
+	}
+	if diff := cmp.Diff(expected, events); diff != "" {
+		t.Error(diff)
+	}
+}
+
+func TestFragmentEventsError(t *testing.T) {
+	stop := errors.New("stop")
+	var n int
+	err := new(Formatter).FragmentEvents(strings.NewReader(`<p>a</p><p>b</p>`), func(e Event) error {
+		n++
+		return stop
+	})
+	if err != stop {
+		t.Errorf("expected the error returned by fn, got %v", err)
+	}
+	if n != 1 {
+		t.Errorf("expected fn to be called once, got %d", n)
+	}
+}
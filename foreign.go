@@ -0,0 +1,50 @@
+package htmlformat
+
+import (
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// isForeignElement reports whether n is an element of SVG or MathML content,
+// which follows XML rules rather than those of HTML: the case of element and
+// attribute names is significant, and any element may be self-closing. The
+// content of a <foreignObject> is HTML again.
+func isForeignElement(n *html.Node) bool {
+	return n != nil && n.Type == html.ElementNode && (n.Namespace == "svg" || n.Namespace == "math")
+}
+
+// isMathTokenElement reports whether n is a MathML token element, such as
+// <mi> or <mtext>, whose text is rendered and so is written as it is.
+// https://w3c.github.io/mathml-core/#token-elements
+func isMathTokenElement(n *html.Node) bool {
+	if n.Namespace != "math" {
+		return false
+	}
+	switch n.DataAtom {
+	case atom.Mi, atom.Mn, atom.Mo, atom.Ms, atom.Mtext:
+		return true
+	}
+	return false
+}
+
+// isEmptyForeignElement reports whether n is a foreign element with no
+// content, which is written as a self-closing tag such as <path d="" />.
+func isEmptyForeignElement(n *html.Node) bool {
+	return isForeignElement(n) && n.FirstChild == nil
+}
+
+// hasNoEndTag reports whether n is written without content or an end tag,
+// either because it is void, because it is an empty foreign element, or
+// because it is a component that was self-closing in the input.
+func (p *printer) hasNoEndTag(n *html.Node) bool {
+	return p.isVoidElement(n) || isEmptyForeignElement(n) || p.selfClosing[n]
+}
+
+// attributeName returns the name of a as it is written, including the prefix
+// of foreign attributes such as xlink:href.
+func attributeName(a html.Attribute) string {
+	if a.Namespace != "" {
+		return a.Namespace + ":" + a.Key
+	}
+	return a.Key
+}
@@ -2,129 +2,1109 @@ package htmlformat
 
 import (
 	"bufio"
+	"bytes"
+	"context"
 	"fmt"
 	"io"
+	"regexp"
 	"strings"
 	"unicode"
 	"unicode/utf8"
 
 	"golang.org/x/net/html"
 	"golang.org/x/net/html/atom"
+	"golang.org/x/text/encoding"
 )
 
+// Mode controls how the formatted output is laid out.
+type Mode int
+
+const (
+	// Pretty places elements on their own lines, indented by nesting level.
+	Pretty Mode = iota
+	// Minify strips insignificant whitespace and writes no newlines, except
+	// within whitespace-sensitive content such as <pre>, <textarea> and
+	// <script>.
+	Minify
+)
+
+// DetectNewline, as the Newline of a Formatter, writes the newline that the
+// input uses.
+const DetectNewline = "auto"
+
+// Formatter formats HTML. The zero value pretty-prints with the default
+// settings, and is what the package level functions use.
+type Formatter struct {
+	Mode Mode
+	// Indent is written once for each level of nesting when pretty-printing.
+	// The default is a single space.
+	Indent string
+	// Newline is written at the end of each line when pretty-printing. The
+	// default is "\n". If it is DetectNewline, the newline that ends the first
+	// line of the input is used.
+	Newline string
+	// NormalizeNewlines writes the line endings within the content that is
+	// written as it is in the input, such as that of <pre> elements and of
+	// regions where formatting is disabled, as Newline, so that the output
+	// does not mix them.
+	NormalizeNewlines bool
+	// PrintWidth is the line length that pretty-printed output is kept within
+	// where possible. Elements containing only text and inline elements are
+	// written on one line if they fit, and start tags that would exceed it
+	// have their attributes written one per line. Zero means there is no
+	// limit, and only elements containing nothing but text are written on
+	// one line.
+	PrintWidth int
+	// MaxBlankLines is the number of consecutive blank lines between sibling
+	// nodes that are kept when pretty-printing. Zero removes them all.
+	MaxBlankLines int
+	// FlatDocument writes the children of the <html>, <head> and <body>
+	// elements at the same indentation as the elements themselves when
+	// pretty-printing, rather than a level further in.
+	FlatDocument bool
+	// ChildIndent overrides the number of levels that the children of
+	// elements are indented by relative to them, which is otherwise one, by
+	// element name. For example, "ul" and "ol" can be 0 to write list items
+	// at the indentation of their lists. It takes precedence over
+	// FlatDocument, and negative numbers are treated as zero.
+	ChildIndent map[string]int
+	// SortAttributes writes attributes in alphabetical order instead of the
+	// order they appear in the input.
+	SortAttributes bool
+	// AttributePriority lists attribute names that are written before any
+	// others, in the order given, e.g. "id", "class", "name". A name ending in
+	// "*" matches any attribute with that prefix, such as "data-*". A lone "*"
+	// stands for all attributes that are not listed, so that names after it
+	// are written last.
+	AttributePriority []string
+	// DropEmptyAttributes removes attributes whose values are empty, such as
+	// class="", apart from boolean attributes, data attributes and those
+	// whose empty values are meaningful, such as alt="" and value="".
+	DropEmptyAttributes bool
+	// SortClasses writes the names in class attributes in alphabetical order,
+	// without duplicates.
+	SortClasses bool
+	// NormalizeStyles writes the declarations of style attributes as
+	// "property: value", separated by "; ", with their whitespace collapsed.
+	NormalizeStyles bool
+	// StyleSemicolon is whether the last declaration of a style attribute
+	// ends with a semicolon, when NormalizeStyles is set.
+	StyleSemicolon SemicolonStyle
+	// WrapAttributeValues wraps the values of class attributes that would not
+	// fit within PrintWidth across several lines, indented one level further
+	// than the attribute. The values of srcset and sizes attributes are
+	// written with one image candidate or size on each line, and those of
+	// style attributes, when NormalizeStyles is set, with one declaration on
+	// each line.
+	WrapAttributeValues bool
+	// AttributeAlignment is how the attributes of start tags that do not fit
+	// within PrintWidth are laid out across lines.
+	AttributeAlignment AttributeAlignment
+	// BracketSameLine writes the > that ends a start tag whose attributes are
+	// indented on lines of their own at the end of the last attribute, with
+	// any content that follows it, rather than on a line of its own. Aligned
+	// attributes are always followed by it.
+	BracketSameLine bool
+	// FormatSrcdoc formats the documents held in the srcdoc attributes of
+	// <iframe> elements, which are then written across several lines within
+	// the attribute value. Documents that cannot be formatted are kept as
+	// they are.
+	FormatSrcdoc bool
+	// WrapComments wraps the lines of comments that are longer than the print
+	// width when pretty-printing.
+	WrapComments bool
+	// WrapText wraps text that is longer than the print width at spaces when
+	// pretty-printing, continuing it on lines indented to the same level.
+	// The content of block elements that is too wide to be written on the
+	// line of their tags is written on lines of its own. Text is never
+	// broken within tags, or within elements whose whitespace is
+	// significant.
+	WrapText bool
+	// SelfClose writes void elements in the XHTML style, e.g. <br />.
+	SelfClose bool
+	// OmitEndTags leaves out the end tags that HTML allows to be omitted,
+	// such as those of <li>, <p>, <td> and <option>, where the element
+	// after them, or the end of their parent, closes them, so that the
+	// output parses to the same content. Stream writes every end tag.
+	OmitEndTags bool
+	// OmitImplied leaves out the <html>, <head>, <body> and <tbody>
+	// elements that the parser adds where the input has none, so that a
+	// snippet formatted as a document is not wrapped in them.
+	OmitImplied bool
+	// Quotes is the style of quotes written around attribute values.
+	Quotes QuoteStyle
+	// Case controls whether tag and attribute names are written in
+	// lowercase, in the case they have in the input, or with the names of
+	// HTML elements in uppercase.
+	Case CaseStyle
+	// Booleans controls whether boolean attributes, such as disabled, are
+	// written with an empty value, no value or their name as their value.
+	Booleans BooleanStyle
+	// DuplicateAttributes controls whether attributes that appear more than
+	// once on an element are all written, only the first or last of them is,
+	// or the input is rejected.
+	DuplicateAttributes DuplicateStyle
+	// Doctype controls whether DOCTYPE declarations are written in the
+	// standard style, replaced by the HTML5 DOCTYPE or kept as they are.
+	Doctype DoctypeStyle
+	// NamedEntities writes the characters of text and attribute values that
+	// have a named character reference in HTML 4, such as the non-breaking
+	// space and ©, as that reference, e.g. &nbsp; and &copy;.
+	NamedEntities bool
+	// XHTML writes well-formed XML that HTML parsers read the same way, as
+	// polyglot markup, for XML toolchains and EPUB packagers. It implies
+	// SelfClose, WrapCDATA, DoubleQuotes, ExplicitBooleans, LowercaseNames
+	// and FirstDuplicate, unless another way of removing duplicates is set,
+	// and overrides NamedEntities, OmitEndTags and OmitImplied. Attributes
+	// are always written with a value, and the namespaces of XHTML, SVG and
+	// MathML are declared where they are missing.
+	XHTML bool
+	// Email formats HTML email, which email clients render with older and
+	// stricter engines than browsers: the whitespace within tables, which
+	// lay out most emails, is treated as significant as with
+	// StrictWhitespace, non-breaking spaces are written as &nbsp;, and
+	// elements are never self-closed nor their end tags omitted. It
+	// overrides XHTML, SelfClose, OmitEndTags and OmitImplied. Conditional
+	// comments, such as <!--[if mso]>, are always kept exactly as they are.
+	Email bool
+	// InlineElements, if set, are the names of the elements that are written
+	// within the text around them, such as DefaultInlineElements. Elements
+	// that contain only text and inline elements are written on one line.
+	// If it is nil, elements are only written on one line when they contain
+	// nothing but text.
+	InlineElements []string
+	// SingleLineElements, if set, are the names of the elements that are
+	// written on one line when they contain only text and inline elements,
+	// such as DefaultSingleLineElements, even if PrintWidth is not set. They
+	// are written across several lines if the line would not fit within
+	// PrintWidth.
+	SingleLineElements []string
+	// Whitespace controls which whitespace in the input is significant, and
+	// kept, when pretty-printing.
+	Whitespace WhitespaceSensitivity
+	// Elements registers the behavior of custom and non-standard elements, or
+	// overrides that of standard ones, by element name. For example, "my-icon"
+	// can be written as a void element and "code-block" as preformatted.
+	Elements map[string]ElementBehavior
+	// WrapCDATA wraps the content of <script> and <style> elements in
+	// commented out CDATA sections, as XHTML requires.
+	WrapCDATA bool
+	// CSS, if set, formats the content of <style> elements when
+	// pretty-printing.
+	CSS EmbeddedFormatter
+	// JS, if set, formats the content of <script> elements that contain
+	// JavaScript, according to their type attribute, when pretty-printing.
+	JS EmbeddedFormatter
+	// FormatJSON pretty-prints the content of <script> elements that contain
+	// JSON, such as JSON-LD and import maps, according to their type
+	// attribute, with Indent, when pretty-printing. JS is not used for them.
+	FormatJSON bool
+	// KeepInvalidJSON leaves JSON that cannot be parsed as it is, re-indented
+	// line by line, rather than failing to format it.
+	KeepInvalidJSON bool
+	// MinifiedLineLength, if positive, is the length in bytes beyond which a
+	// line of the content of a <script> or <style> element marks it as a
+	// minified bundle, which is written as it is rather than re-indented or
+	// formatted by CSS or JS.
+	MinifiedLineLength int
+	// Template, if set, is the syntax of template actions in the input, such
+	// as GoTemplate. Actions are written exactly as they appear in the
+	// input, and the content of blocks is indented. An action in place of a
+	// tag name, as in <{{.Tag}}>, is a ParseError.
+	Template *TemplateSyntax
+	// Component, if set, is the syntax of single-file components such as
+	// VueComponent, of which only the markup is formatted.
+	Component *ComponentSyntax
+	// Strict returns a *RepairError instead of formatting input that the
+	// parser would have to repair, such as elements that are missing end
+	// tags, unexpected end tags and content that is not allowed where it
+	// appears in a table. End tags that HTML allows to be omitted, such as
+	// those of <li> and <p>, are not reported.
+	Strict bool
+	// TrailingNewline controls whether the output ends with a newline.
+	TrailingNewline TrailingNewlineStyle
+	// Charset controls whether the input is assumed to be UTF-8, or decoded
+	// from the encoding it declares. Offsets in source maps and repairs are
+	// those of the input and output after they are converted to UTF-8.
+	Charset CharsetStyle
+	// ContentType is the Content-Type header that was sent with the input,
+	// such as "text/html; charset=shift_jis". Its charset takes precedence
+	// over any <meta> declaration when detecting the encoding of the input.
+	ContentType string
+	// StripComments leaves comments out of the output, apart from
+	// conditional comments and those that start with one of KeepComments.
+	StripComments bool
+	// KeepComments are the prefixes of the comments that StripComments
+	// keeps, after any leading whitespace, such as "!" for <!--! ... -->
+	// license banners.
+	KeepComments []string
+	// MaxPrintDepth, if positive, is how deeply elements are written, for
+	// an overview of a large document: the content of elements nested that
+	// deep is replaced by a comment that says how much was left out, such as
+	// <!-- 38 children elided -->. Elements whose content is only text and
+	// comments keep it. Nodes and Stream do not use MaxPrintDepth.
+	MaxPrintDepth int
+	// Preserve lists CSS selectors, such as pre.highlight or
+	// script[type="text/plain"], for elements that are written as html.Render
+	// writes them, with their content, rather than formatted. Type, ID, class
+	// and attribute selectors and combinators are supported. Stream does not
+	// use Preserve.
+	Preserve []string
+	// Sanitizer, if set, removes unsafe markup from the input before it is
+	// formatted, such as to format user generated content. A *Policy is
+	// applied to the parsed input, and other sanitizers to the input before
+	// it is parsed, so that offsets in source maps and repairs are those of
+	// the sanitized input. Stream does not sanitize its input.
+	Sanitizer Sanitizer
+	// OnNode, if set, is called for each node before it is written, in
+	// document order. It may change the node and its descendants, such as to
+	// rewrite the URLs of assets, or replace the node by inserting siblings
+	// before it and returning SkipNode. The tree is changed in place, including
+	// the nodes passed to Nodes. Placeholders for the parts of the input that
+	// are written as they are, such as template actions, are passed as
+	// comment and text nodes. Stream does not call OnNode.
+	OnNode func(n *html.Node) NodeAction
+	// OnProgress, if set, is called as the input is read and periodically as
+	// the output is written, and once formatting is done, so that wrappers
+	// can show how far formatting of a large input has got. It is called
+	// from the goroutine that is formatting.
+	OnProgress func(Progress)
+	// Verify parses the output again, and returns a *VerifyError instead of
+	// writing it if its content differs from that of the input, apart from
+	// whitespace that does not change how it is rendered. It is ignored by
+	// Nodes, Stream and FormatSelection.
+	Verify bool
+	// Cache, if set, stores the output of Document, Fragment and
+	// FragmentInContext by a hash of their input and these settings, so that
+	// formatting unchanged input again, such as in a watch or build loop,
+	// is a lookup rather than a parse. Output is not cached when OnNode,
+	// OnProgress, CSS, JS or Sanitizer is set, as their behavior cannot be
+	// part of the key.
+	Cache Cache
+	// MaxBytes, MaxDepth and MaxNodes, if positive, limit the size of the
+	// input, how deeply its elements are nested and how many nodes it has,
+	// so that untrusted input cannot use unbounded time and memory. Input
+	// over a limit is not formatted, and the error is a *LimitError. Stream
+	// only applies MaxBytes, and Nodes none of them.
+	MaxBytes, MaxDepth, MaxNodes int
+}
+
 // Document formats a HTML document.
 func Document(w io.Writer, r io.Reader) (err error) {
-	node, err := html.Parse(r)
+	return new(Formatter).Document(w, r)
+}
+
+// Fragment formats a fragment of a HTML document.
+func Fragment(w io.Writer, r io.Reader) (err error) {
+	return new(Formatter).Fragment(w, r)
+}
+
+// FragmentInContext formats a fragment of a HTML document that is parsed as
+// the content of an element called contextTag.
+func FragmentInContext(w io.Writer, r io.Reader, contextTag string) (err error) {
+	return new(Formatter).FragmentInContext(w, r, contextTag)
+}
+
+// Nodes formats a slice of HTML nodes.
+func Nodes(w io.Writer, nodes []*html.Node) (err error) {
+	return new(Formatter).Nodes(w, nodes)
+}
+
+// Document formats a HTML document.
+func (f *Formatter) Document(w io.Writer, r io.Reader) (err error) {
+	if f.cachesOutput() {
+		return f.cached(w, r, "document", f.newPrinter().document)
+	}
+	return f.newPrinter().document(w, r)
+}
+
+// Fragment formats a fragment of a HTML document.
+func (f *Formatter) Fragment(w io.Writer, r io.Reader) (err error) {
+	return f.FragmentInContext(w, r, "")
+}
+
+// FragmentInContext formats a fragment of a HTML document that is parsed as
+// the content of an element called contextTag, such as "tbody" for a fragment
+// of table rows, which the parser would otherwise drop the structure of.
+func (f *Formatter) FragmentInContext(w io.Writer, r io.Reader, contextTag string) (err error) {
+	if f.cachesOutput() {
+		return f.cached(w, r, "fragment "+contextTag, func(w io.Writer, r io.Reader) error {
+			return f.newPrinter().fragment(w, r, contextTag)
+		})
+	}
+	return f.newPrinter().fragment(w, r, contextTag)
+}
+
+// Nodes formats a slice of HTML nodes. Siblings that OnNode inserts next to
+// the nodes themselves, rather than their descendants, are not written.
+func (f *Formatter) Nodes(w io.Writer, nodes []*html.Node) (err error) {
+	if f.OnNode != nil {
+		nodes = f.applyOnNode(nodes)
+	}
+	return f.newPrinter().print(newOutputWriter(w), nodes)
+}
+
+// DocumentString formats the HTML document s.
+func DocumentString(s string) (string, error) {
+	return new(Formatter).DocumentString(s)
+}
+
+// FragmentString formats the fragment of a HTML document s.
+func FragmentString(s string) (string, error) {
+	return new(Formatter).FragmentString(s)
+}
+
+// AppendDocument appends the formatted HTML document src to dst and returns
+// the extended buffer.
+func AppendDocument(dst, src []byte) ([]byte, error) {
+	return new(Formatter).AppendDocument(dst, src)
+}
+
+// AppendFragment appends the formatted fragment of a HTML document src to
+// dst and returns the extended buffer.
+func AppendFragment(dst, src []byte) ([]byte, error) {
+	return new(Formatter).AppendFragment(dst, src)
+}
+
+// DocumentString formats the HTML document s.
+func (f *Formatter) DocumentString(s string) (string, error) {
+	var sb strings.Builder
+	if err := f.Document(&sb, strings.NewReader(s)); err != nil {
+		return "", err
+	}
+	return sb.String(), nil
+}
+
+// FragmentString formats the fragment of a HTML document s.
+func (f *Formatter) FragmentString(s string) (string, error) {
+	var sb strings.Builder
+	if err := f.Fragment(&sb, strings.NewReader(s)); err != nil {
+		return "", err
+	}
+	return sb.String(), nil
+}
+
+// AppendDocument appends the formatted HTML document src to dst and returns
+// the extended buffer. If formatting fails, dst is returned unchanged.
+func (f *Formatter) AppendDocument(dst, src []byte) ([]byte, error) {
+	b := bytes.NewBuffer(dst)
+	if err := f.Document(b, bytes.NewReader(src)); err != nil {
+		return dst, err
+	}
+	return b.Bytes(), nil
+}
+
+// AppendFragment appends the formatted fragment of a HTML document src to
+// dst and returns the extended buffer. If formatting fails, dst is returned
+// unchanged.
+func (f *Formatter) AppendFragment(dst, src []byte) ([]byte, error) {
+	b := bytes.NewBuffer(dst)
+	if err := f.Fragment(b, bytes.NewReader(src)); err != nil {
+		return dst, err
+	}
+	return b.Bytes(), nil
+}
+
+// printer holds the state of a single formatting run.
+type printer struct {
+	*Formatter
+	// verbatim holds the input of regions that formatting is disabled for,
+	// indexed by the placeholder comments that replace them.
+	verbatim []string
+	// verbatimPrefix starts the content of the placeholder comments, which
+	// verbatimComment matches as html.Render writes them.
+	verbatimPrefix  string
+	verbatimComment *regexp.Regexp
+	// actions holds the template actions in the input, indexed by the
+	// placeholders that replace them.
+	actions []action
+
+	// sourceMap, if set, records where each node in the output came from.
+	sourceMap *SourceMap
+	// input and src are the input and the preprocessed input, kept when
+	// offsets in the input are needed.
+	input, src []byte
+	// offsetMaps maps offsets in src back to the input, one for each
+	// preprocessing stage.
+	offsetMaps []offsetMap
+	// offsets holds the offset in the input of each node.
+	offsets map[*html.Node]int
+	// quotes holds the quote character that each attribute of an element
+	// was written with in the input, or 0 if it was unquoted.
+	quotes map[*html.Node]map[string]byte
+	// rawDoctypes holds the DOCTYPE declarations as they appear in the input.
+	rawDoctypes map[*html.Node]string
+	// names and attrNames hold the names of elements and their attributes
+	// as they appear in the input, when they are not lowercase.
+	names     map[*html.Node]string
+	attrNames map[*html.Node]map[string]string
+	// selection selects the elements that FormatSelection writes.
+	selection selector
+	// stats, if set, collects the statistics that DocumentStats and
+	// FragmentStats return, and output holds the output they compare with
+	// the input.
+	stats  *Stats
+	output bytes.Buffer
+	// xmlFeed is set when the XML document printed is a feed or sitemap.
+	xmlFeed bool
+	// nextRoots holds the node after each of the nodes printed, which have
+	// no siblings of their own if they are the nodes of a fragment.
+	nextRoots map[*html.Node]*html.Node
+	// joinEnd is the element whose end tag is written straight after its
+	// content, as the content ends with the start of an end tag.
+	joinEnd *html.Node
+	// flow holds the content of an element that is written on one line.
+	flow bytes.Buffer
+	// indents holds the indentation of the deepest level written so far.
+	indents string
+	// written counts the bytes of output, when making a source map.
+	written *countingWriter
+	// encoding is the encoding to write the output in, if not UTF-8.
+	encoding encoding.Encoding
+	// inputNewline records whether the input ends with a newline.
+	inputNewline bool
+	// context is the element that a fragment is parsed within, or nil for
+	// a document.
+	context *html.Node
+	// markup is set for the printers of the markup of components.
+	markup bool
+	// componentNames holds the names of the component elements that were
+	// replaced before parsing.
+	componentNames []string
+	// selfClosing holds the component elements that are written
+	// self-closing.
+	selfClosing map[*html.Node]bool
+	// ctx, if set, cancels formatting when it is done.
+	ctx context.Context
+	// progress is how far formatting has got.
+	progress Progress
+	// linting is set for the printers that lint rather than format.
+	linting bool
+	// repaired, if set, collects the repairs that the parser makes to the
+	// input, for DocumentRepairs and FragmentRepairs.
+	repaired *[]Repair
+	// srcdocs holds the formatted values of srcdoc attributes, by their
+	// value in the input, when FormatSrcdoc is set.
+	srcdocs map[string]string
+}
+
+func (f *Formatter) newPrinter() *printer {
+	if f.Email {
+		f = f.email()
+	}
+	if f.XHTML {
+		f = f.xhtml()
+	}
+	return &printer{Formatter: f}
+}
+
+func (p *printer) document(w io.Writer, r io.Reader) (err error) {
+	w = newOutputWriter(w)
+	if p.Component != nil && !p.markup {
+		return p.component(w, r)
+	}
+	if r, err = p.preprocess(r); err != nil {
+		return err
+	}
+	if err = p.checkContext(); err != nil {
+		return err
+	}
+	nodes, err := p.parse(r)
+	if err == nil {
+		err = p.checkContext()
+	}
+	if err == nil {
+		err = p.printParsed(w, nodes)
+	}
 	if err != nil {
 		return err
 	}
-	return Nodes(w, []*html.Node{node})
+	p.reportProgress()
+	return nil
 }
 
-// Fragment formats a fragment of a HTML document.
-func Fragment(w io.Writer, r io.Reader) (err error) {
-	context := &html.Node{
-		Type: html.ElementNode,
+func (p *printer) fragment(w io.Writer, r io.Reader, contextTag string) (err error) {
+	w = newOutputWriter(w)
+	if p.Component != nil && !p.markup {
+		return p.component(w, r)
+	}
+	p.context = fragmentContext(contextTag)
+	if r, err = p.preprocess(r); err != nil {
+		return err
+	}
+	if err = p.checkContext(); err != nil {
+		return err
+	}
+	nodes, err := p.parse(r)
+	if err == nil {
+		err = p.checkContext()
+	}
+	if err == nil {
+		err = p.printParsed(w, nodes)
 	}
-	nodes, err := html.ParseFragment(r, context)
 	if err != nil {
 		return err
 	}
-	return Nodes(w, nodes)
+	p.reportProgress()
+	return nil
 }
 
-// Nodes formats a slice of HTML nodes.
-func Nodes(w io.Writer, nodes []*html.Node) (err error) {
-	for _, node := range nodes {
-		if err = printNode(w, node, 0); err != nil {
-			return
+// parse parses the preprocessed input as a document, or as a fragment if the
+// printer has a context element.
+func (p *printer) parse(r io.Reader) (nodes []*html.Node, err error) {
+	if p.context != nil {
+		nodes, err = html.ParseFragment(r, p.context)
+	} else {
+		var node *html.Node
+		node, err = html.Parse(r)
+		nodes = []*html.Node{node}
+	}
+	if err != nil {
+		return nil, err
+	}
+	if p.MaxDepth > 0 || p.MaxNodes > 0 {
+		if err = p.checkTreeLimits(nodes); err != nil {
+			return nil, err
 		}
 	}
-	return
+	p.restoreComponentTags(nodes)
+	if len(p.actions) > 0 {
+		for _, n := range nodes {
+			p.keepActionPairs(n)
+		}
+	}
+	fixEOFComment(nodes)
+	return nodes, nil
 }
 
-// The <pre> tag indicates that the text within it should always be formatted
-// as is. See https://github.com/ericchiang/pup/issues/33
-func printPre(w io.Writer, n *html.Node) (err error) {
-	switch n.Type {
-	case html.TextNode:
-		s := n.Data
-		if _, err = fmt.Fprint(w, s); err != nil {
-			return
+// fragmentContext returns the element that a fragment is parsed within. With
+// no tag, it is an element that the parser has no rules for.
+func fragmentContext(tag string) *html.Node {
+	tag = strings.ToLower(tag)
+	context := &html.Node{
+		Type:     html.ElementNode,
+		Data:     tag,
+		DataAtom: atom.Lookup([]byte(tag)),
+	}
+	if tag == "svg" || tag == "math" {
+		context.Namespace = tag
+	}
+	return context
+}
+
+// printParsed writes the nodes parsed from the preprocessed input.
+func (p *printer) printParsed(w io.Writer, nodes []*html.Node) (err error) {
+	if len(p.Elements) > 0 {
+		nodes = p.hoistVoidChildren(nodes)
+	}
+	if p.needsLocations() {
+		p.locate(nodes)
+	}
+	if p.stats != nil {
+		p.countNodes(nodes)
+	}
+	if p.Charset == TranscodeCharset {
+		for _, n := range nodes {
+			transcodeMetaCharsets(n)
+		}
+	}
+	if p.StripComments {
+		nodes = withParent(nodes, p.stripComments)
+	}
+	if policy, ok := p.Sanitizer.(*Policy); ok {
+		nodes = withParent(nodes, policy.sanitizeChildren)
+	}
+	if p.OnNode != nil {
+		nodes = withParent(nodes, p.applyOnNodeChildren)
+	}
+	if p.selection != nil {
+		nodes = p.selected(nodes)
+	}
+	if p.MaxPrintDepth > 0 {
+		nodes = withParent(nodes, func(n *html.Node) { p.elide(n, 0) })
+	}
+	if len(p.Preserve) > 0 {
+		if nodes, err = p.preserve(nodes); err != nil {
+			return err
 		}
-		for c := n.FirstChild; c != nil; c = c.NextSibling {
-			if err = printPre(w, c); err != nil {
+	}
+	if !p.Verify || p.selection != nil {
+		return p.print(w, nodes)
+	}
+	var out bytes.Buffer
+	if err = p.print(&out, nodes); err != nil {
+		return err
+	}
+	if err = p.verify(nodes, out.Bytes()); err != nil {
+		return err
+	}
+	_, err = w.Write(out.Bytes())
+	return err
+}
+
+// withParent calls fn with a node that is the parent of the parsed nodes,
+// which have none, so that it can change them as it would other children, and
+// returns the children that are left.
+func withParent(nodes []*html.Node, fn func(parent *html.Node)) (children []*html.Node) {
+	parent := &html.Node{Type: html.DocumentNode}
+	for _, n := range nodes {
+		parent.AppendChild(n)
+	}
+	fn(parent)
+	for parent.FirstChild != nil {
+		c := parent.FirstChild
+		parent.RemoveChild(c)
+		children = append(children, c)
+	}
+	return children
+}
+
+// preprocess reads the input and hides the parts of it that the parser must
+// not alter behind placeholders.
+func (p *printer) preprocess(r io.Reader) (io.Reader, error) {
+	src, err := p.readInput(p.trackReading(r))
+	if err != nil {
+		return nil, err
+	}
+	if p.Charset != AssumeUTF8 {
+		if src, err = p.decode(src); err != nil {
+			return nil, err
+		}
+	}
+	p.detectNewlines(src)
+	p.inputNewline = bytes.HasSuffix(src, []byte("\n")) || bytes.HasSuffix(src, []byte("\r"))
+	if _, ok := p.Sanitizer.(*Policy); p.Sanitizer != nil && !ok {
+		src = []byte(p.Sanitizer.Sanitize(string(src)))
+	}
+	if p.tracksOffsets() {
+		p.input = src
+	}
+	p.setVerbatimPrefix(src)
+	src = p.extractVerbatim(src)
+	src = p.extractConditionalComments(src)
+	src = p.extractCDATA(src)
+	src = p.protectNames(src)
+	if p.Template != nil {
+		if src, err = p.protectTemplates(src); err != nil {
+			return nil, err
+		}
+	}
+	src = p.escapeComments(src)
+	if p.tracksOffsets() {
+		p.src = src
+	}
+	if p.MaxDepth > 0 || p.MaxNodes > 0 {
+		if err = p.checkTokenLimits(src); err != nil {
+			return nil, err
+		}
+	}
+	switch {
+	case p.Strict:
+		err = p.checkRepairs()
+	case p.DuplicateAttributes == RejectDuplicates:
+		err = p.checkDuplicateAttributes()
+	}
+	if err != nil {
+		return nil, err
+	}
+	if p.repaired != nil {
+		*p.repaired = p.repairs()
+	}
+	return bytes.NewReader(src), nil
+}
+
+func (p *printer) print(w io.Writer, nodes []*html.Node) (err error) {
+	w, flush := p.encoder(w)
+	defer func() {
+		if ferr := flush(); err == nil {
+			err = ferr
+		}
+	}()
+	w, end := p.trailingNewline(w)
+	defer func() {
+		if eerr := end(); err == nil {
+			err = eerr
+		}
+	}()
+	bw := bufio.NewWriter(w)
+	defer func() {
+		if ferr := bw.Flush(); err == nil {
+			err = ferr
+		}
+	}()
+	w = bw
+	if p.stats != nil {
+		w = io.MultiWriter(w, &p.output)
+	}
+	if p.sourceMap != nil {
+		p.written = &countingWriter{w: w}
+		w = p.written
+	}
+	if p.NormalizeNewlines {
+		w = &newlineWriter{w: w, nl: p.newline()}
+	}
+	if len(p.actions) > 0 {
+		tw := &templateWriter{w: w, actions: p.actions}
+		defer func() {
+			if ferr := tw.Flush(); err == nil {
+				err = ferr
+			}
+		}()
+		w = tw
+	}
+	if p.OmitEndTags {
+		p.nextRoots = make(map[*html.Node]*html.Node, len(nodes))
+		for i := 1; i < len(nodes); i++ {
+			p.nextRoots[nodes[i-1]] = nodes[i]
+		}
+	}
+	if p.Mode != Minify {
+		return p.printSiblings(w, nodes, 0)
+	}
+	for i, node := range nodes {
+		// The nodes of a fragment have no siblings of their own.
+		if isEmptyTextNode(node) && i > 0 && i < len(nodes)-1 && p.separatesInline(nodes[i-1], nodes[i+1]) {
+			p.mark(node, 0)
+			if _, err = io.WriteString(w, " "); err != nil {
 				return
 			}
+			p.wrote(1)
+			continue
 		}
-	case html.ElementNode:
-		if _, err = fmt.Fprintf(w, "<%s", n.Data); err != nil {
+		if err = p.minifyNode(w, node); err != nil {
 			return
 		}
-		for _, a := range n.Attr {
-			val := html.EscapeString(a.Val)
-			if _, err = fmt.Fprintf(w, ` %s="%s"`, a.Key, val); err != nil {
-				return
+	}
+	return
+}
+
+// The <pre> tag indicates that the text within it, including the text of
+// descendant elements, should always be formatted as is.
+// See https://github.com/ericchiang/pup/issues/33
+func (p *printer) printPre(w io.Writer, n *html.Node) (err error) {
+	return walk(n, func(n *html.Node) (descend bool, err error) {
+		p.mark(n, 0)
+		switch n.Type {
+		case html.TextNode:
+			_, err = io.WriteString(w, p.newlines(p.escapeText(n, n.Data)))
+			return true, err
+		case html.ElementNode:
+			if err = p.printStartTag(w, n); err != nil {
+				return false, err
 			}
+			// The parser drops a newline immediately after these start tags,
+			// so one that is part of the content must be preceded by another.
+			if p.isPreformattedElement(n) && n.Namespace == "" && n.FirstChild != nil && n.FirstChild.Type == html.TextNode &&
+				strings.HasPrefix(n.FirstChild.Data, "\n") {
+				if _, err = io.WriteString(w, p.newline()); err != nil {
+					return false, err
+				}
+			}
+			return !p.hasNoEndTag(n), nil
+		case html.CommentNode:
+			if src, ok := p.verbatimSource(n); ok {
+				_, err = io.WriteString(w, src)
+				return false, err
+			}
+			if _, ok := p.templateAction(n); ok {
+				_, err = io.WriteString(w, n.Data)
+				return false, err
+			}
+			_, err = write(w, "<!--", p.newlines(n.Data), "-->")
+			return true, err
+		case html.DoctypeNode:
+			_, err = io.WriteString(w, p.doctype(n))
+			return false, err
 		}
-		if _, err = fmt.Fprint(w, ">"); err != nil {
-			return
+		return n.Type == html.DocumentNode, nil
+	}, func(n *html.Node) (err error) {
+		return p.printEndTag(w, n)
+	})
+}
+
+// printEndTag writes the end tag of n, if it is an element.
+func (p *printer) printEndTag(w io.Writer, n *html.Node) (err error) {
+	if n.Type == html.ElementNode {
+		_, err = io.WriteString(w, p.endTag(n))
+	}
+	return
+}
+
+// childLevel returns the level that the children of the element n are
+// indented to, when n is indented to level.
+func (p *printer) childLevel(n *html.Node, level int) int {
+	return level + p.childIndent(n)
+}
+
+// childIndent returns the number of levels that the children of the element
+// n are indented by relative to it.
+func (f *Formatter) childIndent(n *html.Node) int {
+	if levels, ok := f.ChildIndent[n.Data]; ok && n.Namespace == "" {
+		if levels < 0 {
+			return 0
 		}
-		if !isVoidElement(n) {
-			for c := n.FirstChild; c != nil; c = c.NextSibling {
-				if err = printPre(w, c); err != nil {
-					return
+		return levels
+	}
+	if f.FlatDocument && isDocumentElement(n) {
+		return 0
+	}
+	return 1
+}
+
+// isDocumentElement reports whether n is the <html>, <head> or <body>
+// element.
+func isDocumentElement(n *html.Node) bool {
+	return n.Namespace == "" && (n.DataAtom == atom.Html || n.DataAtom == atom.Head || n.DataAtom == atom.Body)
+}
+
+// minifyNode writes n with insignificant whitespace removed. Runs of
+// whitespace in text are collapsed to a single space, and whitespace-only text
+// is dropped, except in elements where whitespace is significant and between
+// inline-level siblings, where it is written as a single space.
+func (p *printer) minifyNode(w io.Writer, n *html.Node) (err error) {
+	return walk(n, func(n *html.Node) (descend bool, err error) {
+		if err = p.checkContext(); err != nil {
+			return false, err
+		}
+		p.wrote(1)
+		switch n.Type {
+		case html.TextNode:
+			s := n.Data
+			if !p.isSpecialContentElement(n.Parent) {
+				if isEmptyTextNode(n) && !p.separatesInline(n.PrevSibling, n.NextSibling) {
+					return false, nil
 				}
+				s = p.escapeText(n, collapseWhitespace(s))
+			} else {
+				s = p.wrapCDATA(n.Parent, s)
 			}
-			if _, err = fmt.Fprintf(w, "</%s>", n.Data); err != nil {
-				return
+			p.mark(n, 0)
+			_, err = io.WriteString(w, s)
+		case html.ElementNode:
+			if p.isPreformattedElement(n) {
+				return false, p.printPre(w, n)
+			}
+			p.mark(n, 0)
+			if err = p.printStartTag(w, n); err != nil {
+				return false, err
+			}
+			return !p.hasNoEndTag(n), nil
+		case html.CommentNode:
+			p.mark(n, 0)
+			if src, ok := p.verbatimSource(n); ok {
+				_, err = io.WriteString(w, src)
+				return false, err
 			}
+			if _, ok := p.templateAction(n); ok {
+				_, err = io.WriteString(w, n.Data)
+				return false, err
+			}
+			_, err = write(w, "<!--", n.Data, "-->")
+		case html.DoctypeNode:
+			p.mark(n, 0)
+			_, err = io.WriteString(w, p.doctype(n))
+		case html.DocumentNode:
+			return true, nil
 		}
-	case html.CommentNode:
-		data := n.Data
-		if _, err = fmt.Fprintf(w, "<!--%s-->\n", data); err != nil {
-			return
+		return false, err
+	}, func(n *html.Node) (err error) {
+		return p.printEndTag(w, n)
+	})
+}
+
+// walk calls enter for n and, if it returns true, for each of n's children
+// and their descendants in turn, and then exit for n. It keeps its place in
+// the tree without recursion, so that the depth of the tree is limited only
+// by memory.
+func walk(n *html.Node, enter func(n *html.Node) (descend bool, err error), exit func(n *html.Node) error) (err error) {
+	root := n
+	for {
+		descend, err := enter(n)
+		if err != nil {
+			return err
 		}
-		for c := n.FirstChild; c != nil; c = c.NextSibling {
-			if err = printPre(w, c); err != nil {
-				return
+		if descend && n.FirstChild != nil {
+			n = n.FirstChild
+			continue
+		}
+		if descend {
+			if err = exit(n); err != nil {
+				return err
 			}
 		}
-	case html.DoctypeNode, html.DocumentNode:
-		for c := n.FirstChild; c != nil; c = c.NextSibling {
-			if err = printPre(w, c); err != nil {
+		// Leave the nodes that have no more children to visit.
+		for n != root && n.NextSibling == nil {
+			n = n.Parent
+			if err = exit(n); err != nil {
+				return err
+			}
+		}
+		if n == root {
+			return nil
+		}
+		n = n.NextSibling
+	}
+}
+
+// collapseWhitespace replaces each run of whitespace in s with a single space.
+func collapseWhitespace(s string) string {
+	var sb strings.Builder
+	space := false
+	for _, r := range s {
+		if isHTMLSpace(r) {
+			if !space {
+				sb.WriteByte(' ')
+			}
+			space = true
+			continue
+		}
+		space = false
+		sb.WriteRune(r)
+	}
+	return sb.String()
+}
+
+func (p *printer) printStartTag(w io.Writer, n *html.Node) (err error) {
+	if p.isImplied(n) {
+		return nil
+	}
+	if _, err = write(w, "<", p.tagName(n)); err != nil {
+		return
+	}
+	if err = p.writeAttributes(w, n); err != nil {
+		return
+	}
+	_, err = io.WriteString(w, p.startTagEnd(n, " "))
+	return
+}
+
+// printAlignedStartTag writes the start tag of n, which has been indented to
+// level, with the attributes written, as written by attributes, aligned under
+// the first.
+func (p *printer) printAlignedStartTag(w io.Writer, n *html.Node, written []html.Attribute, attrs []string, level int) (err error) {
+	align := strings.Repeat(" ", utf8.RuneCountInString(p.tagName(n))+2)
+	if _, err = write(w, "<", p.tagName(n), " "); err != nil {
+		return
+	}
+	for i, a := range written {
+		for j, line := range p.wrapAttribute(a, attrs[i], level+1) {
+			if i > 0 || j > 0 {
+				if _, err = io.WriteString(w, p.newline()); err != nil {
+					return
+				}
+				if err = p.printIndent(w, level); err != nil {
+					return
+				}
+				if _, err = io.WriteString(w, align); err != nil {
+					return
+				}
+				if j > 0 {
+					if _, err = io.WriteString(w, p.indent()); err != nil {
+						return
+					}
+				}
+			}
+			if _, err = io.WriteString(w, line); err != nil {
 				return
 			}
 		}
 	}
+	_, err = io.WriteString(w, p.startTagEnd(n, " "))
 	return
 }
 
-// Is this node a tag with no end tag such as <meta> or <br>?
-// http://www.w3.org/TR/html-markup/syntax.html#syntax-elements
-func isVoidElement(n *html.Node) bool {
-	switch n.DataAtom {
-	case atom.Area, atom.Base, atom.Br, atom.Col, atom.Command, atom.Embed,
-		atom.Hr, atom.Img, atom.Input, atom.Keygen, atom.Link,
-		atom.Meta, atom.Param, atom.Source, atom.Track, atom.Wbr:
-		return true
+// startTagEnd returns the characters that close the start tag of n, where
+// space separates a self-closing slash from what comes before it.
+func (p *printer) startTagEnd(n *html.Node, space string) string {
+	if isEmptyForeignElement(n) || p.selfClosing[n] || p.SelfClose && p.isVoidElement(n) {
+		return space + "/>"
 	}
-	return false
+	return ">"
 }
 
-func isSpecialContentElement(n *html.Node) bool {
-	if n != nil {
-		switch n.DataAtom {
-		case atom.Style,
-			atom.Script:
-			return true
+// printIndentedStartTag writes the start tag of n, which has been indented to
+// level. If the tag would not fit within the print width, its attributes are
+// written one per line, indented by a further level.
+func (p *printer) printIndentedStartTag(w io.Writer, n *html.Node, level int) (err error) {
+	if p.PrintWidth <= 0 {
+		return p.printStartTag(w, n)
+	}
+	written := p.startTagAttributes(n)
+	if len(written) == 0 {
+		return p.printStartTag(w, n)
+	}
+	width := level*utf8.RuneCountInString(p.indent()) + utf8.RuneCountInString(p.tagName(n)) + 2
+	for _, a := range written {
+		name, quote, val, ok := p.attribute(n, a)
+		width += 1 + utf8.RuneCountInString(name)
+		if ok {
+			width += 1 + 2*len(quote) + utf8.RuneCountInString(val)
 		}
 	}
-	return false
+	if width <= p.PrintWidth {
+		return p.printStartTag(w, n)
+	}
+	attrs := p.attributes(n)
+	if p.AttributeAlignment == AlignAttributes {
+		return p.printAlignedStartTag(w, n, written, attrs, level)
+	}
+	if _, err = write(w, "<", p.tagName(n), p.newline()); err != nil {
+		return
+	}
+	for i, a := range written {
+		lines := p.wrapAttribute(a, attrs[i], level+1)
+		for j, line := range lines {
+			indent := level + 1
+			if j > 0 {
+				indent++
+			}
+			if err = p.printIndent(w, indent); err != nil {
+				return
+			}
+			if p.BracketSameLine && i == len(written)-1 && j == len(lines)-1 {
+				_, err = write(w, line, p.startTagEnd(n, " "))
+				return
+			}
+			if _, err = write(w, line, p.newline()); err != nil {
+				return
+			}
+		}
+	}
+	if err = p.printIndent(w, level); err != nil {
+		return
+	}
+	_, err = io.WriteString(w, p.startTagEnd(n, ""))
+	return
+}
+
+// dedentText returns the text s without its leading and trailing blank
+// lines, and without the indentation that its lines have in common, so that
+// content that is indented again keeps the indentation of its lines relative
+// to each other. A first line that continues the line of the start tag, as
+// in <script>if (a) {, has no indentation of its own, so it is left out when
+// finding the common indentation.
+func dedentText(s string) string {
+	lines := strings.Split(s, "\n")
+	var first []string
+	if len(lines) > 1 && strings.TrimSpace(lines[0]) != "" {
+		first, lines = []string{strings.TrimLeft(lines[0], " \t")}, lines[1:]
+	}
+	for len(first) == 0 && len(lines) > 0 && strings.TrimSpace(lines[0]) == "" {
+		lines = lines[1:]
+	}
+	for len(lines) > 0 && strings.TrimSpace(lines[len(lines)-1]) == "" {
+		lines = lines[:len(lines)-1]
+	}
+	for i, l := range lines {
+		if strings.TrimSpace(l) == "" {
+			lines[i] = ""
+		}
+	}
+	return strings.Join(append(first, dedent(lines)...), "\n")
 }
 
 func isEmptyTextNode(n *html.Node) bool {
-	return n.Type == html.TextNode && strings.TrimSpace(n.Data) == ""
+	return n.Type == html.TextNode && trimHTMLSpace(n.Data) == ""
 }
 
 func getFirstRune(s string) rune {
@@ -132,124 +1112,382 @@ func getFirstRune(s string) rune {
 	return r
 }
 
+// Is n followed by text starting with punctuation, which is kept on the same
+// line as n?
+func isFollowedByPunctuation(n *html.Node) bool {
+	return n.NextSibling != nil && n.NextSibling.Type == html.TextNode &&
+		unicode.IsPunct(getFirstRune(n.NextSibling.Data))
+}
+
+// hasSingleTextChild reports whether the only child of n is text that is not
+// just whitespace, which is written on the same line as n. Elements with only
+// whitespace are written as if they were empty.
 func hasSingleTextChild(n *html.Node) bool {
-	return n != nil && n.FirstChild != nil && n.FirstChild == n.LastChild && n.FirstChild.Type == html.TextNode
+	return n != nil && n.FirstChild != nil && n.FirstChild == n.LastChild && n.FirstChild.Type == html.TextNode &&
+		!isEmptyTextNode(n.FirstChild)
+}
+
+// endsWithEndTagOpen reports whether the raw text s of the element n ends
+// with the start of its end tag, such as "</script" in a script that the
+// input ends within, which whitespace written after it would complete.
+func endsWithEndTagOpen(n *html.Node, s string) bool {
+	end := "</" + n.Data
+	return len(s) >= len(end) && strings.EqualFold(s[len(s)-len(end):], end)
 }
 
-func printNode(w io.Writer, n *html.Node, level int) (err error) {
+// printNode writes n, apart from the content of elements, comments and
+// documents, which is returned for printSiblings to write.
+func (p *printer) printNode(w io.Writer, n *html.Node, level int) (content *siblings, err error) {
 	switch n.Type {
 	case html.TextNode:
-		s := n.Data
-		s = strings.TrimSpace(s)
+		s := trimHTMLSpace(n.Data)
 		if s != "" {
-			if !isSpecialContentElement(n.Parent) && !hasSingleTextChild(n.Parent) &&
-				(n.PrevSibling == nil || !unicode.IsPunct(getFirstRune(s))) {
-				if err = printIndent(w, level); err != nil {
+			if !p.isSpecialContentElement(n.Parent) && !p.keepsTextOnLine(n.Parent) && !p.continuesLine(n) {
+				if err = p.printIndent(w, level); err != nil {
 					return
 				}
 			}
-			if isSpecialContentElement(n.Parent) {
+			p.mark(n, len(n.Data)-len(strings.TrimLeft(n.Data, htmlSpace)))
+			if p.isMinified(n) {
+				s = p.wrapCDATA(n.Parent, trimBlankLines(n.Data))
+				if endsWithEndTagOpen(n.Parent, s) {
+					p.joinEnd = n.Parent
+					_, err = write(w, p.newline(), s)
+					return
+				}
+				_, err = write(w, p.newline(), s, p.newline())
+				return
+			}
+			if p.isSpecialContentElement(n.Parent) {
+				s = dedentText(n.Data)
+			}
+			s = p.escapeText(n, s)
+			if p.isSpecialContentElement(n.Parent) {
+				if ef := p.embeddedFormatter(n.Parent); ef != nil {
+					if s, err = ef.Format(n.Parent, s); err != nil {
+						return nil, fmt.Errorf("failed to format <%s> content: %w", n.Parent.Data, err)
+					}
+				}
+				s = p.wrapCDATA(n.Parent, s)
 				scanner := bufio.NewScanner(strings.NewReader(s))
 				for scanner.Scan() {
 					t := scanner.Text()
-					if _, err = fmt.Fprintln(w); err != nil {
+					if _, err = io.WriteString(w, p.newline()); err != nil {
 						return
 					}
-					if err = printIndent(w, level+1); err != nil {
+					if t == "" {
+						continue
+					}
+					if err = p.printIndent(w, level+1); err != nil {
 						return
 					}
-					if _, err = fmt.Fprint(w, t); err != nil {
+					if _, err = io.WriteString(w, t); err != nil {
 						return
 					}
 				}
 				if err = scanner.Err(); err != nil {
 					return
 				}
-				if _, err = fmt.Fprintln(w); err != nil {
+				if endsWithEndTagOpen(n.Parent, s) {
+					p.joinEnd = n.Parent
+					return
+				}
+				if _, err = io.WriteString(w, p.newline()); err != nil {
 					return
 				}
 			} else {
-				if _, err = fmt.Fprint(w, s); err != nil {
+				if p.wrapsText() && !p.keepsTextOnLine(n.Parent) {
+					s = p.wrapLines(collapseWhitespace(s), level)
+				}
+				if _, err = io.WriteString(w, s); err != nil {
 					return
 				}
-				if !hasSingleTextChild(n.Parent) {
-					if _, err = fmt.Fprint(w, "\n"); err != nil {
+				if !p.keepsTextOnLine(n.Parent) {
+					if _, err = io.WriteString(w, p.newline()); err != nil {
 						return
 					}
 				}
 			}
 		}
 	case html.ElementNode:
-		if err = printIndent(w, level); err != nil {
+		if p.isImplied(n) {
+			return &siblings{nodes: children(n), level: level}, nil
+		}
+		if err = p.printIndent(w, level); err != nil {
 			return
 		}
-		if _, err = fmt.Fprintf(w, "<%s", n.Data); err != nil {
+		if p.isPreformattedElement(n) {
+			if err = p.printPre(w, n); err != nil {
+				return
+			}
+			if !p.isFollowedByPunctuation(n) {
+				if _, err = io.WriteString(w, p.newline()); err != nil {
+					return
+				}
+			}
 			return
 		}
-		for _, a := range n.Attr {
-			val := html.EscapeString(a.Val)
-			if _, err = fmt.Fprintf(w, ` %s="%s"`, a.Key, val); err != nil {
+		p.mark(n, 0)
+		if line, ok := p.oneLine(n, level); ok {
+			if _, err = io.WriteString(w, line); err != nil {
 				return
 			}
+			if !p.isFollowedByPunctuation(n) {
+				_, err = io.WriteString(w, p.newline())
+			}
+			return
 		}
-		if _, err = fmt.Fprint(w, ">"); err != nil {
+		if err = p.printIndentedStartTag(w, n, level); err != nil {
 			return
 		}
-		if !hasSingleTextChild(n) {
-			if _, err = fmt.Fprint(w, "\n"); err != nil {
+		if p.wrapsContent(n) {
+			return nil, p.printWrapped(w, n, level)
+		}
+		if p.hasFlowContent(n) {
+			p.flow.Reset()
+			for c := n.FirstChild; c != nil; c = c.NextSibling {
+				p.writeFlow(&p.flow, c)
+			}
+			if _, err = write(w, string(bytes.TrimSpace(p.flow.Bytes())), p.endTag(n)); err != nil {
 				return
 			}
+			if !p.isFollowedByPunctuation(n) {
+				_, err = io.WriteString(w, p.newline())
+			}
+			return
 		}
-		if !isVoidElement(n) {
-			if err = printChildren(w, n, level+1); err != nil {
+		if !p.keepsTextOnLine(n) && (!p.hasNoEndTag(n) || !p.isFollowedByPunctuation(n)) {
+			if _, err = io.WriteString(w, p.newline()); err != nil {
 				return
 			}
-			if isSpecialContentElement(n) || !hasSingleTextChild(n) {
-				if err = printIndent(w, level); err != nil {
+		}
+		if !p.hasNoEndTag(n) {
+			content = &siblings{nodes: children(n), level: p.childLevel(n, level), end: n, endLevel: level}
+		}
+	case html.CommentNode:
+		if err = p.printIndent(w, level); err != nil {
+			return
+		}
+		p.mark(n, 0)
+		if src, ok := p.verbatimSource(n); ok {
+			_, err = write(w, src, p.newline())
+			return
+		}
+		if _, ok := p.templateAction(n); ok {
+			_, err = write(w, n.Data, p.newline())
+			return
+		}
+		if _, err = write(w, p.comment(n.Data, level), p.newline()); err != nil {
+			return
+		}
+		content = &siblings{nodes: children(n), level: level}
+	case html.DoctypeNode:
+		if err = p.printIndent(w, level); err != nil {
+			return
+		}
+		p.mark(n, 0)
+		_, err = write(w, p.doctype(n), p.newline())
+	case html.DocumentNode:
+		content = &siblings{nodes: children(n), level: level}
+	}
+	return
+}
+
+// printContentEnd writes the end tag of the element whose content has been
+// written, indented to level.
+func (p *printer) printContentEnd(w io.Writer, n *html.Node, level int) (err error) {
+	if p.joinEnd == n {
+		p.joinEnd = nil
+	} else if p.isSpecialContentElement(n) || !p.keepsTextOnLine(n) {
+		if p.omitsEndTag(n) {
+			return nil
+		}
+		if err = p.printIndent(w, level); err != nil {
+			return
+		}
+	}
+	if _, err = io.WriteString(w, p.endTag(n)); err != nil {
+		return
+	}
+	if !p.isFollowedByPunctuation(n) {
+		_, err = io.WriteString(w, p.newline())
+	}
+	return
+}
+
+func children(n *html.Node) (children []*html.Node) {
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		children = append(children, c)
+	}
+	return children
+}
+
+// siblings are nodes that are written in turn, indented to level, followed
+// by the end tag of the element end, if set, indented to endLevel.
+type siblings struct {
+	nodes []*html.Node
+	// next is the index of the next node to write.
+	next  int
+	level int
+	// blocks counts the template blocks that are open among the nodes written
+	// so far, each of which indents the nodes after it by one more level.
+	blocks   int
+	end      *html.Node
+	endLevel int
+}
+
+// printSiblings writes nodes, indented to level, and their descendants. The
+// content of each node is pushed onto a stack rather than written by a
+// recursive call, so that the depth of the tree is limited only by memory.
+func (p *printer) printSiblings(w io.Writer, nodes []*html.Node, level int) (err error) {
+	stack := []*siblings{{nodes: nodes, level: level}}
+	for len(stack) > 0 {
+		if err = p.checkContext(); err != nil {
+			return
+		}
+		s := stack[len(stack)-1]
+		if s.next == len(s.nodes) {
+			stack = stack[:len(stack)-1]
+			if s.end != nil {
+				if err = p.printContentEnd(w, s.end, s.endLevel); err != nil {
 					return
 				}
 			}
-			if _, err = fmt.Fprintf(w, "</%s>", n.Data); err != nil {
+			continue
+		}
+		i := s.next
+		if p.MaxBlankLines > 0 && i > 0 && i < len(s.nodes)-1 && isEmptyTextNode(s.nodes[i]) {
+			if err = p.printBlankLines(w, s.nodes[i]); err != nil {
 				return
 			}
-
-			if n.NextSibling == nil ||
-				(!unicode.IsPunct(getFirstRune(n.NextSibling.Data)) || n.NextSibling.Type == html.ElementNode) {
-				if _, err = fmt.Fprint(w, "\n"); err != nil {
+			p.wrote(1)
+			s.next++
+			continue
+		}
+		if p.strictWhitespace(s.nodes[i]) {
+			if run := p.strictRun(s.nodes[i:]); run > 0 {
+				if err = p.printFlow(w, s.nodes[i:i+run], s.level+s.blocks); err != nil {
 					return
 				}
+				p.wrote(run)
+				s.next += run
+				continue
 			}
 		}
-	case html.CommentNode:
-		if err = printIndent(w, level); err != nil {
-			return
+		if run := p.flowRun(s.nodes[i:]); run > 0 {
+			if err = p.printFlow(w, s.nodes[i:i+run], s.level+s.blocks); err != nil {
+				return
+			}
+			p.wrote(run)
+			s.next += run
+			continue
 		}
-		if _, err = fmt.Fprintf(w, "<!--%s-->\n", n.Data); err != nil {
-			return
+		child := s.nodes[i]
+		s.next++
+		p.wrote(1)
+		a, _ := p.templateAction(child)
+		if a.block == templateClose && s.blocks > 0 {
+			s.blocks--
 		}
-		if err = printChildren(w, n, level); err != nil {
-			return
+		childLevel := s.level + s.blocks
+		if a.block == templateMiddle && s.blocks > 0 {
+			childLevel--
 		}
-	case html.DoctypeNode, html.DocumentNode:
-		if err = printChildren(w, n, level); err != nil {
-			return
+		content, err := p.printNode(w, child, childLevel)
+		if err != nil {
+			return err
+		}
+		if a.block == templateOpen {
+			s.blocks++
+		}
+		if content != nil {
+			stack = append(stack, content)
 		}
 	}
 	return
 }
 
-func printChildren(w io.Writer, n *html.Node, level int) (err error) {
-	child := n.FirstChild
-	for child != nil {
-		if err = printNode(w, child, level); err != nil {
+// printBlankLines writes the blank lines in the whitespace n between two
+// siblings, up to MaxBlankLines of them.
+func (p *printer) printBlankLines(w io.Writer, n *html.Node) (err error) {
+	blank := strings.Count(n.Data, "\n") - 1
+	if blank > p.MaxBlankLines {
+		blank = p.MaxBlankLines
+	}
+	for i := 0; i < blank; i++ {
+		if _, err = io.WriteString(w, p.newline()); err != nil {
 			return
 		}
-		child = child.NextSibling
 	}
 	return
 }
 
-func printIndent(w io.Writer, level int) (err error) {
-	_, err = fmt.Fprint(w, strings.Repeat(" ", level))
+func (p *printer) printIndent(w io.Writer, level int) (err error) {
+	indent := p.indent()
+	if len(p.indents) < level*len(indent) {
+		// Keep the indentation of the deepest level so far, so that each
+		// level is a prefix of it.
+		p.indents = strings.Repeat(indent, level*2)
+	}
+	_, err = io.WriteString(w, p.indents[:level*len(indent)])
 	return err
 }
+
+func (f *Formatter) indent() string {
+	if f.Indent == "" {
+		return " "
+	}
+	return f.Indent
+}
+
+func (f *Formatter) newline() string {
+	if f.Newline == "" || f.Newline == DetectNewline {
+		return "\n"
+	}
+	return f.Newline
+}
+
+// newlines returns s, which the parser has normalized to have "\n" newlines,
+// with the configured newline instead.
+func (f *Formatter) newlines(s string) string {
+	if nl := f.newline(); nl != "\n" {
+		return strings.ReplaceAll(s, "\n", nl)
+	}
+	return s
+}
+
+// detectNewline returns the newline at the end of the first line of src, or
+// "\n" if it has only one line.
+func detectNewline(src []byte) string {
+	i := bytes.IndexAny(src, "\r\n")
+	switch {
+	case i < 0 || src[i] == '\n':
+		return "\n"
+	case i+1 < len(src) && src[i+1] == '\n':
+		return "\r\n"
+	}
+	return "\r"
+}
+
+// detectNewlines sets the newline of p to that of src, if it is to be
+// detected. p shares its Formatter with other calls, so it is copied.
+func (p *printer) detectNewlines(src []byte) {
+	if p.Newline != DetectNewline {
+		return
+	}
+	f := *p.Formatter
+	f.Newline = detectNewline(src)
+	p.Formatter = &f
+}
+
+// write writes each of s to w.
+func write(w io.Writer, s ...string) (n int, err error) {
+	for _, s := range s {
+		m, err := io.WriteString(w, s)
+		n += m
+		if err != nil {
+			return n, err
+		}
+	}
+	return n, nil
+}
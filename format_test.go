@@ -1,17 +1,23 @@
 package htmlformat
 
 import (
+	"encoding/json"
+	"errors"
+	"io"
+	"runtime/debug"
 	"strings"
 	"testing"
 
 	"github.com/google/go-cmp/cmp"
+	"golang.org/x/net/html"
 )
 
 func TestFormat(t *testing.T) {
 	tests := []struct {
-		name     string
-		input    string
-		expected string
+		name      string
+		formatter Formatter
+		input     string
+		expected  string
 	}{
 		{
 			name:  "missing closing tags are inserted",
@@ -38,6 +44,50 @@ func TestFormat(t *testing.T) {
 </ol>
 `,
 		},
+		{
+			name:  "character references in text are kept",
+			input: `<p>&lt;p&gt; &amp;amp; &#60;br&#x3e;</p><textarea>&lt;/textarea></textarea><script>a && b</script>`,
+			expected: `<p>&lt;p&gt; &amp;amp; &lt;br&gt;</p>
+<textarea>&lt;/textarea&gt;</textarea>
+<script>
+  a && b
+</script>
+`,
+		},
+		{
+			name:      "characters can be written as named entities",
+			formatter: Formatter{NamedEntities: true},
+			input:     `<p title="©&nbsp;2024">a&nbsp;b — “c” &#233;</p><script>"—"</script>`,
+			expected: `<p title="&copy;&nbsp;2024">a&nbsp;b &mdash; &ldquo;c&rdquo; &eacute;</p>
+<script>
+  "—"
+</script>
+`,
+		},
+		{
+			name:      "the declared charset of the input can be preserved",
+			formatter: Formatter{Charset: OriginalCharset},
+			input:     "<meta charset=iso-8859-1><p>caf\xe9 &rarr;</p>",
+			expected:  "<meta charset=\"iso-8859-1\">\n<p>caf\xe9 &#8594;</p>\n",
+		},
+		{
+			name:      "input can be transcoded to UTF-8",
+			formatter: Formatter{Charset: TranscodeCharset},
+			input:     `<meta http-equiv="Content-Type" content="text/html; charset=iso-8859-1"><p>caf` + "\xe9</p>",
+			expected:  "<meta http-equiv=\"Content-Type\" content=\"text/html; charset=utf-8\">\n<p>café</p>\n",
+		},
+		{
+			name:      "the content type takes precedence over the declared charset",
+			formatter: Formatter{Charset: TranscodeCharset, ContentType: "text/html; charset=shift_jis"},
+			input:     "<meta charset=iso-8859-1><p>\x93\xfa\x96\x7b</p>",
+			expected:  "<meta charset=\"utf-8\">\n<p>日本</p>\n",
+		},
+		{
+			name:      "undeclared input that is valid UTF-8 is not transcoded",
+			formatter: Formatter{Charset: OriginalCharset},
+			input:     `<p>café</p>`,
+			expected:  "<p>café</p>\n",
+		},
 		{
 			name:  "html elements are indented",
 			input: `<ol> <li class="name"> A </li> <li> B </li> </ol> `,
@@ -74,10 +124,1189 @@ body {
     text-color: red;
   }
 </style>
+`,
+		},
+		{
+			name:  "script content that starts on the line of its tag keeps its relative indentation",
+			input: "<div><script>if (a) {\n        b();\n      }</script></div>",
+			expected: `<div>
+ <script>
+   if (a) {
+     b();
+   }
+ </script>
+</div>
+`,
+		},
+		{
+			name:      "the newlines of preserved content can be normalized",
+			formatter: Formatter{Newline: "\r\n", NormalizeNewlines: true, MinifiedLineLength: 1},
+			input:     "<div><pre>a\r\nb\rc\nd</pre><script>x\n  y</script><!-- htmlformat:off --><p>\r\nq\n</p><!-- htmlformat:on --></div>",
+			expected:  "<div>\r\n <pre>a\r\nb\r\nc\r\nd</pre>\r\n <script>\r\nx\r\n  y\r\n </script>\r\n <!-- htmlformat:off --><p>\r\nq\r\n</p><!-- htmlformat:on -->\r\n</div>\r\n",
+		},
+		{
+			name:  "whitespace in pre descendants is preserved",
+			input: "<div><pre><code>  two\n  lines</code>\n  <b> x </b></pre></div>",
+			expected: `<div>
+ <pre><code>  two
+  lines</code>
+  <b> x </b></pre>
+</div>
+`,
+		},
+		{
+			name:  "whitespace in textarea is preserved",
+			input: "<form><textarea>  default\n    content </textarea></form>",
+			expected: `<form>
+ <textarea>  default
+    content </textarea>
+</form>
+`,
+		},
+		{
+			name:  "leading newlines in pre are preserved",
+			input: "<pre>\n\nx</pre>",
+			expected: `<pre>
+
+x</pre>
+`,
+		},
+		{
+			name: "style content can be formatted by an embedded formatter",
+			formatter: Formatter{
+				CSS: EmbeddedFormatterFunc(func(n *html.Node, content string) (string, error) {
+					return strings.ReplaceAll(strings.ReplaceAll(content, "{ ", "{\n  "), "; }", ";\n}"), nil
+				}),
+			},
+			input: `<style>body { color: red; }</style>`,
+			expected: `<style>
+  body {
+    color: red;
+  }
+</style>
+`,
+		},
+		{
+			name: "script content can be formatted by an embedded formatter",
+			formatter: Formatter{
+				JS: EmbeddedFormatterFunc(func(n *html.Node, content string) (string, error) {
+					return strings.ReplaceAll(content, "; ", ";\n"), nil
+				}),
+			},
+			input: `<script type="module">let a = 1; let b = 2;</script><script type="text/template">a; b</script>`,
+			expected: `<script type="module">
+  let a = 1;
+  let b = 2;
+</script>
+<script type="text/template">
+  a; b
+</script>
+`,
+		},
+		{
+			name: "regions between directive comments are not formatted",
+			input: `<div><p>a</p>
+<!-- htmlformat:off -->
+<table><tr><td>a</td>   <td>b</td></tr>
+       <tr><td>cc</td>  <td>d</td></tr></table>
+<!-- htmlformat:on -->
+<p>b</p></div>`,
+			expected: `<div>
+ <p>a</p>
+ <!-- htmlformat:off -->
+<table><tr><td>a</td>   <td>b</td></tr>
+       <tr><td>cc</td>  <td>d</td></tr></table>
+<!-- htmlformat:on -->
+ <p>b</p>
+</div>
+`,
+		},
+		{
+			name: "formatting is disabled until the end of the input without an on directive",
+			input: `<p>a</p><!--htmlformat:off--><b>
+  x</b>`,
+			expected: `<p>a</p>
+<!--htmlformat:off--><b>
+  x</b>
+`,
+		},
+		{
+			name:  "comments like placeholders are not taken for them",
+			input: `<!--htmlformat:verbatim:0--><div><!-- htmlformat:off --><p>  x  </p><!-- htmlformat:on --></div>`,
+			expected: `<!--htmlformat:verbatim:0-->
+<div>
+ <!-- htmlformat:off --><p>  x  </p><!-- htmlformat:on -->
+</div>
+`,
+		},
+		{
+			name:  "a region without an on directive ends at the end tag of its parent",
+			input: `<section><div><!-- htmlformat:off --><p>a</p></div><p>b</p></section>`,
+			expected: `<section>
+ <div>
+  <!-- htmlformat:off --><p>a</p>
+ </div>
+ <p>b</p>
+</section>
+`,
+		},
+		{
+			name:  "an on directive outside of the parent of the off directive does not end the region",
+			input: `<section><div><!-- htmlformat:off --><p>a</p></div><!-- htmlformat:on --><p>b</p></section>`,
+			expected: `<section>
+ <div>
+  <!-- htmlformat:off --><p>a</p>
+ </div>
+ <!-- htmlformat:on -->
+ <p>b</p>
+</section>
+`,
+		},
+		{
+			name:      "indentation and newlines can be configured",
+			formatter: Formatter{Indent: "\t", Newline: "\r\n"},
+			input:     `<ol><li>A</li><li><b>B</b></li></ol>`,
+			expected:  "<ol>\r\n\t<li>A</li>\r\n\t<li>\r\n\t\t<b>B</b>\r\n\t</li>\r\n</ol>\r\n",
+		},
+		{
+			name:      "the newline of the input can be detected",
+			formatter: Formatter{Newline: DetectNewline},
+			input:     "<div>\r\n<pre>a\r\nb</pre><!--x\r\ny--></div>\r\n",
+			expected:  "<div>\r\n <pre>a\r\nb</pre>\r\n <!--x\r\n  y-->\r\n</div>\r\n",
+		},
+		{
+			name:      "the trailing newline can be forbidden",
+			formatter: Formatter{TrailingNewline: ForbidTrailingNewline},
+			input:     "<p>a</p>\n\n",
+			expected:  "<p>a</p>",
+		},
+		{
+			name:      "the trailing newline can be required",
+			formatter: Formatter{Mode: Minify, TrailingNewline: RequireTrailingNewline},
+			input:     "<p>a</p>",
+			expected:  "<p>a</p>\n",
+		},
+		{
+			name:      "the trailing newline of the input can be preserved",
+			formatter: Formatter{TrailingNewline: OriginalTrailingNewline, Newline: "\r\n"},
+			input:     "<p>a</p><p>b</p>",
+			expected:  "<p>a</p>\r\n<p>b</p>",
+		},
+		{
+			name:      "start tags that exceed the print width have one attribute per line",
+			formatter: Formatter{PrintWidth: 40},
+			input:     `<div><input type="email" name="email" placeholder="you@example.com" required></div>`,
+			expected: `<div>
+ <input
+  type="email"
+  name="email"
+  placeholder="you@example.com"
+  required=""
+ >
+</div>
+`,
+		},
+		{
+			name:      "long class attribute values can be wrapped",
+			formatter: Formatter{PrintWidth: 40, WrapAttributeValues: true},
+			input:     `<div><div class="flex items-center justify-between px-4 py-2 text-sm" id="x">a</div></div>`,
+			expected: `<div>
+ <div
+  class="flex items-center
+   justify-between px-4 py-2 text-sm"
+  id="x"
+ >a</div>
+</div>
+`,
+		},
+		{
+			name:      "the end of wrapped start tags can be written on the line of the last attribute",
+			formatter: Formatter{PrintWidth: 30, BracketSameLine: true},
+			input:     `<div><a href="https://example.com/a" class="link">A</a><img src="a.png" alt="A picture" /></div>`,
+			expected: `<div>
+ <a
+  href="https://example.com/a"
+  class="link">A</a>
+ <img
+  src="a.png"
+  alt="A picture">
+</div>
+`,
+		},
+		{
+			name:      "wrapped attributes can be aligned under the first",
+			formatter: Formatter{PrintWidth: 30, AttributeAlignment: AlignAttributes, WrapAttributeValues: true},
+			input:     `<div><input type="text" name="email" class="field field-large field-wide" disabled></div>`,
+			expected: `<div>
+ <input type="text"
+        name="email"
+        class="field field-large
+         field-wide"
+        disabled="">
+</div>
+`,
+		},
+		{
+			name:      "long srcset and sizes values are wrapped after each item",
+			formatter: Formatter{PrintWidth: 40, WrapAttributeValues: true},
+			input:     `<img srcset="a.jpg?w=1,2 480w, b.jpg 800w,c.jpg 2x" sizes="(max-width: 600px) 480px, 50vw, 800px" alt="">`,
+			expected: `<img
+ srcset="a.jpg?w=1,2 480w,
+  b.jpg 800w,
+  c.jpg 2x"
+ sizes="(max-width: 600px) 480px,
+  50vw,
+  800px"
+ alt=""
+>
+`,
+		},
+		{
+			name:      "single line elements are written on one line",
+			formatter: Formatter{SingleLineElements: DefaultSingleLineElements},
+			input:     "<form><label>Name <input name=a></label><button>Save <b>now</b></button><fieldset><legend>A <i>b</i></legend></fieldset><div>a <b>b</b></div></form>",
+			expected: `<form>
+ <label>Name <input name="a"></label>
+ <button>Save <b>now</b></button>
+ <fieldset>
+  <legend>A <i>b</i></legend>
+ </fieldset>
+ <div>
+  a
+  <b>b</b>
+ </div>
+</form>
+`,
+		},
+		{
+			name:      "single line elements that do not fit are written across several lines",
+			formatter: Formatter{SingleLineElements: []string{"button", "dt"}, PrintWidth: 20},
+			input:     "<button>Save <b>all of the changes</b></button><dt>A <b>b</b></dt>",
+			expected: `<button>
+ Save
+ <b>all of the changes</b>
+</button>
+<dt>A <b>b</b></dt>
+`,
+		},
+		{
+			name:      "template content is formatted as other children are",
+			formatter: Formatter{Verify: true},
+			input:     `<ul><template><li>a<template><tr><td>b</td></tr></template></li></template><li>c</li></ul>`,
+			expected: `<ul>
+ <template>
+  <li>
+   a
+   <template>
+    <tr>
+     <td>b</td>
+    </tr>
+   </template>
+  </li>
+ </template>
+ <li>c</li>
+</ul>
+`,
+		},
+		{
+			name:      "declarative shadow roots are formatted",
+			formatter: Formatter{OmitEndTags: true, Verify: true},
+			input:     `<my-card><template shadowrootmode="open"><style>p{}</style><p>a<slot></slot></template><span>light</span></my-card>`,
+			expected: `<my-card>
+ <template shadowrootmode="open">
+  <style>
+    p{}
+  </style>
+  <p>
+   a
+   <slot>
+   </slot>
+ </template>
+ <span>light</span>
+</my-card>
+`,
+		},
+		{
+			name:      "style declarations can be normalized",
+			formatter: Formatter{NormalizeStyles: true},
+			input:     `<p style="color:red ;margin :0  auto;;background:url(&quot;a;b.png&quot;)">x</p><p style="  ">y</p>`,
+			expected:  "<p style=\"color: red; margin: 0 auto; background: url(&#34;a;b.png&#34;);\">x</p>\n<p style=\"\">y</p>\n",
+		},
+		{
+			name:      "the last semicolon of style declarations can be kept as it is",
+			formatter: Formatter{NormalizeStyles: true, StyleSemicolon: OriginalSemicolon, Quotes: SingleQuotes},
+			input:     `<p style="color:red;content:'a'">x</p><p style="color:red;">y</p>`,
+			expected:  "<p style=\"color: red; content: 'a'\">x</p>\n<p style='color: red;'>y</p>\n",
+		},
+		{
+			name:      "long style attribute values are wrapped after each declaration",
+			formatter: Formatter{PrintWidth: 40, WrapAttributeValues: true, NormalizeStyles: true, StyleSemicolon: ForbidSemicolon},
+			input:     `<div style="display:flex;gap:1rem;font-family:'A B', sans-serif" id="x">a</div>`,
+			expected: `<div
+ style="display: flex;
+  gap: 1rem;
+  font-family: &#39;A B&#39;, sans-serif"
+ id="x"
+>a</div>
+`,
+		},
+		{
+			name:      "class names can be sorted",
+			formatter: Formatter{SortClasses: true},
+			input:     `<p class=" b a  c a">x</p><svg class="z y"></svg>`,
+			expected: `<p class="a b c">x</p>
+<svg class="y z" />
+`,
+		},
+		{
+			name:      "empty attributes can be dropped",
+			formatter: Formatter{DropEmptyAttributes: true},
+			input:     `<p class="" id="" data-x="">a</p><img src="a.png" alt="" title=""><input value="" disabled="" style="">`,
+			expected: `<p data-x="">a</p>
+<img src="a.png" alt="" title="">
+<input value="" disabled="">
+`,
+		},
+		{
+			name:      "comments can be stripped",
+			formatter: Formatter{StripComments: true, KeepComments: []string{"!"}},
+			input:     "<!--! License --><p>a<!-- note -->b</p><!--[if IE]><p>IE</p><![endif]--><!-- htmlformat:off --><i>  x  </i><!-- htmlformat:on -->",
+			expected: `<!--! License -->
+<p>ab</p>
+<!--[if IE]><p>IE</p><![endif]-->
+<!-- htmlformat:off --><i>  x  </i><!-- htmlformat:on -->
+`,
+		},
+		{
+			name:      "void elements can be self-closed",
+			formatter: Formatter{SelfClose: true},
+			input:     `<p>a<br>b<img src="x.png" alt=""></p>`,
+			expected: `<p>
+ a
+ <br />
+ b
+ <img src="x.png" alt="" />
+</p>
+`,
+		},
+		{
+			name:      "wrapped void elements are self-closed",
+			formatter: Formatter{SelfClose: true, PrintWidth: 20},
+			input:     `<img src="image.png" alt="An image">`,
+			expected: `<img
+ src="image.png"
+ alt="An image"
+/>
+`,
+		},
+		{
+			name:      "attribute values can be single quoted",
+			formatter: Formatter{Quotes: SingleQuotes},
+			input:     `<a href="/" title="it's" data-x='say "hi"'>x</a>`,
+			expected: `<a href='/' title="it's" data-x='say "hi"'>x</a>
+`,
+		},
+		{
+			name:      "attribute quoting can be preserved",
+			formatter: Formatter{Quotes: OriginalQuotes},
+			input:     `<a href='/' class=c title="t" data-x='a&quot;b'>x</a><svg viewBox='0 0 1 1'></svg>`,
+			expected: `<a href='/' class=c title="t" data-x='a"b'>x</a>
+<svg viewBox='0 0 1 1' />
+`,
+		},
+		{
+			name:      "XHTML is well-formed XML",
+			formatter: Formatter{XHTML: true, Verify: true, NamedEntities: true, Quotes: MinimalQuotes},
+			input:     `<p class=a class=b title="it's">a&nbsp;b<br><input disabled v-else><svg><use xlink:href="#a"/></svg></p><style>p > a {}</style>`,
+			expected: `<p class="a" title="it&#39;s">
+ a` + "\u00a0" + `b
+ <br />
+ <input disabled="disabled" v-else="" />
+ <svg xmlns="http://www.w3.org/2000/svg" xmlns:xlink="http://www.w3.org/1999/xlink">
+  <use xlink:href="#a" />
+ </svg>
+</p>
+<style>
+  /*<![CDATA[*/
+  p > a {}
+  /*]]>*/
+</style>
+`,
+		},
+		{
+			name:     "non-breaking spaces are not whitespace",
+			input:    "<p>\u00a0a\u00a0</p><p>\u00a0</p>",
+			expected: "<p>\u00a0a\u00a0</p>\n<p>\u00a0</p>\n",
+		},
+		{
+			name:      "email keeps the whitespace in tables",
+			formatter: Formatter{Email: true, SelfClose: true, Verify: true},
+			input:     "<table><tr><td><img src=a.png><img src=b.png>\n <a href=x>Go</a>&nbsp;now</td></tr></table>\n<!--[if mso]><v:rect  fill=\"true\"><![endif]-->\n<div><p>a&nbsp;b</p><br></div>",
+			expected: `<table><tbody><tr><td><img src="a.png"><img src="b.png"> <a href="x">Go</a>&nbsp;now</td></tr></tbody></table>
+<!--[if mso]><v:rect  fill="true"><![endif]-->
+<div>
+ <p>a&nbsp;b</p>
+ <br>
+</div>
+`,
+		},
+		{
+			name:      "optional end tags can be omitted",
+			formatter: Formatter{OmitEndTags: true, Verify: true, PrintWidth: 80},
+			input:     `<ul><li>a</li> <li><p>b</p></li></ul><p>c</p><div>d</div><p>e</p><!-- f --><a href="/"><p>g</p></a><table><tr><td>1</td><td>2</td></tr></table><dl><dt>h</dt><dd>i</dd></dl>`,
+			expected: `<ul>
+ <li>a
+ <li>
+  <p>b
+</ul>
+<p>c
+<div>d</div>
+<p>e</p>
+<!-- f -->
+<a href="/">
+ <p>g</p>
+</a>
+<table>
+ <tbody>
+  <tr>
+   <td>1
+   <td>2
+</table>
+<dl>
+ <dt>h
+ <dd>i
+</dl>
+`,
+		},
+		{
+			name:      "the case of tag and attribute names can be preserved",
+			formatter: Formatter{Case: OriginalCase},
+			input:     `<DIV onClick="f()"><Input DISABLED><svg viewBox="0 0 1 1"></svg></DIV>`,
+			expected: `<DIV onClick="f()">
+ <Input DISABLED="">
+ <svg viewBox="0 0 1 1" />
+</DIV>
+`,
+		},
+		{
+			name:      "HTML tag names can be written in uppercase",
+			formatter: Formatter{Case: UppercaseTags, PrintWidth: 80},
+			input:     `<div onClick="f()"><p>a <b>b</b></p><svg viewBox="0 0 1 1"><foreignObject></foreignObject></svg></div>`,
+			expected: `<DIV onclick="f()">
+ <P>a <B>b</B></P>
+ <svg viewBox="0 0 1 1">
+  <foreignObject />
+ </svg>
+</DIV>
+`,
+		},
+		{
+			name:      "attribute quotes can be omitted where possible",
+			formatter: Formatter{Quotes: MinimalQuotes},
+			input:     `<a href="/a?b=c" class="c" title="a b" alt="">x</a>`,
+			expected: `<a href="/a?b=c" class=c title="a b" alt="">x</a>
+`,
+		},
+		{
+			name:  "framework attributes are written as they are",
+			input: `<div @click="a > b && c" :class="{ 'x': y }" x-data='{ "open": false }' v-else="" #myRef *ngIf="show" [ngModel]="v" (ngModelChange)="f('&amp;')">x</div>`,
+			expected: `<div @click="a > b && c" :class="{ 'x': y }" x-data='{ "open": false }' v-else #myRef *ngIf="show" [ngModel]="v" (ngModelChange)="f('&')">x</div>
+`,
+		},
+		{
+			name:      "framework attributes escape the quote that delimits them",
+			formatter: Formatter{Quotes: SingleQuotes},
+			input:     `<div x-text="'a' + &quot;b&quot;" x-on:click="go(&amp;x)" onClick="y">x</div>`,
+			expected: `<div x-text='&#39;a&#39; + "b"' x-on:click='go(&amp;x)' onclick='y'>x</div>
+`,
+		},
+		{
+			name:      "the first of duplicate attributes can be kept",
+			formatter: Formatter{DuplicateAttributes: FirstDuplicate, Template: GoTemplate},
+			input:     `<div class="a" id="x" class="b" {{ if .X }}hidden{{ end }}>x</div>`,
+			expected: `<div class="a" id="x" {{ if .X }}hidden{{ end }}>x</div>
+`,
+		},
+		{
+			name:      "the last of duplicate attributes can be kept",
+			formatter: Formatter{DuplicateAttributes: LastDuplicate, Verify: true},
+			input:     `<div class="a" id="x" class="b">x</div>`,
+			expected: `<div class="b" id="x">x</div>
+`,
+		},
+		{
+			name:      "boolean attributes can be written without values",
+			formatter: Formatter{Booleans: MinimalBooleans},
+			input:     `<input required="" disabled="Disabled" hidden="until-found" value=""><svg><path disabled=""/></svg>`,
+			expected: `<input required disabled hidden="until-found" value="">
+<svg>
+ <path disabled="" />
+</svg>
+`,
+		},
+		{
+			name:      "boolean attributes can be written with explicit values",
+			formatter: Formatter{Booleans: ExplicitBooleans},
+			input:     `<option selected>a</option><details open="">b</details>`,
+			expected: `<option selected="selected">a</option>
+<details open="open">b</details>
+`,
+		},
+		{
+			name:      "inline elements are kept in the text flow",
+			formatter: Formatter{InlineElements: DefaultInlineElements},
+			input: `<div>Some <em>emphasised</em>,
+   <a href="/">linked</a> text<ul><li><a href="/">Home</a></li></ul>after <b>it</b></div>`,
+			expected: `<div>
+ Some <em>emphasised</em>, <a href="/">linked</a> text
+ <ul>
+  <li><a href="/">Home</a></li>
+ </ul>
+ after <b>it</b>
+</div>
+`,
+		},
+		{
+			name:      "elements outside the inline set are not kept in the text flow",
+			formatter: Formatter{InlineElements: []string{"b"}},
+			input:     `<p>a <b>b</b> <i>c</i></p>`,
+			expected: `<p>
+ a <b>b</b>
+ <i>c</i>
+</p>
+`,
+		},
+		{
+			name:      "elements with inline content that fit within the print width are written on one line",
+			formatter: Formatter{PrintWidth: 40},
+			input: `<ul><li><a href="/">Home</a></li><li>A <a href="/about">longer link</a>, with <em>emphasis</em></li><li></li></ul>
+<p>Some
+  text</p>`,
+			expected: `<ul>
+ <li><a href="/">Home</a></li>
+ <li>
+  A
+  <a href="/about">longer link</a>, with
+  <em>emphasis</em>
+ </li>
+ <li></li>
+</ul>
+<p>Some text</p>
+`,
+		},
+		{
+			name:      "blank lines between siblings can be kept",
+			formatter: Formatter{MaxBlankLines: 1},
+			input:     "<div>\n\n<h1>A</h1>\n\n\n\n<p>B</p>\n<p>C</p>\r\n\r\n<p>D</p>\n\n</div>",
+			expected: `<div>
+ <h1>A</h1>
+
+ <p>B</p>
+ <p>C</p>
+
+ <p>D</p>
+</div>
+`,
+		},
+		{
+			name: "multi-line comments are re-indented",
+			input: `<div><div><!-- a -->
+        <!--
+          Notes:
+            - b
+          c
+        -->
+<!-- d
+     e --></div></div>`,
+			expected: `<div>
+ <div>
+  <!-- a -->
+  <!--
+   Notes:
+     - b
+   c
+  -->
+  <!-- d
+   e -->
+ </div>
+</div>
+`,
+		},
+		{
+			name:      "long comment lines can be wrapped",
+			formatter: Formatter{WrapComments: true, PrintWidth: 24},
+			input: `<div><!-- one two three four five six -->
+<!--
+  seven eight nine ten eleven
+    - twelve thirteen fourteen
+--></div>`,
+			expected: `<div>
+ <!-- one two three four
+  five six -->
+ <!--
+  seven eight nine ten
+  eleven
+    - twelve thirteen
+    fourteen
+ -->
+</div>
+`,
+		},
+		{
+			name:  "character references in comments are kept",
+			input: `<div><!-- &amp; &lt;b&gt; --><!&gt;></div>`,
+			expected: `<div>
+ <!-- &amp; &lt;b&gt; -->
+ <!--&gt;-->
+</div>
+`,
+		},
+		{
+			name: "downlevel-hidden conditional comments are preserved",
+			input: `<div><!--[if mso]>
+<table><tr><td  width="600">
+<![endif]--><p>a</p></div>`,
+			expected: `<div>
+ <!--[if mso]>
+<table><tr><td  width="600">
+<![endif]-->
+ <p>a</p>
+</div>
+`,
+		},
+		{
+			name:  "downlevel-revealed conditional comment markers are preserved",
+			input: `<div><![if !IE]><p>a</p><![endif]><!--[if !mso]><!--><p>b</p><!--<![endif]--></div>`,
+			expected: `<div>
+ <![if !IE]>
+ <p>a</p>
+ <![endif]>
+ <!--[if !mso]><!-->
+ <p>b</p>
+ <!--<![endif]-->
+</div>
+`,
+		},
+		{
+			name:  "text like conditional comments in raw text and attributes is not a conditional comment",
+			input: `<script>var s = "<!--[if IE]>x<![endif]-->";</script><style>a{content:"<![if IE]>"}</style><textarea><!--[if IE]>x<![endif]--></textarea><p title="<!--[if IE]>x<![endif]-->">a</p>`,
+			expected: `<script>
+  var s = "<!--[if IE]>x<![endif]-->";
+</script>
+<style>
+  a{content:"<![if IE]>"}
+</style>
+<textarea>&lt;!--[if IE]&gt;x&lt;![endif]--&gt;</textarea>
+<p title="&lt;!--[if IE]&gt;x&lt;![endif]--&gt;">a</p>
+`,
+		},
+		{
+			name:  "text like CDATA sections in attribute values is not a CDATA section",
+			input: `<div title="<![CDATA[x]]>"><svg><text a='<![CDATA[y]]>'><![CDATA[z]]></text></svg></div>`,
+			expected: `<div title="&lt;![CDATA[x]]&gt;">
+ <svg>
+  <text a="&lt;![CDATA[y]]&gt;">
+   <![CDATA[z]]>
+  </text>
+ </svg>
+</div>
+`,
+		},
+		{
+			name: "CDATA sections are preserved",
+			input: `<svg><style><![CDATA[ a > b { } ]]></style><text><![CDATA[x < y && z]]></text></svg><p><![CDATA[<b>]]></p><script>//<![CDATA[
+x < y
+//]]></script>`,
+			expected: `<svg>
+ <style>
+  <![CDATA[ a > b { } ]]>
+ </style>
+ <text>
+  <![CDATA[x < y && z]]>
+ </text>
+</svg>
+<p>
+ <![CDATA[<b>]]>
+</p>
+<script>
+  //<![CDATA[
+  x < y
+  //]]>
+</script>
+`,
+		},
+		{
+			name:      "script and style content can be wrapped in CDATA sections",
+			formatter: Formatter{WrapCDATA: true},
+			input:     `<style>a { }</style><script>let a;</script><script type="application/json">{}</script>`,
+			expected: `<style>
+  /*<![CDATA[*/
+  a { }
+  /*]]>*/
+</style>
+<script>
+  //<![CDATA[
+  let a;
+  //]]>
+</script>
+<script type="application/json">
+  {}
+</script>
+`,
+		},
+		{
+			name:  "inline SVG keeps its case, namespaces and self-closing elements",
+			input: `<svg viewbox="0 0 10 10" xmlns:xlink="http://www.w3.org/1999/xlink"><lineargradient id="g"><stop offset="0"/></lineargradient><use xlink:href="#a"></use><foreignobject><p>a<br/>b</p></foreignobject></svg>`,
+			expected: `<svg viewBox="0 0 10 10" xmlns:xlink="http://www.w3.org/1999/xlink">
+ <linearGradient id="g">
+  <stop offset="0" />
+ </linearGradient>
+ <use xlink:href="#a" />
+ <foreignObject>
+  <p>
+   a
+   <br>
+   b
+  </p>
+ </foreignObject>
+</svg>
+`,
+		},
+		{
+			name:  "whitespace in MathML token elements is preserved",
+			input: `<math display="block"><mrow><mi>x</mi><mo>=</mo><mtext> if  y </mtext><mspace width="1em"></mspace></mrow></math>`,
+			expected: `<math display="block">
+ <mrow>
+  <mi>x</mi>
+  <mo>=</mo>
+  <mtext> if  y </mtext>
+  <mspace width="1em" />
+ </mrow>
+</math>
+`,
+		},
+		{
+			name:      "MathML is kept in the text flow with the inline elements",
+			formatter: Formatter{InlineElements: DefaultInlineElements},
+			input:     `<p>where <math><msup><mi>x</mi><mn>2</mn></msup><mtext> is  odd</mtext></math> holds</p>`,
+			expected: `<p>where <math><msup><mi>x</mi><mn>2</mn></msup><mtext> is  odd</mtext></math> holds</p>
+`,
+		},
+		{
+			name:      "legacy tags can be registered as void",
+			formatter: Formatter{Elements: map[string]ElementBehavior{"spacer": VoidElement}},
+			input:     `<div><spacer type="block" width="10"><font>a</font><bgsound src="a.mid"></div>`,
+			expected: `<div>
+ <spacer type="block" width="10">
+ <font>a</font>
+ <bgsound src="a.mid">
+</div>
+`,
+		},
+		{
+			name: "custom elements can be registered as void, preformatted or inline",
+			formatter: Formatter{Elements: map[string]ElementBehavior{
+				"my-icon":    VoidElement,
+				"code-block": PreformattedElement,
+				"x-chip":     InlineElement,
+				"pre":        BlockElement,
+			}},
+			input: `<div><my-icon name="a"><p>Some <x-chip>chip</x-chip> text</p><code-block>  a
+    b</code-block><pre> c </pre></div><my-icon>d`,
+			expected: `<div>
+ <my-icon name="a">
+ <p>Some <x-chip>chip</x-chip> text</p>
+ <code-block>  a
+    b</code-block>
+ <pre>c</pre>
+</div>
+<my-icon>
+d
+`,
+		},
+		{
+			name:      "attributes can be sorted alphabetically",
+			formatter: Formatter{SortAttributes: true},
+			input:     `<a title="t" href="/" class="c">x</a>`,
+			expected: `<a class="c" href="/" title="t">x</a>
+`,
+		},
+		{
+			name: "attributes can be ordered by priority",
+			formatter: Formatter{
+				SortAttributes:    true,
+				AttributePriority: []string{"id", "class", "name", "*", "data-*"},
+			},
+			input: `<input data-b="2" type="text" data-a="1" name="n" class="c" id="i" autocomplete="off">`,
+			expected: `<input id="i" class="c" name="n" autocomplete="off" type="text" data-a="1" data-b="2">
+`,
+		},
+		{
+			name:      "attribute priority keeps input order within a rank",
+			formatter: Formatter{AttributePriority: []string{"class"}},
+			input:     `<div title="t" data-x="x" class="c">x</div>`,
+			expected: `<div class="c" title="t" data-x="x">x</div>
+`,
+		},
+		{
+			name:      "long text is wrapped at the print width",
+			formatter: Formatter{PrintWidth: 30, WrapText: true},
+			input:     "<div><p>The quick brown fox\n   jumps over the lazy dog again.</p>Text before <a href=\"/a b\">a link</a> and after it, at length.<pre>  kept   as   it   is  </pre></div>",
+			expected: `<div>
+ <p>
+  The quick brown fox jumps
+  over the lazy dog again.
+ </p>
+ Text before
+ <a href="/a b">a link</a>
+ and after it, at length.
+ <pre>  kept   as   it   is  </pre>
+</div>
+`,
+		},
+		{
+			name:      "wrapped flow content is not broken within tags",
+			formatter: Formatter{PrintWidth: 30, WrapText: true, InlineElements: DefaultInlineElements},
+			input:     `<p>Some words <a href="/a b" title="x y">linked text</a> done.</p>`,
+			expected: `<p>
+ Some words
+ <a href="/a b" title="x y">linked
+ text</a> done.
+</p>
+`,
+		},
+		{
+			name:      "phrasing elements are inline with css whitespace sensitivity",
+			formatter: Formatter{Whitespace: CSSWhitespace},
+			input:     `<p>Some <em>words</em>, <a href="/">linked</a>.</p><div><span>a</span><span>b</span></div>`,
+			expected: `<p>Some <em>words</em>, <a href="/">linked</a>.</p>
+<div><span>a</span><span>b</span></div>
+`,
+		},
+		{
+			name:      "whitespace is neither added nor removed with strict whitespace sensitivity",
+			formatter: Formatter{Whitespace: StrictWhitespace},
+			input:     "<ul>\n<li>a</li><li>b</li>\n<li> c </li>\n</ul>\n<div>\n<p>x</p><p>y</p>\n</div>",
+			expected: `<ul>
+ <li>a</li><li>b</li>
+ <li>
+  c
+ </li>
+</ul>
+<div>
+ <p>x</p><p>y</p>
+</div>
+`,
+		},
+		{
+			name:      "a fragment of text is written with strict whitespace",
+			formatter: Formatter{Whitespace: StrictWhitespace},
+			input:     "hello",
+			expected:  "hello\n",
+		},
+		{
+			name:      "a fragment of text that looks like markup is written with strict whitespace",
+			formatter: Formatter{Whitespace: StrictWhitespace},
+			input:     "a & b < c {{",
+			expected:  "a &amp; b &lt; c {{\n",
+		},
+		{
+			name:      "a fragment ending with the start of an end tag is written with strict whitespace",
+			formatter: Formatter{Whitespace: StrictWhitespace},
+			input:     "</",
+			expected:  "&lt;/\n",
+		},
+		{
+			name:      "every element is on a line of its own with ignored whitespace",
+			formatter: Formatter{Whitespace: IgnoreWhitespace, InlineElements: DefaultInlineElements},
+			input:     `<p>Some <em>words</em>, done.</p>`,
+			expected: `<p>
+ Some
+ <em>words</em>
+ , done.
+</p>
+`,
+		},
+		{
+			name:      "elements matching the preserved selectors are written as they are",
+			formatter: Formatter{Preserve: []string{"pre.highlight, .raw"}},
+			input:     "<div><p class=raw>a   <b>b</b>\n</p><pre class=\"highlight\"><span>  x</span>\n</pre><p> c </p></div>",
+			expected: `<div>
+ <p class="raw">a   <b>b</b>
+</p>
+ <pre class="highlight"><span>  x</span>
+</pre>
+ <p>c</p>
+</div>
+`,
+		},
+		{
+			name:      "JSON scripts are pretty-printed",
+			formatter: Formatter{FormatJSON: true},
+			input:     `<script type="application/ld+json">{"@type":"Person","sameAs":["a","b"]}</script><script type=importmap>{}</script><script>{"a":1}</script>`,
+			expected: `<script type="application/ld+json">
+  {
+   "@type": "Person",
+   "sameAs": [
+    "a",
+    "b"
+   ]
+  }
+</script>
+<script type="importmap">
+  {}
+</script>
+<script>
+  {"a":1}
+</script>
+`,
+		},
+		{
+			name:      "invalid JSON can be kept as it is",
+			formatter: Formatter{FormatJSON: true, KeepInvalidJSON: true},
+			input:     "<script type=\"application/json\">\n    {\"a\":\n    1,}\n</script>",
+			expected:  "<script type=\"application/json\">\n  {\"a\":\n  1,}\n</script>\n",
+		},
+		{
+			name:      "srcdoc documents are formatted",
+			formatter: Formatter{FormatSrcdoc: true, Verify: true},
+			input:     `<iframe srcdoc="<p class=&quot;a&quot;>Hi &amp; bye</p><ul><li>A</ul>"></iframe><iframe srcdoc="<div>"></iframe>`,
+			expected:  "<iframe srcdoc=\"<p class='a'>Hi &amp;amp; bye</p>\n<ul>\n <li>A</li>\n</ul>\">\n</iframe>\n<iframe srcdoc=\"<div>\n</div>\">\n</iframe>\n",
+		},
+		{
+			name:      "minified scripts and styles are written as they are",
+			formatter: Formatter{MinifiedLineLength: 20, JS: EmbeddedFormatterFunc(func(n *html.Node, content string) (string, error) { return "", errors.New("formatted") })},
+			input:     "<div><script>\n  var a=1,b=2;function c(){return a+b}\n  c();\n</script><style>p{margin:0}</style></div>",
+			expected:  "<div>\n <script>\n  var a=1,b=2;function c(){return a+b}\n  c();\n </script>\n <style>\n   p{margin:0}\n </style>\n</div>\n",
+		},
+		{
+			name:      "elements deeper than the print depth are elided",
+			formatter: Formatter{MaxPrintDepth: 2},
+			input:     "<div><ul><li>a</li><li>b <b>c</b></li></ul><p>d <i>e</i></p><p>f<!-- g --></p></div><section></section>",
+			expected:  "<div>\n <ul>\n  <!-- 2 children elided -->\n </ul>\n <p>\n  <!-- 2 children elided -->\n </p>\n <p>\n  f\n  <!-- g -->\n </p>\n</div>\n<section>\n</section>\n",
+		},
+		{
+			name:      "the indentation of children can be set by element",
+			formatter: Formatter{ChildIndent: map[string]int{"ul": 0, "tbody": 0, "div": 2}},
+			input:     `<ul><li>a</li><li>b</li></ul><table><tbody><tr><td>c</td></tr></tbody></table><div><p>d</p></div>`,
+			expected: `<ul>
+<li>a</li>
+<li>b</li>
+</ul>
+<table>
+ <tbody>
+ <tr>
+  <td>c</td>
+ </tr>
+ </tbody>
+</table>
+<div>
+  <p>d</p>
+</div>
+`,
+		},
+		{
+			name:      "start tags within the print width stay on one line",
+			formatter: Formatter{PrintWidth: 40},
+			input:     `<input type="email" name="email">`,
+			expected: `<input type="email" name="email">
 `,
 		},
 	}
 
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			out, err := test.formatter.CheckFragment([]byte(test.input))
+			if out == nil {
+				t.Fatalf("failed to format: %v", err)
+			}
+			if diff := cmp.Diff(test.expected, string(out)); diff != "" {
+				t.Error(diff)
+			}
+			if err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+func TestDocument(t *testing.T) {
+	tests := []struct {
+		name      string
+		formatter Formatter
+		input     string
+		expected  string
+	}{
+		{
+			name:      "the doctype is written with strict whitespace",
+			formatter: Formatter{Whitespace: StrictWhitespace},
+			input:     "<!DOCTYPE html><html><head><title>t</title></head><body><p>a <b>b</b></p></body></html>\n",
+			expected:  "<!DOCTYPE html>\n<html>\n <head>\n  <title>t</title>\n </head>\n <body>\n  <p>a <b>b</b></p>\n </body>\n</html>\n",
+		},
+		{
+			name:      "strict whitespace at the edges of the body is not kept",
+			formatter: Formatter{Whitespace: StrictWhitespace},
+			input:     "<!DOCTYPE html>\n<html>\n<head>\n<title>t</title>\n</head>\n<body>\n<p>a</p>\n</body>\n</html>\n",
+			expected:  "<!DOCTYPE html>\n<html>\n <head>\n  <title>t</title>\n </head>\n <body>\n  <p>a</p>\n </body>\n</html>\n",
+		},
+		{
+			name:      "the print depth counts the elements that the parser inserts",
+			formatter: Formatter{MaxPrintDepth: 2},
+			input:     "<!doctype html><title>t</title><div><p>a</p></div>",
+			expected:  "<!DOCTYPE html>\n<html>\n <head>\n  <!-- 1 child elided -->\n </head>\n <body>\n  <!-- 1 child elided -->\n </body>\n</html>\n",
+		},
+		{
+			name:     "a region without an on directive ends at the end of the body",
+			input:    "<!DOCTYPE html><html><body><!-- htmlformat:off --><div>  y  </div></body></html>\n",
+			expected: "<!DOCTYPE html>\n<html>\n <head>\n </head>\n <body>\n  <!-- htmlformat:off --><div>  y  </div>\n </body>\n</html>\n",
+		},
+		{
+			name:     "an off directive before the body is an ordinary comment",
+			input:    "<!-- htmlformat:off --><div>  y  </div>",
+			expected: "<!-- htmlformat:off -->\n<html>\n <head>\n </head>\n <body>\n  <div>y</div>\n </body>\n</html>\n",
+		},
+		{
+			name:  "the doctype is written",
+			input: `<!doctype html><html><body><p>a</p></body></html>`,
+			expected: `<!DOCTYPE html>
+<html>
+ <head>
+ </head>
+ <body>
+  <p>a</p>
+ </body>
+</html>
+`,
+		},
+		{
+			name:     "legacy doctypes are written in the standard style",
+			input:    `<!doctype HTML public "-//W3C//DTD HTML 4.01//EN" 'http://www.w3.org/TR/html4/strict.dtd'><title>a</title>`,
+			expected: "<!DOCTYPE html PUBLIC \"-//W3C//DTD HTML 4.01//EN\" \"http://www.w3.org/TR/html4/strict.dtd\">\n<html>\n <head>\n  <title>a</title>\n </head>\n <body>\n </body>\n</html>\n",
+		},
+		{
+			name:      "XHTML declares its namespace",
+			formatter: Formatter{XHTML: true, OmitImplied: true, Mode: Minify},
+			input:     `<!DOCTYPE html><html lang="en"><title>a</title><math><mi>x</mi></math></html>`,
+			expected:  `<!DOCTYPE html><html xmlns="http://www.w3.org/1999/xhtml" lang="en"><head><title>a</title></head><body><math xmlns="http://www.w3.org/1998/Math/MathML"><mi>x</mi></math></body></html>`,
+		},
+		{
+			name:      "elements that the parser adds can be omitted",
+			formatter: Formatter{OmitImplied: true, Verify: true},
+			input:     `<!doctype html><title>a</title><table><tr><td>b</td></tr></table>`,
+			expected: `<!DOCTYPE html>
+<title>a</title>
+<table>
+ <tr>
+  <td>b</td>
+ </tr>
+</table>
+`,
+		},
+		{
+			name:      "elements in the input are written when implied elements are omitted",
+			formatter: Formatter{OmitImplied: true, Mode: Minify},
+			input:     `<html lang="en"><body><table><tbody><tr><td>a</td></tr></tbody></table></body></html>`,
+			expected:  `<html lang="en"><body><table><tbody><tr><td>a</td></tr></tbody></table></body></html>`,
+		},
+		{
+			name:      "the tags that templates ignore are not mistaken for implied elements",
+			formatter: Formatter{OmitImplied: true, Verify: true},
+			input:     `<template><html><head><body><p>x</template><p>y`,
+			expected: `<template>
+ <p>x</p>
+</template>
+<p>y</p>
+`,
+		},
+		{
+			name:      "legacy doctypes can be replaced with the HTML5 doctype",
+			formatter: Formatter{Doctype: HTML5Doctype, Mode: Minify},
+			input:     `<!DOCTYPE html PUBLIC "-//W3C//DTD HTML 4.01//EN"><title>a</title>`,
+			expected:  `<!DOCTYPE html><html><head><title>a</title></head><body></body></html>`,
+		},
+		{
+			name:      "doctypes can be preserved",
+			formatter: Formatter{Doctype: OriginalDoctype, Mode: Minify},
+			input:     `<!doctype HTML system 'about:legacy-compat'><title>a</title>`,
+			expected:  `<!doctype HTML system 'about:legacy-compat'><html><head><title>a</title></head><body></body></html>`,
+		},
+		{
+			name:      "the children of html, head and body can be left unindented",
+			formatter: Formatter{FlatDocument: true},
+			input:     `<!doctype html><title>a</title><div><p>b</p></div>`,
+			expected: `<!DOCTYPE html>
+<html>
+<head>
+<title>a</title>
+</head>
+<body>
+<div>
+ <p>b</p>
+</div>
+</body>
+</html>
+`,
+		},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			out, err := test.formatter.CheckDocument([]byte(test.input))
+			if out == nil {
+				t.Fatalf("failed to format: %v", err)
+			}
+			if diff := cmp.Diff(test.expected, string(out)); diff != "" {
+				t.Error(diff)
+			}
+			if err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+func TestFragmentInContext(t *testing.T) {
+	tests := []struct {
+		name     string
+		context  string
+		input    string
+		expected string
+	}{
+		{
+			name:    "table rows keep their structure",
+			context: "tbody",
+			input:   `<tr><td>a</td><td>b</td></tr>`,
+			expected: `<tr>
+ <td>a</td>
+ <td>b</td>
+</tr>
+`,
+		},
+		{
+			name:     "table cells keep their structure",
+			context:  "TR",
+			input:    `<td>a</td><th>b`,
+			expected: "<td>a</td>\n<th>b</th>\n",
+		},
+		{
+			name:     "SVG content is parsed as SVG",
+			context:  "svg",
+			input:    `<lineargradient id="g"></lineargradient>`,
+			expected: "<linearGradient id=\"g\" />\n",
+		},
+		{
+			name:     "without a context, the structure of tables is dropped",
+			input:    `<tr><td>a</td></tr>`,
+			expected: "a\n",
+		},
+	}
+
 	for _, test := range tests {
 		test := test
 		t.Run(test.name, func(t *testing.T) {
@@ -85,7 +1314,7 @@ body {
 
 			r := strings.NewReader(test.input)
 			w := new(strings.Builder)
-			if err := Fragment(w, r); err != nil {
+			if err := FragmentInContext(w, r, test.context); err != nil {
 				t.Fatalf("failed to format: %v", err)
 			}
 			if diff := cmp.Diff(test.expected, w.String()); diff != "" {
@@ -94,3 +1323,156 @@ body {
 		})
 	}
 }
+
+func TestStringAndAppend(t *testing.T) {
+	s, err := FragmentString(`<p> a </p>`)
+	if err != nil {
+		t.Fatalf("failed to format: %v", err)
+	}
+	if diff := cmp.Diff("<p>a</p>\n", s); diff != "" {
+		t.Error(diff)
+	}
+	s, err = DocumentString(`<title>a</title>`)
+	if err != nil {
+		t.Fatalf("failed to format: %v", err)
+	}
+	if diff := cmp.Diff("<html>\n <head>\n  <title>a</title>\n </head>\n <body>\n </body>\n</html>\n", s); diff != "" {
+		t.Error(diff)
+	}
+
+	b, err := AppendFragment([]byte("<!-- a -->\n"), []byte(`<b>b</b>`))
+	if err != nil {
+		t.Fatalf("failed to format: %v", err)
+	}
+	b, err = new(Formatter).AppendDocument(b, nil)
+	if err != nil {
+		t.Fatalf("failed to format: %v", err)
+	}
+	if diff := cmp.Diff("<!-- a -->\n<b>b</b>\n<html>\n <head>\n </head>\n <body>\n </body>\n</html>\n", string(b)); diff != "" {
+		t.Error(diff)
+	}
+
+	f := Formatter{Strict: true}
+	dst := []byte("x")
+	if b, err = f.AppendFragment(dst, []byte(`<div>`)); err == nil {
+		t.Error("expected an error")
+	}
+	if string(b) != "x" {
+		t.Errorf("expected dst to be unchanged, got %q", b)
+	}
+}
+
+func TestMinify(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{
+			name:     "whitespace between elements is removed",
+			input:    "<ol>\n <li> A </li>\n <li>B</li>\n</ol>\n",
+			expected: `<ol><li> A </li><li>B</li></ol>`,
+		},
+		{
+			name:     "runs of whitespace in text are collapsed",
+			input:    "<p>Hello,\n\t   world <em>again</em></p>",
+			expected: `<p>Hello, world <em>again</em></p>`,
+		},
+		{
+			name:     "pre content is preserved",
+			input:    "<div>\n <pre>  a\n    b</pre>\n</div>",
+			expected: "<div><pre>  a\n    b</pre></div>",
+		},
+		{
+			name:     "textarea content is preserved",
+			input:    "<textarea>  a\n  b</textarea>",
+			expected: "<textarea>  a\n  b</textarea>",
+		},
+		{
+			name:     "script content is preserved",
+			input:    "<script>\n  let a = 1;\n  let b = 2;\n</script>",
+			expected: "<script>\n  let a = 1;\n  let b = 2;\n</script>",
+		},
+		{
+			name:     "comments are kept",
+			input:    "<div>\n <!-- note -->\n</div>",
+			expected: `<div><!-- note --></div>`,
+		},
+		{
+			name:     "whitespace between inline elements is kept as a space",
+			input:    "<span>a</span> <span>b</span>\n<div>\n <b>c</b>\n\n <i>d</i>\n <p>e</p>\n</div>",
+			expected: `<span>a</span> <span>b</span><div><b>c</b> <i>d</i><p>e</p></div>`,
+		},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			f := Formatter{Mode: Minify}
+			out, err := f.CheckFragment([]byte(test.input))
+			if out == nil {
+				t.Fatalf("failed to format: %v", err)
+			}
+			if diff := cmp.Diff(test.expected, string(out)); diff != "" {
+				t.Error(diff)
+			}
+			if err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+func TestEmbeddedFormatterError(t *testing.T) {
+	errInvalid := errors.New("invalid CSS")
+	f := Formatter{
+		CSS: EmbeddedFormatterFunc(func(n *html.Node, content string) (string, error) {
+			return "", errInvalid
+		}),
+	}
+	err := f.Fragment(new(strings.Builder), strings.NewReader(`<style>body {</style>`))
+	if !errors.Is(err, errInvalid) {
+		t.Errorf("expected the embedded formatter error, got %v", err)
+	}
+}
+
+func TestInvalidJSON(t *testing.T) {
+	f := Formatter{FormatJSON: true}
+	err := f.Fragment(new(strings.Builder), strings.NewReader(`<script type="application/ld+json">{"a":}</script>`))
+	var serr *json.SyntaxError
+	if !errors.As(err, &serr) {
+		t.Errorf("expected a JSON syntax error, got %v", err)
+	}
+}
+
+func TestDeeplyNested(t *testing.T) {
+	// Printing must not use the call stack for each level of nesting, which
+	// would exceed this limit.
+	defer debug.SetMaxStack(debug.SetMaxStack(1 << 20))
+	const depth = 5000
+	input := strings.Repeat("<div><span>", depth) + "x" + strings.Repeat("</span></div>", depth)
+	for _, f := range []Formatter{{}, {Mode: Minify}, {InlineElements: DefaultInlineElements, PrintWidth: 80}} {
+		output, err := f.FragmentString(input)
+		if err != nil {
+			t.Fatalf("failed to format: %v", err)
+		}
+		if n := strings.Count(output, "</div>"); n != depth {
+			t.Errorf("%v: expected %d end tags, got %d", f.Mode, depth, n)
+		}
+	}
+}
+
+func BenchmarkFragment(b *testing.B) {
+	row := `<tr><td class="name"><a href="/item?id=1&amp;x=2">Item &lt;1&gt;</a></td><td>Some <em>text</em> here</td></tr>`
+	input := "<table><tbody>" + strings.Repeat(row, 1000) + "</tbody></table>"
+	f := Formatter{InlineElements: DefaultInlineElements}
+	b.ReportAllocs()
+	b.SetBytes(int64(len(input)))
+	for i := 0; i < b.N; i++ {
+		if err := f.Fragment(io.Discard, strings.NewReader(input)); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,92 @@
+package htmlformat
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// WritableFS is a file system that FormatFS writes formatted files to.
+type WritableFS interface {
+	// WriteFile writes data to the file name, a slash-separated path as in
+	// fs.FS, creating it and its parent directories if they do not exist.
+	WriteFile(name string, data []byte, perm fs.FileMode) error
+}
+
+// DirFS is a directory on disk that can be read as an fs.FS, and written to
+// as a WritableFS, so that FormatFS can format the files within it in place.
+type DirFS string
+
+// Open opens the file name within the directory.
+func (dir DirFS) Open(name string) (fs.File, error) {
+	return os.DirFS(string(dir)).Open(name)
+}
+
+// WriteFile writes data to the file name within the directory.
+func (dir DirFS) WriteFile(name string, data []byte, perm fs.FileMode) error {
+	if !fs.ValidPath(name) {
+		return &fs.PathError{Op: "write", Path: name, Err: fs.ErrInvalid}
+	}
+	p := filepath.Join(string(dir), filepath.FromSlash(name))
+	if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+		return err
+	}
+	return os.WriteFile(p, data, perm)
+}
+
+// FormatFS formats the HTML files in src that match, with the default
+// settings, and writes them to dst.
+func FormatFS(dst WritableFS, src fs.FS, match func(path string) bool) error {
+	return new(Formatter).FormatFS(dst, src, match)
+}
+
+// FormatFS walks src and formats each file whose path match returns true
+// for, writing the output to the same path in dst, such as the output
+// directory of a static site generator. If match is nil, the files ending in
+// .html and .htm are formatted. Files are formatted as documents if they
+// start with a DOCTYPE or an <html> tag, and as fragments otherwise. dst and
+// src may be the same DirFS. FormatFS stops at the first file that cannot be
+// formatted, returning an error that names it.
+func (f *Formatter) FormatFS(dst WritableFS, src fs.FS, match func(path string) bool) error {
+	if match == nil {
+		match = isHTMLPath
+	}
+	return fs.WalkDir(src, ".", func(name string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || !match(name) {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		in, err := fs.ReadFile(src, name)
+		if err != nil {
+			return err
+		}
+		var out []byte
+		if isDocumentSource(in) {
+			out, err = f.AppendDocument(nil, in)
+		} else {
+			out, err = f.AppendFragment(nil, in)
+		}
+		if err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+		return dst.WriteFile(name, out, info.Mode().Perm())
+	})
+}
+
+// isHTMLPath reports whether name is the path of a HTML file.
+func isHTMLPath(name string) bool {
+	switch strings.ToLower(path.Ext(name)) {
+	case ".html", ".htm":
+		return true
+	}
+	return false
+}
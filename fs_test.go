@@ -0,0 +1,81 @@
+package htmlformat
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+// mapWritableFS records the files written to it.
+type mapWritableFS map[string]string
+
+func (m mapWritableFS) WriteFile(name string, data []byte, perm fs.FileMode) error {
+	m[name] = string(data)
+	return nil
+}
+
+func TestFormatFS(t *testing.T) {
+	src := fstest.MapFS{
+		"index.html":      {Data: []byte("<!DOCTYPE html><title>a</title>")},
+		"posts/a.htm":     {Data: []byte("<ul><li>a</li></ul>")},
+		"posts/style.css": {Data: []byte("p{}")},
+		"partial.tmpl":    {Data: []byte("<p>a</p>")},
+	}
+	dst := mapWritableFS{}
+	if err := FormatFS(dst, src, nil); err != nil {
+		t.Fatal(err)
+	}
+	expected := mapWritableFS{
+		"index.html":  "<!DOCTYPE html>\n<html>\n <head>\n  <title>a</title>\n </head>\n <body>\n </body>\n</html>\n",
+		"posts/a.htm": "<ul>\n <li>a</li>\n</ul>\n",
+	}
+	if diff := cmp.Diff(expected, dst); diff != "" {
+		t.Error(diff)
+	}
+
+	dst = mapWritableFS{}
+	match := func(path string) bool { return strings.HasSuffix(path, ".tmpl") }
+	if err := FormatFS(dst, src, match); err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(mapWritableFS{"partial.tmpl": "<p>a</p>\n"}, dst); diff != "" {
+		t.Error(diff)
+	}
+}
+
+func TestFormatFSErrors(t *testing.T) {
+	src := fstest.MapFS{"a.html": {Data: []byte("<div>")}}
+	err := (&Formatter{Strict: true}).FormatFS(mapWritableFS{}, src, nil)
+	if err == nil || !strings.HasPrefix(err.Error(), "a.html: ") {
+		t.Errorf("expected an error naming a.html, got %v", err)
+	}
+}
+
+func TestDirFS(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "a.html"), []byte("<ul><li>a</li></ul>"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	fsys := DirFS(dir)
+	if err := FormatFS(fsys, fsys, nil); err != nil {
+		t.Fatal(err)
+	}
+	out, err := os.ReadFile(filepath.Join(dir, "a.html"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff("<ul>\n <li>a</li>\n</ul>\n", string(out)); diff != "" {
+		t.Error(diff)
+	}
+	if err = fsys.WriteFile("b/c.html", nil, 0o644); err != nil {
+		t.Errorf("failed to write to a new directory: %v", err)
+	}
+	if err = fsys.WriteFile("../d.html", nil, 0o644); err == nil {
+		t.Error("expected writing outside the directory to fail")
+	}
+}
@@ -2,6 +2,9 @@ module github.com/a-h/htmlformat
 
 go 1.20
 
-require golang.org/x/net v0.17.0
+require (
+	golang.org/x/net v0.17.0
+	golang.org/x/text v0.13.0
+)
 
 require github.com/google/go-cmp v0.6.0
@@ -0,0 +1,180 @@
+package htmlformat
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/scanner"
+	"go/token"
+	"io"
+	"sort"
+	"strings"
+)
+
+// GoSource formats the HTML in the string literals of a Go source file with
+// the default settings.
+func GoSource(w io.Writer, r io.Reader) (err error) {
+	return new(Formatter).GoSource(w, r)
+}
+
+// GoSource formats the HTML held in the raw string literals of a Go source
+// file, writing the file with only their content changed, as a companion to
+// gofmt for server-rendered apps. The literals formatted are those passed to
+// the Parse method of templates, as in
+// template.Must(template.New("page").Parse(`...`)), whose actions are
+// preserved as GoTemplate syntax unless Template is set, and those whose
+// content starts with a tag and ends with '>'. A literal is formatted as a
+// document if it starts with a DOCTYPE or an <html> tag, and as a fragment
+// otherwise, and keeps the whitespace at its start and end, so that the
+// backticks stay where they are. Interpreted string literals, in double
+// quotes, are left as they are, as their newlines would have to be escaped.
+func (f *Formatter) GoSource(w io.Writer, r io.Reader) (err error) {
+	src, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, "", src, parser.ParseComments)
+	if err != nil {
+		var el scanner.ErrorList
+		if errors.As(err, &el) && len(el) > 0 {
+			return &ParseError{Line: el[0].Pos.Line, Column: el[0].Pos.Column, Err: errors.New(el[0].Msg)}
+		}
+		return err
+	}
+	type literal struct {
+		lit      *ast.BasicLit
+		template bool
+	}
+	var literals []literal
+	seen := make(map[*ast.BasicLit]bool)
+	ast.Inspect(file, func(n ast.Node) bool {
+		switch n := n.(type) {
+		case *ast.CallExpr:
+			if lit := templateSource(n); lit != nil && !seen[lit] {
+				seen[lit] = true
+				literals = append(literals, literal{lit: lit, template: true})
+			}
+		case *ast.BasicLit:
+			if isRawString(n) && !seen[n] && looksLikeHTML(n.Value[1:len(n.Value)-1]) {
+				seen[n] = true
+				literals = append(literals, literal{lit: n})
+			}
+		}
+		return true
+	})
+	sort.Slice(literals, func(i, j int) bool {
+		return literals[i].lit.Pos() < literals[j].lit.Pos()
+	})
+	tf := *f
+	if tf.Template == nil {
+		tf.Template = GoTemplate
+	}
+	var out bytes.Buffer
+	var last int
+	for _, l := range literals {
+		start := fset.Position(l.lit.Pos()).Offset
+		content := l.lit.Value[1 : len(l.lit.Value)-1]
+		lf := f
+		if l.template {
+			lf = &tf
+		}
+		formatted, err := lf.literalHTML(content)
+		if err != nil {
+			return fmt.Errorf("%s: %w", fset.Position(l.lit.Pos()), err)
+		}
+		out.Write(src[last:start])
+		out.WriteString("`" + formatted + "`")
+		last = start + len(l.lit.Value)
+	}
+	out.Write(src[last:])
+	_, err = newOutputWriter(w).Write(out.Bytes())
+	return err
+}
+
+// templateSource returns the raw string literal that the call n parses as a
+// template, if it is one: a call of the Parse method of a template made by
+// New, or of the template that Must is called with.
+func templateSource(n *ast.CallExpr) *ast.BasicLit {
+	sel, ok := n.Fun.(*ast.SelectorExpr)
+	if !ok {
+		return nil
+	}
+	if sel.Sel.Name == "Must" && len(n.Args) > 0 {
+		if parse, ok := n.Args[0].(*ast.CallExpr); ok {
+			if psel, ok := parse.Fun.(*ast.SelectorExpr); ok && psel.Sel.Name == "Parse" {
+				return rawStringArg(parse)
+			}
+		}
+		return nil
+	}
+	if sel.Sel.Name != "Parse" {
+		return nil
+	}
+	// The template is made by a chain of method calls, such as
+	// template.New("page").Funcs(funcs), that starts with New.
+	for x := sel.X; ; {
+		call, ok := x.(*ast.CallExpr)
+		if !ok {
+			return nil
+		}
+		csel, ok := call.Fun.(*ast.SelectorExpr)
+		if !ok {
+			return nil
+		}
+		if csel.Sel.Name == "New" {
+			return rawStringArg(n)
+		}
+		x = csel.X
+	}
+}
+
+// rawStringArg returns the only argument of n, if it is a raw string literal.
+func rawStringArg(n *ast.CallExpr) *ast.BasicLit {
+	if len(n.Args) != 1 {
+		return nil
+	}
+	if lit, ok := n.Args[0].(*ast.BasicLit); ok && isRawString(lit) {
+		return lit
+	}
+	return nil
+}
+
+func isRawString(lit *ast.BasicLit) bool {
+	return lit.Kind == token.STRING && strings.HasPrefix(lit.Value, "`")
+}
+
+// looksLikeHTML reports whether s starts with a tag, comment or DOCTYPE and
+// ends with '>', after whitespace.
+func looksLikeHTML(s string) bool {
+	s = trimHTMLSpace(s)
+	if len(s) < 3 || s[0] != '<' || s[len(s)-1] != '>' {
+		return false
+	}
+	c := s[1]
+	return c == '!' || 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z'
+}
+
+// literalHTML formats the HTML content of a raw string literal, keeping the
+// whitespace at its start and end.
+func (f *Formatter) literalHTML(content string) (string, error) {
+	trimmed := trimHTMLSpace(content)
+	leading := content[:strings.Index(content, trimmed)]
+	trailing := content[len(leading)+len(trimmed):]
+	var out []byte
+	var err error
+	if isDocumentSource([]byte(trimmed)) {
+		out, err = f.AppendDocument(nil, []byte(trimmed))
+	} else {
+		out, err = f.AppendFragment(nil, []byte(trimmed))
+	}
+	if err != nil {
+		return "", err
+	}
+	if bytes.ContainsRune(out, '`') {
+		return "", fmt.Errorf("formatted HTML contains a backtick")
+	}
+	return leading + trimHTMLSpace(string(out)) + trailing, nil
+}
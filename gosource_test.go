@@ -0,0 +1,55 @@
+package htmlformat
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestGoSource(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{
+			name:     "templates are formatted with their actions",
+			input:    "package main\n\nvar page = template.Must(template.New(\"page\").Parse(`\n<ul>{{range .}}<li>{{.}}</li>{{end}}</ul>\n`))\n",
+			expected: "package main\n\nvar page = template.Must(template.New(\"page\").Parse(`\n<ul>\n {{range .}}\n  <li>{{.}}</li>\n {{end}}\n</ul>\n`))\n",
+		},
+		{
+			name:     "the templates of Must are formatted",
+			input:    "package main\n\nvar page = template.Must(t.Parse(`<div><p>{{.}}</p></div>`))\n",
+			expected: "package main\n\nvar page = template.Must(t.Parse(`<div>\n <p>{{.}}</p>\n</div>`))\n",
+		},
+		{
+			name:     "raw strings that hold HTML are formatted",
+			input:    "package main\n\nconst (\n\tbanner = `<div><p>a</p></div>`\n\tquery  = `SELECT 1 < 2`\n\tquoted = \"<div><p>a</p></div>\"\n)\n",
+			expected: "package main\n\nconst (\n\tbanner = `<div>\n <p>a</p>\n</div>`\n\tquery  = `SELECT 1 < 2`\n\tquoted = \"<div><p>a</p></div>\"\n)\n",
+		},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			var sb strings.Builder
+			if err := GoSource(&sb, strings.NewReader(test.input)); err != nil {
+				t.Fatalf("failed to format: %v", err)
+			}
+			if diff := cmp.Diff(test.expected, sb.String()); diff != "" {
+				t.Error(diff)
+			}
+		})
+	}
+}
+
+func TestGoSourceErrors(t *testing.T) {
+	f := &Formatter{Strict: true}
+	err := f.GoSource(new(strings.Builder), strings.NewReader("package main\n\nconst a = `<div>`\n"))
+	if err == nil || !strings.HasPrefix(err.Error(), "3:11: ") {
+		t.Errorf("expected an error at the literal, got %v", err)
+	}
+}
@@ -0,0 +1,46 @@
+package htmlformat
+
+import "golang.org/x/net/html"
+
+// NodeAction is what the Formatter does with a node once OnNode has been
+// called for it.
+type NodeAction int
+
+const (
+	// KeepNode writes the node, with any changes that OnNode made to it.
+	KeepNode NodeAction = iota
+	// SkipNode leaves the node and its descendants out of the output.
+	SkipNode
+)
+
+// applyOnNode calls OnNode for each of nodes and their descendants, in
+// document order, and returns the nodes that are kept. The children of a node
+// are visited after OnNode returns for it, so it may change them. Siblings
+// that OnNode inserts next to nodes are not returned.
+func (f *Formatter) applyOnNode(nodes []*html.Node) (kept []*html.Node) {
+	for _, n := range nodes {
+		if f.OnNode(n) == SkipNode {
+			if n.Parent != nil {
+				n.Parent.RemoveChild(n)
+			}
+			continue
+		}
+		f.applyOnNodeChildren(n)
+		kept = append(kept, n)
+	}
+	return kept
+}
+
+func (f *Formatter) applyOnNodeChildren(n *html.Node) {
+	for c := n.FirstChild; c != nil; {
+		// OnNode may insert siblings after c, which are visited next.
+		if f.OnNode(c) == SkipNode {
+			next := c.NextSibling
+			n.RemoveChild(c)
+			c = next
+			continue
+		}
+		f.applyOnNodeChildren(c)
+		c = c.NextSibling
+	}
+}
@@ -0,0 +1,112 @@
+package htmlformat
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+func TestOnNode(t *testing.T) {
+	tests := []struct {
+		name     string
+		onNode   func(n *html.Node) NodeAction
+		input    string
+		expected string
+	}{
+		{
+			name: "nodes can be skipped",
+			onNode: func(n *html.Node) NodeAction {
+				if n.DataAtom == atom.Script {
+					return SkipNode
+				}
+				return KeepNode
+			},
+			input:    `<div><script src="analytics.js"></script><p>a</p><script>track()</script></div>`,
+			expected: "<div>\n <p>a</p>\n</div>\n",
+		},
+		{
+			name: "nodes can be changed",
+			onNode: func(n *html.Node) NodeAction {
+				for i, a := range n.Attr {
+					if a.Key == "src" {
+						n.Attr[i].Val = "https://cdn.example.com/" + a.Val
+					}
+				}
+				return KeepNode
+			},
+			input:    `<p><img src="a.png"></p>`,
+			expected: "<p>\n <img src=\"https://cdn.example.com/a.png\">\n</p>\n",
+		},
+		{
+			name: "nodes can be replaced, including those at the top level",
+			onNode: func(n *html.Node) NodeAction {
+				if n.DataAtom != atom.B {
+					return KeepNode
+				}
+				strong := &html.Node{Type: html.ElementNode, Data: "strong", DataAtom: atom.Strong}
+				for n.FirstChild != nil {
+					c := n.FirstChild
+					n.RemoveChild(c)
+					strong.AppendChild(c)
+				}
+				n.Parent.InsertBefore(strong, n)
+				return SkipNode
+			},
+			input:    `<b>a</b><p><b>b</b></p>`,
+			expected: "<strong>a</strong>\n<p>\n <strong>b</strong>\n</p>\n",
+		},
+		{
+			name: "the children of a node are visited after it is changed",
+			onNode: func(n *html.Node) NodeAction {
+				if n.DataAtom == atom.Ul {
+					n.AppendChild(&html.Node{Type: html.ElementNode, Data: "li", DataAtom: atom.Li})
+				}
+				if n.DataAtom == atom.Li && n.FirstChild == nil {
+					n.AppendChild(&html.Node{Type: html.TextNode, Data: "added"})
+				}
+				return KeepNode
+			},
+			input:    `<ul><li>a</li></ul>`,
+			expected: "<ul>\n <li>a</li>\n <li>added</li>\n</ul>\n",
+		},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			f := Formatter{OnNode: test.onNode}
+			s, err := f.FragmentString(test.input)
+			if err != nil {
+				t.Fatalf("failed to format: %v", err)
+			}
+			if diff := cmp.Diff(test.expected, s); diff != "" {
+				t.Error(diff)
+			}
+		})
+	}
+}
+
+func TestOnNodeNodes(t *testing.T) {
+	nodes, err := html.ParseFragment(strings.NewReader(`<p>a</p><!-- b --><p>c <!-- d --></p>`), fragmentContext(""))
+	if err != nil {
+		t.Fatalf("failed to parse: %v", err)
+	}
+	f := Formatter{OnNode: func(n *html.Node) NodeAction {
+		if n.Type == html.CommentNode {
+			return SkipNode
+		}
+		return KeepNode
+	}}
+	w := new(strings.Builder)
+	if err = f.Nodes(w, nodes); err != nil {
+		t.Fatalf("failed to format: %v", err)
+	}
+	if diff := cmp.Diff("<p>a</p>\n<p>c</p>\n", w.String()); diff != "" {
+		t.Error(diff)
+	}
+}
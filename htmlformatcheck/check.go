@@ -0,0 +1,190 @@
+// Package htmlformatcheck checks the invariants that the output of
+// htmlformat should keep, for use in downstream tests and fuzz targets:
+//
+//	func FuzzFormat(f *testing.F) {
+//		for _, seed := range htmlformatcheck.Seeds() {
+//			f.Add(seed)
+//		}
+//		formatter := &htmlformat.Formatter{PrintWidth: 80}
+//		f.Fuzz(func(t *testing.T, src []byte) {
+//			if err := htmlformatcheck.Fragment(formatter, src); err != nil {
+//				t.Error(err)
+//			}
+//		})
+//	}
+package htmlformatcheck
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/a-h/htmlformat"
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// LossError is returned when the content of a preformatted or raw text
+// element in the input is missing from the output.
+type LossError struct {
+	// Element is the name of the element, and Index its position among the
+	// preformatted and raw text elements of the input, from 1.
+	Element string
+	Index   int
+	// Input and Output are the content of the element in the input and the
+	// output, as they are compared.
+	Input, Output string
+}
+
+func (e *LossError) Error() string {
+	return fmt.Sprintf("the content of <%s> %d changed from %q to %q", e.Element, e.Index, e.Input, e.Output)
+}
+
+// Document checks that formatting the HTML document src with f is
+// idempotent, keeps its content and does not lose the content of
+// preformatted and raw text elements. Input that f cannot format, such as
+// input that Strict rejects, is not an error, and neither is input that is
+// not valid UTF-8 unless f decodes it from the charset it declares. The error is an
+// *htmlformat.IdempotenceError, an *htmlformat.VerifyError or a *LossError.
+func Document(f *htmlformat.Formatter, src []byte) error {
+	return check(f, src, (*htmlformat.Formatter).CheckDocument, true)
+}
+
+// Fragment checks the fragment of a HTML document src like Document.
+func Fragment(f *htmlformat.Formatter, src []byte) error {
+	return check(f, src, (*htmlformat.Formatter).CheckFragment, false)
+}
+
+func check(f *htmlformat.Formatter, src []byte,
+	format func(f *htmlformat.Formatter, src []byte) ([]byte, error),
+	document bool) error {
+	if f.Charset == htmlformat.AssumeUTF8 && !utf8.Valid(src) {
+		return nil
+	}
+	verified := *f
+	verified.Verify = true
+	out, err := format(&verified, src)
+	var ie *htmlformat.IdempotenceError
+	var ve *htmlformat.VerifyError
+	switch {
+	case errors.As(err, &ie) || errors.As(err, &ve):
+		return err
+	case err != nil:
+		// The input was rejected, rather than formatted wrongly.
+		return nil
+	}
+	return Preserved(f, src, out, document)
+}
+
+// Preserved returns a *LossError if the content of a preformatted or raw text
+// element in src differs in out, the output of formatting src with f. They are
+// parsed as documents if document is true, and as fragments otherwise. The content of <pre>
+// and <textarea> elements must be the same, and that of <script> and <style>
+// elements must have the same lines, apart from their indentation and blank
+// lines. It is independent of the Formatter, so that it can find bugs that
+// Verify shares with it.
+//
+// Elements that f does not write as they are, because they are removed by
+// its Sanitizer or OnNode, or formatted by its CSS or JS formatter, are not
+// compared. The input is assumed to be UTF-8.
+func Preserved(f *htmlformat.Formatter, src, out []byte, document bool) error {
+	if f.Sanitizer != nil || f.OnNode != nil {
+		return nil
+	}
+	parse := parseFragment
+	if document {
+		parse = parseDocument
+	}
+	in, err := parse(src)
+	if err != nil {
+		return err
+	}
+	reparsed, err := parse(out)
+	if err != nil {
+		return err
+	}
+	a, b := preserved(f, in, nil), preserved(f, reparsed, nil)
+	for i := 0; i < len(a) || i < len(b); i++ {
+		switch {
+		case i >= len(b):
+			return &LossError{Element: a[i].element, Index: i + 1, Input: a[i].content}
+		case i >= len(a):
+			return &LossError{Element: b[i].element, Index: i + 1, Output: b[i].content}
+		case a[i] != b[i]:
+			return &LossError{Element: a[i].element, Index: i + 1, Input: a[i].content, Output: b[i].content}
+		}
+	}
+	return nil
+}
+
+func parseDocument(src []byte) ([]*html.Node, error) {
+	n, err := html.Parse(bytes.NewReader(src))
+	if err != nil {
+		return nil, err
+	}
+	return []*html.Node{n}, nil
+}
+
+func parseFragment(src []byte) ([]*html.Node, error) {
+	// Fragments are parsed within an element that the parser has no rules
+	// for, as htmlformat parses them.
+	return html.ParseFragment(bytes.NewReader(src), &html.Node{Type: html.ElementNode})
+}
+
+type content struct {
+	element, content string
+}
+
+// preserved appends the content of the preformatted and raw text elements in
+// nodes and their descendants to cs.
+func preserved(f *htmlformat.Formatter, nodes []*html.Node, cs []content) []content {
+	for _, n := range nodes {
+		if n.Type == html.ElementNode && n.Namespace == "" {
+			switch n.DataAtom {
+			case atom.Pre, atom.Textarea:
+				cs = append(cs, content{n.Data, text(n)})
+				continue
+			case atom.Script, atom.Style:
+				if n.DataAtom == atom.Script && f.JS == nil || n.DataAtom == atom.Style && f.CSS == nil {
+					cs = append(cs, content{n.Data, lines(text(n))})
+				}
+				continue
+			}
+		}
+		var children []*html.Node
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			children = append(children, c)
+		}
+		cs = preserved(f, children, cs)
+	}
+	return cs
+}
+
+// text returns the text within n and its descendants.
+func text(n *html.Node) string {
+	if n.Type == html.TextNode {
+		return n.Data
+	}
+	var sb strings.Builder
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		sb.WriteString(text(c))
+	}
+	return sb.String()
+}
+
+// lines returns the lines of s without their indentation, and without blank
+// lines or the markers of the CDATA sections that WrapCDATA writes.
+func lines(s string) string {
+	var kept []string
+	for _, l := range strings.Split(s, "\n") {
+		l = strings.TrimSpace(l)
+		switch l {
+		case "", "//<![CDATA[", "//]]>", "/*<![CDATA[*/", "/*]]>*/":
+			continue
+		}
+		kept = append(kept, l)
+	}
+	return strings.Join(kept, "\n")
+}
@@ -0,0 +1,58 @@
+package htmlformatcheck
+
+import (
+	"errors"
+	"math/rand"
+	"testing"
+
+	"github.com/a-h/htmlformat"
+)
+
+var formatters = map[string]*htmlformat.Formatter{
+	"default": {},
+	"pretty": {InlineElements: htmlformat.DefaultInlineElements, PrintWidth: 40,
+		WrapAttributeValues: true, SortClasses: true},
+	"minify": {Mode: htmlformat.Minify, Quotes: htmlformat.MinimalQuotes},
+	"cdata":  {WrapCDATA: true, DropEmptyAttributes: true},
+}
+
+func TestGenerate(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	for name, f := range formatters {
+		for i := 0; i < 200; i++ {
+			src := Generate(r, 4)
+			if err := Fragment(f, src); err != nil {
+				t.Errorf("%s: %q: %v", name, src, err)
+			}
+		}
+	}
+}
+
+func TestPreserved(t *testing.T) {
+	f := &htmlformat.Formatter{}
+	err := Preserved(f, []byte("<pre> a</pre><script>\n  x()\n</script>"), []byte("<pre>a</pre><script>x()</script>"), false)
+	var le *LossError
+	if !errors.As(err, &le) {
+		t.Fatalf("expected a *LossError, got %v", err)
+	}
+	expected := `the content of <pre> 1 changed from " a" to "a"`
+	if err.Error() != expected {
+		t.Errorf("expected %q, got %q", expected, err.Error())
+	}
+	if err := Preserved(f, []byte("<script>\n  x()\n</script>"), []byte("<script>x()</script>"), false); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func FuzzFragment(f *testing.F) {
+	for _, seed := range Seeds() {
+		f.Add(seed)
+	}
+	f.Fuzz(func(t *testing.T, src []byte) {
+		for name, formatter := range formatters {
+			if err := Fragment(formatter, src); err != nil {
+				t.Errorf("%s: %v", name, err)
+			}
+		}
+	})
+}
@@ -0,0 +1,117 @@
+package htmlformatcheck
+
+import (
+	"math/rand"
+	"strings"
+)
+
+// Seeds returns inputs that cover the markup that htmlformat treats
+// specially, for use as the seed corpus of fuzz targets.
+func Seeds() [][]byte {
+	seeds := []string{
+		`<p>Hello <a href="#">world</a>, how are <em>you</em>?</p>`,
+		`<ul><li>a<li>b</ul>`,
+		`<table><tr><td>a</td><td>b</td></tr></table>`,
+		"<pre>  a\n\tb\n</pre>",
+		"<textarea>\n x </textarea>",
+		"<script>\n  if (a) {\n    b()\n  }\n</script>",
+		"<style>p { color: red }</style>",
+		`<img src="a.jpg" srcset="a.jpg 1x,b.jpg 2x" alt="">`,
+		`<input disabled class="b a" value='x "y"'>`,
+		`<!-- a comment --><!--[if IE]><p>IE</p><![endif]-->`,
+		`<svg viewBox="0 0 10 10"><path d="M0"/></svg>`,
+		`<p>&lt;b&gt; &amp;amp; &nbsp; x</p>`,
+		"<div>\n\n  text\n\n</div>",
+		`<select><option>a<option selected>b</select>`,
+	}
+	out := make([][]byte, len(seeds))
+	for i, s := range seeds {
+		out[i] = []byte(s)
+	}
+	return out
+}
+
+var (
+	blockElements  = []string{"div", "p", "section", "ul", "li", "blockquote", "h1", "table", "tr", "td"}
+	inlineElements = []string{"a", "b", "em", "span", "code", "button"}
+	voidElements   = []string{"br", "img", "input", "hr"}
+	rawElements    = []string{"pre", "textarea", "script", "style"}
+	attributes     = []string{"id", "class", "href", "title", "disabled", "data-x", "srcset"}
+	words          = []string{"a", "word", "text", ",", ".", "&amp;", "&lt;", "&nbsp;", "é", "  ", "\n", "\t"}
+)
+
+// Generate returns a random fragment of a HTML document, with elements nested
+// up to depth deep. The markup is not always well formed, so that the
+// repairs of the parser are covered too.
+func Generate(r *rand.Rand, depth int) []byte {
+	var sb strings.Builder
+	generate(r, &sb, depth)
+	return []byte(sb.String())
+}
+
+func generate(r *rand.Rand, sb *strings.Builder, depth int) {
+	for i, n := 0, r.Intn(4); i < n; i++ {
+		switch k := r.Intn(10); {
+		case k < 3 || depth <= 0:
+			generateText(r, sb)
+		case k < 5:
+			generateElement(r, sb, pick(r, blockElements), depth)
+		case k < 7:
+			generateElement(r, sb, pick(r, inlineElements), depth)
+		case k < 8:
+			sb.WriteString("<" + pick(r, voidElements))
+			generateAttributes(r, sb)
+			sb.WriteString(">")
+		case k < 9:
+			name := pick(r, rawElements)
+			sb.WriteString("<" + name + ">")
+			generateText(r, sb)
+			sb.WriteString("\n  ")
+			generateText(r, sb)
+			sb.WriteString("</" + name + ">")
+		default:
+			sb.WriteString("<!--")
+			generateText(r, sb)
+			sb.WriteString("-->")
+		}
+	}
+}
+
+func generateElement(r *rand.Rand, sb *strings.Builder, name string, depth int) {
+	sb.WriteString("<" + name)
+	generateAttributes(r, sb)
+	sb.WriteString(">")
+	generate(r, sb, depth-1)
+	// Leave some end tags out, for the parser to repair.
+	if r.Intn(8) > 0 {
+		sb.WriteString("</" + name + ">")
+	}
+}
+
+func generateAttributes(r *rand.Rand, sb *strings.Builder) {
+	for i, n := 0, r.Intn(3); i < n; i++ {
+		sb.WriteString(" " + pick(r, attributes))
+		switch r.Intn(4) {
+		case 0:
+		case 1:
+			sb.WriteString(`=""`)
+		default:
+			sb.WriteString(`="`)
+			generateText(r, sb)
+			sb.WriteString(`"`)
+		}
+	}
+}
+
+func generateText(r *rand.Rand, sb *strings.Builder) {
+	for i, n := 0, 1+r.Intn(4); i < n; i++ {
+		if i > 0 && r.Intn(2) == 0 {
+			sb.WriteString(" ")
+		}
+		sb.WriteString(pick(r, words))
+	}
+}
+
+func pick(r *rand.Rand, s []string) string {
+	return s[r.Intn(len(s))]
+}
@@ -0,0 +1,130 @@
+// Package htmlformattest provides helpers for tests that check HTML is
+// formatted, such as the output of template libraries, against golden files:
+//
+//	func TestTemplates(t *testing.T) {
+//		htmlformattest.Run(t, &htmlformat.Formatter{}, "testdata")
+//	}
+//
+// Run with -update to write the golden files from the current output.
+package htmlformattest
+
+import (
+	"bytes"
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/a-h/htmlformat"
+	"github.com/google/go-cmp/cmp"
+)
+
+// GoldenSuffix ends the names of golden files, which replaces the extension
+// of the input that they are the output for, as in page.golden.html for
+// page.html.
+const GoldenSuffix = ".golden"
+
+func init() {
+	// The test binary may define -update itself.
+	if flag.Lookup("update") == nil {
+		flag.Bool("update", false, "Write golden files from the current output instead of comparing it with them")
+	}
+}
+
+// updating reports whether the tests were run with -update.
+func updating() bool {
+	f := flag.Lookup("update")
+	if f == nil {
+		return false
+	}
+	g, ok := f.Value.(flag.Getter)
+	if !ok {
+		return false
+	}
+	update, _ := g.Get().(bool)
+	return update
+}
+
+// Format formats src with f, as a document if it starts with a DOCTYPE or an
+// <html> tag, and as a fragment otherwise, failing the test if it cannot be
+// formatted.
+func Format(t testing.TB, f *htmlformat.Formatter, src []byte) []byte {
+	t.Helper()
+	var out bytes.Buffer
+	w := f.NewWriter(&out)
+	if _, err := w.Write(src); err != nil {
+		t.Fatalf("failed to format: %v", err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("failed to format: %v", err)
+	}
+	return out.Bytes()
+}
+
+// Formatted fails the test, with a diff, if src is not formatted as f
+// formats it, so that code which generates HTML can check that its output
+// stays formatted.
+func Formatted(t testing.TB, f *htmlformat.Formatter, src []byte) {
+	t.Helper()
+	if diff := cmp.Diff(string(src), string(Format(t, f, src))); diff != "" {
+		t.Errorf("the HTML is not formatted (-got +formatted):\n%s", diff)
+	}
+}
+
+// Golden formats src with f and compares the output with the golden file at
+// path, failing the test with a diff if they differ. With -update, the
+// golden file is written instead.
+func Golden(t testing.TB, f *htmlformat.Formatter, path string, src []byte) {
+	t.Helper()
+	out := Format(t, f, src)
+	if updating() {
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, out, 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+	expected, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("failed to read the golden file, run with -update to write it: %v", err)
+	}
+	if diff := cmp.Diff(string(expected), string(out)); diff != "" {
+		// The output is kept so that it can be inspected or copied.
+		got := filepath.Join(t.TempDir(), filepath.Base(path))
+		if err := os.WriteFile(got, out, 0o644); err != nil {
+			t.Fatal(err)
+		}
+		t.Errorf("the output differs from %s (-golden +got), and was written to %s:\n%s", path, got, diff)
+	}
+}
+
+// Run runs a subtest for each .html file in dir that is not a golden file,
+// comparing the formatted file with its golden file as Golden does.
+func Run(t *testing.T, f *htmlformat.Formatter, dir string) {
+	t.Helper()
+	inputs, err := filepath.Glob(filepath.Join(dir, "*.html"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(inputs) == 0 {
+		t.Fatalf("no .html files in %s", dir)
+	}
+	for _, input := range inputs {
+		ext := filepath.Ext(input)
+		name := strings.TrimSuffix(input, ext)
+		if strings.HasSuffix(name, GoldenSuffix) {
+			continue
+		}
+		input := input
+		t.Run(filepath.Base(name), func(t *testing.T) {
+			src, err := os.ReadFile(input)
+			if err != nil {
+				t.Fatal(err)
+			}
+			Golden(t, f, name+GoldenSuffix+ext, src)
+		})
+	}
+}
@@ -0,0 +1,53 @@
+package htmlformattest
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/a-h/htmlformat"
+)
+
+// recorder records the failures of a test, without failing the test that
+// runs it.
+type recorder struct {
+	testing.TB
+	errors []string
+}
+
+func (r *recorder) Helper() {}
+
+func (r *recorder) Errorf(format string, args ...any) {
+	r.errors = append(r.errors, fmt.Sprintf(format, args...))
+}
+
+func TestRun(t *testing.T) {
+	Run(t, &htmlformat.Formatter{}, "testdata")
+}
+
+func TestFormatted(t *testing.T) {
+	f := &htmlformat.Formatter{}
+	r := &recorder{TB: t}
+	Formatted(r, f, []byte("<ul>\n <li>a</li>\n</ul>\n"))
+	if len(r.errors) != 0 {
+		t.Errorf("unexpected failures: %v", r.errors)
+	}
+	Formatted(r, f, []byte("<ul><li>a</li></ul>"))
+	if len(r.errors) != 1 || !strings.Contains(r.errors[0], "not formatted") {
+		t.Errorf("expected a failure, got %v", r.errors)
+	}
+}
+
+func TestGoldenDiff(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "a.golden.html")
+	if err := os.WriteFile(path, []byte("<p>b</p>\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	r := &recorder{TB: t}
+	Golden(r, &htmlformat.Formatter{}, path, []byte("<p>a</p>"))
+	if len(r.errors) != 1 || !strings.Contains(r.errors[0], `"<p>b</p>\n"`) {
+		t.Errorf("expected a diff, got %v", r.errors)
+	}
+}
@@ -0,0 +1,65 @@
+package htmlformat
+
+import (
+	"bytes"
+	"fmt"
+)
+
+// IdempotenceError is returned when formatting the output of the Formatter
+// changes it again, which is a bug in the Formatter.
+type IdempotenceError struct {
+	// Output is the output of formatting the input, and Reformatted the
+	// output of formatting Output.
+	Output, Reformatted []byte
+}
+
+func (e *IdempotenceError) Error() string {
+	a := bytes.Split(e.Output, []byte("\n"))
+	b := bytes.Split(e.Reformatted, []byte("\n"))
+	line := 0
+	for line < len(a) && line < len(b) && bytes.Equal(a[line], b[line]) {
+		line++
+	}
+	var from, to []byte
+	if line < len(a) {
+		from = a[line]
+	}
+	if line < len(b) {
+		to = b[line]
+	}
+	return fmt.Sprintf("formatting again changes line %d of the output from %q to %q", line+1, from, to)
+}
+
+// CheckDocument formats the HTML document src, and then formats the output
+// again, returning the output of the first pass. If the second pass changes
+// it, the error is an *IdempotenceError. It is meant for tests, to check that
+// the output of a Formatter is stable.
+func (f *Formatter) CheckDocument(src []byte) (out []byte, err error) {
+	return f.check(src, (*Formatter).AppendDocument)
+}
+
+// CheckFragment formats the fragment of a HTML document src, and then formats
+// the output again, returning the output of the first pass. If the second
+// pass changes it, the error is an *IdempotenceError.
+func (f *Formatter) CheckFragment(src []byte) (out []byte, err error) {
+	return f.check(src, (*Formatter).AppendFragment)
+}
+
+func (f *Formatter) check(src []byte, format func(f *Formatter, dst, src []byte) ([]byte, error)) (out []byte, err error) {
+	if out, err = format(f, nil, src); err != nil {
+		return nil, err
+	}
+	again := *f
+	if f.Charset == TranscodeCharset {
+		// The output is UTF-8, and declares that it is.
+		again.ContentType = ""
+	}
+	reformatted, err := format(&again, nil, out)
+	if err != nil {
+		return out, fmt.Errorf("failed to format the output again: %w", err)
+	}
+	if !bytes.Equal(out, reformatted) {
+		return out, &IdempotenceError{Output: out, Reformatted: reformatted}
+	}
+	return out, nil
+}
@@ -0,0 +1,120 @@
+package htmlformat
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"golang.org/x/net/html"
+)
+
+func TestIdempotence(t *testing.T) {
+	inputs := []string{
+		`<p><b>a</b>, then <i>b</i>.</p>`,
+		`<div><span>x</span>!<span>y</span></div>`,
+		`<div><span>x</span> !<span>y</span>  , z</div>`,
+		`<ul><li><a href="x">Test</a>. More text <b>b</b>;</li></ul>`,
+		`<p>Hello <a href="#">world</a>, how are <em>you</em>? Fine.</p>`,
+		`<div>text<br>more<br/>, end</div>`,
+		`<table><tr><td>a</td><td>b</td></tr></table>`,
+		`<p>a<!-- c -->, b</p>`,
+		`<div><p>x</p>. y</div>`,
+		`<div><p>x</p>.<p>y</p></div>`,
+		`<div><img src=a>.</div>`,
+		`<pre>  a
+ b</pre>.`,
+		`<textarea>
+ x</textarea>`,
+		`<div><b>a</b>.<b>b</b>.</div>`,
+		`<select><option>a<option>b</select>`,
+		`<p>` + strings.Repeat("word ", 40) + `<a href="https://example.com/long/url">link text here</a>.</p>`,
+		`<div class="a b c d e f g h i j k l m n o p q r s t u v w x y z aa bb cc dd ee ff gg">x</div>`,
+		`<svg><g><path d="M0"/></g></svg>`,
+		`<div>a   b
+   c</div>`,
+		`<script>
+  if (a) {
+    b()
+  }
+</script><style></style><script></script>`,
+		`<button>  Go  </button>.`,
+		`<p>(<a>x</a>)</p>`,
+		`<label>A <input>:</label>`,
+		`<div><b>a</b>.b</div>`,
+		`<p>a <b> b </b> c</p>`,
+		`<p>&lt;b&gt; &amp;amp; &nbsp; x</p>`,
+		`<div><span>a</span><span>b</span>.</div>`,
+		`<div>a<div>b</div>.c</div>`,
+		`<p><b>x</b> . y</p>`,
+		`<h1>Title</h1>
+<p>Para</p>
+
+
+<p>Another</p>`,
+		`<div>
+
+text
+
+</div>`,
+		`<p>a<b>b<i>c</i>d</b>e</p>`,
+		`<a href="x"><img src="y"></a>.`,
+		`<ol><li>x.</li><li>y</li></ol>.`,
+		`<p>x</p>
+<!-- comment
+  spanning
+    lines -->`,
+		`<div><!-- a --> , b</div>`,
+		`<b>a</b>.`,
+		`<div></div>.`,
+		`text <b>a</b>. more`,
+		`<p><a>x</a>, <a>y</a>, and <a>z</a>.</p>`,
+		`<div><div><a>x</a>.</div>, <span>y</span>; z</div>`,
+		`<p><a>x</a>.<br>y</p>`,
+		`<p><a>x</a>.
+   <b>y</b>.
+</p>`,
+	}
+	formatters := map[string]Formatter{
+		"default":      {},
+		"inline":       {InlineElements: DefaultInlineElements},
+		"width":        {PrintWidth: 40},
+		"inline width": {InlineElements: DefaultInlineElements, PrintWidth: 40, WrapAttributeValues: true},
+		"blank lines":  {MaxBlankLines: 1},
+		"minify":       {Mode: Minify},
+		"minimal":      {Quotes: MinimalQuotes, Booleans: MinimalBooleans},
+	}
+	for name, f := range formatters {
+		f := f
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			for _, input := range inputs {
+				if _, err := f.CheckFragment([]byte(input)); err != nil {
+					t.Errorf("%q: %v", input, err)
+				}
+			}
+		})
+	}
+}
+
+func TestIdempotenceError(t *testing.T) {
+	f := Formatter{OnNode: func(n *html.Node) NodeAction {
+		// Change the text each time it is formatted.
+		if n.Type == html.TextNode {
+			n.Data += "!"
+		}
+		return KeepNode
+	}}
+	out, err := f.CheckFragment([]byte("<p>a</p>"))
+	if string(out) != "<p>a!</p>\n" {
+		t.Errorf("unexpected output %q", out)
+	}
+	var ie *IdempotenceError
+	if !errors.As(err, &ie) {
+		t.Fatalf("expected an *IdempotenceError, got %v", err)
+	}
+	expected := `formatting again changes line 1 of the output from "<p>a!</p>" to "<p>a!!</p>"`
+	if err.Error() != expected {
+		t.Errorf("expected %q, got %q", expected, err.Error())
+	}
+}
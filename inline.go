@@ -0,0 +1,361 @@
+package htmlformat
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/net/html"
+)
+
+// DefaultInlineElements are the phrasing elements that are usually written
+// within the text around them, for use as Formatter.InlineElements.
+var DefaultInlineElements = []string{
+	"a", "abbr", "b", "bdi", "bdo", "br", "button", "cite", "code", "data",
+	"del", "dfn", "em", "i", "img", "input", "ins", "kbd", "label", "mark",
+	"math", "q", "s", "samp", "small", "span", "strong", "sub", "sup", "time", "u",
+	"var", "wbr",
+}
+
+// DefaultSingleLineElements are the elements holding short labels and titles
+// that are usually written on one line, for use as
+// Formatter.SingleLineElements.
+var DefaultSingleLineElements = []string{
+	"button", "caption", "dt", "figcaption", "h1", "h2", "h3", "h4", "h5", "h6",
+	"label", "legend", "option", "summary", "th", "title",
+}
+
+// separatesInline reports whether whitespace-only text between prev and next
+// is between inline-level siblings, where it renders as a space.
+func (p *printer) separatesInline(prev, next *html.Node) bool {
+	return prev != nil && next != nil && p.isInlineLevel(prev) && p.isInlineLevel(next)
+}
+
+// isInlineLevel reports whether n is laid out within a line of text: text,
+// a template action, or a phrasing element such as <span> or <a>.
+func (p *printer) isInlineLevel(n *html.Node) bool {
+	if n.Type == html.CommentNode {
+		_, ok := p.templateAction(n)
+		return ok
+	}
+	return n.Type == html.TextNode || p.isInline(n, DefaultInlineElements)
+}
+
+// isInline reports whether n is one of the inline elements, or is registered
+// in Elements as an inline element. MathML elements are inline if <math> is.
+func (f *Formatter) isInline(n *html.Node, inline []string) bool {
+	if n.Type != html.ElementNode {
+		return false
+	}
+	if b, ok := f.Elements[n.Data]; ok && n.Namespace == "" {
+		return b == InlineElement
+	}
+	data := n.Data
+	if n.Namespace == "math" {
+		data = "math"
+	}
+	for _, name := range inline {
+		if name == data {
+			return true
+		}
+	}
+	return false
+}
+
+// isFlowIn reports whether n can be written within a line of text: it is text,
+// or an inline element that contains only text and inline elements.
+func (f *Formatter) isFlowIn(n *html.Node, inline []string) bool {
+	switch n.Type {
+	case html.TextNode:
+		return true
+	case html.ElementNode:
+		if !f.isInline(n, inline) {
+			return false
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			if !f.isFlowIn(c, inline) {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
+
+func (f *Formatter) isFlow(n *html.Node) bool {
+	return f.isFlowIn(n, f.inlineElements())
+}
+
+// hasFlowContent reports whether n contains at least one inline element and
+// nothing that cannot be written within a line of text, so that it can be
+// written on a single line.
+func (f *Formatter) hasFlowContent(n *html.Node) bool {
+	if !f.hasInlineElements() || f.strictWhitespace(n) || f.isSpecialContentElement(n) || f.isPreformattedElement(n) {
+		return false
+	}
+	var inline bool
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if !f.isFlow(c) {
+			return false
+		}
+		inline = inline || c.Type == html.ElementNode
+	}
+	return inline
+}
+
+// flowRun returns the number of nodes at the start of nodes that can be
+// written together within a line of text. Runs without an inline element are
+// not returned, as text on its own is written as it is.
+func (f *Formatter) flowRun(nodes []*html.Node) int {
+	if !f.hasInlineElements() {
+		return 0
+	}
+	var n int
+	var inline bool
+	for n < len(nodes) && f.isFlow(nodes[n]) {
+		inline = inline || nodes[n].Type == html.ElementNode
+		n++
+	}
+	if !inline {
+		return 0
+	}
+	return n
+}
+
+// oneLine returns n written on a single line, if it fits within the print
+// width when indented to level. Only elements whose content is text and
+// inline elements are written on one line, so that runs of whitespace in
+// them can be collapsed to a single space without changing how they are
+// rendered. DefaultInlineElements are used if InlineElements is not set.
+// Without a print width, only SingleLineElements are.
+func (p *printer) oneLine(n *html.Node, level int) (line string, ok bool) {
+	if p.PrintWidth <= 0 && !p.isSingleLine(n) ||
+		p.strictWhitespace(n) || p.isSpecialContentElement(n) || p.isPreformattedElement(n) || p.hasNoEndTag(n) {
+		return "", false
+	}
+	inline := p.inlineElements()
+	if inline == nil {
+		inline = DefaultInlineElements
+	}
+	width := level * utf8.RuneCountInString(p.indent())
+	sb := &p.flow
+	sb.Reset()
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if !p.isFlowIn(c, inline) {
+			return "", false
+		}
+		p.writeFlow(sb, c)
+		if p.PrintWidth > 0 && width+sb.Len() > p.PrintWidth {
+			// The content alone is too wide.
+			return "", false
+		}
+	}
+	content := trimHTMLSpace(sb.String())
+	sb.Reset()
+	// Writing to a bytes.Buffer does not fail.
+	_ = p.printStartTag(sb, n)
+	sb.WriteString(content)
+	sb.WriteString(p.endTag(n))
+	line = sb.String()
+	if p.PrintWidth > 0 && width+utf8.RuneCountInString(line) > p.PrintWidth {
+		return "", false
+	}
+	return line, true
+}
+
+// isSingleLine reports whether n is one of SingleLineElements.
+func (f *Formatter) isSingleLine(n *html.Node) bool {
+	if n.Type != html.ElementNode || n.Namespace != "" {
+		return false
+	}
+	for _, name := range f.SingleLineElements {
+		if name == n.Data {
+			return true
+		}
+	}
+	return false
+}
+
+// printFlow writes nodes on a single line, indented to level unless they
+// continue the line of the sibling before them, with runs of whitespace
+// collapsed to a single space.
+func (p *printer) printFlow(w io.Writer, nodes []*html.Node, level int) (err error) {
+	if !p.continuesLine(nodes[0]) {
+		if err = p.printIndent(w, level); err != nil {
+			return
+		}
+	}
+	p.mark(nodes[0], 0)
+	p.flow.Reset()
+	for _, n := range nodes {
+		p.writeFlow(&p.flow, n)
+	}
+	line := trimHTMLSpace(p.flow.String())
+	// Strict runs may hold preformatted content, whose spaces must not be
+	// broken at.
+	if p.wrapsText() && !p.strictWhitespace(nodes[0]) {
+		line = p.wrapLines(line, level)
+	}
+	_, err = write(w, line, p.newline())
+	return
+}
+
+// wrapsText reports whether text that does not fit within the print width is
+// wrapped.
+func (p *printer) wrapsText() bool {
+	return p.WrapText && p.PrintWidth > 0
+}
+
+// wrapsContent reports whether the content of n, which does not fit on the
+// line of its tags, is wrapped on lines of its own. The content of inline
+// elements is not, as the whitespace at its start and end would be rendered.
+func (p *printer) wrapsContent(n *html.Node) bool {
+	inline := p.inlineElements()
+	if inline == nil {
+		inline = DefaultInlineElements
+	}
+	return p.wrapsText() && !p.strictWhitespace(n) && !p.isInline(n, inline) && !p.isSpecialContentElement(n) &&
+		!p.isPreformattedElement(n) && (hasSingleTextChild(n) || p.hasFlowContent(n))
+}
+
+// printWrapped writes the content of n, whose start tag has been written, as
+// wrapped lines indented by a level more than n, followed by its end tag.
+func (p *printer) printWrapped(w io.Writer, n *html.Node, level int) (err error) {
+	p.flow.Reset()
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		p.writeFlow(&p.flow, c)
+	}
+	content := string(bytes.TrimSpace(p.flow.Bytes()))
+	if _, err = io.WriteString(w, p.newline()); err != nil {
+		return
+	}
+	if err = p.printIndent(w, p.childLevel(n, level)); err != nil {
+		return
+	}
+	if _, err = write(w, p.wrapLines(content, p.childLevel(n, level)), p.newline()); err != nil {
+		return
+	}
+	if p.omitsEndTag(n) {
+		return nil
+	}
+	if err = p.printIndent(w, level); err != nil {
+		return
+	}
+	if _, err = write(w, "</", p.tagName(n), ">"); err != nil {
+		return
+	}
+	if !p.isFollowedByPunctuation(n) {
+		_, err = io.WriteString(w, p.newline())
+	}
+	return
+}
+
+// wrapLines returns the line s, which is written indented to level, broken
+// at spaces into lines that fit within the print width where they can, with
+// the lines after the first indented to level too. Spaces within tags are
+// not broken at, and words longer than the width are not split.
+func (p *printer) wrapLines(s string, level int) string {
+	indent := strings.Repeat(p.indent(), level)
+	width := utf8.RuneCountInString(indent)
+	if width+p.textWidth(s) <= p.PrintWidth {
+		return s
+	}
+	var sb strings.Builder
+	col := width
+	for i, word := range flowWords(s) {
+		n := p.textWidth(word)
+		switch {
+		case i == 0:
+		case col+1+n > p.PrintWidth:
+			sb.WriteString(p.newline() + indent)
+			col = width
+		default:
+			sb.WriteByte(' ')
+			col++
+		}
+		sb.WriteString(word)
+		col += n
+	}
+	return sb.String()
+}
+
+// textWidth returns the width of s as it is written, with the template
+// actions that placeholders in it stand for.
+func (p *printer) textWidth(s string) int {
+	return utf8.RuneCountInString(p.restoreActions(s))
+}
+
+// flowWords splits the line s at the spaces that are not within tags.
+func flowWords(s string) (words []string) {
+	var quote byte
+	var inTag bool
+	start := 0
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case inTag && (c == '"' || c == '\''):
+			quote = c
+		case c == '<':
+			inTag = true
+		case c == '>':
+			inTag = false
+		case c == ' ' && !inTag:
+			if i > start {
+				words = append(words, s[start:i])
+			}
+			start = i + 1
+		}
+	}
+	if start < len(s) {
+		words = append(words, s[start:])
+	}
+	return words
+}
+
+// writeFlow writes n and its descendants to sb as they appear within a line
+// of text.
+func (p *printer) writeFlow(sb *bytes.Buffer, n *html.Node) {
+	if n.Type == html.TextNode {
+		sb.WriteString(p.escapeText(n, collapseWhitespace(n.Data)))
+		return
+	}
+	if n.Type == html.DoctypeNode {
+		sb.WriteString(p.doctype(n))
+		return
+	}
+	if n.Type == html.CommentNode {
+		if src, ok := p.verbatimSource(n); ok {
+			sb.WriteString(src)
+		} else if _, ok := p.templateAction(n); ok {
+			sb.WriteString(n.Data)
+		} else {
+			sb.WriteString("<!--" + n.Data + "-->")
+		}
+		return
+	}
+	// Writing to a bytes.Buffer does not fail.
+	if p.isPreformattedElement(n) {
+		_ = p.printPre(sb, n)
+		return
+	}
+	if p.isSpecialContentElement(n) {
+		_ = p.printStartTag(sb, n)
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			sb.WriteString(p.escapeText(c, c.Data))
+		}
+		sb.WriteString("</" + p.tagName(n) + ">")
+		return
+	}
+	_ = p.printStartTag(sb, n)
+	if p.hasNoEndTag(n) {
+		return
+	}
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		p.writeFlow(sb, c)
+	}
+	sb.WriteString(p.endTag(n))
+}
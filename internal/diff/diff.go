@@ -0,0 +1,261 @@
+// Package diff produces unified diffs of line based text.
+package diff
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+// context is the number of unchanged lines shown around each change.
+const context = 3
+
+type op int
+
+const (
+	equal op = iota
+	remove
+	insert
+)
+
+type edit struct {
+	op   op
+	line string
+}
+
+// Unified returns a unified diff of a and b, with oldName and newName used in
+// the file headers. It returns nil if a and b are equal.
+func Unified(oldName, newName string, a, b []byte) []byte {
+	if bytes.Equal(a, b) {
+		return nil
+	}
+	edits := diffLines(splitLines(a), splitLines(b))
+
+	var out bytes.Buffer
+	fmt.Fprintf(&out, "--- %s\n+++ %s\n", oldName, newName)
+	for _, h := range hunks(edits) {
+		h.write(&out, edits)
+	}
+	return out.Bytes()
+}
+
+// splitLines splits s into lines, each retaining its trailing newline.
+func splitLines(s []byte) (lines []string) {
+	for len(s) > 0 {
+		i := bytes.IndexByte(s, '\n')
+		if i < 0 {
+			lines = append(lines, string(s))
+			break
+		}
+		lines = append(lines, string(s[:i+1]))
+		s = s[i+1:]
+	}
+	return lines
+}
+
+// diffLines computes the shortest edit script between a and b using Myers'
+// O(ND) algorithm, in its linear space form: the middle snake of the paths
+// is found by searching from both ends, and the parts before and after it
+// are diffed in turn.
+func diffLines(a, b []string) []edit {
+	var edits []edit
+	compare(&edits, a, b)
+	return edits
+}
+
+// compare appends the edits that turn a into b to edits.
+func compare(edits *[]edit, a, b []string) {
+	// Lines in common at the start and end are not searched.
+	var prefix int
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+	var suffix int
+	for suffix < len(a)-prefix && suffix < len(b)-prefix && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+	for _, line := range a[:prefix] {
+		*edits = append(*edits, edit{op: equal, line: line})
+	}
+	common := a[len(a)-suffix:]
+	a, b = a[prefix:len(a)-suffix], b[prefix:len(b)-suffix]
+	if x, y, ok := bisect(a, b); ok {
+		compare(edits, a[:x], b[:y])
+		compare(edits, a[x:], b[y:])
+	} else {
+		for _, line := range a {
+			*edits = append(*edits, edit{op: remove, line: line})
+		}
+		for _, line := range b {
+			*edits = append(*edits, edit{op: insert, line: line})
+		}
+	}
+	for _, line := range common {
+		*edits = append(*edits, edit{op: equal, line: line})
+	}
+}
+
+// bisect returns the point at which a shortest edit script between a and b,
+// which have no lines in common at either end, crosses the middle snake. It
+// returns false if the script is to remove all of a and insert all of b.
+func bisect(a, b []string) (x, y int, ok bool) {
+	n, m := len(a), len(b)
+	if n == 0 || m == 0 {
+		return 0, 0, false
+	}
+	// vf holds the furthest x reached on each diagonal k = x - y searching
+	// forward from the start, and vb the furthest reached searching back from
+	// the end, counted from the end, on each diagonal of the reversed inputs.
+	maxD := (n + m + 1) / 2
+	offset := maxD + 1
+	vf := make([]int, 2*offset+1)
+	vb := make([]int, 2*offset+1)
+	for i := range vf {
+		vf[i], vb[i] = -1, -1
+	}
+	vf[offset+1], vb[offset+1] = 0, 0
+	delta := n - m
+	// The paths meet in the forward search if delta is odd, and in the
+	// backward search otherwise.
+	odd := delta%2 != 0
+	// The diagonals that have run off the edges of the inputs are not
+	// searched again.
+	var kfStart, kfEnd, kbStart, kbEnd int
+	for d := 0; d < maxD; d++ {
+		for k := -d + kfStart; k <= d-kfEnd; k += 2 {
+			var x1 int
+			if k == -d || k != d && vf[offset+k-1] < vf[offset+k+1] {
+				x1 = vf[offset+k+1]
+			} else {
+				x1 = vf[offset+k-1] + 1
+			}
+			y1 := x1 - k
+			for x1 < n && y1 < m && a[x1] == b[y1] {
+				x1++
+				y1++
+			}
+			vf[offset+k] = x1
+			switch {
+			case x1 > n:
+				kfEnd += 2
+			case y1 > m:
+				kfStart += 2
+			case odd:
+				if kb := offset + delta - k; kb >= 0 && kb < len(vb) && vb[kb] != -1 && x1 >= n-vb[kb] {
+					return x1, y1, true
+				}
+			}
+		}
+		for k := -d + kbStart; k <= d-kbEnd; k += 2 {
+			var x2 int
+			if k == -d || k != d && vb[offset+k-1] < vb[offset+k+1] {
+				x2 = vb[offset+k+1]
+			} else {
+				x2 = vb[offset+k-1] + 1
+			}
+			y2 := x2 - k
+			for x2 < n && y2 < m && a[n-x2-1] == b[m-y2-1] {
+				x2++
+				y2++
+			}
+			vb[offset+k] = x2
+			switch {
+			case x2 > n:
+				kbEnd += 2
+			case y2 > m:
+				kbStart += 2
+			case !odd:
+				if kf := offset + delta - k; kf >= 0 && kf < len(vf) && vf[kf] != -1 {
+					x1 := vf[kf]
+					if y1 := x1 - (kf - offset); x1 >= n-x2 {
+						return x1, y1, true
+					}
+				}
+			}
+		}
+	}
+	return 0, 0, false
+}
+
+// hunk is a range of edits, along with the line numbers, counting from zero,
+// of the first line of the range in each input.
+type hunk struct {
+	start, end       int
+	oldLine, newLine int
+}
+
+func hunks(edits []edit) (hs []hunk) {
+	var oldLine, newLine int
+	var h *hunk
+	for i, e := range edits {
+		if e.op != equal {
+			if h == nil || i-h.end > 2*context {
+				if h != nil {
+					hs = append(hs, *h)
+				}
+				start := i - context
+				if start < 0 {
+					start = 0
+				}
+				h = &hunk{start: start, oldLine: oldLine - (i - start), newLine: newLine - (i - start)}
+			}
+			h.end = i + 1
+		}
+		switch e.op {
+		case equal:
+			oldLine++
+			newLine++
+		case remove:
+			oldLine++
+		case insert:
+			newLine++
+		}
+	}
+	if h != nil {
+		hs = append(hs, *h)
+	}
+	for i := range hs {
+		hs[i].end += context
+		if hs[i].end > len(edits) {
+			hs[i].end = len(edits)
+		}
+	}
+	return hs
+}
+
+func (h hunk) write(out *bytes.Buffer, edits []edit) {
+	var oldCount, newCount int
+	for _, e := range edits[h.start:h.end] {
+		if e.op != insert {
+			oldCount++
+		}
+		if e.op != remove {
+			newCount++
+		}
+	}
+	fmt.Fprintf(out, "@@ -%s +%s @@\n", formatRange(h.oldLine, oldCount), formatRange(h.newLine, newCount))
+	for _, e := range edits[h.start:h.end] {
+		switch e.op {
+		case equal:
+			out.WriteByte(' ')
+		case remove:
+			out.WriteByte('-')
+		case insert:
+			out.WriteByte('+')
+		}
+		out.WriteString(e.line)
+		if !strings.HasSuffix(e.line, "\n") {
+			out.WriteString("\n\\ No newline at end of file\n")
+		}
+	}
+}
+
+func formatRange(line, count int) string {
+	switch count {
+	case 0:
+		return fmt.Sprintf("%d,0", line)
+	case 1:
+		return fmt.Sprintf("%d", line+1)
+	}
+	return fmt.Sprintf("%d,%d", line+1, count)
+}
@@ -0,0 +1,184 @@
+package diff
+
+import (
+	"bytes"
+	"fmt"
+	"math/rand"
+	"runtime"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+)
+
+func TestUnified(t *testing.T) {
+	tests := []struct {
+		name     string
+		a, b     string
+		expected string
+	}{
+		{
+			name:     "equal inputs produce no diff",
+			a:        "a\nb\n",
+			b:        "a\nb\n",
+			expected: "",
+		},
+		{
+			name: "changed lines are shown with context",
+			a:    "1\n2\n3\n4\n5\n6\n7\n8\n9\n",
+			b:    "1\n2\n3\n4\nfive\n6\n7\n8\n9\n",
+			expected: `--- a
++++ b
+@@ -2,7 +2,7 @@
+ 2
+ 3
+ 4
+-5
++five
+ 6
+ 7
+ 8
+`,
+		},
+		{
+			name: "distant changes are split into hunks",
+			a:    "1\n2\n3\n4\n5\n6\n7\n8\n9\n10\n",
+			b:    "one\n2\n3\n4\n5\n6\n7\n8\n9\n",
+			expected: `--- a
++++ b
+@@ -1,4 +1,4 @@
+-1
++one
+ 2
+ 3
+ 4
+@@ -7,4 +7,3 @@
+ 7
+ 8
+ 9
+-10
+`,
+		},
+		{
+			name: "missing trailing newlines are marked",
+			a:    "a",
+			b:    "a\n",
+			expected: `--- a
++++ b
+@@ -1 +1 @@
+-a
+\ No newline at end of file
++a
+`,
+		},
+		{
+			name: "insertion into empty input",
+			a:    "",
+			b:    "a\n",
+			expected: `--- a
++++ b
+@@ -0,0 +1 @@
++a
+`,
+		},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			actual := string(Unified("a", "b", []byte(test.a), []byte(test.b)))
+			if diff := cmp.Diff(test.expected, actual); diff != "" {
+				t.Error(diff)
+			}
+		})
+	}
+}
+
+func TestDiffLinesIsShortest(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	for i := 0; i < 500; i++ {
+		a, b := randomLines(r), randomLines(r)
+		edits := diffLines(a, b)
+		var gotA, gotB []string
+		var changes int
+		for _, e := range edits {
+			if e.op != insert {
+				gotA = append(gotA, e.line)
+			}
+			if e.op != remove {
+				gotB = append(gotB, e.line)
+			}
+			if e.op != equal {
+				changes++
+			}
+		}
+		if !cmp.Equal(a, gotA, cmpopts.EquateEmpty()) || !cmp.Equal(b, gotB, cmpopts.EquateEmpty()) {
+			t.Fatalf("%q to %q: the edits do not turn one into the other", a, b)
+		}
+		if expected := len(a) + len(b) - 2*lcsLength(a, b); changes != expected {
+			t.Errorf("%q to %q: expected %d changes, got %d", a, b, expected, changes)
+		}
+	}
+}
+
+func randomLines(r *rand.Rand) (lines []string) {
+	for i := r.Intn(12); i > 0; i-- {
+		lines = append(lines, string(rune('a'+r.Intn(4))))
+	}
+	return lines
+}
+
+// lcsLength returns the length of the longest common subsequence of a and b.
+func lcsLength(a, b []string) int {
+	prev := make([]int, len(b)+1)
+	for i := range a {
+		cur := make([]int, len(b)+1)
+		for j := range b {
+			switch {
+			case a[i] == b[j]:
+				cur[j+1] = prev[j] + 1
+			case prev[j+1] > cur[j]:
+				cur[j+1] = prev[j+1]
+			default:
+				cur[j+1] = cur[j]
+			}
+		}
+		prev = cur
+	}
+	return prev[len(b)]
+}
+
+func TestUnifiedMemory(t *testing.T) {
+	// A minified page on one line, and the thousands of lines it is
+	// formatted to, must not take memory in proportion to the product of
+	// their lengths.
+	var minified, formatted, changed bytes.Buffer
+	for i := 0; i < 9000; i++ {
+		fmt.Fprintf(&minified, "<p>%d</p>", i)
+		fmt.Fprintf(&formatted, "<p>%d</p>\n", i)
+		if i%2 == 0 {
+			fmt.Fprintf(&changed, "<p>%d</p>\n", i)
+		} else {
+			fmt.Fprintf(&changed, "<p>changed %d</p>\n", i)
+		}
+	}
+	for _, test := range []struct{ name, a, b string }{
+		{"one line to many", minified.String(), formatted.String()},
+		{"many changed lines", formatted.String(), changed.String()},
+	} {
+		var before, after runtime.MemStats
+		runtime.GC()
+		runtime.ReadMemStats(&before)
+		out := Unified("a", "b", []byte(test.a), []byte(test.b))
+		runtime.ReadMemStats(&after)
+		if out == nil {
+			t.Fatalf("%s: expected a diff", test.name)
+		}
+		const limit = 64 << 20
+		if allocated := after.TotalAlloc - before.TotalAlloc; allocated > limit {
+			t.Errorf("%s: expected at most %d bytes to be allocated, got %d", test.name, limit, allocated)
+		}
+	}
+}
@@ -0,0 +1,136 @@
+package htmlformat
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+
+	"golang.org/x/net/html"
+)
+
+// LimitError is returned when the input exceeds one of the limits set by
+// MaxBytes, MaxDepth and MaxNodes.
+type LimitError struct {
+	// Limit is the name of the Formatter field that sets the limit, such as
+	// "MaxDepth".
+	Limit string
+	// Max is the value of the limit.
+	Max int
+}
+
+var limitDescriptions = map[string]string{
+	"MaxBytes": "is larger than %d bytes",
+	"MaxDepth": "has elements nested more than %d deep",
+	"MaxNodes": "has more than %d nodes",
+}
+
+func (e *LimitError) Error() string {
+	return "the input " + fmt.Sprintf(limitDescriptions[e.Limit], e.Max)
+}
+
+// readInput reads the input, up to MaxBytes of it if it is set.
+func (f *Formatter) readInput(r io.Reader) (src []byte, err error) {
+	if f.MaxBytes <= 0 {
+		return io.ReadAll(r)
+	}
+	if src, err = io.ReadAll(io.LimitReader(r, int64(f.MaxBytes)+1)); err != nil {
+		return nil, err
+	}
+	if len(src) > f.MaxBytes {
+		return nil, &LimitError{Limit: "MaxBytes", Max: f.MaxBytes}
+	}
+	return src, nil
+}
+
+// limitReader returns a *LimitError once more than max bytes have been read
+// from r, for Stream, which does not read its input all at once.
+type limitReader struct {
+	r        io.Reader
+	max, len int
+}
+
+func (l *limitReader) Read(b []byte) (n int, err error) {
+	n, err = l.r.Read(b)
+	if l.len += n; l.len > l.max {
+		return n, &LimitError{Limit: "MaxBytes", Max: l.max}
+	}
+	return n, err
+}
+
+// checkTokenLimits returns a *LimitError if the preprocessed input src has
+// more nodes or deeper nesting than MaxNodes and MaxDepth allow, before the
+// parser spends time on it. The nesting of the tokens is followed as closely
+// as the parser's rules for omitted end tags allow; checkTreeLimits checks
+// the parsed tree exactly.
+func (f *Formatter) checkTokenLimits(src []byte) error {
+	z := html.NewTokenizer(bytes.NewReader(src))
+	var open []html.Token
+	var nodes int
+	for {
+		tt := z.Next()
+		if tt == html.ErrorToken {
+			return nil
+		}
+		if tt != html.EndTagToken {
+			if nodes++; f.MaxNodes > 0 && nodes > f.MaxNodes {
+				return &LimitError{Limit: "MaxNodes", Max: f.MaxNodes}
+			}
+		}
+		switch tt {
+		case html.StartTagToken:
+			tok := z.Token()
+			for i := len(open) - 1; i >= 0; i-- {
+				if impliesEnd(tok.DataAtom, open[i].DataAtom) {
+					open = open[:i]
+					break
+				}
+				if !hasOptionalEndTag(open[i].DataAtom) {
+					break
+				}
+			}
+			if f.isVoidElementName(tok.Data) {
+				continue
+			}
+			if open = append(open, tok); f.MaxDepth > 0 && len(open) > f.MaxDepth {
+				return &LimitError{Limit: "MaxDepth", Max: f.MaxDepth}
+			}
+		case html.EndTagToken:
+			name, _ := z.TagName()
+			for i := len(open) - 1; i >= 0; i-- {
+				if open[i].Data == string(name) {
+					open = open[:i]
+					break
+				}
+			}
+		}
+	}
+}
+
+// checkTreeLimits returns a *LimitError if the parsed nodes have more nodes
+// or deeper nesting than MaxNodes and MaxDepth allow, including the elements
+// that the parser inserts.
+func (f *Formatter) checkTreeLimits(nodes []*html.Node) error {
+	var count, depth int
+	for _, n := range nodes {
+		err := walk(n, func(n *html.Node) (bool, error) {
+			if count++; f.MaxNodes > 0 && count > f.MaxNodes {
+				return false, &LimitError{Limit: "MaxNodes", Max: f.MaxNodes}
+			}
+			if n.Type == html.ElementNode {
+				if depth++; f.MaxDepth > 0 && depth > f.MaxDepth {
+					return false, &LimitError{Limit: "MaxDepth", Max: f.MaxDepth}
+				}
+			}
+			return true, nil
+		}, func(n *html.Node) error {
+			if n.Type == html.ElementNode {
+				depth--
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,95 @@
+package htmlformat
+
+import (
+	"errors"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestLimits(t *testing.T) {
+	tests := []struct {
+		name      string
+		formatter Formatter
+		document  bool
+		input     string
+		expected  *LimitError
+	}{
+		{
+			name:      "input up to max bytes is formatted",
+			formatter: Formatter{MaxBytes: 8},
+			input:     "<p>x</p>",
+		},
+		{
+			name:      "input over max bytes is refused",
+			formatter: Formatter{MaxBytes: 7},
+			input:     "<p>x</p>",
+			expected:  &LimitError{Limit: "MaxBytes", Max: 7},
+		},
+		{
+			name:      "nesting up to max depth is formatted",
+			formatter: Formatter{MaxDepth: 2},
+			input:     "<div><div>x</div></div><p>y</p>",
+		},
+		{
+			name:      "nesting deeper than max depth is refused",
+			formatter: Formatter{MaxDepth: 1},
+			input:     "<div><div>x</div></div>",
+			expected:  &LimitError{Limit: "MaxDepth", Max: 1},
+		},
+		{
+			name:      "omitted end tags do not count as nesting",
+			formatter: Formatter{MaxDepth: 2},
+			input:     "<ul><li>a<li>b<li>c</ul><p>d<p>e",
+		},
+		{
+			name:      "elements that the parser inserts count as nesting",
+			formatter: Formatter{MaxDepth: 2},
+			document:  true,
+			input:     "<p>x</p>",
+			expected:  &LimitError{Limit: "MaxDepth", Max: 2},
+		},
+		{
+			name:      "input up to max nodes is formatted",
+			formatter: Formatter{MaxNodes: 4},
+			input:     "<p>a</p><p>b</p>",
+		},
+		{
+			name:      "input with more than max nodes is refused",
+			formatter: Formatter{MaxNodes: 3},
+			input:     "<p>a</p><p>b</p>",
+			expected:  &LimitError{Limit: "MaxNodes", Max: 3},
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			format := tt.formatter.FragmentString
+			if tt.document {
+				format = tt.formatter.DocumentString
+			}
+			_, err := format(tt.input)
+			var le *LimitError
+			if err != nil && !errors.As(err, &le) {
+				t.Fatalf("expected a *LimitError, got %v", err)
+			}
+			if diff := cmp.Diff(tt.expected, le); diff != "" {
+				t.Error(diff)
+			}
+		})
+	}
+}
+
+func TestStreamMaxBytes(t *testing.T) {
+	f := Formatter{MaxBytes: 100}
+	err := f.Stream(io.Discard, strings.NewReader(strings.Repeat("<p>x</p>", 100)))
+	var le *LimitError
+	if !errors.As(err, &le) {
+		t.Fatalf("expected a *LimitError, got %v", err)
+	}
+	if expected := "the input is larger than 100 bytes"; err.Error() != expected {
+		t.Errorf("expected %q, got %q", expected, err.Error())
+	}
+}
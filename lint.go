@@ -0,0 +1,165 @@
+package htmlformat
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// Diagnostic describes an issue in the input that LintDocument and
+// LintFragment find.
+type Diagnostic struct {
+	// Offset is the byte offset in the input of the markup with the issue.
+	Offset int
+	// Line and Column are the 1-based line number and byte column of Offset.
+	Line, Column int
+	// Rule names the kind of issue: "unknown-element", "obsolete-element",
+	// "duplicate-id", "duplicate-attribute" or "repair", for markup that the
+	// parser repairs, such as a missing end tag.
+	Rule    string
+	Message string
+}
+
+func (d Diagnostic) String() string {
+	return fmt.Sprintf("%d:%d: %s (%s)", d.Line, d.Column, d.Message, d.Rule)
+}
+
+// LintDocument returns the issues in a HTML document, with the default
+// settings.
+func LintDocument(r io.Reader) ([]Diagnostic, error) {
+	return new(Formatter).LintDocument(r)
+}
+
+// LintFragment returns the issues in a fragment of a HTML document, with the
+// default settings.
+func LintFragment(r io.Reader) ([]Diagnostic, error) {
+	return new(Formatter).LintFragment(r)
+}
+
+// LintDocument returns the issues in a HTML document, in the order they
+// appear in the input: elements that are not part of HTML or that are
+// obsolete, IDs and attributes that are used more than once, and markup that
+// the parser repairs. Custom elements, and those registered in Elements, are
+// not reported as unknown. The input is parsed as for formatting, but not
+// sanitized, and is not rejected by Strict.
+func (f *Formatter) LintDocument(r io.Reader) ([]Diagnostic, error) {
+	return f.lint(r, nil)
+}
+
+// LintFragment returns the issues in a fragment of a HTML document, like
+// LintDocument.
+func (f *Formatter) LintFragment(r io.Reader) ([]Diagnostic, error) {
+	return f.lint(r, fragmentContext(""))
+}
+
+func (f *Formatter) lint(r io.Reader, context *html.Node) (ds []Diagnostic, err error) {
+	lf := *f
+	lf.Strict, lf.DuplicateAttributes = false, KeepDuplicates
+	lf.Sanitizer, lf.Component = nil, nil
+	p := lf.newPrinter()
+	p.linting = true
+	p.context = context
+	if r, err = p.preprocess(r); err != nil {
+		return nil, err
+	}
+	nodes, err := p.parse(r)
+	if err != nil {
+		return nil, err
+	}
+	for _, repair := range p.repairs() {
+		ds = append(ds, Diagnostic{Offset: repair.Offset, Line: repair.Line, Column: repair.Column, Rule: "repair", Message: repair.Message})
+	}
+	p.locate(nodes)
+	report := func(n *html.Node, rule, format string, args ...any) {
+		offset, ok := p.offsets[n]
+		if !ok {
+			// Elements that the parser inserts are reported as repairs.
+			return
+		}
+		line, column := position(p.input, offset)
+		ds = append(ds, Diagnostic{Offset: offset, Line: line, Column: column, Rule: rule, Message: fmt.Sprintf(format, args...)})
+	}
+	ids := make(map[string]*html.Node)
+	for _, n := range nodes {
+		_ = walk(n, func(n *html.Node) (bool, error) {
+			if n.Type != html.ElementNode {
+				return true, nil
+			}
+			if n.Namespace == "" {
+				switch {
+				case obsoleteElements[n.Data]:
+					report(n, "obsolete-element", "<%s> is obsolete", n.Data)
+				case !knownElements[n.Data] && !strings.Contains(n.Data, "-"):
+					if _, ok := p.Elements[n.Data]; !ok {
+						report(n, "unknown-element", "<%s> is not a HTML element", n.Data)
+					}
+				}
+			}
+			for _, name := range duplicateAttributes(n.Attr) {
+				report(n, "duplicate-attribute", "duplicate %s attribute on <%s>", name, n.Data)
+			}
+			for _, a := range n.Attr {
+				if a.Namespace != "" || a.Key != "id" || a.Val == "" || strings.ContainsRune(a.Val, placeholderStart) {
+					continue
+				}
+				if first, ok := ids[a.Val]; ok {
+					line, column := position(p.input, p.offsets[first])
+					report(n, "duplicate-id", "duplicate id %q, first used at %d:%d", a.Val, line, column)
+				} else if _, ok := p.offsets[n]; ok {
+					ids[a.Val] = n
+				}
+				break
+			}
+			return true, nil
+		}, func(*html.Node) error { return nil })
+	}
+	sort.SliceStable(ds, func(i, j int) bool {
+		return ds[i].Offset < ds[j].Offset
+	})
+	return ds, nil
+}
+
+// knownElements holds the names of the elements of HTML, apart from the
+// obsolete ones.
+var knownElements = map[string]bool{
+	"a": true, "abbr": true, "address": true, "area": true, "article": true,
+	"aside": true, "audio": true, "b": true, "base": true, "bdi": true,
+	"bdo": true, "blockquote": true, "body": true, "br": true, "button": true,
+	"canvas": true, "caption": true, "cite": true, "code": true, "col": true,
+	"colgroup": true, "data": true, "datalist": true, "dd": true, "del": true,
+	"details": true, "dfn": true, "dialog": true, "div": true, "dl": true,
+	"dt": true, "em": true, "embed": true, "fieldset": true, "figcaption": true,
+	"figure": true, "footer": true, "form": true, "h1": true, "h2": true,
+	"h3": true, "h4": true, "h5": true, "h6": true, "head": true,
+	"header": true, "hgroup": true, "hr": true, "html": true, "i": true,
+	"iframe": true, "img": true, "input": true, "ins": true, "kbd": true,
+	"label": true, "legend": true, "li": true, "link": true, "main": true,
+	"map": true, "mark": true, "math": true, "menu": true, "meta": true,
+	"meter": true, "nav": true, "noscript": true, "object": true, "ol": true,
+	"optgroup": true, "option": true, "output": true, "p": true, "param": true,
+	"picture": true, "pre": true, "progress": true, "q": true, "rp": true,
+	"rt": true, "ruby": true, "s": true, "samp": true, "script": true,
+	"search": true, "section": true, "select": true, "slot": true,
+	"small": true, "source": true, "span": true, "strong": true, "style": true,
+	"sub": true, "summary": true, "sup": true, "svg": true, "table": true,
+	"tbody": true, "td": true, "template": true, "textarea": true,
+	"tfoot": true, "th": true, "thead": true, "time": true, "title": true,
+	"tr": true, "track": true, "u": true, "ul": true, "var": true,
+	"video": true, "wbr": true,
+}
+
+// obsoleteElements holds the names of the elements that HTML no longer
+// allows.
+// https://html.spec.whatwg.org/multipage/obsolete.html#non-conforming-features
+var obsoleteElements = map[string]bool{
+	"acronym": true, "applet": true, "basefont": true, "bgsound": true,
+	"big": true, "blink": true, "center": true, "dir": true, "font": true,
+	"frame": true, "frameset": true, "isindex": true, "keygen": true,
+	"listing": true, "marquee": true, "menuitem": true, "multicol": true,
+	"nextid": true, "nobr": true, "noembed": true, "noframes": true,
+	"plaintext": true, "rb": true, "rtc": true, "spacer": true, "strike": true,
+	"tt": true, "xmp": true,
+}
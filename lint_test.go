@@ -0,0 +1,84 @@
+package htmlformat
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestLint(t *testing.T) {
+	tests := []struct {
+		name      string
+		formatter Formatter
+		document  bool
+		input     string
+		expected  []string
+	}{
+		{
+			name:  "unknown and obsolete elements are reported",
+			input: "<center>\n<foo>a</foo><my-element></my-element><svg><linearGradient/></svg>\n</center>",
+			expected: []string{
+				"1:1: <center> is obsolete (obsolete-element)",
+				"2:1: <foo> is not a HTML element (unknown-element)",
+			},
+		},
+		{
+			name:      "elements registered in Elements are known",
+			formatter: Formatter{Elements: map[string]ElementBehavior{"icon": VoidElement}},
+			input:     "<icon>",
+		},
+		{
+			name:  "duplicate ids and attributes are reported",
+			input: "<p id=\"a\">x</p>\n<p id=\"b\" class=\"c\" class=\"d\">y</p>\n<p id=\"a\">z</p>",
+			expected: []string{
+				"2:1: duplicate class attribute on <p> (duplicate-attribute)",
+				`3:1: duplicate id "a", first used at 1:1 (duplicate-id)`,
+			},
+		},
+		{
+			name:  "markup that the parser repairs is reported",
+			input: "<div>\n<span>a</div>\n<ul></ol>",
+			expected: []string{
+				"2:1: missing end tag for <span> (repair)",
+				"3:1: missing end tag for <ul> (repair)",
+				"3:5: unexpected end tag </ol> (repair)",
+			},
+		},
+		{
+			name:      "documents are linted",
+			formatter: Formatter{Strict: true},
+			document:  true,
+			input:     "<!DOCTYPE html>\n<title>a</title>\n<font>b</font>",
+			expected:  []string{"3:1: <font> is obsolete (obsolete-element)"},
+		},
+		{
+			name:      "ids with template actions are not compared",
+			formatter: Formatter{Template: GoTemplate},
+			input:     `{{ range . }}<p id="item-{{ .ID }}">x</p>{{ end }}<p id="item-{{ .ID }}">y</p>`,
+		},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			lint := test.formatter.LintFragment
+			if test.document {
+				lint = test.formatter.LintDocument
+			}
+			ds, err := lint(strings.NewReader(test.input))
+			if err != nil {
+				t.Fatal(err)
+			}
+			var actual []string
+			for _, d := range ds {
+				actual = append(actual, d.String())
+			}
+			if diff := cmp.Diff(test.expected, actual); diff != "" {
+				t.Error(diff)
+			}
+		})
+	}
+}
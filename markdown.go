@@ -0,0 +1,232 @@
+package htmlformat
+
+import (
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// Markdown formats the HTML blocks of a Markdown document with the default
+// settings.
+func Markdown(w io.Writer, r io.Reader) (err error) {
+	return new(Formatter).Markdown(w, r)
+}
+
+// Markdown formats the raw HTML blocks of a CommonMark document, leaving the
+// Markdown around them as it is, for documentation that mixes the two. The
+// blocks formatted are those that start with a block-level tag, such as
+// <div> or <table>, or with a tag alone on its line, and that end at a blank
+// line, as CommonMark defines them. A block is left as it is if its tags are
+// not all closed within it, as when Markdown is written between a <div> and
+// its end tag, or if it cannot be formatted. Blocks within fenced code,
+// block quotes and list items, and YAML front matter, are not formatted.
+// Blank lines are never written within a block, as they would end it.
+func (f *Formatter) Markdown(w io.Writer, r io.Reader) (err error) {
+	src, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	bf := *f
+	bf.MaxBlankLines = 0
+	lines := splitLines(string(src))
+	var out strings.Builder
+	var fence string
+	// rawEnd holds the strings that end the raw HTML block that is being
+	// copied, if any.
+	var rawEnd []string
+	// paragraph is set when the previous line continues a paragraph, which
+	// only some HTML blocks can interrupt.
+	var paragraph bool
+	// list is set within a list, whose items' blocks are indented.
+	var list bool
+	for i := 0; i < len(lines); i++ {
+		line := lines[i]
+		if i == 0 && strings.TrimRight(line, "\r\n") == "---" {
+			end := i + 1
+			for end < len(lines) && strings.TrimRight(lines[end], "\r\n") != "---" && strings.TrimRight(lines[end], "\r\n") != "..." {
+				end++
+			}
+			if end < len(lines) {
+				for ; i <= end; i++ {
+					out.WriteString(lines[i])
+				}
+				i--
+				continue
+			}
+		}
+		content := strings.TrimRight(line, "\r\n")
+		trimmed := strings.TrimLeft(content, " ")
+		indent := len(content) - len(trimmed)
+		if trimmed != "" && indent == 0 {
+			list = markdownListItem.MatchString(trimmed)
+		} else if trimmed != "" && indent < 4 && markdownListItem.MatchString(trimmed) {
+			list = true
+		}
+		switch {
+		case fence != "":
+			if indent < 4 && strings.HasPrefix(trimmed, fence) && strings.Trim(trimmed, fence[:1]+" \t") == "" {
+				fence = ""
+			}
+			out.WriteString(line)
+			continue
+		case indent < 4 && (strings.HasPrefix(trimmed, "```") || strings.HasPrefix(trimmed, "~~~")):
+			fence = trimmed[:3]
+			for len(fence) < len(trimmed) && trimmed[len(fence)] == fence[0] {
+				fence += fence[:1]
+			}
+			out.WriteString(line)
+			paragraph = false
+			continue
+		case rawEnd != nil:
+			if containsAnyFold(line, rawEnd) {
+				rawEnd = nil
+			}
+			out.WriteString(line)
+			continue
+		case indent < 4 && !(list && indent > 0) && strings.HasPrefix(trimmed, "<"):
+			if end, ok := markdownRawEnd(trimmed); ok {
+				if !containsAnyFold(trimmed[1:], end) {
+					rawEnd = end
+				}
+				out.WriteString(line)
+				paragraph = false
+				continue
+			}
+			if !markdownBlockStart.MatchString(trimmed) && (paragraph || !markdownTagLine.MatchString(trimmed)) {
+				break
+			}
+			end := i + 1
+			for end < len(lines) && strings.TrimSpace(lines[end]) != "" {
+				end++
+			}
+			block := strings.Join(lines[i:end], "")
+			out.WriteString(bf.markdownBlock(block))
+			i = end - 1
+			paragraph = false
+			continue
+		}
+		out.WriteString(line)
+		paragraph = strings.TrimSpace(content) != "" && indent < 4
+	}
+	_, err = io.WriteString(newOutputWriter(w), out.String())
+	return err
+}
+
+// markdownBlock returns the HTML block formatted, or as it is if it cannot
+// be formatted on its own.
+func (f *Formatter) markdownBlock(block string) string {
+	src := strings.TrimRight(block, "\r\n")
+	if !f.isBalanced(src) {
+		return block
+	}
+	var out []byte
+	var err error
+	if isDocumentSource([]byte(src)) {
+		out, err = f.AppendDocument(nil, []byte(src))
+	} else {
+		out, err = f.AppendFragment(nil, []byte(src))
+	}
+	if err != nil {
+		return block
+	}
+	return strings.TrimRight(string(out), "\r\n") + block[len(src):]
+}
+
+// isBalanced reports whether each element started in src, apart from void
+// elements, ends within it, and each end tag closes an element started in
+// it, so that it can be formatted on its own.
+func (f *Formatter) isBalanced(src string) bool {
+	z := html.NewTokenizer(strings.NewReader(src))
+	var open []string
+	for {
+		switch z.Next() {
+		case html.ErrorToken:
+			return len(open) == 0
+		case html.StartTagToken:
+			name, _ := z.TagName()
+			if !f.isVoidElementName(string(name)) {
+				open = append(open, string(name))
+			}
+		case html.EndTagToken:
+			name, _ := z.TagName()
+			if len(open) == 0 || open[len(open)-1] != string(name) {
+				return false
+			}
+			open = open[:len(open)-1]
+		}
+	}
+}
+
+// splitLines splits s into lines, each with its line ending.
+func splitLines(s string) (lines []string) {
+	for s != "" {
+		i := strings.IndexByte(s, '\n') + 1
+		if i == 0 {
+			i = len(s)
+		}
+		lines = append(lines, s[:i])
+		s = s[i:]
+	}
+	return lines
+}
+
+// markdownBlockStart matches the start of a line that starts an HTML block of
+// CommonMark's type 6, with one of its block-level tags.
+// https://spec.commonmark.org/0.31.2/#html-blocks
+var markdownBlockStart = regexp.MustCompile(`(?i)^</?(` + strings.Join([]string{
+	"address", "article", "aside", "base", "basefont", "blockquote", "body",
+	"caption", "center", "col", "colgroup", "dd", "details", "dialog", "dir",
+	"div", "dl", "dt", "fieldset", "figcaption", "figure", "footer", "form",
+	"frame", "frameset", "h[1-6]", "head", "header", "hr", "html", "iframe",
+	"legend", "li", "link", "main", "menu", "menuitem", "nav", "noframes",
+	"ol", "optgroup", "option", "p", "param", "search", "section", "summary",
+	"table", "tbody", "td", "tfoot", "th", "thead", "title", "tr", "track",
+	"ul",
+}, "|") + `)([ \t>]|/>|$)`)
+
+// markdownTagLine matches a line that starts an HTML block of CommonMark's
+// type 7: a single complete start or end tag, other than those of the raw
+// text elements, followed only by whitespace.
+var markdownTagLine = regexp.MustCompile(fmt.Sprintf(`^(<[A-Za-z][A-Za-z0-9-]*(%s)*[ \t]*/?>|</[A-Za-z][A-Za-z0-9-]*[ \t]*>)[ \t]*$`,
+	`[ \t]+[A-Za-z_:][A-Za-z0-9_.:-]*([ \t]*=[ \t]*([^ \t"'=<>`+"`"+`]+|'[^']*'|"[^"]*"))?`))
+
+// markdownListItem matches the marker that starts a list item.
+var markdownListItem = regexp.MustCompile(`^([-+*]|[0-9]{1,9}[.)])([ \t]|$)`)
+
+// markdownRawBlocks are the starts of the HTML blocks of CommonMark's types 1
+// to 5, whose content is left as it is, and the strings that end them.
+var markdownRawBlocks = []struct {
+	start *regexp.Regexp
+	end   []string
+}{
+	{regexp.MustCompile(`(?i)^<(pre|script|style|textarea)([ \t>]|$)`), []string{"</pre>", "</script>", "</style>", "</textarea>"}},
+	{regexp.MustCompile(`^<!--`), []string{"-->"}},
+	{regexp.MustCompile(`^<\?`), []string{"?>"}},
+	{regexp.MustCompile(`^<!\[CDATA\[`), []string{"]]>"}},
+	{regexp.MustCompile(`^<![A-Za-z]`), []string{">"}},
+}
+
+// markdownRawEnd returns the strings that end the raw HTML block that line
+// starts, if it starts one.
+func markdownRawEnd(line string) (end []string, ok bool) {
+	for _, b := range markdownRawBlocks {
+		if b.start.MatchString(line) {
+			return b.end, true
+		}
+	}
+	return nil, false
+}
+
+// containsAnyFold reports whether s contains any of substrs, ignoring case.
+func containsAnyFold(s string, substrs []string) bool {
+	s = strings.ToLower(s)
+	for _, sub := range substrs {
+		if strings.Contains(s, sub) {
+			return true
+		}
+	}
+	return false
+}
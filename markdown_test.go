@@ -0,0 +1,67 @@
+package htmlformat
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestMarkdown(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{
+			name:     "HTML blocks are formatted",
+			input:    "# Title\n\n<div class=\"note\"><p>Read *this*.</p></div>\n\nSome _text_.\n",
+			expected: "# Title\n\n<div class=\"note\">\n <p>Read *this*.</p>\n</div>\n\nSome _text_.\n",
+		},
+		{
+			name:     "blocks whose tags are closed after Markdown are left as they are",
+			input:    "<div align=\"center\">\n\n**Bold**\n\n</div>\n",
+			expected: "<div align=\"center\">\n\n**Bold**\n\n</div>\n",
+		},
+		{
+			name:     "fenced code is left as it is",
+			input:    "```html\n<div><p>a</p></div>\n```\n",
+			expected: "```html\n<div><p>a</p></div>\n```\n",
+		},
+		{
+			name:     "front matter is left as it is",
+			input:    "---\nlayout: <div><p>a</p></div>\n---\n<div><p>a</p></div>\n",
+			expected: "---\nlayout: <div><p>a</p></div>\n---\n<div>\n <p>a</p>\n</div>\n",
+		},
+		{
+			name:     "raw blocks are left as they are until their end",
+			input:    "<pre>\n<div><p>a</p></div>\n\n<div><p>b</p></div>\n</pre>\n",
+			expected: "<pre>\n<div><p>a</p></div>\n\n<div><p>b</p></div>\n</pre>\n",
+		},
+		{
+			name:     "blocks within list items are left as they are",
+			input:    "- Item\n\n  <div><p>a</p></div>\n",
+			expected: "- Item\n\n  <div><p>a</p></div>\n",
+		},
+		{
+			name:     "inline HTML within paragraphs is left as it is",
+			input:    "Some text\n<span><b>a</b></span>\n",
+			expected: "Some text\n<span><b>a</b></span>\n",
+		},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			var sb strings.Builder
+			if err := Markdown(&sb, strings.NewReader(test.input)); err != nil {
+				t.Fatalf("failed to format: %v", err)
+			}
+			if diff := cmp.Diff(test.expected, sb.String()); diff != "" {
+				t.Error(diff)
+			}
+		})
+	}
+}
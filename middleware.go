@@ -0,0 +1,136 @@
+package htmlformat
+
+import (
+	"bytes"
+	"mime"
+	"net/http"
+	"strconv"
+)
+
+// Middleware returns a handler that pretty-prints the HTML responses of next
+// with the default settings.
+func Middleware(next http.Handler) http.Handler {
+	return new(Formatter).Middleware(next)
+}
+
+// Middleware returns a handler that formats the text/html responses of next
+// before sending them, so that the markup of server-rendered pages can be
+// read in the browser's source view while developing. Responses are held
+// until next returns, and their Content-Length is set to that of the
+// formatted output. Other responses, those with a Content-Encoding, and those
+// that next flushes, which it is streaming, are sent as they are written. If
+// a response cannot be formatted, it is sent unformatted.
+//
+// It is meant for development: holding and formatting each response adds
+// latency and memory use.
+func (f *Formatter) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fw := &formatResponseWriter{f: f, w: w, status: http.StatusOK, head: r.Method == http.MethodHead}
+		next.ServeHTTP(fw, r)
+		fw.finish()
+	})
+}
+
+// formatResponseWriter holds a HTML response until it is finished, and passes
+// any other response through.
+type formatResponseWriter struct {
+	f      *Formatter
+	w      http.ResponseWriter
+	status int
+	// head is set for responses to HEAD requests, which have no body to
+	// format.
+	head bool
+	// decided is set once the status has been set or the body started,
+	// and formatting is set if the response is being held to be formatted.
+	decided, formatting bool
+	buf                 bytes.Buffer
+}
+
+func (fw *formatResponseWriter) Header() http.Header {
+	return fw.w.Header()
+}
+
+func (fw *formatResponseWriter) WriteHeader(status int) {
+	if fw.decided {
+		return
+	}
+	if status < 200 {
+		// Informational responses, such as 103 Early Hints, precede the
+		// response itself.
+		fw.w.WriteHeader(status)
+		return
+	}
+	fw.status = status
+	fw.decide(nil)
+}
+
+func (fw *formatResponseWriter) Write(b []byte) (int, error) {
+	if !fw.decided {
+		fw.decide(b)
+	}
+	if fw.formatting {
+		return fw.buf.Write(b)
+	}
+	return fw.w.Write(b)
+}
+
+// decide chooses whether to hold the response to format it, from its headers
+// and, if it has no Content-Type, the start of its body.
+func (fw *formatResponseWriter) decide(b []byte) {
+	fw.decided = true
+	h := fw.w.Header()
+	if h.Get("Content-Type") == "" && b != nil && h.Get("Content-Encoding") == "" {
+		// As net/http would, so that it is known before the body.
+		h.Set("Content-Type", http.DetectContentType(b))
+	}
+	mediaType, _, _ := mime.ParseMediaType(h.Get("Content-Type"))
+	fw.formatting = mediaType == "text/html" && h.Get("Content-Encoding") == "" && !fw.head &&
+		fw.status != http.StatusNoContent && fw.status != http.StatusNotModified
+	if !fw.formatting {
+		fw.w.WriteHeader(fw.status)
+	}
+}
+
+// Flush sends what has been written so far, unformatted if the response is
+// being held, and passes the rest through, as next is streaming it.
+func (fw *formatResponseWriter) Flush() {
+	if fw.formatting {
+		fw.formatting = false
+		fw.w.Header().Del("Content-Length")
+		fw.w.WriteHeader(fw.status)
+		_, _ = fw.w.Write(fw.buf.Bytes())
+		fw.buf.Reset()
+	}
+	if fl, ok := fw.w.(http.Flusher); ok {
+		fl.Flush()
+	}
+}
+
+// Unwrap returns the underlying ResponseWriter, for http.ResponseController.
+func (fw *formatResponseWriter) Unwrap() http.ResponseWriter {
+	return fw.w
+}
+
+// finish sends the response once the handler has returned.
+func (fw *formatResponseWriter) finish() {
+	if !fw.decided {
+		fw.decide(nil)
+	}
+	if !fw.formatting {
+		return
+	}
+	src := fw.buf.Bytes()
+	var out []byte
+	var err error
+	if isDocumentSource(src) {
+		out, err = fw.f.AppendDocument(nil, src)
+	} else {
+		out, err = fw.f.AppendFragment(nil, src)
+	}
+	if err != nil {
+		out = src
+	}
+	fw.w.Header().Set("Content-Length", strconv.Itoa(len(out)))
+	fw.w.WriteHeader(fw.status)
+	_, _ = fw.w.Write(out)
+}
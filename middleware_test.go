@@ -0,0 +1,86 @@
+package htmlformat
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestMiddleware(t *testing.T) {
+	tests := []struct {
+		name           string
+		method         string
+		handler        http.HandlerFunc
+		expectedBody   string
+		expectedLength string
+	}{
+		{
+			name: "HTML responses are formatted",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "text/html; charset=utf-8")
+				w.Header().Set("Content-Length", "19")
+				_, _ = io.WriteString(w, "<ul><li>a</li></ul>")
+			},
+			expectedBody:   "<ul>\n <li>a</li>\n</ul>\n",
+			expectedLength: "23",
+		},
+		{
+			name: "responses are sniffed for HTML",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				_, _ = io.WriteString(w, "<!DOCTYPE html><title>a</title>")
+			},
+			expectedBody:   "<!DOCTYPE html>\n<html>\n <head>\n  <title>a</title>\n </head>\n <body>\n </body>\n</html>\n",
+			expectedLength: "84",
+		},
+		{
+			name: "other responses are passed through",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "application/json")
+				_, _ = io.WriteString(w, `{"a":"<b>"}`)
+			},
+			expectedBody: `{"a":"<b>"}`,
+		},
+		{
+			name: "flushed responses are streamed as they are",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "text/html; charset=utf-8")
+				_, _ = io.WriteString(w, "<ul><li>a</li>")
+				w.(http.Flusher).Flush()
+				_, _ = io.WriteString(w, "</ul>")
+			},
+			expectedBody: "<ul><li>a</li></ul>",
+		},
+		{
+			name:   "responses to HEAD requests keep their length",
+			method: http.MethodHead,
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "text/html")
+				w.Header().Set("Content-Length", "19")
+			},
+			expectedLength: "19",
+		},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			method := test.method
+			if method == "" {
+				method = http.MethodGet
+			}
+			w := httptest.NewRecorder()
+			Middleware(test.handler).ServeHTTP(w, httptest.NewRequest(method, "/", nil))
+			if diff := cmp.Diff(test.expectedBody, w.Body.String()); diff != "" {
+				t.Error(diff)
+			}
+			if length := w.Header().Get("Content-Length"); length != test.expectedLength {
+				t.Errorf("expected Content-Length %q, got %q", test.expectedLength, length)
+			}
+		})
+	}
+}
@@ -0,0 +1,38 @@
+package htmlformat
+
+import (
+	"bytes"
+	"io"
+)
+
+// newlineWriter replaces the line endings written to it, "\r\n", "\r" and
+// "\n", with nl before writing them to w, for NormalizeNewlines.
+type newlineWriter struct {
+	w  io.Writer
+	nl string
+	// cr is set when the last byte written was '\r', so that a '\n' written
+	// after it ends the same line.
+	cr  bool
+	buf []byte
+}
+
+func (nw *newlineWriter) Write(b []byte) (n int, err error) {
+	if !nw.cr && bytes.IndexByte(b, '\r') < 0 && (nw.nl == "\n" || bytes.IndexByte(b, '\n') < 0) {
+		return nw.w.Write(b)
+	}
+	nw.buf = nw.buf[:0]
+	for _, c := range b {
+		switch {
+		case c == '\n' && nw.cr:
+		case c == '\r' || c == '\n':
+			nw.buf = append(nw.buf, nw.nl...)
+		default:
+			nw.buf = append(nw.buf, c)
+		}
+		nw.cr = c == '\r'
+	}
+	if _, err = nw.w.Write(nw.buf); err != nil {
+		return 0, err
+	}
+	return len(b), nil
+}
@@ -0,0 +1,95 @@
+package htmlformat
+
+import (
+	"io"
+
+	"golang.org/x/net/html"
+)
+
+// Normalize normalizes the whitespace of n and its descendants in place, with
+// the default settings.
+func Normalize(n *html.Node) {
+	new(Formatter).Normalize(n)
+}
+
+// NormalizeDocument parses a HTML document and returns it normalized, with
+// the default settings.
+func NormalizeDocument(r io.Reader) (*html.Node, error) {
+	return new(Formatter).NormalizeDocument(r)
+}
+
+// NormalizeFragment parses a fragment of a HTML document and returns its
+// nodes normalized, with the default settings.
+func NormalizeFragment(r io.Reader) ([]*html.Node, error) {
+	return new(Formatter).NormalizeFragment(r)
+}
+
+// Normalize cleans up the whitespace of n and its descendants in place, as
+// minifying does, for tools that use the tree rather than the output: runs of
+// whitespace in text are collapsed to a single space, adjacent text nodes are
+// merged, and whitespace-only text is dropped, except between inline-level
+// siblings, where it is kept as a single space. The content of preformatted
+// and raw text elements is left as it is. With StrictWhitespace, no text is
+// dropped. The children of the elements registered as void in Elements are
+// moved to after them, unless n is one.
+func (f *Formatter) Normalize(n *html.Node) {
+	p := f.newPrinter()
+	if len(p.Elements) > 0 {
+		p.hoistVoidChildren([]*html.Node{n})
+	}
+	if n.Type == html.TextNode && !p.isPreformattedElement(n.Parent) && !p.isSpecialContentElement(n.Parent) {
+		n.Data = collapseWhitespace(n.Data)
+	}
+	_ = walk(n, func(n *html.Node) (bool, error) {
+		if n.Type != html.ElementNode && n.Type != html.DocumentNode ||
+			p.isPreformattedElement(n) || p.isSpecialContentElement(n) {
+			return false, nil
+		}
+		p.normalizeChildren(n)
+		return true, nil
+	}, func(*html.Node) error { return nil })
+}
+
+// NormalizeDocument parses a HTML document and returns it with its whitespace
+// normalized, like Normalize.
+func (f *Formatter) NormalizeDocument(r io.Reader) (*html.Node, error) {
+	doc, err := html.Parse(r)
+	if err != nil {
+		return nil, err
+	}
+	f.Normalize(doc)
+	return doc, nil
+}
+
+// NormalizeFragment parses a fragment of a HTML document and returns its
+// nodes with their whitespace normalized, like Normalize. Whitespace between
+// the nodes is dropped as it is between siblings.
+func (f *Formatter) NormalizeFragment(r io.Reader) ([]*html.Node, error) {
+	nodes, err := html.ParseFragment(r, fragmentContext(""))
+	if err != nil {
+		return nil, err
+	}
+	return withParent(nodes, f.Normalize), nil
+}
+
+// normalizeChildren merges, collapses and drops the text children of n.
+func (p *printer) normalizeChildren(n *html.Node) {
+	for c := n.FirstChild; c != nil; {
+		next := c.NextSibling
+		if c.Type != html.TextNode {
+			c = next
+			continue
+		}
+		for next != nil && next.Type == html.TextNode {
+			c.Data += next.Data
+			n.RemoveChild(next)
+			next = c.NextSibling
+		}
+		if c.Data == "" || isEmptyTextNode(c) && p.Whitespace != StrictWhitespace && !p.separatesInline(c.PrevSibling, next) {
+			n.RemoveChild(c)
+		} else {
+			c.Data = collapseWhitespace(c.Data)
+		}
+		c = next
+	}
+}
@@ -0,0 +1,86 @@
+package htmlformat
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"golang.org/x/net/html"
+)
+
+func TestNormalizeFragment(t *testing.T) {
+	tests := []struct {
+		name      string
+		formatter Formatter
+		input     string
+		expected  string
+	}{
+		{
+			name:     "whitespace in text is collapsed",
+			input:    "<p>\n  a   b\n</p>",
+			expected: "<p> a b </p>",
+		},
+		{
+			name:     "whitespace between blocks is dropped",
+			input:    "<div>\n <p>a</p>\n <p>b</p>\n</div>\n<p>c</p>",
+			expected: "<div><p>a</p><p>b</p></div><p>c</p>",
+		},
+		{
+			name:     "whitespace between inline elements is kept as a space",
+			input:    "<p><b>a</b>\n  <i>b</i></p>",
+			expected: "<p><b>a</b> <i>b</i></p>",
+		},
+		{
+			name:     "preformatted and raw text content is left as it is",
+			input:    "<pre>  a\n  b</pre><script>\n  a  =  1\n</script>",
+			expected: "<pre>  a\n  b</pre><script>\n  a  =  1\n</script>",
+		},
+		{
+			name:      "registered void elements are hoisted",
+			formatter: Formatter{Elements: map[string]ElementBehavior{"my-icon": VoidElement}},
+			input:     "<div><my-icon>\n<p>a</p></div>",
+			expected:  "<div><my-icon></my-icon><p>a</p></div>",
+		},
+		{
+			name:      "no text is dropped with strict whitespace",
+			formatter: Formatter{Whitespace: StrictWhitespace},
+			input:     "<div>\n <p>a</p>\n</div>",
+			expected:  "<div> <p>a</p> </div>",
+		},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			nodes, err := test.formatter.NormalizeFragment(strings.NewReader(test.input))
+			if err != nil {
+				t.Fatalf("failed to normalize: %v", err)
+			}
+			var sb strings.Builder
+			for _, n := range nodes {
+				if err = html.Render(&sb, n); err != nil {
+					t.Fatalf("failed to render: %v", err)
+				}
+			}
+			if diff := cmp.Diff(test.expected, sb.String()); diff != "" {
+				t.Error(diff)
+			}
+		})
+	}
+}
+
+func TestNormalize(t *testing.T) {
+	doc, err := NormalizeDocument(strings.NewReader("<!DOCTYPE html>\n<html>\n <body>\n  <p>a\n  b</p>\n  \n </body>\n</html>\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	body := doc.LastChild.LastChild
+	if body.Data != "body" || body.FirstChild != body.LastChild {
+		t.Fatalf("expected <body> to have only <p>, got %v", body.FirstChild)
+	}
+	if text := body.FirstChild.FirstChild.Data; text != "a b" {
+		t.Errorf("expected collapsed text %q, got %q", "a b", text)
+	}
+}
@@ -0,0 +1,162 @@
+package htmlformat
+
+import (
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// endTag returns the end tag of the element n, or "" if it is omitted.
+func (p *printer) endTag(n *html.Node) string {
+	if p.omitsEndTag(n) || p.isImplied(n) {
+		return ""
+	}
+	return "</" + p.tagName(n) + ">"
+}
+
+// omitsEndTag reports whether the end tag of the element n is left out with
+// OmitEndTags, as the element that follows it, or the end of its parent,
+// closes it when the output is parsed. Whitespace between n and the node
+// after it does not stop the end tag being omitted, but comments and text
+// do.
+// https://html.spec.whatwg.org/multipage/syntax.html#optional-tags
+func (p *printer) omitsEndTag(n *html.Node) bool {
+	if !p.OmitEndTags || n.Type != html.ElementNode || n.Namespace != "" {
+		return false
+	}
+	next := p.nextSibling(n)
+	for next != nil && isEmptyTextNode(next) {
+		next = p.nextSibling(next)
+	}
+	switch n.DataAtom {
+	case atom.Html, atom.Body:
+		return next == nil || next.Type != html.CommentNode
+	}
+	if next == nil {
+		return p.endsWithParent(n)
+	}
+	if next.Type != html.ElementNode || next.Namespace != "" {
+		return false
+	}
+	switch n.DataAtom {
+	case atom.Thead, atom.Tbody:
+		return next.DataAtom == atom.Tbody || next.DataAtom == atom.Tfoot
+	case atom.Option, atom.Optgroup:
+		if next.DataAtom == atom.Hr {
+			return true
+		}
+	case atom.P:
+		// In quirks mode a <table> is put inside an open <p>.
+		if next.DataAtom == atom.Table && p.mayBeQuirks(n) {
+			return false
+		}
+	}
+	return impliesEnd(next.DataAtom, n.DataAtom)
+}
+
+// mayBeQuirks reports whether the document that n is in may be parsed in
+// quirks mode, as it has no DOCTYPE, or one other than <!DOCTYPE html>.
+// Fragments are parsed in no-quirks mode.
+func (p *printer) mayBeQuirks(n *html.Node) bool {
+	for n.Parent != nil {
+		n = n.Parent
+	}
+	if n.Type != html.DocumentNode {
+		return false
+	}
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if c.Type != html.DoctypeNode {
+			continue
+		}
+		if c.Data != "html" {
+			return true
+		}
+		for _, a := range c.Attr {
+			if a.Key == "public" || a.Key == "system" && a.Val != "about:legacy-compat" {
+				return true
+			}
+		}
+		return false
+	}
+	return true
+}
+
+// nextSibling returns the node after n, including the nodes of a fragment,
+// which have no parent.
+func (p *printer) nextSibling(n *html.Node) *html.Node {
+	if n.Parent == nil {
+		return p.nextRoots[n]
+	}
+	return n.NextSibling
+}
+
+// endsWithParent reports whether the element n, which is the last child of
+// its parent, is closed by the end of its parent. The end tag of a parent
+// that is not one of the parser's special elements, such as <em> or <span>,
+// does not close the special elements in it, such as <p> and <li>: it is
+// ignored, or the elements are moved out of the parent.
+// https://html.spec.whatwg.org/multipage/parsing.html#special
+func (p *printer) endsWithParent(n *html.Node) bool {
+	switch n.DataAtom {
+	case atom.Rt, atom.Rp, atom.Option, atom.Optgroup:
+		return true
+	case atom.Li, atom.Dd, atom.Tbody, atom.Tfoot, atom.Tr, atom.Td, atom.Th, atom.P:
+	default:
+		return false
+	}
+	parent := n.Parent
+	if parent == nil {
+		parent = p.context
+	}
+	if parent == nil || parent.Type != html.ElementNode {
+		return true
+	}
+	if parent.Namespace != "" || !specialElements[parent.DataAtom] {
+		return false
+	}
+	// The end of a <noscript> does not close a <p> in it.
+	return n.DataAtom != atom.P || parent.DataAtom != atom.Noscript
+}
+
+// specialElements are the HTML elements that can have content and that the
+// parser treats as special, whose end tags close the elements in them whose
+// end tags are optional.
+var specialElements = map[atom.Atom]bool{
+	atom.Address: true, atom.Applet: true, atom.Article: true, atom.Aside: true,
+	atom.Blockquote: true, atom.Body: true, atom.Button: true, atom.Caption: true,
+	atom.Center: true, atom.Colgroup: true, atom.Dd: true, atom.Details: true,
+	atom.Dir: true, atom.Div: true, atom.Dl: true, atom.Dt: true,
+	atom.Fieldset: true, atom.Figcaption: true, atom.Figure: true, atom.Footer: true,
+	atom.Form: true, atom.H1: true, atom.H2: true, atom.H3: true,
+	atom.H4: true, atom.H5: true, atom.H6: true, atom.Header: true,
+	atom.Hgroup: true, atom.Html: true, atom.Li: true, atom.Listing: true,
+	atom.Main: true, atom.Marquee: true, atom.Menu: true, atom.Nav: true,
+	atom.Noscript: true, atom.Object: true, atom.Ol: true, atom.Section: true,
+	atom.Select: true, atom.Summary: true, atom.Table: true, atom.Tbody: true,
+	atom.Td: true, atom.Template: true, atom.Tfoot: true, atom.Th: true,
+	atom.Thead: true, atom.Tr: true, atom.Ul: true,
+}
+
+// isImplied reports whether the element n is left out with OmitImplied, as
+// the parser added it where the input has none, and adds it again when the
+// output is parsed. Its content is written in its place.
+func (p *printer) isImplied(n *html.Node) bool {
+	if !p.OmitImplied || n.Type != html.ElementNode || n.Namespace != "" || len(n.Attr) > 0 {
+		return false
+	}
+	switch n.DataAtom {
+	case atom.Html, atom.Head, atom.Body:
+	case atom.Tbody:
+		// The parser only adds a <tbody> around rows.
+		c := n.FirstChild
+		for c != nil && isEmptyTextNode(c) {
+			c = c.NextSibling
+		}
+		if c == nil || c.Type != html.ElementNode || c.DataAtom != atom.Tr {
+			return false
+		}
+	default:
+		return false
+	}
+	_, ok := p.offsets[n]
+	return !ok
+}
@@ -0,0 +1,73 @@
+package htmlformat
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestOmitEndTagsReparse(t *testing.T) {
+	tests := []struct {
+		name     string
+		document bool
+		input    string
+	}{
+		{
+			name:  "a paragraph in a formatting element",
+			input: "<em><p>a</p></em>",
+		},
+		{
+			name:  "a paragraph in a formatting element in a block",
+			input: "<div><em><p>a</p></em></div>",
+		},
+		{
+			name:  "a list item in a phrasing element",
+			input: "<span><li>a</li></span>",
+		},
+		{
+			name:     "a paragraph before a table in quirks mode",
+			document: true,
+			input:    "<p>a</p><table><tr><td>b</td></tr></table>",
+		},
+		{
+			name:     "a paragraph before a table in no-quirks mode",
+			document: true,
+			input:    "<!DOCTYPE html><p>a</p><table><tr><td>b</td></tr></table>",
+		},
+		{
+			name:     "a paragraph before a table with a legacy doctype",
+			document: true,
+			input:    `<!DOCTYPE HTML PUBLIC "-//W3C//DTD HTML 4.01 Transitional//EN"><p>a</p><table><tr><td>b</td></tr></table>`,
+		},
+	}
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			omit := Formatter{OmitEndTags: true}
+			var f Formatter
+			format, formatOmitted := f.FragmentString, omit.FragmentString
+			if test.document {
+				format, formatOmitted = f.DocumentString, omit.DocumentString
+			}
+			expected, err := format(test.input)
+			if err != nil {
+				t.Fatalf("failed to format: %v", err)
+			}
+			omitted, err := formatOmitted(test.input)
+			if err != nil {
+				t.Fatalf("failed to format with omitted end tags: %v", err)
+			}
+			// Formatting the output again writes every end tag, and so shows
+			// the tree that the output parses to.
+			actual, err := format(omitted)
+			if err != nil {
+				t.Fatalf("failed to format the output: %v", err)
+			}
+			if diff := cmp.Diff(expected, actual); diff != "" {
+				t.Errorf("output %q parses to a different tree:\n%s", omitted, diff)
+			}
+		})
+	}
+}
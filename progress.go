@@ -0,0 +1,59 @@
+package htmlformat
+
+import "io"
+
+// Progress is how far formatting has got, as reported to OnProgress.
+type Progress struct {
+	// BytesRead is the number of bytes of input read so far.
+	BytesRead int64
+	// NodesWritten is the number of nodes written so far. The nodes within
+	// text that is written on one line are counted as one, and Stream counts
+	// tokens.
+	NodesWritten int
+}
+
+// progressInterval is the number of nodes written between reports.
+const progressInterval = 1024
+
+// progressReader reports the bytes read from r.
+type progressReader struct {
+	p *printer
+	r io.Reader
+}
+
+func (pr *progressReader) Read(b []byte) (n int, err error) {
+	n, err = pr.r.Read(b)
+	if n > 0 {
+		pr.p.progress.BytesRead += int64(n)
+		if pr.p.OnProgress != nil {
+			pr.p.OnProgress(pr.p.progress)
+		}
+	}
+	return n, err
+}
+
+// trackReading returns r, counting the bytes read from it if OnProgress or
+// stats are set.
+func (p *printer) trackReading(r io.Reader) io.Reader {
+	if p.OnProgress == nil && p.stats == nil {
+		return r
+	}
+	return &progressReader{p: p, r: r}
+}
+
+// wrote counts nodes written, and reports progress every progressInterval
+// nodes.
+func (p *printer) wrote(nodes int) {
+	before := p.progress.NodesWritten
+	p.progress.NodesWritten += nodes
+	if p.OnProgress != nil && before/progressInterval != p.progress.NodesWritten/progressInterval {
+		p.OnProgress(p.progress)
+	}
+}
+
+// reportProgress reports the progress at the end of formatting.
+func (p *printer) reportProgress() {
+	if p.OnProgress != nil {
+		p.OnProgress(p.progress)
+	}
+}
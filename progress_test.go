@@ -0,0 +1,51 @@
+package htmlformat
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestProgress(t *testing.T) {
+	src := strings.Repeat("<div><p>a</p></div>\n", 1000)
+	tests := map[string]func(f *Formatter) error{
+		"document": func(f *Formatter) error {
+			return f.Document(new(strings.Builder), strings.NewReader(src))
+		},
+		"minified fragment": func(f *Formatter) error {
+			f.Mode = Minify
+			return f.Fragment(new(strings.Builder), strings.NewReader(src))
+		},
+		"stream": func(f *Formatter) error {
+			return f.Stream(new(strings.Builder), strings.NewReader(src))
+		},
+	}
+	for name, format := range tests {
+		format := format
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			var reports []Progress
+			f := Formatter{Verify: true, OnProgress: func(p Progress) {
+				reports = append(reports, p)
+			}}
+			if err := format(&f); err != nil {
+				t.Fatal(err)
+			}
+			if len(reports) < 3 {
+				t.Fatalf("expected progress to be reported while formatting, got %v", reports)
+			}
+			for i := 1; i < len(reports); i++ {
+				if reports[i].BytesRead < reports[i-1].BytesRead || reports[i].NodesWritten < reports[i-1].NodesWritten {
+					t.Fatalf("progress went backwards: %v then %v", reports[i-1], reports[i])
+				}
+			}
+			last := reports[len(reports)-1]
+			if last.BytesRead != int64(len(src)) {
+				t.Errorf("expected %d bytes read, got %d", len(src), last.BytesRead)
+			}
+			if last.NodesWritten < 2000 {
+				t.Errorf("expected at least 2000 nodes written, got %d", last.NodesWritten)
+			}
+		})
+	}
+}
@@ -0,0 +1,248 @@
+package htmlformat
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// Repair describes a change that the parser makes to malformed input, such
+// as inserting a missing end tag.
+type Repair struct {
+	// Offset is the byte offset in the input of the markup that was repaired.
+	Offset int
+	// Line and Column are the 1-based line number and byte column of Offset.
+	Line, Column int
+	Message      string
+}
+
+func (r Repair) String() string {
+	return fmt.Sprintf("%d:%d: %s", r.Line, r.Column, r.Message)
+}
+
+// RepairError is returned when formatting in strict mode, if the input is
+// malformed such that the parser would have to repair it.
+type RepairError struct {
+	Repairs []Repair
+}
+
+func (e *RepairError) Error() string {
+	if len(e.Repairs) == 1 {
+		return e.Repairs[0].String()
+	}
+	return fmt.Sprintf("%s (and %d more)", e.Repairs[0], len(e.Repairs)-1)
+}
+
+// DocumentRepairs formats a HTML document, and returns the repairs that the
+// parser made to it, such as the end tags it inserted, the content it moved
+// out of tables and the end tags it ignored, so that they can be reported
+// rather than made silently. Elements whose end tags may be omitted are not
+// reported as repaired.
+func (f *Formatter) DocumentRepairs(w io.Writer, r io.Reader) (repairs []Repair, err error) {
+	p := f.newPrinter()
+	p.repaired = &repairs
+	if err = p.document(w, r); err != nil {
+		return nil, err
+	}
+	return repairs, nil
+}
+
+// FragmentRepairs formats a fragment of a HTML document, and returns the
+// repairs that the parser made to it, like DocumentRepairs.
+func (f *Formatter) FragmentRepairs(w io.Writer, r io.Reader) (repairs []Repair, err error) {
+	p := f.newPrinter()
+	p.repaired = &repairs
+	if err = p.fragment(w, r, ""); err != nil {
+		return nil, err
+	}
+	return repairs, nil
+}
+
+// openElement is an element that has been started but not yet ended.
+type openElement struct {
+	name   string
+	a      atom.Atom
+	offset int
+}
+
+// checkRepairs returns a *RepairError if the preprocessed input has markup
+// that the parser would repair.
+func (p *printer) checkRepairs() error {
+	if repairs := p.repairs(); len(repairs) > 0 {
+		return &RepairError{Repairs: repairs}
+	}
+	return nil
+}
+
+// repairs returns the repairs that the parser would make to the preprocessed
+// input. Elements whose end tags may be omitted are not reported.
+func (p *printer) repairs() (repairs []Repair) {
+	report := func(offset int, format string, args ...any) {
+		repairs = append(repairs, p.repair(offset, format, args...))
+	}
+	var open []openElement
+	// closeTo pops the open elements until only n remain, reporting those
+	// whose end tags cannot be omitted.
+	closeTo := func(n int) {
+		for len(open) > n {
+			e := open[len(open)-1]
+			open = open[:len(open)-1]
+			if !hasOptionalEndTag(e.a) {
+				report(e.offset, "missing end tag for <%s>", e.name)
+			}
+		}
+	}
+	foreign := func() bool {
+		for _, e := range open {
+			if e.a == atom.Svg || e.a == atom.Math {
+				return true
+			}
+		}
+		return false
+	}
+
+	z := html.NewTokenizer(bytes.NewReader(p.src))
+	var offset int
+	for {
+		tt := z.Next()
+		if tt == html.ErrorToken {
+			break
+		}
+		raw := z.Raw()
+		tok := z.Token()
+		switch tt {
+		case html.StartTagToken, html.SelfClosingTagToken:
+			if p.DuplicateAttributes == RejectDuplicates {
+				for _, name := range duplicateAttributes(tok.Attr) {
+					report(offset, "duplicate %s attribute on <%s>", name, tok.Data)
+				}
+			}
+			if moves, parent := movedByTable(tok.DataAtom, open); moves && !foreign() {
+				report(offset, "<%s> is not allowed in <%s> and is moved before it", tok.Data, parent)
+			}
+			for i := len(open) - 1; i >= 0; i-- {
+				if impliesEnd(tok.DataAtom, open[i].a) {
+					closeTo(i)
+					break
+				}
+				if !hasOptionalEndTag(open[i].a) {
+					break
+				}
+			}
+			if tt == html.SelfClosingTagToken && (foreign() || tok.DataAtom == atom.Svg || tok.DataAtom == atom.Math) {
+				break
+			}
+			if p.isVoidElementName(tok.Data) {
+				break
+			}
+			open = append(open, openElement{name: tok.Data, a: tok.DataAtom, offset: offset})
+		case html.EndTagToken:
+			i := len(open) - 1
+			for ; i >= 0; i-- {
+				if open[i].name == tok.Data {
+					break
+				}
+			}
+			if i < 0 {
+				report(offset, "unexpected end tag </%s>", tok.Data)
+				break
+			}
+			closeTo(i + 1)
+			open = open[:i]
+		case html.TextToken:
+			if strings.TrimSpace(tok.Data) == "" || len(open) == 0 {
+				break
+			}
+			if e := open[len(open)-1]; isTableContext(e.a) && !foreign() {
+				report(offset, "text is not allowed in <%s> and is moved before it", e.name)
+			}
+		}
+		offset += len(raw)
+	}
+	closeTo(0)
+	return repairs
+}
+
+// checkDuplicateAttributes returns a *RepairError if an element in the
+// preprocessed input has duplicate attributes.
+func (p *printer) checkDuplicateAttributes() error {
+	var repairs []Repair
+	z := html.NewTokenizer(bytes.NewReader(p.src))
+	var offset int
+	for {
+		tt := z.Next()
+		if tt == html.ErrorToken {
+			break
+		}
+		raw := z.Raw()
+		if tt == html.StartTagToken || tt == html.SelfClosingTagToken {
+			tok := z.Token()
+			for _, name := range duplicateAttributes(tok.Attr) {
+				repairs = append(repairs, p.repair(offset, "duplicate %s attribute on <%s>", name, tok.Data))
+			}
+		}
+		offset += len(raw)
+	}
+	if len(repairs) == 0 {
+		return nil
+	}
+	return &RepairError{Repairs: repairs}
+}
+
+// repair returns the Repair of the markup at offset in the preprocessed
+// input, described by format and args.
+func (p *printer) repair(offset int, format string, args ...any) Repair {
+	offset = p.originalOffset(offset)
+	line, column := position(p.input, offset)
+	return Repair{
+		Offset:  offset,
+		Line:    line,
+		Column:  column,
+		Message: fmt.Sprintf(format, args...),
+	}
+}
+
+// isTableContext reports whether elements of type a can only contain the
+// parts of a table, so that the parser moves any other content out of them.
+func isTableContext(a atom.Atom) bool {
+	switch a {
+	case atom.Table, atom.Tbody, atom.Thead, atom.Tfoot, atom.Tr:
+		return true
+	}
+	return false
+}
+
+// movedByTable reports whether an element of type a, started within the open
+// elements, would be moved out of the table it is in, and the name of the
+// element it is in.
+func movedByTable(a atom.Atom, open []openElement) (moved bool, parent string) {
+	if len(open) == 0 {
+		return false, ""
+	}
+	e := open[len(open)-1]
+	if !isTableContext(e.a) {
+		return false, ""
+	}
+	switch a {
+	case atom.Caption, atom.Colgroup, atom.Col, atom.Tbody, atom.Thead,
+		atom.Tfoot, atom.Tr, atom.Td, atom.Th, atom.Script, atom.Style,
+		atom.Template, atom.Form, atom.Input:
+		return false, ""
+	}
+	return true, e.name
+}
+
+// position returns the 1-based line and column of offset in src.
+func position(src []byte, offset int) (line, column int) {
+	if offset > len(src) {
+		offset = len(src)
+	}
+	before := src[:offset]
+	line = bytes.Count(before, []byte("\n")) + 1
+	column = offset - bytes.LastIndexByte(before, '\n')
+	return line, column
+}
@@ -0,0 +1,151 @@
+package htmlformat
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestStrict(t *testing.T) {
+	tests := []struct {
+		name      string
+		formatter Formatter
+		input     string
+		expected  []Repair
+	}{
+		{
+			name:  "well-formed markup is not reported",
+			input: "<div>\n <p>A</p>\n <br>\n <img src=\"a.png\"/>\n <svg><path d=\"\"/></svg>\n</div>",
+		},
+		{
+			name:  "omitted optional end tags are not reported",
+			input: "<ul><li>A<li>B</ul><p>C<div>D</div><table><tr><td>E<td>F</table>",
+		},
+		{
+			name:  "missing end tags are reported",
+			input: "<div>\n  <span>A\n</div>",
+			expected: []Repair{
+				{Offset: 8, Line: 2, Column: 3, Message: "missing end tag for <span>"},
+			},
+		},
+		{
+			name:  "missing end tags at the end of the input are reported",
+			input: "<section><b>A",
+			expected: []Repair{
+				{Offset: 9, Line: 1, Column: 10, Message: "missing end tag for <b>"},
+				{Offset: 0, Line: 1, Column: 1, Message: "missing end tag for <section>"},
+			},
+		},
+		{
+			name:  "unexpected end tags are reported",
+			input: "<div>A</span></div></p>",
+			expected: []Repair{
+				{Offset: 6, Line: 1, Column: 7, Message: "unexpected end tag </span>"},
+				{Offset: 19, Line: 1, Column: 20, Message: "unexpected end tag </p>"},
+			},
+		},
+		{
+			name:  "misnested elements are reported",
+			input: "<b><i>A</b></i>",
+			expected: []Repair{
+				{Offset: 3, Line: 1, Column: 4, Message: "missing end tag for <i>"},
+				{Offset: 11, Line: 1, Column: 12, Message: "unexpected end tag </i>"},
+			},
+		},
+		{
+			name:  "content moved out of tables is reported",
+			input: "<table>A<div>B</div><tr><td>C</td></tr></table>",
+			expected: []Repair{
+				{Offset: 7, Line: 1, Column: 8, Message: "text is not allowed in <table> and is moved before it"},
+				{Offset: 8, Line: 1, Column: 9, Message: "<div> is not allowed in <table> and is moved before it"},
+			},
+		},
+		{
+			name:      "duplicate attributes are reported when they are rejected",
+			formatter: Formatter{DuplicateAttributes: RejectDuplicates},
+			input:     "<p>\n <a class=\"a\" href=\"/\" class=\"b\">x</a>\n</p>",
+			expected: []Repair{
+				{Offset: 5, Line: 2, Column: 2, Message: "duplicate class attribute on <a>"},
+			},
+		},
+		{
+			name:      "offsets are those of the input when templates are used",
+			formatter: Formatter{Template: GoTemplate},
+			input:     `<div title="{{ .T }}">{{ if .A }}<span>{{ end }}</div>`,
+			expected: []Repair{
+				{Offset: 33, Line: 1, Column: 34, Message: "missing end tag for <span>"},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			f := test.formatter
+			f.Strict = true
+			r := strings.NewReader(test.input)
+			w := new(strings.Builder)
+			err := f.Fragment(w, r)
+			var actual []Repair
+			var re *RepairError
+			if errors.As(err, &re) {
+				actual = re.Repairs
+			} else if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if diff := cmp.Diff(test.expected, actual); diff != "" {
+				t.Error(diff)
+			}
+			if err != nil && w.Len() > 0 {
+				t.Errorf("expected no output, got %q", w.String())
+			}
+		})
+	}
+}
+
+func TestRepairError(t *testing.T) {
+	err := &RepairError{Repairs: []Repair{
+		{Line: 2, Column: 3, Message: "missing end tag for <span>"},
+		{Line: 4, Column: 1, Message: "unexpected end tag </p>"},
+	}}
+	expected := "2:3: missing end tag for <span> (and 1 more)"
+	if actual := err.Error(); actual != expected {
+		t.Errorf("expected %q, got %q", expected, actual)
+	}
+}
+
+func TestFragmentRepairs(t *testing.T) {
+	var sb strings.Builder
+	repairs, err := new(Formatter).FragmentRepairs(&sb, strings.NewReader("<div><span>A</div></p><table><tr><td>B</td></tr>C</table>"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []Repair{
+		{Offset: 5, Line: 1, Column: 6, Message: "missing end tag for <span>"},
+		{Offset: 18, Line: 1, Column: 19, Message: "unexpected end tag </p>"},
+		{Offset: 48, Line: 1, Column: 49, Message: "text is not allowed in <table> and is moved before it"},
+	}
+	if diff := cmp.Diff(expected, repairs); diff != "" {
+		t.Error(diff)
+	}
+	if sb.Len() == 0 {
+		t.Error("expected the repaired input to be formatted")
+	}
+}
+
+func TestRejectDuplicates(t *testing.T) {
+	f := Formatter{DuplicateAttributes: RejectDuplicates}
+	_, err := f.FragmentString(`<ul><li id="a" id="b">A<li>B</ul>`)
+	var re *RepairError
+	if !errors.As(err, &re) {
+		t.Fatalf("expected a *RepairError, got %v", err)
+	}
+	expected := []Repair{{Offset: 4, Line: 1, Column: 5, Message: "duplicate id attribute on <li>"}}
+	if diff := cmp.Diff(expected, re.Repairs); diff != "" {
+		t.Error(diff)
+	}
+}
@@ -0,0 +1,171 @@
+package htmlformat
+
+import (
+	"net/url"
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// Sanitizer removes unsafe markup from HTML. It is satisfied by
+// *bluemonday.Policy, as well as by *Policy.
+type Sanitizer interface {
+	Sanitize(s string) string
+}
+
+// Policy is a Sanitizer that allows only the elements and attributes that it
+// lists. Elements that are not allowed are replaced by their content, apart
+// from those whose content is not text meant to be read, such as <script>
+// and <style>, and foreign elements, which are removed with their content.
+// Comments are removed. The <html>, <head> and <body> elements of documents
+// are kept, but none of their attributes that are not allowed.
+type Policy struct {
+	// Elements maps the names of the elements that are allowed to the names
+	// of the attributes that are allowed on them.
+	Elements map[string][]string
+	// Attributes are the names of the attributes that are allowed on all of
+	// the elements that are allowed.
+	Attributes []string
+	// URLSchemes are the schemes that are allowed in URLs, such as those of
+	// href and src attributes. Relative URLs are always allowed.
+	URLSchemes []string
+}
+
+// UGCPolicy returns a Policy for user generated content, which allows the
+// elements that format text, links to http, https and mailto URLs, images,
+// lists and tables.
+func UGCPolicy() *Policy {
+	return &Policy{
+		Elements: map[string][]string{
+			"a": {"href"}, "abbr": nil, "b": nil, "blockquote": {"cite"},
+			"br": nil, "code": nil, "dd": nil, "del": nil, "dl": nil, "dt": nil,
+			"em": nil, "h1": nil, "h2": nil, "h3": nil, "h4": nil, "h5": nil,
+			"h6": nil, "hr": nil, "i": nil, "img": {"src", "alt", "width", "height"},
+			"ins": nil, "kbd": nil, "li": nil, "ol": nil, "p": nil, "pre": nil,
+			"q": {"cite"}, "s": nil, "samp": nil, "small": nil, "span": nil,
+			"strong": nil, "sub": nil, "sup": nil, "table": nil, "tbody": nil,
+			"td": {"colspan", "rowspan"}, "tfoot": nil,
+			"th": {"colspan", "rowspan", "scope"}, "thead": nil, "tr": nil,
+			"u": nil, "ul": nil,
+		},
+		Attributes: []string{"dir", "lang", "title"},
+		URLSchemes: []string{"http", "https", "mailto"},
+	}
+}
+
+// Sanitize returns the fragment of a HTML document s with the markup that the
+// policy does not allow removed.
+func (p *Policy) Sanitize(s string) string {
+	nodes, err := html.ParseFragment(strings.NewReader(s), &html.Node{Type: html.ElementNode, Data: "body", DataAtom: atom.Body})
+	if err != nil {
+		return ""
+	}
+	var sb strings.Builder
+	for _, n := range withParent(nodes, p.sanitizeChildren) {
+		// Writing to a strings.Builder does not fail.
+		_ = html.Render(&sb, n)
+	}
+	return sb.String()
+}
+
+// removedElements are the elements whose content is removed with them when
+// they are not allowed.
+var removedElements = map[atom.Atom]bool{
+	atom.Applet: true, atom.Embed: true, atom.Frame: true, atom.Frameset: true,
+	atom.Iframe: true, atom.Noembed: true, atom.Noframes: true,
+	atom.Noscript: true, atom.Object: true, atom.Plaintext: true,
+	atom.Script: true, atom.Style: true, atom.Template: true, atom.Title: true,
+	atom.Xmp: true,
+}
+
+// urlAttributes are the attributes whose values are URLs.
+var urlAttributes = map[string]bool{
+	"action": true, "background": true, "cite": true, "formaction": true,
+	"href": true, "longdesc": true, "poster": true, "src": true,
+	"usemap": true, "xlink:href": true,
+}
+
+// sanitizeChildren removes the markup that the policy does not allow from the
+// children of n and their descendants.
+func (p *Policy) sanitizeChildren(n *html.Node) {
+	for c := n.FirstChild; c != nil; {
+		next := c.NextSibling
+		switch c.Type {
+		case html.CommentNode:
+			n.RemoveChild(c)
+		case html.DocumentNode:
+			p.sanitizeChildren(c)
+		case html.ElementNode:
+			allowed, ok := p.Elements[c.Data]
+			ok = ok && c.Namespace == ""
+			if !ok && isDocumentElement(c) {
+				allowed, ok = nil, true
+			}
+			switch {
+			case ok:
+				c.Attr = p.sanitizeAttributes(c.Attr, allowed)
+				p.sanitizeChildren(c)
+			case c.Namespace != "" || removedElements[c.DataAtom]:
+				n.RemoveChild(c)
+			default:
+				// Replace the element by its content, which is sanitized in
+				// turn.
+				if c.FirstChild != nil {
+					next = c.FirstChild
+				}
+				for c.FirstChild != nil {
+					gc := c.FirstChild
+					c.RemoveChild(gc)
+					n.InsertBefore(gc, c)
+				}
+				n.RemoveChild(c)
+			}
+		}
+		c = next
+	}
+}
+
+// sanitizeAttributes returns the attributes among attrs that are allowed, as
+// well as the policy's Attributes, and that do not have URLs with schemes
+// that are not allowed.
+func (p *Policy) sanitizeAttributes(attrs []html.Attribute, allowed []string) (kept []html.Attribute) {
+	for _, a := range attrs {
+		name := attributeName(a)
+		if !containsString(allowed, name) && !containsString(p.Attributes, name) {
+			continue
+		}
+		if urlAttributes[name] && !p.allowsURL(a.Val) {
+			continue
+		}
+		kept = append(kept, a)
+	}
+	return kept
+}
+
+// allowsURL reports whether the URL s is relative, or has a scheme that is
+// allowed.
+func (p *Policy) allowsURL(s string) bool {
+	// Browsers ignore these characters within URLs, so that "java\tscript:"
+	// is a javascript: URL.
+	s = strings.Map(func(r rune) rune {
+		if r == '\t' || r == '\n' || r == '\r' {
+			return -1
+		}
+		return r
+	}, s)
+	u, err := url.Parse(strings.TrimSpace(s))
+	if err != nil {
+		return false
+	}
+	return u.Scheme == "" || containsString(p.URLSchemes, strings.ToLower(u.Scheme))
+}
+
+func containsString(s []string, v string) bool {
+	for _, e := range s {
+		if e == v {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,83 @@
+package htmlformat
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestSanitize(t *testing.T) {
+	tests := []struct {
+		name      string
+		sanitizer Sanitizer
+		input     string
+		expected  string
+	}{
+		{
+			name:      "scripts and event handlers are removed",
+			sanitizer: UGCPolicy(),
+			input:     `<p onclick="steal()">a<script>steal()</script></p><style>p {}</style>`,
+			expected:  "<p>a</p>\n",
+		},
+		{
+			name:      "elements that are not allowed are replaced by their content",
+			sanitizer: UGCPolicy(),
+			input:     `<div class="x"><font color="red"><b>a</b></font></div>`,
+			expected:  "<b>a</b>\n",
+		},
+		{
+			name:      "URLs with schemes that are not allowed are removed",
+			sanitizer: UGCPolicy(),
+			input:     "<a href=\"java\tscript:alert(1)\">a</a><a href=\"/b\" title=\"B\">b</a><img src=\"https://example.com/c.png\" alt=\"c\">",
+			expected:  "<a>a</a>\n<a href=\"/b\" title=\"B\">b</a>\n<img src=\"https://example.com/c.png\" alt=\"c\">\n",
+		},
+		{
+			name:      "comments and foreign elements are removed",
+			sanitizer: UGCPolicy(),
+			input:     `<p>a<!-- b --><svg><text>c</text></svg></p>`,
+			expected:  "<p>a</p>\n",
+		},
+		{
+			name:      "custom policies allow the elements and attributes they list",
+			sanitizer: &Policy{Elements: map[string][]string{"section": {"id"}}},
+			input:     `<section id="a" class="b"><p>c</p></section>`,
+			expected:  "<section id=\"a\">c</section>\n",
+		},
+		{
+			name:      "other sanitizers are applied to the input",
+			sanitizer: sanitizerFunc(func(s string) string { return strings.ReplaceAll(s, "<blink>", "") }),
+			input:     `<p><blink>a</p>`,
+			expected:  "<p>a</p>\n",
+		},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			f := Formatter{Sanitizer: test.sanitizer}
+			s, err := f.FragmentString(test.input)
+			if err != nil {
+				t.Fatalf("failed to format: %v", err)
+			}
+			if diff := cmp.Diff(test.expected, s); diff != "" {
+				t.Error(diff)
+			}
+		})
+	}
+}
+
+func TestPolicySanitize(t *testing.T) {
+	s := UGCPolicy().Sanitize(`<p style="color: red">a<iframe src="b"></iframe></p>`)
+	if diff := cmp.Diff("<p>a</p>", s); diff != "" {
+		t.Error(diff)
+	}
+}
+
+type sanitizerFunc func(s string) string
+
+func (fn sanitizerFunc) Sanitize(s string) string {
+	return fn(s)
+}
@@ -0,0 +1,60 @@
+package htmlformat
+
+import (
+	"io"
+
+	"golang.org/x/net/html"
+)
+
+// FormatSelection formats the elements of a HTML document that match a CSS
+// selector, with the default settings.
+func FormatSelection(w io.Writer, r io.Reader, selector string) (err error) {
+	return new(Formatter).FormatSelection(w, r, selector)
+}
+
+// FormatSelection parses a HTML document and formats only the elements that
+// match a CSS selector, such as "main article.post", one after another, so
+// that a component can be extracted from a page. Elements within one that
+// matches are not written again. Type, universal, ID, class and attribute
+// selectors are supported, combined with the descendant, child, next-sibling
+// and subsequent-sibling combinators. Nothing is written if no elements
+// match. The input is parsed as a document even if Component is set, and the
+// output is not verified.
+func (f *Formatter) FormatSelection(w io.Writer, r io.Reader, selector string) (err error) {
+	sel, err := parseSelector(selector)
+	if err != nil {
+		return err
+	}
+	sf := *f
+	sf.Component = nil
+	p := sf.newPrinter()
+	p.selection = sel
+	return p.document(w, r)
+}
+
+// selected returns the elements within nodes that match p.selection, in
+// document order and removed from their parents, apart from those within
+// another that matches.
+func (p *printer) selected(nodes []*html.Node) (matches []*html.Node) {
+	var find func(n *html.Node)
+	find = func(n *html.Node) {
+		if p.selection.match(n) {
+			matches = append(matches, n)
+			return
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			find(c)
+		}
+	}
+	for _, n := range nodes {
+		find(n)
+	}
+	// The elements are matched against their ancestors and siblings before
+	// any of them are removed.
+	for _, n := range matches {
+		if n.Parent != nil {
+			n.Parent.RemoveChild(n)
+		}
+	}
+	return matches
+}
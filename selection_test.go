@@ -0,0 +1,84 @@
+package htmlformat
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestFormatSelection(t *testing.T) {
+	page := `<!DOCTYPE html><html><head><title>Page</title></head><body>
+<nav><ul><li><a href="/">Home</a></li></ul></nav>
+<main><article class="post"><h1>One</h1><p>First post.</p></article>
+<article class="post draft"><h1>Two</h1></article></main>
+<table><tr><td>a</td></tr></table>
+</body></html>`
+	tests := []struct {
+		name      string
+		formatter Formatter
+		selector  string
+		expected  string
+	}{
+		{
+			name:     "the matching elements are written one after another",
+			selector: "main > article",
+			expected: `<article class="post">
+ <h1>One</h1>
+ <p>First post.</p>
+</article>
+<article class="post draft">
+ <h1>Two</h1>
+</article>
+`,
+		},
+		{
+			name:     "elements within a match are not written again",
+			selector: "main, article.draft, h1",
+			expected: `<main>
+ <article class="post">
+  <h1>One</h1>
+  <p>First post.</p>
+ </article>
+ <article class="post draft">
+  <h1>Two</h1>
+ </article>
+</main>
+`,
+		},
+		{
+			name:      "the selection is formatted with the formatter's settings",
+			formatter: Formatter{Mode: Minify},
+			selector:  "nav a, tr",
+			expected:  `<a href="/">Home</a><tr><td>a</td></tr>`,
+		},
+		{
+			name:     "nothing is written if no elements match",
+			selector: "aside",
+			expected: ``,
+		},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			var out bytes.Buffer
+			if err := test.formatter.FormatSelection(&out, strings.NewReader(page), test.selector); err != nil {
+				t.Fatalf("failed to format: %v", err)
+			}
+			if diff := cmp.Diff(test.expected, out.String()); diff != "" {
+				t.Error(diff)
+			}
+		})
+	}
+}
+
+func TestFormatSelectionInvalidSelector(t *testing.T) {
+	err := FormatSelection(new(bytes.Buffer), strings.NewReader("<p>a</p>"), "p >")
+	if err == nil {
+		t.Fatal("expected an error for an invalid selector")
+	}
+}
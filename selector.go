@@ -0,0 +1,323 @@
+package htmlformat
+
+import (
+	"fmt"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// selector is a list of CSS selectors, such as `pre.highlight, .raw`, that
+// matches an element if any of them does. Type, universal, ID, class and
+// attribute selectors are supported, combined with the descendant, child,
+// next-sibling and subsequent-sibling combinators.
+type selector []complexSelector
+
+// complexSelector is a sequence of compound selectors, such as `ul > li.a`.
+// combinators[i] is the combinator between compounds[i] and compounds[i+1].
+type complexSelector struct {
+	compounds   []compoundSelector
+	combinators []byte
+}
+
+// compoundSelector matches an element with the tag name, unless it is empty,
+// that meets all of the conditions.
+type compoundSelector struct {
+	tag        string
+	conditions []attributeCondition
+}
+
+// attributeCondition matches an element with the attribute key, whose value
+// compares with val as op does in an attribute selector. An empty op matches
+// any value.
+type attributeCondition struct {
+	key, op, val string
+}
+
+// parseSelector parses a comma separated list of CSS selectors.
+func parseSelector(s string) (sel selector, err error) {
+	sp := &selectorParser{s: s}
+	for {
+		c, err := sp.complex()
+		if err != nil {
+			return nil, fmt.Errorf("invalid selector %q: %w", s, err)
+		}
+		sel = append(sel, c)
+		sp.skipSpace()
+		if sp.i == len(sp.s) {
+			return sel, nil
+		}
+		if sp.s[sp.i] != ',' {
+			return nil, fmt.Errorf("invalid selector %q: unexpected %q", s, sp.s[sp.i])
+		}
+		sp.i++
+	}
+}
+
+// parseSelectors parses each of the selectors in list into one.
+func parseSelectors(list []string) (sel selector, err error) {
+	for _, s := range list {
+		parsed, err := parseSelector(s)
+		if err != nil {
+			return nil, err
+		}
+		sel = append(sel, parsed...)
+	}
+	return sel, nil
+}
+
+// match reports whether the element n matches any of the selectors.
+func (sel selector) match(n *html.Node) bool {
+	if n.Type != html.ElementNode {
+		return false
+	}
+	for _, c := range sel {
+		if c.matchAt(len(c.compounds)-1, n) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchAt reports whether n matches c.compounds[i], and its ancestors and
+// siblings match the compounds before it.
+func (c complexSelector) matchAt(i int, n *html.Node) bool {
+	if !c.compounds[i].match(n) {
+		return false
+	}
+	if i == 0 {
+		return true
+	}
+	switch c.combinators[i-1] {
+	case '>':
+		return n.Parent != nil && n.Parent.Type == html.ElementNode && c.matchAt(i-1, n.Parent)
+	case '+':
+		prev := previousElement(n)
+		return prev != nil && c.matchAt(i-1, prev)
+	case '~':
+		for prev := previousElement(n); prev != nil; prev = previousElement(prev) {
+			if c.matchAt(i-1, prev) {
+				return true
+			}
+		}
+	default:
+		for a := n.Parent; a != nil && a.Type == html.ElementNode; a = a.Parent {
+			if c.matchAt(i-1, a) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func previousElement(n *html.Node) *html.Node {
+	for n = n.PrevSibling; n != nil; n = n.PrevSibling {
+		if n.Type == html.ElementNode {
+			return n
+		}
+	}
+	return nil
+}
+
+func (cs compoundSelector) match(n *html.Node) bool {
+	if cs.tag != "" && !strings.EqualFold(cs.tag, n.Data) {
+		return false
+	}
+	for _, cond := range cs.conditions {
+		if !cond.match(n) {
+			return false
+		}
+	}
+	return true
+}
+
+func (cond attributeCondition) match(n *html.Node) bool {
+	for _, a := range n.Attr {
+		if a.Namespace != "" || !strings.EqualFold(a.Key, cond.key) {
+			continue
+		}
+		switch cond.op {
+		case "":
+			return true
+		case "=":
+			return a.Val == cond.val
+		case "~=":
+			for _, f := range strings.Fields(a.Val) {
+				if f == cond.val {
+					return true
+				}
+			}
+			return false
+		case "|=":
+			return a.Val == cond.val || strings.HasPrefix(a.Val, cond.val+"-")
+		case "^=":
+			return cond.val != "" && strings.HasPrefix(a.Val, cond.val)
+		case "$=":
+			return cond.val != "" && strings.HasSuffix(a.Val, cond.val)
+		case "*=":
+			return cond.val != "" && strings.Contains(a.Val, cond.val)
+		}
+	}
+	return false
+}
+
+type selectorParser struct {
+	s string
+	i int
+}
+
+func (sp *selectorParser) skipSpace() (skipped bool) {
+	for sp.i < len(sp.s) && isSpace(sp.s[sp.i]) {
+		sp.i++
+		skipped = true
+	}
+	return skipped
+}
+
+func (sp *selectorParser) complex() (c complexSelector, err error) {
+	sp.skipSpace()
+	for {
+		cs, err := sp.compound()
+		if err != nil {
+			return c, err
+		}
+		c.compounds = append(c.compounds, cs)
+		space := sp.skipSpace()
+		if sp.i == len(sp.s) || sp.s[sp.i] == ',' {
+			return c, nil
+		}
+		switch comb := sp.s[sp.i]; comb {
+		case '>', '+', '~':
+			sp.i++
+			sp.skipSpace()
+			c.combinators = append(c.combinators, comb)
+		default:
+			if !space {
+				return c, fmt.Errorf("unexpected %q", comb)
+			}
+			c.combinators = append(c.combinators, ' ')
+		}
+	}
+}
+
+func (sp *selectorParser) compound() (cs compoundSelector, err error) {
+	start := sp.i
+	if sp.i < len(sp.s) && sp.s[sp.i] == '*' {
+		sp.i++
+	} else {
+		cs.tag = sp.ident()
+	}
+	for sp.i < len(sp.s) {
+		switch sp.s[sp.i] {
+		case '#':
+			sp.i++
+			id := sp.ident()
+			if id == "" {
+				return cs, fmt.Errorf("missing ID after #")
+			}
+			cs.conditions = append(cs.conditions, attributeCondition{key: "id", op: "=", val: id})
+		case '.':
+			sp.i++
+			class := sp.ident()
+			if class == "" {
+				return cs, fmt.Errorf("missing class name after .")
+			}
+			cs.conditions = append(cs.conditions, attributeCondition{key: "class", op: "~=", val: class})
+		case '[':
+			sp.i++
+			cond, err := sp.attribute()
+			if err != nil {
+				return cs, err
+			}
+			cs.conditions = append(cs.conditions, cond)
+		default:
+			if sp.i == start {
+				return cs, fmt.Errorf("unexpected %q", sp.s[sp.i])
+			}
+			return cs, nil
+		}
+	}
+	if sp.i == start {
+		return cs, fmt.Errorf("missing selector")
+	}
+	return cs, nil
+}
+
+// attribute parses an attribute selector, after its opening bracket.
+func (sp *selectorParser) attribute() (cond attributeCondition, err error) {
+	sp.skipSpace()
+	if cond.key = sp.ident(); cond.key == "" {
+		return cond, fmt.Errorf("missing attribute name")
+	}
+	sp.skipSpace()
+	if sp.i < len(sp.s) && sp.s[sp.i] == ']' {
+		sp.i++
+		return cond, nil
+	}
+	for _, op := range []string{"=", "~=", "|=", "^=", "$=", "*="} {
+		if strings.HasPrefix(sp.s[sp.i:], op) {
+			cond.op = op
+			sp.i += len(op)
+			break
+		}
+	}
+	if cond.op == "" {
+		return cond, fmt.Errorf("missing ] after attribute name")
+	}
+	sp.skipSpace()
+	if sp.i < len(sp.s) && (sp.s[sp.i] == '"' || sp.s[sp.i] == '\'') {
+		if cond.val, err = sp.quoted(); err != nil {
+			return cond, err
+		}
+	} else if cond.val = sp.ident(); cond.val == "" {
+		return cond, fmt.Errorf("missing attribute value")
+	}
+	sp.skipSpace()
+	if sp.i == len(sp.s) || sp.s[sp.i] != ']' {
+		return cond, fmt.Errorf("missing ] after attribute value")
+	}
+	sp.i++
+	return cond, nil
+}
+
+// ident parses a name, in which a backslash escapes the character after it.
+func (sp *selectorParser) ident() string {
+	var sb strings.Builder
+	for sp.i < len(sp.s) {
+		c := sp.s[sp.i]
+		switch {
+		case c == '\\' && sp.i+1 < len(sp.s):
+			sb.WriteByte(sp.s[sp.i+1])
+			sp.i += 2
+		case c == '-' || c == '_' || c >= 0x80 || '0' <= c && c <= '9' || 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z':
+			sb.WriteByte(c)
+			sp.i++
+		default:
+			return sb.String()
+		}
+	}
+	return sb.String()
+}
+
+// quoted parses a quoted string, in which a backslash escapes the character
+// after it.
+func (sp *selectorParser) quoted() (string, error) {
+	quote := sp.s[sp.i]
+	sp.i++
+	var sb strings.Builder
+	for sp.i < len(sp.s) {
+		c := sp.s[sp.i]
+		switch {
+		case c == quote:
+			sp.i++
+			return sb.String(), nil
+		case c == '\\' && sp.i+1 < len(sp.s):
+			sb.WriteByte(sp.s[sp.i+1])
+			sp.i += 2
+		default:
+			sb.WriteByte(c)
+			sp.i++
+		}
+	}
+	return "", fmt.Errorf("missing closing %c", quote)
+}
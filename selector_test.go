@@ -0,0 +1,64 @@
+package htmlformat
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"golang.org/x/net/html"
+)
+
+func TestSelector(t *testing.T) {
+	doc, err := html.Parse(strings.NewReader(`<div id="main" class="a b"><ul><li lang="en-GB">1</li><li data-x="abc">2</li><li>3</li></ul><pre class="highlight">x</pre><svg><foreignObject></foreignObject></svg></div>`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		selector string
+		expected []string
+	}{
+		{selector: "li", expected: []string{"li 1", "li 2", "li 3"}},
+		{selector: "#main", expected: []string{"div"}},
+		{selector: "div.b.a", expected: []string{"div"}},
+		{selector: ".c", expected: nil},
+		{selector: "pre.highlight, ul > li[data-x]", expected: []string{"li 2", "pre x"}},
+		{selector: `li[data-x^="ab"]`, expected: []string{"li 2"}},
+		{selector: `li[data-x$=c]`, expected: []string{"li 2"}},
+		{selector: `li[data-x*='b']`, expected: []string{"li 2"}},
+		{selector: `li[lang|=en]`, expected: []string{"li 1"}},
+		{selector: "li + li", expected: []string{"li 2", "li 3"}},
+		{selector: "[lang] ~ *", expected: []string{"li 2", "li 3"}},
+		{selector: "div pre", expected: []string{"pre x"}},
+		{selector: "body > pre", expected: nil},
+		{selector: "foreignobject", expected: []string{"foreignObject"}},
+	}
+	for _, test := range tests {
+		sel, err := parseSelector(test.selector)
+		if err != nil {
+			t.Errorf("%s: %v", test.selector, err)
+			continue
+		}
+		var matched []string
+		_ = walk(doc, func(n *html.Node) (bool, error) {
+			if sel.match(n) {
+				s := n.Data
+				if n.DataAtom != 0 && n.FirstChild != nil && n.FirstChild.Type == html.TextNode {
+					s += " " + n.FirstChild.Data
+				}
+				matched = append(matched, s)
+			}
+			return true, nil
+		}, func(*html.Node) error { return nil })
+		if diff := cmp.Diff(test.expected, matched); diff != "" {
+			t.Errorf("%s: %s", test.selector, diff)
+		}
+	}
+}
+
+func TestSelectorErrors(t *testing.T) {
+	for _, s := range []string{"", "div,", "div[", "li[x=]", `a[href="x]`, "div >", ".", "p:first-child"} {
+		if _, err := parseSelector(s); err == nil {
+			t.Errorf("%q: expected an error", s)
+		}
+	}
+}
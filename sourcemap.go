@@ -0,0 +1,269 @@
+package htmlformat
+
+import (
+	"bytes"
+	"io"
+	"sort"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// SourceMap relates positions in formatted output to the positions in the
+// input that they were formatted from, so that editors can keep the cursor in
+// place and map diagnostics between the two.
+type SourceMap struct {
+	// Mappings holds a mapping for the start of each element, text and
+	// comment in the output, in output order.
+	Mappings []Mapping
+}
+
+// Mapping relates the byte offset of the start of a node in the output to the
+// byte offset it started at in the input.
+type Mapping struct {
+	Output int
+	Input  int
+}
+
+// Input returns the offset in the input that the byte at offset output in the
+// output was formatted from, or -1 if it precedes all mappings.
+func (m *SourceMap) Input(output int) int {
+	i := sort.Search(len(m.Mappings), func(i int) bool { return m.Mappings[i].Output > output })
+	if i == 0 {
+		return -1
+	}
+	return m.Mappings[i-1].Input
+}
+
+// Output returns the offset in the output of the node that contains, or most
+// closely precedes, the byte at offset input in the input, or -1 if there is
+// none.
+func (m *SourceMap) Output(input int) int {
+	output, best := -1, -1
+	for _, mp := range m.Mappings {
+		if mp.Input <= input && mp.Input > best {
+			output, best = mp.Output, mp.Input
+		}
+	}
+	return output
+}
+
+// DocumentSourceMap formats a HTML document, and returns a map of the
+// formatted output to the input.
+func (f *Formatter) DocumentSourceMap(w io.Writer, r io.Reader) (m *SourceMap, err error) {
+	p := f.newPrinter()
+	p.sourceMap = new(SourceMap)
+	if err = p.document(w, r); err != nil {
+		return nil, err
+	}
+	return p.sourceMap, nil
+}
+
+// FragmentSourceMap formats a fragment of a HTML document, and returns a map
+// of the formatted output to the input.
+func (f *Formatter) FragmentSourceMap(w io.Writer, r io.Reader) (m *SourceMap, err error) {
+	p := f.newPrinter()
+	p.sourceMap = new(SourceMap)
+	if err = p.fragment(w, r, ""); err != nil {
+		return nil, err
+	}
+	return p.sourceMap, nil
+}
+
+// shift records that the byte at offset out in the output of a preprocessing
+// stage came from offset in in its input.
+type shift struct {
+	out, in int
+}
+
+// offsetMap maps offsets in the output of a preprocessing stage back to its
+// input. Offsets between two shifts are displaced by the same amount as the
+// first of them.
+type offsetMap []shift
+
+func (m offsetMap) input(out int) int {
+	i := sort.Search(len(m), func(i int) bool { return m[i].out > out })
+	if i == 0 {
+		return out
+	}
+	return m[i-1].in + out - m[i-1].out
+}
+
+// replaced records that a preprocessing stage wrote src[inStart:inEnd] as
+// out[outStart:outEnd], when offsets in the input are needed.
+func (p *printer) replaced(m *offsetMap, outStart, outEnd, inStart, inEnd int) {
+	if !p.tracksOffsets() {
+		return
+	}
+	*m = append(*m, shift{outStart, inStart}, shift{outEnd, inEnd})
+}
+
+// srcToken is the position of a token of the preprocessed input.
+type srcToken struct {
+	typ    html.TokenType
+	name   string
+	offset int
+	// quotes holds the quote character of each attribute of a start tag.
+	quotes map[string]byte
+	// raw holds a DOCTYPE as it appears in the input.
+	raw string
+	// rawName and attrNames hold the names of a start tag and its
+	// attributes as they appear in the input, when they are not lowercase.
+	rawName   string
+	attrNames map[string]string
+}
+
+// locate finds the offset in the input of each of the nodes and their
+// descendants, by matching them against the tokens of the input in order.
+// Nodes that the parser created without a token, such as an implied <body>,
+// are left without one.
+func (p *printer) locate(nodes []*html.Node) {
+	var tokens []srcToken
+	z := html.NewTokenizer(bytes.NewReader(p.src))
+	var offset int
+	// templates counts the <template> elements that the tokens are within,
+	// where the parser ignores <html>, <head> and <body> tags.
+	var templates int
+	for {
+		tt := z.Next()
+		if tt == html.ErrorToken {
+			break
+		}
+		raw := z.Raw()
+		t := srcToken{typ: tt, offset: offset}
+		if tt == html.EndTagToken {
+			if name, _ := z.TagName(); string(name) == "template" && templates > 0 {
+				templates--
+			}
+		}
+		if tt == html.StartTagToken || tt == html.SelfClosingTagToken {
+			var rawName string
+			if p.Case == OriginalCase {
+				// TagName lowercases the name in raw.
+				rawName = string(raw)
+				t.attrNames = attributeCases(raw)
+			}
+			name, _ := z.TagName()
+			t.name = string(name)
+			if rawName != "" && rawName[1:1+len(name)] != t.name {
+				t.rawName = rawName[1 : 1+len(name)]
+			}
+			if p.Quotes == OriginalQuotes {
+				t.quotes = attributeQuotes(raw)
+			}
+		}
+		if tt == html.DoctypeToken && p.Doctype == OriginalDoctype {
+			t.raw = string(raw)
+		}
+		offset += len(raw)
+		switch {
+		case t.name == "template":
+			templates++
+		case templates > 0 && (t.name == "html" || t.name == "head" || t.name == "body"):
+			continue
+		}
+		if tt != html.EndTagToken {
+			tokens = append(tokens, t)
+		}
+	}
+
+	// The parser drops and reorders some tokens, so each node is looked for
+	// among the next few tokens only.
+	const lookahead = 16
+	p.offsets = make(map[*html.Node]int)
+	p.quotes = make(map[*html.Node]map[string]byte)
+	p.rawDoctypes = make(map[*html.Node]string)
+	p.names = make(map[*html.Node]string)
+	p.attrNames = make(map[*html.Node]map[string]string)
+	var next int
+	var visit func(n *html.Node)
+	visit = func(n *html.Node) {
+		for i := next; i < len(tokens) && i < next+lookahead; i++ {
+			if matchesToken(n, tokens[i]) {
+				p.offsets[n] = p.originalOffset(tokens[i].offset)
+				if tokens[i].quotes != nil {
+					p.quotes[n] = tokens[i].quotes
+				}
+				if tokens[i].raw != "" {
+					p.rawDoctypes[n] = tokens[i].raw
+				}
+				if tokens[i].rawName != "" {
+					p.names[n] = tokens[i].rawName
+				}
+				if tokens[i].attrNames != nil {
+					p.attrNames[n] = tokens[i].attrNames
+				}
+				next = i + 1
+				break
+			}
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			visit(c)
+		}
+	}
+	for _, n := range nodes {
+		visit(n)
+	}
+}
+
+func matchesToken(n *html.Node, t srcToken) bool {
+	switch n.Type {
+	case html.ElementNode:
+		return (t.typ == html.StartTagToken || t.typ == html.SelfClosingTagToken) &&
+			strings.EqualFold(n.Data, t.name)
+	case html.TextNode:
+		return t.typ == html.TextToken
+	case html.CommentNode:
+		return t.typ == html.CommentToken
+	case html.DoctypeNode:
+		return t.typ == html.DoctypeToken
+	}
+	return false
+}
+
+// tracksOffsets reports whether the input is kept, and offsets in the
+// preprocessed input mapped back to it.
+func (p *printer) tracksOffsets() bool {
+	return p.Strict || p.DuplicateAttributes == RejectDuplicates || p.linting || p.repaired != nil || p.needsLocations()
+}
+
+// needsLocations reports whether the parsed nodes need to be matched to the
+// tokens they were parsed from, to make a source map or to preserve the
+// original quoting of attributes, DOCTYPE or case of names, or to find the
+// elements that the parser added.
+func (p *printer) needsLocations() bool {
+	return p.sourceMap != nil || p.Quotes == OriginalQuotes || p.Doctype == OriginalDoctype || p.Case == OriginalCase || p.OmitImplied
+}
+
+// originalOffset maps an offset in the preprocessed input back through each
+// of the preprocessing stages.
+func (p *printer) originalOffset(offset int) int {
+	for i := len(p.offsetMaps) - 1; i >= 0; i-- {
+		offset = p.offsetMaps[i].input(offset)
+	}
+	return offset
+}
+
+// mark records that the output of n starts at the current output offset, when
+// a source map is being made. skip is the number of bytes at the start of n
+// that are not written, such as leading whitespace that has been trimmed.
+func (p *printer) mark(n *html.Node, skip int) {
+	if p.sourceMap == nil || p.written == nil {
+		return
+	}
+	if offset, ok := p.offsets[n]; ok {
+		p.sourceMap.Mappings = append(p.sourceMap.Mappings, Mapping{Output: p.written.n, Input: offset + skip})
+	}
+}
+
+// countingWriter counts the bytes written to w.
+type countingWriter struct {
+	w io.Writer
+	n int
+}
+
+func (cw *countingWriter) Write(b []byte) (n int, err error) {
+	n, err = cw.w.Write(b)
+	cw.n += n
+	return n, err
+}
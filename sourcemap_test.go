@@ -0,0 +1,133 @@
+package htmlformat
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestSourceMap(t *testing.T) {
+	tests := []struct {
+		name      string
+		formatter Formatter
+		input     string
+		expected  []Mapping
+	}{
+		{
+			name:  "elements, text and comments are mapped",
+			input: `<ol>  <li>A</li><!--c-->   B</ol>`,
+			// <ol>
+			//  <li>A</li>
+			//  <!--c-->
+			//  B
+			// </ol>
+			expected: []Mapping{
+				{Output: 0, Input: 0},
+				{Output: 6, Input: 6},
+				{Output: 10, Input: 10},
+				{Output: 18, Input: 16},
+				{Output: 28, Input: 27},
+			},
+		},
+		{
+			name:      "minified output is mapped",
+			formatter: Formatter{Mode: Minify},
+			input:     "<p>\n  A <b>B</b>\n</p>",
+			expected: []Mapping{
+				{Output: 0, Input: 0},
+				{Output: 3, Input: 3},
+				{Output: 6, Input: 8},
+				{Output: 9, Input: 11},
+			},
+		},
+		{
+			name:      "offsets are mapped through template placeholders",
+			formatter: Formatter{Template: GoTemplate},
+			input:     `{{ if .A }}<p title="{{ .T }}">x</p>{{ end }}`,
+			// {{ if .A }}
+			//  <p title="{{ .T }}">x</p>
+			// {{ end }}
+			expected: []Mapping{
+				{Output: 0, Input: 0},
+				{Output: 13, Input: 11},
+				{Output: 33, Input: 31},
+				{Output: 39, Input: 36},
+			},
+		},
+		{
+			name:  "offsets are mapped through disabled regions",
+			input: "<!-- htmlformat:off --><b>  x</b><!-- htmlformat:on --><i>y</i>",
+			expected: []Mapping{
+				{Output: 0, Input: 0},
+				{Output: 56, Input: 55},
+				{Output: 59, Input: 58},
+			},
+		},
+		{
+			name:  "implied elements are not mapped",
+			input: `<table><td>x</td></table>`,
+			// <table>
+			//  <tbody>
+			//   <tr>
+			//    <td>x</td>
+			expected: []Mapping{
+				{Output: 0, Input: 0},
+				{Output: 27, Input: 7},
+				{Output: 31, Input: 11},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			r := strings.NewReader(test.input)
+			w := new(strings.Builder)
+			m, err := test.formatter.FragmentSourceMap(w, r)
+			if err != nil {
+				t.Fatalf("failed to format: %v", err)
+			}
+			if diff := cmp.Diff(test.expected, m.Mappings); diff != "" {
+				t.Errorf("%s\n%s", w.String(), diff)
+			}
+			out := w.String()
+			for _, mp := range m.Mappings {
+				// Whitespace may have been collapsed or trimmed.
+				if out[mp.Output] != test.input[mp.Input] && out[mp.Output] != ' ' {
+					t.Errorf("output %q at %d does not match input %q at %d", out[mp.Output:], mp.Output, test.input[mp.Input:], mp.Input)
+				}
+			}
+		})
+	}
+}
+
+func TestSourceMapLookup(t *testing.T) {
+	m := &SourceMap{Mappings: []Mapping{
+		{Output: 0, Input: 0},
+		{Output: 6, Input: 4},
+		{Output: 10, Input: 12},
+	}}
+	tests := []struct {
+		output, input int
+	}{
+		{output: 0, input: 0},
+		{output: 5, input: 0},
+		{output: 6, input: 4},
+		{output: 9, input: 4},
+		{output: 20, input: 12},
+	}
+	for _, test := range tests {
+		if actual := m.Input(test.output); actual != test.input {
+			t.Errorf("Input(%d): expected %d, got %d", test.output, test.input, actual)
+		}
+	}
+	if actual := m.Output(11); actual != 6 {
+		t.Errorf("Output(11): expected 6, got %d", actual)
+	}
+	if actual := new(SourceMap).Input(3); actual != -1 {
+		t.Errorf("Input on an empty map: expected -1, got %d", actual)
+	}
+}
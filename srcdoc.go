@@ -0,0 +1,53 @@
+package htmlformat
+
+import (
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// isSrcdocAttribute reports whether a is the srcdoc attribute of the
+// <iframe> n, whose value is a document.
+func isSrcdocAttribute(n *html.Node, a html.Attribute) bool {
+	return n.Namespace == "" && n.Data == "iframe" && a.Namespace == "" && a.Key == "srcdoc"
+}
+
+// srcdoc returns the document in the value of a srcdoc attribute formatted,
+// or as it is if it holds template actions or cannot be formatted. Its
+// attributes are quoted with the quote that the value is not, so that they
+// do not have to be escaped.
+func (p *printer) srcdoc(val string) string {
+	if strings.TrimSpace(val) == "" || strings.ContainsRune(val, placeholderStart) {
+		return val
+	}
+	if formatted, ok := p.srcdocs[val]; ok {
+		return formatted
+	}
+	f := *p.Formatter
+	f.Charset = AssumeUTF8
+	f.TrailingNewline = ForbidTrailingNewline
+	f.Template, f.Component = nil, nil
+	// The progress of the document is reported as part of the element's.
+	f.OnProgress = nil
+	f.Cache = nil
+	f.Quotes = SingleQuotes
+	if p.Quotes == SingleQuotes {
+		f.Quotes = DoubleQuotes
+	}
+	var out []byte
+	var err error
+	if isDocumentSource([]byte(val)) {
+		out, err = f.AppendDocument(nil, []byte(val))
+	} else {
+		out, err = f.AppendFragment(nil, []byte(val))
+	}
+	formatted := val
+	if err == nil {
+		formatted = strings.TrimRight(string(out), "\r\n")
+	}
+	if p.srcdocs == nil {
+		p.srcdocs = make(map[string]string)
+	}
+	p.srcdocs[val] = formatted
+	return formatted
+}
@@ -0,0 +1,118 @@
+package htmlformat
+
+import (
+	"bytes"
+	"io"
+	"sort"
+
+	"golang.org/x/net/html"
+)
+
+// Stats describes the input and output of formatting a document or fragment,
+// for build tools to log and track.
+type Stats struct {
+	// Elements, TextNodes and Comments count the nodes parsed from the input.
+	// Text that is only whitespace is not counted.
+	Elements, TextNodes, Comments int
+	// MaxDepth is how deeply the most deeply nested element is nested, where
+	// top-level elements are at depth 1.
+	MaxDepth int
+	// BytesRead and BytesWritten are the sizes of the input and the output.
+	BytesRead, BytesWritten int64
+	// NodesChanged is the number of elements, text and comments whose start
+	// tag, text or comment is written differently from the input, such as
+	// requoted attributes or reflowed text. The whitespace around text, and
+	// end tags, are not compared.
+	NodesChanged int
+}
+
+// DocumentStats formats a HTML document, and returns statistics about it.
+func (f *Formatter) DocumentStats(w io.Writer, r io.Reader) (s *Stats, err error) {
+	p := f.newPrinter()
+	p.stats, p.sourceMap = new(Stats), new(SourceMap)
+	cw := &countingWriter{w: w}
+	if err = p.document(cw, r); err != nil {
+		return nil, err
+	}
+	return p.finishStats(cw), nil
+}
+
+// FragmentStats formats a fragment of a HTML document, and returns
+// statistics about it.
+func (f *Formatter) FragmentStats(w io.Writer, r io.Reader) (s *Stats, err error) {
+	p := f.newPrinter()
+	p.stats, p.sourceMap = new(Stats), new(SourceMap)
+	cw := &countingWriter{w: w}
+	if err = p.fragment(cw, r, ""); err != nil {
+		return nil, err
+	}
+	return p.finishStats(cw), nil
+}
+
+// countNodes counts the parsed nodes and their descendants in p.stats.
+func (p *printer) countNodes(nodes []*html.Node) {
+	var depth int
+	for _, n := range nodes {
+		_ = walk(n, func(n *html.Node) (bool, error) {
+			switch {
+			case n.Type == html.ElementNode:
+				p.stats.Elements++
+				if depth++; depth > p.stats.MaxDepth {
+					p.stats.MaxDepth = depth
+				}
+			case n.Type == html.TextNode && !isEmptyTextNode(n):
+				p.stats.TextNodes++
+			case n.Type == html.CommentNode:
+				p.stats.Comments++
+			}
+			return true, nil
+		}, func(n *html.Node) error {
+			if n.Type == html.ElementNode {
+				depth--
+			}
+			return nil
+		})
+	}
+}
+
+// finishStats completes p.stats once the output has been written through cw.
+func (p *printer) finishStats(cw *countingWriter) *Stats {
+	p.stats.BytesRead = p.progress.BytesRead
+	p.stats.BytesWritten = int64(cw.n)
+	in, out := newTokenBounds(p.input), newTokenBounds(p.output.Bytes())
+	for _, m := range p.sourceMap.Mappings {
+		a, b := in.token(p.input, m.Input), out.token(p.output.Bytes(), m.Output)
+		if !bytes.Equal(a, b) {
+			p.stats.NodesChanged++
+		}
+	}
+	return p.stats
+}
+
+// tokenBounds holds the offsets at which the tokens of some markup end, in
+// order.
+type tokenBounds []int
+
+func newTokenBounds(src []byte) (ends tokenBounds) {
+	z := html.NewTokenizer(bytes.NewReader(src))
+	var offset int
+	for z.Next() != html.ErrorToken {
+		offset += len(z.Raw())
+		ends = append(ends, offset)
+	}
+	return ends
+}
+
+// token returns src from offset to the end of the token that contains it,
+// with the whitespace around text trimmed.
+func (tb tokenBounds) token(src []byte, offset int) []byte {
+	if offset < 0 || offset >= len(src) {
+		return nil
+	}
+	i := sort.SearchInts(tb, offset+1)
+	end := len(src)
+	if i < len(tb) {
+		end = tb[i]
+	}
+	return bytes.Trim(src[offset:end], htmlSpace)
+}
@@ -0,0 +1,57 @@
+package htmlformat
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestFragmentStats(t *testing.T) {
+	tests := []struct {
+		name      string
+		formatter Formatter
+		input     string
+		expected  Stats
+	}{
+		{
+			name:     "formatted input is unchanged",
+			input:    "<div>\n <p class=\"a\">a</p>\n <!-- b -->\n</div>\n",
+			expected: Stats{Elements: 2, TextNodes: 1, Comments: 1, MaxDepth: 2, BytesRead: 45, BytesWritten: 45},
+		},
+		{
+			name:     "reindenting does not change nodes",
+			input:    "<ul><li>a<li>b</ul>",
+			expected: Stats{Elements: 3, TextNodes: 2, MaxDepth: 2, BytesRead: 19, BytesWritten: 35},
+		},
+		{
+			name:      "rewritten tags and text are changed",
+			formatter: Formatter{Mode: Minify},
+			input:     "<p class='a'>a\n  b</p><p>c</p>",
+			expected:  Stats{Elements: 2, TextNodes: 2, MaxDepth: 1, BytesRead: 30, BytesWritten: 28, NodesChanged: 2},
+		},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			var sb strings.Builder
+			stats, err := test.formatter.FragmentStats(&sb, strings.NewReader(test.input))
+			if err != nil {
+				t.Fatalf("failed to format: %v", err)
+			}
+			if diff := cmp.Diff(test.expected, *stats); diff != "" {
+				t.Error(diff)
+			}
+			var expected strings.Builder
+			if err = test.formatter.Fragment(&expected, strings.NewReader(test.input)); err != nil {
+				t.Fatalf("failed to format: %v", err)
+			}
+			if diff := cmp.Diff(expected.String(), sb.String()); diff != "" {
+				t.Error(diff)
+			}
+		})
+	}
+}
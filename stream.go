@@ -0,0 +1,416 @@
+package htmlformat
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+	"golang.org/x/text/transform"
+)
+
+// Stream formats HTML read from r with bounded memory, using the default
+// settings.
+func Stream(w io.Writer, r io.Reader) (err error) {
+	return new(Formatter).Stream(w, r)
+}
+
+// Stream formats HTML read from r as it is tokenized, without building a
+// document tree, so that memory use does not grow with the size of the input.
+//
+// Without the tree, some layout decisions are approximated: the parser's
+// repairs of misnested markup are not applied, missing end tags are only
+// inserted where an element is implicitly closed by its next sibling or
+// parent, and text is only kept on the same line as its element when it is
+// the element's only content. Template actions and formatting directives are
+// not supported.
+func (f *Formatter) Stream(w io.Writer, r io.Reader) (err error) {
+	return f.newPrinter().stream(w, r)
+}
+
+func (p *printer) stream(w io.Writer, r io.Reader) (err error) {
+	w = newOutputWriter(w)
+	f := p.Formatter
+	if f.MaxBytes > 0 {
+		r = &limitReader{r: r, max: f.MaxBytes}
+	}
+	r = p.trackReading(r)
+	if f.Charset != AssumeUTF8 {
+		// Only the start of the input is used to detect its encoding.
+		br := bufio.NewReader(r)
+		content, _ := br.Peek(1024)
+		r = br
+		if e := f.detectEncoding(content); e != nil {
+			r = transform.NewReader(br, e.NewDecoder())
+			if f.Charset == OriginalCharset {
+				p.encoding = e
+			}
+		}
+	}
+	if f.Newline == DetectNewline {
+		br := bufio.NewReader(r)
+		content, _ := br.Peek(1024)
+		r = br
+		p.detectNewlines(content)
+	}
+	lr := &lastByteReader{r: r}
+	ew, flush := p.encoder(w)
+	tw, end := p.trailingNewline(ew)
+	bw := bufio.NewWriter(tw)
+	s := &streamer{
+		printer: p,
+		w:       bw,
+		z:       html.NewTokenizer(lr),
+	}
+	if f.NormalizeNewlines {
+		s.w = &newlineWriter{w: bw, nl: p.newline()}
+	}
+	if err = s.run(); err != nil {
+		return err
+	}
+	p.inputNewline = lr.last == '\n' || lr.last == '\r'
+	if err = bw.Flush(); err != nil {
+		return err
+	}
+	if err = end(); err != nil {
+		return err
+	}
+	if err = flush(); err != nil {
+		return err
+	}
+	p.reportProgress()
+	return nil
+}
+
+// streamer formats the tokens of a HTML document as they are read.
+type streamer struct {
+	*printer
+	w io.Writer
+	z *html.Tokenizer
+	// open is the stack of open elements.
+	open []*html.Node
+	// queue holds tokens that have been read ahead.
+	queue []html.Token
+}
+
+func (s *streamer) next() (tok html.Token, err error) {
+	if len(s.queue) > 0 {
+		tok = s.queue[0]
+		s.queue = s.queue[1:]
+		return tok, nil
+	}
+	if s.z.Next() == html.ErrorToken {
+		return tok, s.z.Err()
+	}
+	return s.z.Token(), nil
+}
+
+// peek returns the token after the next n tokens, without consuming it.
+func (s *streamer) peek(n int) (tok html.Token, err error) {
+	for len(s.queue) <= n {
+		if s.z.Next() == html.ErrorToken {
+			return tok, s.z.Err()
+		}
+		s.queue = append(s.queue, s.z.Token())
+	}
+	return s.queue[n], nil
+}
+
+func (s *streamer) level() (level int) {
+	for _, n := range s.open {
+		level += s.childIndent(n)
+	}
+	return level
+}
+
+func (s *streamer) run() (err error) {
+	for {
+		if err := s.checkContext(); err != nil {
+			return err
+		}
+		tok, err := s.next()
+		if errors.Is(err, io.EOF) {
+			return s.closeTo(0)
+		}
+		if err != nil {
+			return err
+		}
+		s.wrote(1)
+		switch tok.Type {
+		case html.StartTagToken, html.SelfClosingTagToken:
+			err = s.startTag(tok)
+		case html.EndTagToken:
+			err = s.endTag(tok)
+		case html.TextToken:
+			err = s.text(tok)
+		case html.CommentToken:
+			if s.StripComments && !s.keepsComment(tok.Data) {
+				break
+			}
+			err = s.line("<!--" + tok.Data + "-->")
+		case html.DoctypeToken:
+			if s.Doctype == HTML5Doctype {
+				err = s.line("<!DOCTYPE html>")
+				break
+			}
+			err = s.line("<!DOCTYPE " + tok.Data + ">")
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// line writes s on its own line at the current level.
+func (s *streamer) line(text string) (err error) {
+	if err = s.printIndent(s.w, s.level()); err != nil {
+		return
+	}
+	_, err = write(s.w, text, s.newline())
+	return
+}
+
+func (s *streamer) startTag(tok html.Token) (err error) {
+	n := &html.Node{Type: html.ElementNode, Data: tok.Data, DataAtom: tok.DataAtom, Attr: tok.Attr, Namespace: s.namespace(tok)}
+	if s.Charset == TranscodeCharset {
+		setMetaCharset(n)
+	}
+	if err = s.closeImplied(n); err != nil {
+		return
+	}
+	empty := s.isVoidElement(n) || tok.Type == html.SelfClosingTagToken
+	if n.Namespace != "" && !empty {
+		// A foreign element is written as self-closing if it is empty, as
+		// the tree printer writes it. Otherwise, it is given a child, as
+		// its content is not added to it, for its start tag to be written
+		// as such.
+		if end, err := s.peek(0); err == nil && end.Type == html.EndTagToken && end.Data == n.Data {
+			s.queue = s.queue[1:]
+			empty = true
+		} else {
+			n.AppendChild(&html.Node{Type: html.TextNode})
+		}
+	}
+	if err = s.printIndent(s.w, s.level()); err != nil {
+		return
+	}
+	if err = s.printIndentedStartTag(s.w, n, s.level()); err != nil {
+		return
+	}
+	if empty {
+		_, err = io.WriteString(s.w, s.newline())
+		return
+	}
+	if s.isPreformattedElement(n) {
+		return s.preformatted(n)
+	}
+	if !s.isSpecialContentElement(n) {
+		// Keep elements containing only text on a single line.
+		text, err := s.peek(0)
+		if err == nil && text.Type == html.TextToken && trimHTMLSpace(text.Data) != "" {
+			end, err := s.peek(1)
+			if err == nil && end.Type == html.EndTagToken && end.Data == n.Data {
+				s.queue = s.queue[2:]
+				content := s.escapeText(&html.Node{Type: html.TextNode, Parent: n}, trimHTMLSpace(text.Data))
+				_, err = write(s.w, content, "</", s.tagName(n), ">", s.newline())
+				return err
+			}
+		}
+	}
+	s.open = append(s.open, n)
+	_, err = io.WriteString(s.w, s.newline())
+	return
+}
+
+// namespace returns the namespace of the element started by tok: that of
+// SVG or MathML content within an <svg> or <math> element, apart from the
+// HTML in the elements that integrate it.
+func (s *streamer) namespace(tok html.Token) string {
+	switch tok.DataAtom {
+	case atom.Svg, atom.Math:
+		return tok.Data
+	}
+	if len(s.open) == 0 {
+		return ""
+	}
+	parent := s.open[len(s.open)-1]
+	switch {
+	case parent.Namespace == "svg" && (parent.DataAtom == atom.Foreignobject || parent.DataAtom == atom.Desc || parent.DataAtom == atom.Title),
+		isMathTokenElement(parent):
+		return ""
+	}
+	return parent.Namespace
+}
+
+// preformatted copies the content of the element n exactly as it appears in
+// the input, up to and including its end tag.
+func (s *streamer) preformatted(n *html.Node) (err error) {
+	depth := 1
+	for depth > 0 {
+		var raw []byte
+		var tt html.TokenType
+		var name []byte
+		if len(s.queue) > 0 {
+			tok := s.queue[0]
+			s.queue = s.queue[1:]
+			tt, name, raw = tok.Type, []byte(tok.Data), []byte(tok.String())
+		} else {
+			tt = s.z.Next()
+			if tt == html.ErrorToken {
+				if errors.Is(s.z.Err(), io.EOF) {
+					break
+				}
+				return s.z.Err()
+			}
+			raw = s.z.Raw()
+			if tt == html.StartTagToken || tt == html.EndTagToken {
+				name, _ = s.z.TagName()
+			}
+		}
+		switch {
+		case tt == html.StartTagToken && string(name) == n.Data:
+			depth++
+		case tt == html.EndTagToken && string(name) == n.Data:
+			depth--
+			if depth == 0 {
+				raw = []byte("</" + s.tagName(n) + ">")
+			}
+		}
+		if _, err = s.w.Write(raw); err != nil {
+			return
+		}
+	}
+	_, err = io.WriteString(s.w, s.newline())
+	return
+}
+
+func (s *streamer) endTag(tok html.Token) (err error) {
+	for i := len(s.open) - 1; i >= 0; i-- {
+		if s.open[i].Data == tok.Data {
+			return s.closeTo(i)
+		}
+	}
+	// Stray end tags are dropped, as the parser would.
+	return nil
+}
+
+// closeTo writes end tags for the open elements until only n remain.
+func (s *streamer) closeTo(n int) (err error) {
+	for len(s.open) > n {
+		e := s.open[len(s.open)-1]
+		s.open = s.open[:len(s.open)-1]
+		if err = s.line("</" + s.tagName(e) + ">"); err != nil {
+			return
+		}
+	}
+	return
+}
+
+// closeImplied closes the open elements whose end tags are implied by the
+// start of n, such as an open <li> when another <li> starts.
+func (s *streamer) closeImplied(n *html.Node) error {
+	for i := len(s.open) - 1; i >= 0; i-- {
+		open := s.open[i].DataAtom
+		if impliesEnd(n.DataAtom, open) {
+			return s.closeTo(i)
+		}
+		if !hasOptionalEndTag(open) {
+			break
+		}
+	}
+	return nil
+}
+
+// hasOptionalEndTag reports whether the end tags of elements of type a may be
+// omitted, so that they are closed by a following element or the end of their
+// parent.
+func hasOptionalEndTag(a atom.Atom) bool {
+	switch a {
+	case atom.Html, atom.Head, atom.Body, atom.Li, atom.Dt, atom.Dd, atom.P,
+		atom.Option, atom.Optgroup, atom.Colgroup, atom.Caption, atom.Thead,
+		atom.Tbody, atom.Tfoot, atom.Tr, atom.Td, atom.Th, atom.Rt, atom.Rp:
+		return true
+	}
+	return false
+}
+
+// impliesEnd reports whether the start of an element of type next closes an
+// open element of type open.
+// https://html.spec.whatwg.org/multipage/syntax.html#optional-tags
+func impliesEnd(next, open atom.Atom) bool {
+	switch open {
+	case atom.Li:
+		return next == atom.Li
+	case atom.Dt, atom.Dd:
+		return next == atom.Dt || next == atom.Dd
+	case atom.Option:
+		return next == atom.Option || next == atom.Optgroup
+	case atom.Optgroup:
+		return next == atom.Optgroup
+	case atom.Tr:
+		return next == atom.Tr
+	case atom.Td, atom.Th:
+		return next == atom.Td || next == atom.Th || next == atom.Tr
+	case atom.Rt, atom.Rp:
+		return next == atom.Rt || next == atom.Rp
+	case atom.P:
+		return closesParagraph(next)
+	}
+	return false
+}
+
+// closesParagraph reports whether the start of an element of type a closes
+// an open <p>.
+func closesParagraph(a atom.Atom) bool {
+	switch a {
+	case atom.Address, atom.Article, atom.Aside, atom.Blockquote, atom.Details,
+		atom.Div, atom.Dl, atom.Fieldset, atom.Figcaption, atom.Figure,
+		atom.Footer, atom.Form, atom.H1, atom.H2, atom.H3, atom.H4, atom.H5,
+		atom.H6, atom.Header, atom.Hgroup, atom.Hr, atom.Main, atom.Menu,
+		atom.Nav, atom.Ol, atom.P, atom.Pre, atom.Section, atom.Table, atom.Ul:
+		return true
+	}
+	return false
+}
+
+func (s *streamer) text(tok html.Token) (err error) {
+	text := trimHTMLSpace(tok.Data)
+	if text == "" {
+		return nil
+	}
+	var parent *html.Node
+	if len(s.open) > 0 {
+		parent = s.open[len(s.open)-1]
+	}
+	if !s.isSpecialContentElement(parent) {
+		return s.line(s.escapeText(&html.Node{Type: html.TextNode, Parent: parent}, text))
+	}
+	if s.isMinified(&html.Node{Type: html.TextNode, Data: tok.Data, Parent: parent}) {
+		_, err = write(s.w, trimBlankLines(tok.Data), s.newline())
+		return err
+	}
+	text = dedentText(tok.Data)
+	if ef := s.embeddedFormatter(parent); ef != nil {
+		if text, err = ef.Format(parent, text); err != nil {
+			return fmt.Errorf("failed to format <%s> content: %w", parent.Data, err)
+		}
+	}
+	for _, l := range strings.Split(text, "\n") {
+		if strings.TrimSpace(l) == "" {
+			if _, err = io.WriteString(s.w, s.newline()); err != nil {
+				return
+			}
+			continue
+		}
+		if err = s.printIndent(s.w, s.level()+1); err != nil {
+			return
+		}
+		if _, err = write(s.w, strings.TrimRight(l, "\r"), s.newline()); err != nil {
+			return
+		}
+	}
+	return nil
+}
@@ -0,0 +1,176 @@
+package htmlformat
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestStream(t *testing.T) {
+	tests := []struct {
+		name      string
+		formatter Formatter
+		input     string
+		expected  string
+	}{
+		{
+			name:  "elements are indented",
+			input: `<div><ol> <li class="a"> A </li> <li> B </li> </ol></div>`,
+			expected: `<div>
+ <ol>
+  <li class="a">A</li>
+  <li>B</li>
+ </ol>
+</div>
+`,
+		},
+		{
+			name:      "minified scripts are written as they are",
+			formatter: Formatter{MinifiedLineLength: 10},
+			input:     "<div><script>\n    var a=1,b=2;c(a,b)\n</script></div>",
+			expected:  "<div>\n <script>\n    var a=1,b=2;c(a,b)\n </script>\n</div>\n",
+		},
+		{
+			name:      "the children of html, head and body can be left unindented",
+			formatter: Formatter{FlatDocument: true},
+			input:     `<html><body><div><p>A</p></div></body></html>`,
+			expected: `<html>
+<body>
+<div>
+ <p>A</p>
+</div>
+</body>
+</html>
+`,
+		},
+		{
+			name:  "missing end tags are inserted",
+			input: `<ul><li>A<li>B</ul><p>C<div>D`,
+			expected: `<ul>
+ <li>
+  A
+ </li>
+ <li>
+  B
+ </li>
+</ul>
+<p>
+ C
+</p>
+<div>
+ D
+</div>
+`,
+		},
+		{
+			name:  "empty foreign elements are self-closing",
+			input: `<svg><path d="M0"/><circle r="1"/><g><rect></rect></g></svg>`,
+			expected: `<svg>
+ <path d="M0" />
+ <circle r="1" />
+ <g>
+  <rect />
+ </g>
+</svg>
+`,
+		},
+		{
+			name:  "the content of foreign objects is HTML",
+			input: `<svg><foreignObject><p>a</p><br/></foreignObject></svg>`,
+			expected: `<svg>
+ <foreignobject>
+  <p>a</p>
+  <br>
+ </foreignobject>
+</svg>
+`,
+		},
+		{
+			name:     "non-breaking spaces at the edges of text are kept",
+			input:    `<p>a&nbsp;</p><p>&nbsp;</p>`,
+			expected: "<p>a\u00a0</p>\n<p>\u00a0</p>\n",
+		},
+		{
+			name:     "stray end tags are dropped",
+			input:    `<p>A</p></div>`,
+			expected: "<p>A</p>\n",
+		},
+		{
+			name:  "void elements are not closed",
+			input: `<p><br>A<img src="a.png"></p>`,
+			expected: `<p>
+ <br>
+ A
+ <img src="a.png">
+</p>
+`,
+		},
+		{
+			name:  "doctype and comments are written",
+			input: "<!doctype html><html><body><!-- x --></body></html>",
+			expected: `<!DOCTYPE html>
+<html>
+ <body>
+  <!-- x -->
+ </body>
+</html>
+`,
+		},
+		{
+			name:     "pre content is preserved",
+			input:    "<div><pre>\n  a <b>b</b>\n  c</pre></div>",
+			expected: "<div>\n <pre>\n  a <b>b</b>\n  c</pre>\n</div>\n",
+		},
+		{
+			name:     "script content is indented",
+			input:    "<script>\n  let a = 1;\n  let b = 2;\n</script>",
+			expected: "<script>\n  let a = 1;\n  let b = 2;\n</script>\n",
+		},
+		{
+			name:      "the newlines of preformatted content can be normalized",
+			formatter: Formatter{NormalizeNewlines: true},
+			input:     "<div><pre>a\r\nb\rc</pre><!-- d\r\ne --></div>",
+			expected:  "<div>\n <pre>a\nb\nc</pre>\n <!-- d\ne -->\n</div>\n",
+		},
+		{
+			name:     "the relative indentation of script content is kept",
+			input:    "<div><script>if (a) {\n      b();\n\n    }</script></div>",
+			expected: "<div>\n <script>\n   if (a) {\n     b();\n\n   }\n </script>\n</div>\n",
+		},
+		{
+			name:      "formatter settings are used",
+			formatter: Formatter{Indent: "\t", Newline: "\r\n", PrintWidth: 20},
+			input:     `<div><a href="https://example.com" class="link">A</a></div>`,
+			expected:  "<div>\r\n\t<a\r\n\t\thref=\"https://example.com\"\r\n\t\tclass=\"link\"\r\n\t>A</a>\r\n</div>\r\n",
+		},
+		{
+			name:      "the newline and trailing newline of the input can be kept",
+			formatter: Formatter{Newline: DetectNewline, TrailingNewline: OriginalTrailingNewline},
+			input:     "<p>\r\nA</p><p>B</p>",
+			expected:  "<p>A</p>\r\n<p>B</p>",
+		},
+		{
+			name:      "comments can be stripped",
+			formatter: Formatter{StripComments: true, KeepComments: []string{"!"}},
+			input:     "<!--! License --><!-- note --><p>A</p>",
+			expected:  "<!--! License -->\n<p>A</p>\n",
+		},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			r := strings.NewReader(test.input)
+			w := new(strings.Builder)
+			if err := test.formatter.Stream(w, r); err != nil {
+				t.Fatalf("failed to format: %v", err)
+			}
+			if diff := cmp.Diff(test.expected, w.String()); diff != "" {
+				t.Error(diff)
+			}
+		})
+	}
+}
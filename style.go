@@ -0,0 +1,151 @@
+package htmlformat
+
+import (
+	"fmt"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// SemicolonStyle controls whether the last declaration of a style attribute
+// ends with a semicolon, when NormalizeStyles is set.
+type SemicolonStyle int
+
+const (
+	// RequireSemicolon ends every declaration with a semicolon, including
+	// the last.
+	RequireSemicolon SemicolonStyle = iota
+	// ForbidSemicolon leaves out the semicolon after the last declaration.
+	ForbidSemicolon
+	// OriginalSemicolon ends the last declaration with a semicolon if it
+	// ends with one in the input.
+	OriginalSemicolon
+)
+
+var semicolonStyleNames = []string{
+	RequireSemicolon:  "require",
+	ForbidSemicolon:   "forbid",
+	OriginalSemicolon: "preserve",
+}
+
+// String returns the name of the semicolon style: "require", "forbid" or
+// "preserve".
+func (s SemicolonStyle) String() string {
+	if s < 0 || int(s) >= len(semicolonStyleNames) {
+		return fmt.Sprintf("SemicolonStyle(%d)", int(s))
+	}
+	return semicolonStyleNames[s]
+}
+
+// Set sets the semicolon style from its name, so that it can be used as a
+// flag.Value.
+func (s *SemicolonStyle) Set(name string) error {
+	for i, n := range semicolonStyleNames {
+		if n == name {
+			*s = SemicolonStyle(i)
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown semicolon style %q", name)
+}
+
+// isStyleAttribute reports whether a is a style attribute, whose value is a
+// list of CSS declarations.
+func isStyleAttribute(a html.Attribute) bool {
+	return a.Namespace == "" && a.Key == "style"
+}
+
+// normalizeStyle returns the declarations in the style attribute value val
+// written as "property: value" and separated by "; ". Values containing
+// template actions are returned as they are.
+func (f *Formatter) normalizeStyle(val string) string {
+	if strings.ContainsRune(val, placeholderStart) {
+		return val
+	}
+	decls := styleDeclarations(val)
+	if len(decls) == 0 {
+		return ""
+	}
+	s := strings.Join(decls, "; ")
+	if f.styleSemicolon(val) {
+		s += ";"
+	}
+	return s
+}
+
+// styleSemicolon reports whether the last declaration of the style
+// attribute value val is written with a semicolon.
+func (f *Formatter) styleSemicolon(val string) bool {
+	switch f.StyleSemicolon {
+	case ForbidSemicolon:
+		return false
+	case OriginalSemicolon:
+		return strings.HasSuffix(strings.TrimRight(val, htmlSpace), ";")
+	}
+	return true
+}
+
+// styleDeclarations returns the declarations of the style attribute value
+// val, without the semicolons between them, each with its whitespace
+// collapsed and a single space after the colon that follows its property.
+// Semicolons in strings, comments and parentheses, as in url() and var(), do
+// not end declarations.
+func styleDeclarations(val string) (decls []string) {
+	var sb strings.Builder
+	end := func() {
+		decl := strings.TrimSpace(sb.String())
+		sb.Reset()
+		if decl == "" {
+			return
+		}
+		if prop, value, ok := strings.Cut(decl, ":"); ok && !strings.Contains(prop, "/*") {
+			decl = strings.TrimSpace(prop) + ": " + strings.TrimSpace(value)
+		}
+		decls = append(decls, strings.TrimSpace(decl))
+	}
+	var depth int
+	for i := 0; i < len(val); i++ {
+		switch c := val[i]; {
+		case c == '"' || c == '\'':
+			j := i + 1
+			for j < len(val) && val[j] != c {
+				if val[j] == '\\' {
+					j++
+				}
+				j++
+			}
+			if j >= len(val) {
+				j = len(val) - 1
+			}
+			sb.WriteString(val[i : j+1])
+			i = j
+		case c == '/' && strings.HasPrefix(val[i:], "/*"):
+			j := strings.Index(val[i+2:], "*/")
+			if j < 0 {
+				j = len(val)
+			} else {
+				j += i + 4
+			}
+			sb.WriteString(val[i:j])
+			i = j - 1
+		case c == '(':
+			depth++
+			sb.WriteByte(c)
+		case c == ')':
+			if depth > 0 {
+				depth--
+			}
+			sb.WriteByte(c)
+		case c == ';' && depth == 0:
+			end()
+		case isSpace(c):
+			if s := sb.String(); s != "" && !strings.HasSuffix(s, " ") {
+				sb.WriteByte(' ')
+			}
+		default:
+			sb.WriteByte(c)
+		}
+	}
+	end()
+	return decls
+}
@@ -0,0 +1,583 @@
+package htmlformat
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// TemplateSyntax describes the actions of a template language. When set on a
+// Formatter, actions are hidden from the HTML parser and written exactly as
+// they appear in the input, and the markup between actions that open and
+// close blocks is indented.
+//
+// Syntaxes for common template languages are provided, and others can be
+// described by their delimiters and block keywords.
+type TemplateSyntax struct {
+	// Delimiters lists the strings that start and end actions.
+	Delimiters []TemplateDelimiter
+	// Open, Middle and Close match the actions that start a block, such as
+	// {{ if .X }}, continue it, such as {{ else }}, and end it, such as
+	// {{ end }}. They are matched against the text between the delimiters,
+	// with surrounding whitespace and trim markers removed.
+	Open, Middle, Close *regexp.Regexp
+}
+
+// TemplateDelimiter is a pair of strings that start and end template actions.
+type TemplateDelimiter struct {
+	Left, Right string
+	// Comment is set for delimiters that start and end comments, which are
+	// not searched for quoted strings and are never blocks.
+	Comment bool
+	// Nested is set for delimiters that may also appear in pairs within
+	// actions, such as the braces of Svelte expressions, so that an action
+	// ends at the Right that matches its Left.
+	Nested bool
+}
+
+// GoTemplate is the syntax of Go's text/template and html/template packages.
+var GoTemplate = &TemplateSyntax{
+	Delimiters: []TemplateDelimiter{{Left: "{{", Right: "}}"}},
+	Open:       regexp.MustCompile(`^(if|range|with|define|block)\b`),
+	Middle:     regexp.MustCompile(`^else\b`),
+	Close:      regexp.MustCompile(`^end\b`),
+}
+
+// Jinja is the syntax of Jinja templates, which is shared by Django, Nunjucks
+// and Twig.
+var Jinja = &TemplateSyntax{
+	Delimiters: []TemplateDelimiter{
+		{Left: "{{", Right: "}}"},
+		{Left: "{%", Right: "%}"},
+		{Left: "{#", Right: "#}", Comment: true},
+	},
+	Open:   regexp.MustCompile(`^(if|for|block|macro|call|filter|with|autoescape|trans|blocktrans|embed|apply|spaceless|raw|verbatim)\b|^set\s+[\w.,\s]+$`),
+	Middle: regexp.MustCompile(`^(elif|elseif|else|empty|plural)\b`),
+	Close:  regexp.MustCompile(`^end\w*$`),
+}
+
+// Liquid is the syntax of Shopify's Liquid templates, as used by Jekyll.
+var Liquid = &TemplateSyntax{
+	Delimiters: []TemplateDelimiter{
+		{Left: "{{", Right: "}}"},
+		{Left: "{%", Right: "%}"},
+	},
+	Open:   regexp.MustCompile(`^(if|unless|case|for|capture|tablerow|comment|raw|paginate|form|schema|style|javascript)\b`),
+	Middle: regexp.MustCompile(`^(elsif|else|when)\b`),
+	Close:  regexp.MustCompile(`^end\w+$`),
+}
+
+// ERB is the syntax of Ruby's embedded templates.
+var ERB = &TemplateSyntax{
+	Delimiters: []TemplateDelimiter{
+		{Left: "<%", Right: "%>"},
+		{Left: "<%#", Right: "%>", Comment: true},
+	},
+	Open:   regexp.MustCompile(`^(if|unless|case|while|until|for|begin)\b|\bdo(\s*\|[^|]*\|)?$`),
+	Middle: regexp.MustCompile(`^(else|elsif|when|rescue|ensure)\b`),
+	Close:  regexp.MustCompile(`^end\b`),
+}
+
+// Handlebars is the syntax of Handlebars and Mustache templates.
+var Handlebars = &TemplateSyntax{
+	Delimiters: []TemplateDelimiter{
+		{Left: "{{", Right: "}}"},
+		{Left: "{{{", Right: "}}}"},
+		{Left: "{{!", Right: "}}", Comment: true},
+		{Left: "{{!--", Right: "--}}", Comment: true},
+	},
+	Open:   regexp.MustCompile(`^#`),
+	Middle: regexp.MustCompile(`^(else\b|\^$)`),
+	Close:  regexp.MustCompile(`^/`),
+}
+
+// LookupTemplateSyntax returns the template syntax with the given name, as
+// used in configuration files and on the command line: "go", "jinja" (or
+// "django", "nunjucks", "twig"), "liquid", "erb", or "handlebars" (or
+// "mustache"), "vue" or "svelte".
+func LookupTemplateSyntax(name string) (ts *TemplateSyntax, ok bool) {
+	switch name {
+	case "go":
+		return GoTemplate, true
+	case "jinja", "django", "nunjucks", "twig":
+		return Jinja, true
+	case "liquid":
+		return Liquid, true
+	case "erb":
+		return ERB, true
+	case "handlebars", "mustache":
+		return Handlebars, true
+	case "vue":
+		return Vue, true
+	case "svelte":
+		return Svelte, true
+	}
+	return nil, false
+}
+
+// templateExtensions are the file extensions of templates whose syntax is
+// known from the extension alone.
+var templateExtensions = map[string]*TemplateSyntax{
+	".gohtml": GoTemplate, ".tmpl": GoTemplate,
+	".j2": Jinja, ".jinja": Jinja, ".jinja2": Jinja, ".njk": Jinja, ".twig": Jinja,
+	".liquid": Liquid,
+	".erb":    ERB,
+	".hbs":    Handlebars, ".handlebars": Handlebars, ".mustache": Handlebars,
+}
+
+type templateBlock int
+
+const (
+	templateInline templateBlock = iota
+	templateOpen
+	templateMiddle
+	templateClose
+)
+
+// Template actions are replaced by placeholders before parsing, and restored
+// as the output is written. A placeholder is the index of the action, written
+// in decimal between two characters from the Unicode private use area, which
+// survives parsing in text, attribute names and values, and comments.
+const (
+	placeholderStart = '\uE000'
+	placeholderEnd   = '\uE001'
+)
+
+func placeholder(i int) string {
+	return string(placeholderStart) + strconv.Itoa(i) + string(placeholderEnd)
+}
+
+// action is a template action found in the input.
+type action struct {
+	src   string
+	block templateBlock
+}
+
+// protectTemplates replaces the template actions in src with placeholders.
+// Actions that stand on their own line, open or close blocks, or appear where
+// the parser would move text, such as directly within a <table>, are replaced
+// with placeholder comments so that the printer can lay them out as block
+// content. Others, including those within tags, are replaced by placeholder
+// text. An action in place of a tag name, as in <{{.Tag}}>, cannot be hidden
+// from the parser without changing the markup, and is a ParseError.
+func (p *printer) protectTemplates(src []byte) ([]byte, error) {
+	var out bytes.Buffer
+	var m offsetMap
+	var open []string // The names of open elements, approximately.
+	var rawText string
+	for i := 0; i < len(src); {
+		if a, end, ok := p.scanAction(src, i); ok {
+			isComment := rawText == "" &&
+				(a.block != templateInline || standsAlone(src, i, end) || movesText(open))
+			p.actions = append(p.actions, a)
+			start := out.Len()
+			if isComment {
+				out.WriteString("<!--" + placeholder(len(p.actions)-1) + "-->")
+			} else {
+				out.WriteString(placeholder(len(p.actions) - 1))
+			}
+			p.replaced(&m, start, out.Len(), i, end)
+			i = end
+			continue
+		}
+		c := src[i]
+		if c != '<' {
+			out.WriteByte(c)
+			i++
+			continue
+		}
+		// Copy comments and tags, replacing any actions within them with
+		// placeholder text.
+		var end int
+		switch {
+		case rawText != "":
+			if !hasEndTag(src[i:], rawText) {
+				out.WriteByte(c)
+				i++
+				continue
+			}
+			rawText = ""
+			end = p.tagEnd(src, i)
+		case bytes.HasPrefix(src[i:], []byte("<!--")):
+			end = bytes.Index(src[i+4:], []byte("-->"))
+			if end < 0 {
+				end = len(src)
+			} else {
+				end += i + 7
+			}
+		case p.hasActionName(src, i):
+			pe := &ParseError{Err: errors.New("template action in place of a tag name")}
+			if p.tracksOffsets() {
+				pe.Line, pe.Column = position(p.input, p.originalOffset(i))
+			}
+			return nil, pe
+		case i+1 < len(src) && (isASCIILetter(src[i+1]) || src[i+1] == '/'):
+			end = p.tagEnd(src, i)
+			name, closing := tagName(src[i:end])
+			switch {
+			case closing:
+				for j := len(open) - 1; j >= 0; j-- {
+					if open[j] == name {
+						open = open[:j]
+						break
+					}
+				}
+			case isRawTextElementName(name):
+				rawText = name
+			case !p.isVoidElementName(name) && !bytes.HasSuffix(src[i:end], []byte("/>")):
+				open = append(open, name)
+			}
+		default:
+			out.WriteByte(c)
+			i++
+			continue
+		}
+		for j := i; j < end; {
+			if a, aend, ok := p.scanAction(src, j); ok {
+				p.actions = append(p.actions, action{src: a.src})
+				start := out.Len()
+				out.WriteString(placeholder(len(p.actions) - 1))
+				p.replaced(&m, start, out.Len(), j, aend)
+				j = aend
+				continue
+			}
+			out.WriteByte(src[j])
+			j++
+		}
+		i = end
+	}
+	p.offsetMaps = append(p.offsetMaps, m)
+	return out.Bytes(), nil
+}
+
+// hasActionName reports whether the tag that starts at src[i] has an action
+// in place of its name.
+func (p *printer) hasActionName(src []byte, i int) bool {
+	i++
+	if i < len(src) && src[i] == '/' {
+		i++
+	}
+	_, _, ok := p.scanAction(src, i)
+	return ok
+}
+
+// scanAction returns the action starting at src[i], and the offset of the end
+// of it.
+func (p *printer) scanAction(src []byte, i int) (a action, end int, ok bool) {
+	var best *TemplateDelimiter
+	for j, d := range p.Template.Delimiters {
+		if bytes.HasPrefix(src[i:], []byte(d.Left)) && (best == nil || len(d.Left) > len(best.Left)) {
+			best = &p.Template.Delimiters[j]
+		}
+	}
+	if best == nil {
+		return a, 0, false
+	}
+	body := i + len(best.Left)
+	if best.Comment {
+		end = bytes.Index(src[body:], []byte(best.Right))
+		if end < 0 {
+			return a, 0, false
+		}
+		end += body + len(best.Right)
+		return action{src: string(src[i:end])}, end, true
+	}
+	var depth int
+	for j := body; j < len(src); j++ {
+		if best.Nested && bytes.HasPrefix(src[j:], []byte(best.Left)) {
+			depth++
+			j += len(best.Left) - 1
+			continue
+		}
+		if depth > 0 && bytes.HasPrefix(src[j:], []byte(best.Right)) {
+			depth--
+			j += len(best.Right) - 1
+			continue
+		}
+		if bytes.HasPrefix(src[j:], []byte(best.Right)) {
+			end = j + len(best.Right)
+			a = action{src: string(src[i:end])}
+			a.block = p.Template.classify(string(src[body:j]))
+			return a, end, true
+		}
+		var closer string
+		k := j + 1
+		switch {
+		case src[j] == '"', src[j] == '\'', src[j] == '`':
+			closer = string(src[j])
+		case bytes.HasPrefix(src[j:], []byte("/*")):
+			closer = "*/"
+			k++
+		default:
+			continue
+		}
+		for ; k < len(src); k++ {
+			if src[k] == '\\' && closer != "`" && closer != "*/" {
+				k++
+				continue
+			}
+			if bytes.HasPrefix(src[k:], []byte(closer)) {
+				break
+			}
+		}
+		j = k + len(closer) - 1
+	}
+	return a, 0, false
+}
+
+func (ts *TemplateSyntax) classify(body string) templateBlock {
+	body = strings.TrimSpace(body)
+	body = strings.TrimSpace(strings.TrimLeft(body, "-+~="))
+	body = strings.TrimSpace(strings.TrimRight(body, "-+~="))
+	switch {
+	case ts.Close != nil && ts.Close.MatchString(body):
+		return templateClose
+	case ts.Middle != nil && ts.Middle.MatchString(body):
+		return templateMiddle
+	case ts.Open != nil && ts.Open.MatchString(body):
+		return templateOpen
+	}
+	return templateInline
+}
+
+// tagEnd returns the offset after the '>' that ends the tag starting at
+// src[i], skipping quoted attribute values and template actions.
+func (p *printer) tagEnd(src []byte, i int) int {
+	var quote byte
+	// value is set after an equals sign, until the value starts, and
+	// unquoted within an unquoted value. Quotes elsewhere, such as in
+	// <b"> or <a href=x"y>, are part of a name or value.
+	var value, unquoted bool
+	for j := i + 1; j < len(src); j++ {
+		if p.Template != nil {
+			if _, end, ok := p.scanAction(src, j); ok {
+				j = end - 1
+				continue
+			}
+		}
+		switch c := src[j]; {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '>':
+			return j + 1
+		case unquoted:
+			unquoted = !isSpace(c)
+		case value:
+			if isSpace(c) {
+				continue
+			}
+			if c == '"' || c == '\'' {
+				quote = c
+			} else {
+				unquoted = true
+			}
+			value = false
+		case c == '=':
+			value = true
+		}
+	}
+	return len(src)
+}
+
+// tagName returns the lower case name of the tag in src, and whether it is an
+// end tag.
+func tagName(src []byte) (name string, closing bool) {
+	src = src[1:]
+	if len(src) > 0 && src[0] == '/' {
+		closing = true
+		src = src[1:]
+	}
+	end := bytes.IndexFunc(src, func(r rune) bool {
+		return unicode.IsSpace(r) || r == '/' || r == '>'
+	})
+	if end < 0 {
+		end = len(src)
+	}
+	return strings.ToLower(string(src[:end])), closing
+}
+
+func hasEndTag(src []byte, name string) bool {
+	if len(src) < len(name)+2 || src[1] != '/' {
+		return false
+	}
+	return strings.EqualFold(string(src[2:2+len(name)]), name)
+}
+
+func isASCIILetter(c byte) bool {
+	return 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z'
+}
+
+// isRawTextElementName reports whether the content of elements with the given
+// name is parsed as text rather than markup.
+func isRawTextElementName(name string) bool {
+	switch name {
+	case "script", "style", "textarea", "title", "xmp", "iframe", "noembed", "noframes", "plaintext":
+		return true
+	}
+	return false
+}
+
+// standsAlone reports whether src[start:end] is the only thing on its line.
+func standsAlone(src []byte, start, end int) bool {
+	before := src[:start]
+	if i := bytes.LastIndexByte(before, '\n'); i >= 0 {
+		before = before[i+1:]
+	}
+	after := src[end:]
+	if i := bytes.IndexByte(after, '\n'); i >= 0 {
+		after = after[:i]
+	}
+	return len(bytes.TrimSpace(before)) == 0 && len(bytes.TrimSpace(after)) == 0
+}
+
+// movesText reports whether the parser would move text out of the innermost
+// open element, as it does for text directly within tables.
+func movesText(open []string) bool {
+	if len(open) == 0 {
+		return false
+	}
+	switch open[len(open)-1] {
+	case "table", "thead", "tbody", "tfoot", "tr", "colgroup":
+		return true
+	}
+	return false
+}
+
+// keepActionPairs moves the actions that open blocks directly before a
+// <tbody> or <tr>, which the parser inserts in tables, into it, where the
+// actions that close them are, such as the range in
+// <table>{{ range .Rows }}<tr>...</tr>{{ end }}</table>. Otherwise the element
+// would be written within the block, and repeated as the template renders.
+func (p *printer) keepActionPairs(n *html.Node) {
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		p.keepActionPairs(c)
+	}
+	if n.Type != html.ElementNode || n.DataAtom != atom.Tbody && n.DataAtom != atom.Tr {
+		return
+	}
+	// unclosed counts the actions in n that close blocks opened before it.
+	var depth, unclosed int
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		switch a, _ := p.templateAction(c); {
+		case a.block == templateOpen:
+			depth++
+		case a.block == templateClose && depth > 0:
+			depth--
+		case a.block == templateClose:
+			unclosed++
+		}
+	}
+	var moved []*html.Node
+	for c := n.PrevSibling; c != nil && unclosed > 0; c = c.PrevSibling {
+		a, ok := p.templateAction(c)
+		switch {
+		case ok && a.block == templateOpen:
+			unclosed--
+		case ok && a.block == templateClose:
+			unclosed++
+		case !ok && !isEmptyTextNode(c):
+			return
+		}
+		moved = append(moved, c)
+	}
+	if unclosed > 0 {
+		return
+	}
+	for _, c := range moved {
+		c.Parent.RemoveChild(c)
+		n.InsertBefore(c, n.FirstChild)
+	}
+}
+
+// templateAction returns the action that the placeholder comment n stands in
+// for.
+func (p *printer) templateAction(n *html.Node) (a action, ok bool) {
+	if n.Type != html.CommentNode || len(p.actions) == 0 {
+		return a, false
+	}
+	r, size := utf8.DecodeRuneInString(n.Data)
+	if r != placeholderStart || !strings.HasSuffix(n.Data, string(placeholderEnd)) {
+		return a, false
+	}
+	i, err := strconv.Atoi(n.Data[size : len(n.Data)-utf8.RuneLen(placeholderEnd)])
+	if err != nil || i < 0 || i >= len(p.actions) {
+		return a, false
+	}
+	return p.actions[i], true
+}
+
+// templateWriter restores the template actions that placeholders stand in for
+// as output is written.
+type templateWriter struct {
+	w       io.Writer
+	actions []action
+	pending []byte
+}
+
+func (tw *templateWriter) Write(b []byte) (n int, err error) {
+	n = len(b)
+	buf := append(tw.pending, b...)
+	tw.pending = nil
+	var out []byte
+	for len(buf) > 0 {
+		i := bytes.IndexRune(buf, placeholderStart)
+		if i < 0 {
+			// Wait for the rest of a placeholder that starts partway through
+			// its first character.
+			keep := partialPrefix(buf, string(placeholderStart))
+			out = append(out, buf[:len(buf)-keep]...)
+			tw.pending = append([]byte(nil), buf[len(buf)-keep:]...)
+			break
+		}
+		out = append(out, buf[:i]...)
+		buf = buf[i:]
+		end := bytes.IndexRune(buf, placeholderEnd)
+		if end < 0 {
+			// Wait for the rest of the placeholder.
+			tw.pending = append([]byte(nil), buf...)
+			break
+		}
+		index, err := strconv.Atoi(string(buf[utf8.RuneLen(placeholderStart):end]))
+		if err != nil || index < 0 || index >= len(tw.actions) {
+			out = append(out, buf[:end]...)
+			buf = buf[end:]
+			continue
+		}
+		out = append(out, tw.actions[index].src...)
+		buf = buf[end+utf8.RuneLen(placeholderEnd):]
+	}
+	if _, err = tw.w.Write(out); err != nil {
+		return 0, err
+	}
+	return n, nil
+}
+
+// partialPrefix returns the length of the longest suffix of b that is a
+// proper prefix of s.
+func partialPrefix(b []byte, s string) int {
+	for n := len(s) - 1; n > 0; n-- {
+		if len(b) >= n && string(b[len(b)-n:]) == s[:n] {
+			return n
+		}
+	}
+	return 0
+}
+
+// Flush writes any incomplete placeholder as it is.
+func (tw *templateWriter) Flush() (err error) {
+	if len(tw.pending) > 0 {
+		_, err = tw.w.Write(tw.pending)
+		tw.pending = nil
+	}
+	return err
+}
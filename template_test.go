@@ -0,0 +1,186 @@
+package htmlformat
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestTemplate(t *testing.T) {
+	tests := []struct {
+		name     string
+		syntax   *TemplateSyntax
+		input    string
+		expected string
+	}{
+		{
+			name:  "block actions indent their content",
+			input: "<ul>{{ range .Items }}<li>{{ .Name }}</li>{{ else }}<li>None</li>{{ end }}</ul>",
+			expected: `<ul>
+ {{ range .Items }}
+  <li>{{ .Name }}</li>
+ {{ else }}
+  <li>None</li>
+ {{ end }}
+</ul>
+`,
+		},
+		{
+			name:  "the body that the parser adds to a table is kept outside of a block",
+			input: "<table>{{ range .Rows }}<tr><td>{{ . }}</td></tr>{{ end }}</table>",
+			expected: `<table>
+ <tbody>
+  {{ range .Rows }}
+   <tr>
+    <td>{{ . }}</td>
+   </tr>
+  {{ end }}
+ </tbody>
+</table>
+`,
+		},
+		{
+			name:  "actions within attributes are preserved",
+			input: `<a class="{{ if .Active }}active{{ end }}" href="{{ .URL }}?a=1&b={{ "<x>" }}" {{ if .Hidden }}hidden{{ end }}>x</a>`,
+			expected: `<a class="{{ if .Active }}active{{ end }}" href="{{ .URL }}?a=1&amp;b={{ "<x>" }}" {{ if .Hidden }}hidden{{ end }}>x</a>
+`,
+		},
+		{
+			name:  "inline actions stay in the text",
+			input: `<p>Hello, {{ .Name }}!</p>`,
+			expected: `<p>Hello, {{ .Name }}!</p>
+`,
+		},
+		{
+			name:  "actions on their own line are written on their own line",
+			input: "<div>\n  {{ template \"header\" . }}\n  <p>x</p>\n</div>",
+			expected: `<div>
+ {{ template "header" . }}
+ <p>x</p>
+</div>
+`,
+		},
+		{
+			name:  "delimiters within strings and comments do not end actions",
+			input: `<p>{{ "}}" }} {{/* a "quote */}}</p>`,
+			expected: `<p>{{ "}}" }} {{/* a "quote */}}</p>
+`,
+		},
+		{
+			name:  "actions within script content are preserved",
+			input: `<script>let data = {{ .JSON }}; if (a < b) {}</script>`,
+			expected: `<script>
+  let data = {{ .JSON }}; if (a < b) {}
+</script>
+`,
+		},
+		{
+			name:  "trim markers are recognised on block actions",
+			input: "<div>{{- if .X -}}<p>x</p>{{- end -}}</div>",
+			expected: `<div>
+ {{- if .X -}}
+  <p>x</p>
+ {{- end -}}
+</div>
+`,
+		},
+		{
+			name:   "jinja blocks, expressions and comments",
+			syntax: Jinja,
+			input:  `<ul>{# items #}{% for item in items %}<li class="{{ item.class }}">{{ item.name | e }}</li>{% empty %}<li>None</li>{% endfor %}</ul>{% set x = 1 %}`,
+			expected: `<ul>
+ {# items #}
+ {% for item in items %}
+  <li class="{{ item.class }}">{{ item.name | e }}</li>
+ {% empty %}
+  <li>None</li>
+ {% endfor %}
+</ul>
+{% set x = 1 %}
+`,
+		},
+		{
+			name:   "liquid blocks",
+			syntax: Liquid,
+			input:  `<div>{%- if user -%}<p>Hi {{ user.name }}</p>{%- elsif guest -%}<p>Hi</p>{%- endif -%}</div>`,
+			expected: `<div>
+ {%- if user -%}
+  <p>Hi {{ user.name }}</p>
+ {%- elsif guest -%}
+  <p>Hi</p>
+ {%- endif -%}
+</div>
+`,
+		},
+		{
+			name:   "erb blocks, including do blocks",
+			syntax: ERB,
+			input:  `<ul><%# items %><% @items.each do |item| %><li><%= item.name %></li><% end %></ul><% if a > b %><p>x</p><% end %>`,
+			expected: `<ul>
+ <%# items %>
+ <% @items.each do |item| %>
+  <li><%= item.name %></li>
+ <% end %>
+</ul>
+<% if a > b %>
+ <p>x</p>
+<% end %>
+`,
+		},
+		{
+			name:   "handlebars blocks and comments",
+			syntax: Handlebars,
+			input:  `<div>{{!-- note --}}{{#if author}}<h1>{{{title}}}</h1>{{else}}<h1>Unknown</h1>{{/if}}</div>`,
+			expected: `<div>
+ {{!-- note --}}
+ {{#if author}}
+  <h1>{{{title}}}</h1>
+ {{else}}
+  <h1>Unknown</h1>
+ {{/if}}
+</div>
+`,
+		},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			f := Formatter{Template: test.syntax}
+			if f.Template == nil {
+				f.Template = GoTemplate
+			}
+			out, err := f.CheckFragment([]byte(test.input))
+			if out == nil {
+				t.Fatalf("failed to format: %v", err)
+			}
+			if diff := cmp.Diff(test.expected, string(out)); diff != "" {
+				t.Error(diff)
+			}
+			if err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+func TestTemplateWriter(t *testing.T) {
+	w := new(strings.Builder)
+	tw := &templateWriter{w: w, actions: []action{{src: "{{ .A }}"}, {src: "{{ .B }}"}}}
+	input := "a" + placeholder(0) + "b" + placeholder(1) + "c"
+	// Write a byte at a time, splitting the placeholders across writes.
+	for i := 0; i < len(input); i++ {
+		if _, err := tw.Write([]byte{input[i]}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff("a{{ .A }}b{{ .B }}c", w.String()); diff != "" {
+		t.Error(diff)
+	}
+}
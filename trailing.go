@@ -0,0 +1,122 @@
+package htmlformat
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+)
+
+// TrailingNewlineStyle controls whether the output ends with a newline.
+type TrailingNewlineStyle int
+
+const (
+	// DefaultTrailingNewline ends pretty-printed output with a newline, and
+	// minified output without one.
+	DefaultTrailingNewline TrailingNewlineStyle = iota
+	// RequireTrailingNewline ends the output with a single newline.
+	RequireTrailingNewline
+	// ForbidTrailingNewline ends the output without a newline, which suits
+	// snippets that are inserted into other files.
+	ForbidTrailingNewline
+	// OriginalTrailingNewline ends the output with a newline if the input
+	// ends with one.
+	OriginalTrailingNewline
+)
+
+var trailingNewlineStyleNames = []string{
+	DefaultTrailingNewline:  "default",
+	RequireTrailingNewline:  "require",
+	ForbidTrailingNewline:   "forbid",
+	OriginalTrailingNewline: "preserve",
+}
+
+// String returns the name of the trailing newline style: "default",
+// "require", "forbid" or "preserve".
+func (t TrailingNewlineStyle) String() string {
+	if t < 0 || int(t) >= len(trailingNewlineStyleNames) {
+		return fmt.Sprintf("TrailingNewlineStyle(%d)", int(t))
+	}
+	return trailingNewlineStyleNames[t]
+}
+
+// Set sets the trailing newline style from its name, so that it can be used
+// as a flag.Value.
+func (t *TrailingNewlineStyle) Set(name string) error {
+	for i, n := range trailingNewlineStyleNames {
+		if n == name {
+			*t = TrailingNewlineStyle(i)
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown trailing newline style %q", name)
+}
+
+// trailingNewlineWriter holds back the newlines at the end of what has been
+// written to w until more is written, so that Close can decide how the output
+// ends.
+type trailingNewlineWriter struct {
+	w       io.Writer
+	pending []byte
+	written bool
+	// end returns what the output ends with, once it is complete.
+	end func() string
+}
+
+func (t *trailingNewlineWriter) Write(b []byte) (n int, err error) {
+	content := bytes.TrimRight(b, "\r\n")
+	if len(content) > 0 {
+		if _, err = t.w.Write(t.pending); err != nil {
+			return 0, err
+		}
+		t.pending = t.pending[:0]
+		if _, err = t.w.Write(content); err != nil {
+			return 0, err
+		}
+		t.written = true
+	}
+	t.pending = append(t.pending, b[len(content):]...)
+	return len(b), nil
+}
+
+// Close ends output that is not empty as configured.
+func (t *trailingNewlineWriter) Close() (err error) {
+	if t.written {
+		_, err = io.WriteString(t.w, t.end())
+	}
+	return err
+}
+
+// trailingNewline returns w wrapped to end the output as configured, and a
+// function that ends it.
+func (p *printer) trailingNewline(w io.Writer) (io.Writer, func() error) {
+	if p.TrailingNewline == DefaultTrailingNewline {
+		return w, func() error { return nil }
+	}
+	tw := &trailingNewlineWriter{w: w}
+	tw.end = func() string {
+		switch p.TrailingNewline {
+		case RequireTrailingNewline:
+			return p.newline()
+		case OriginalTrailingNewline:
+			if p.inputNewline {
+				return p.newline()
+			}
+		}
+		return ""
+	}
+	return tw, tw.Close
+}
+
+// lastByteReader records the last byte read from r.
+type lastByteReader struct {
+	r    io.Reader
+	last byte
+}
+
+func (l *lastByteReader) Read(b []byte) (n int, err error) {
+	n, err = l.r.Read(b)
+	if n > 0 {
+		l.last = b[n-1]
+	}
+	return n, err
+}
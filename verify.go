@@ -0,0 +1,309 @@
+package htmlformat
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// VerifyError is returned when Verify is set, if the formatted output does
+// not parse to the same content as the input.
+type VerifyError struct {
+	// Path locates the content that differs, such as "html > body > p[2]".
+	Path string
+	// Message describes how it differs.
+	Message string
+}
+
+func (e *VerifyError) Error() string {
+	if e.Path == "" {
+		return "formatting changed the content: " + e.Message
+	}
+	return fmt.Sprintf("formatting changed the content at %s: %s", e.Path, e.Message)
+}
+
+// verify returns a *VerifyError if the output out does not parse to the same
+// content as nodes, which it was printed from.
+func (p *printer) verify(nodes []*html.Node, out []byte) (err error) {
+	// The output is parsed as it was written, without changing it again.
+	f := *p.Formatter
+	f.Strict, f.StripComments = false, false
+	f.Sanitizer, f.OnNode, f.OnProgress = nil, nil, nil
+	if f.Charset == TranscodeCharset {
+		f.Charset = AssumeUTF8
+	}
+	q := f.newPrinter()
+	q.context = p.context
+	r, err := q.preprocess(bytes.NewReader(out))
+	if err != nil {
+		return err
+	}
+	reparsed, err := q.parse(r)
+	if err != nil {
+		return err
+	}
+	if len(q.Elements) > 0 {
+		reparsed = q.hoistVoidChildren(reparsed)
+	}
+	if len(q.Preserve) > 0 {
+		if reparsed, err = q.preserve(reparsed); err != nil {
+			return err
+		}
+	}
+	return compareContent("", p.content(nodes, textContent), q.content(reparsed, textContent))
+}
+
+// singleComment returns the content of src if it is one comment.
+func singleComment(src string) (data string, ok bool) {
+	data, ok = strings.CutPrefix(src, "<!--")
+	if !ok {
+		return "", false
+	}
+	if data, ok = strings.CutSuffix(data, "-->"); !ok || strings.Contains(data, "-->") {
+		return "", false
+	}
+	return data, true
+}
+
+// contentMode is how the text within an element is compared.
+type contentMode int
+
+const (
+	// textContent is compared with runs of whitespace collapsed, and
+	// whitespace on its own ignored.
+	textContent contentMode = iota
+	// preformattedContent is compared exactly.
+	preformattedContent
+	// rawTextContent is compared line by line, ignoring indentation and
+	// blank lines.
+	rawTextContent
+	// formattedContent is formatted by an EmbeddedFormatter, and not
+	// compared.
+	formattedContent
+)
+
+// content is a node as it is compared.
+type content struct {
+	n        *html.Node
+	mode     contentMode
+	name     string
+	attrs    []string
+	text     string
+	children []*content
+}
+
+// content returns nodes as they are compared, with placeholders replaced by
+// the actions and regions of the input that they stand for.
+func (p *printer) content(nodes []*html.Node, mode contentMode) (cs []*content) {
+	for _, n := range nodes {
+		c := &content{n: n, mode: mode}
+		switch n.Type {
+		case html.TextNode:
+			c.text = p.restorePlaceholders(n.Data)
+		case html.CommentNode:
+			if src, ok := p.verbatimSource(n); ok {
+				c.text = src
+				// A conditional comment may have been an ordinary comment
+				// in the input, such as one that the input ends within,
+				// which is written the same.
+				if data, ok := singleComment(src); ok {
+					c.text = strings.Join(strings.Fields(data), " ")
+				}
+				break
+			}
+			if a, ok := p.templateAction(n); ok {
+				// Actions may be parsed as text or comments, depending on
+				// where they appear, and are written on lines of their own.
+				c.n = &html.Node{Type: html.TextNode}
+				c.text = " " + a.src + " "
+				break
+			}
+			c.text = strings.Join(strings.Fields(n.Data), " ")
+		case html.DoctypeNode:
+			if p.Doctype != HTML5Doctype {
+				c.name = n.Data
+				c.attrs = p.contentAttributes(n)
+			}
+		case html.ElementNode:
+			c.name = n.Data
+			if n.Namespace != "" {
+				c.name = n.Namespace + " " + n.Data
+			}
+			c.attrs = p.contentAttributes(n)
+			childMode := mode
+			switch {
+			case mode != textContent:
+			case p.isPreformattedElement(n):
+				childMode = preformattedContent
+			case p.isSpecialContentElement(n) && p.Mode != Minify && p.embeddedFormatter(n) != nil:
+				childMode = formattedContent
+			case p.isSpecialContentElement(n):
+				childMode = rawTextContent
+			}
+			var children []*html.Node
+			for ch := n.FirstChild; ch != nil; ch = ch.NextSibling {
+				children = append(children, ch)
+			}
+			c.children = p.content(children, childMode)
+		case html.DocumentNode:
+			var children []*html.Node
+			for ch := n.FirstChild; ch != nil; ch = ch.NextSibling {
+				children = append(children, ch)
+			}
+			c.children = p.content(children, mode)
+		}
+		if c.n.Type == html.TextNode && len(cs) > 0 && cs[len(cs)-1].n.Type == html.TextNode {
+			cs[len(cs)-1].text += c.text
+			continue
+		}
+		cs = append(cs, c)
+	}
+	// Normalize the text once it has been joined up.
+	kept := cs[:0]
+	for _, c := range cs {
+		if c.n.Type == html.TextNode {
+			c.text = normalizeText(c.text, c.mode)
+			if c.text == "" && c.mode != preformattedContent {
+				continue
+			}
+		}
+		kept = append(kept, c)
+	}
+	return kept
+}
+
+// normalizeText returns the text s as it is compared in mode.
+func normalizeText(s string, mode contentMode) string {
+	switch mode {
+	case preformattedContent:
+		return s
+	case formattedContent:
+		return ""
+	case rawTextContent:
+		var lines []string
+		for _, l := range strings.Split(s, "\n") {
+			l = strings.TrimSpace(l)
+			switch l {
+			case "", "//<![CDATA[", "//]]>", "/*<![CDATA[*/", "/*]]>*/":
+				continue
+			}
+			lines = append(lines, l)
+		}
+		return strings.Join(lines, "\n")
+	}
+	return strings.Join(strings.Fields(s), " ")
+}
+
+// contentAttributes returns the attributes of n as they are compared, sorted,
+// with the changes that the Formatter makes to them undone.
+func (p *printer) contentAttributes(n *html.Node) (attrs []string) {
+	for _, a := range p.dedupeAttributes(p.withNamespaces(n, n.Attr)) {
+		if p.DropEmptyAttributes && isDroppable(n, a) {
+			continue
+		}
+		val := p.restorePlaceholders(a.Val)
+		switch {
+		case isBooleanAttribute(n, a):
+			val = ""
+		case isClassAttribute(a):
+			val = sortClasses(val)
+		case p.NormalizeStyles && isStyleAttribute(a):
+			val = p.normalizeStyle(val)
+		case p.FormatSrcdoc && isSrcdocAttribute(n, a):
+			val = p.srcdoc(val)
+		case listAttributes[a.Key] != nil && a.Namespace == "":
+			items := listAttributes[a.Key](val)
+			for i, item := range items {
+				items[i] = strings.Join(strings.Fields(item), " ")
+			}
+			val = strings.Join(items, ", ")
+		}
+		attrs = append(attrs, p.restoreActions(attributeName(a))+"="+val)
+	}
+	sort.Strings(attrs)
+	return attrs
+}
+
+// restorePlaceholders returns s with the template actions and the regions of
+// the input that placeholders in it stand for restored. Placeholders that
+// were written as they are, such as those of regions in the text of scripts
+// and attribute values where they cannot be restored, then differ from the
+// input that they stand for.
+func (p *printer) restorePlaceholders(s string) string {
+	if p.verbatimPrefix != "" && strings.Contains(s, p.verbatimPrefix) {
+		s = p.verbatimComment.ReplaceAllStringFunc(s, func(c string) string {
+			if src, ok := p.verbatimSource(&html.Node{Data: c[len("<!--") : len(c)-len("-->")]}); ok {
+				return src
+			}
+			return c
+		})
+	}
+	return p.restoreActions(s)
+}
+
+// restoreActions returns s with the template actions that placeholders in it
+// stand for restored.
+func (p *printer) restoreActions(s string) string {
+	if len(p.actions) == 0 || !strings.ContainsRune(s, placeholderStart) {
+		return s
+	}
+	var sb strings.Builder
+	tw := &templateWriter{w: &sb, actions: p.actions}
+	// Writing to a strings.Builder does not fail.
+	_, _ = tw.Write([]byte(s))
+	_ = tw.Flush()
+	return sb.String()
+}
+
+// compareContent returns a *VerifyError if the content of a and b differs.
+func compareContent(path string, a, b []*content) error {
+	// seen counts the elements with each name so far, to number them.
+	seen := map[string]int{}
+	for i := 0; i < len(a) || i < len(b); i++ {
+		if i >= len(b) {
+			return &VerifyError{Path: path, Message: fmt.Sprintf("%s was removed", describeContent(a[i]))}
+		}
+		if i >= len(a) {
+			return &VerifyError{Path: path, Message: fmt.Sprintf("%s was added", describeContent(b[i]))}
+		}
+		ca, cb := a[i], b[i]
+		if ca.n.Type != cb.n.Type || ca.name != cb.name {
+			return &VerifyError{Path: path, Message: fmt.Sprintf("%s became %s", describeContent(ca), describeContent(cb))}
+		}
+		p := path
+		if ca.n.Type == html.ElementNode {
+			if p != "" {
+				p += " > "
+			}
+			seen[ca.n.Data]++
+			p += fmt.Sprintf("%s[%d]", ca.n.Data, seen[ca.n.Data])
+		}
+		if ca.text != cb.text {
+			return &VerifyError{Path: p, Message: fmt.Sprintf("%q became %q", ca.text, cb.text)}
+		}
+		if strings.Join(ca.attrs, " ") != strings.Join(cb.attrs, " ") {
+			return &VerifyError{Path: p, Message: fmt.Sprintf("attributes %q became %q", ca.attrs, cb.attrs)}
+		}
+		if err := compareContent(p, ca.children, cb.children); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func describeContent(c *content) string {
+	switch c.n.Type {
+	case html.TextNode:
+		return fmt.Sprintf("text %q", c.text)
+	case html.CommentNode:
+		return fmt.Sprintf("comment %q", c.text)
+	case html.DoctypeNode:
+		return "DOCTYPE"
+	case html.ElementNode:
+		return "<" + c.n.Data + ">"
+	}
+	return "document"
+}
@@ -0,0 +1,98 @@
+package htmlformat
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+func TestVerify(t *testing.T) {
+	inputs := []string{
+		`<p>Hello <a href="#">world</a>, how are <em>you</em>?</p>`,
+		`<div>a   b
+   c</div>`,
+		`<pre>  a
+ b</pre>`,
+		`<script>
+  if (a) {
+        b()
+  }
+</script>`,
+		`<img alt="" srcset="a.jpg 480w,b.jpg 800w" sizes="(max-width: 600px) 480px,800px" class="b a b">`,
+		`<input disabled="disabled"><!--   a
+   comment -->`,
+		`<svg viewBox="0 0 10 10"><path d="M0"/></svg>`,
+		`<table><tr><td>a</td></tr></table>`,
+	}
+	formatters := map[string]Formatter{
+		"default": {Verify: true},
+		"pretty": {Verify: true, InlineElements: DefaultInlineElements, PrintWidth: 40,
+			WrapAttributeValues: true, SortClasses: true, Booleans: MinimalBooleans},
+		"minify": {Verify: true, Mode: Minify, Quotes: MinimalQuotes},
+		"cdata":  {Verify: true, WrapCDATA: true, DropEmptyAttributes: true},
+	}
+	for name, f := range formatters {
+		f := f
+		t.Run(name, func(t *testing.T) {
+			for _, input := range inputs {
+				if _, err := f.FragmentString(input); err != nil {
+					t.Errorf("%q: %v", input, err)
+				}
+			}
+		})
+	}
+}
+
+func TestVerifyTemplate(t *testing.T) {
+	f := Formatter{Verify: true, Template: GoTemplate}
+	input := `<ul>{{/* items */}}{{range .Items}}<li>{{.}}</li>{{end}}</ul>`
+	if _, err := f.FragmentString(input); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestVerifyPlaceholder(t *testing.T) {
+	// A placeholder that is written as text, rather than replaced by the
+	// region that it stands for, changes the content.
+	src := `<script>var s = "<!--htmlformat:verbatim:0-->";</script>`
+	p := (&Formatter{Verify: true}).newPrinter()
+	p.context = fragmentContext("")
+	p.setVerbatimPrefix(nil)
+	p.verbatim = []string{"<!--[if IE]>x<![endif]-->"}
+	nodes, err := p.parse(strings.NewReader(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = p.verify(nodes, []byte(src))
+	var ve *VerifyError
+	if !errors.As(err, &ve) {
+		t.Fatalf("expected a *VerifyError, got %v", err)
+	}
+}
+
+func TestVerifyError(t *testing.T) {
+	f := Formatter{Verify: true, OnNode: func(n *html.Node) NodeAction {
+		// A <div> cannot be written within a <p>, as the parser closes the
+		// <p> when it reaches the <div>.
+		if n.DataAtom == atom.P {
+			n.AppendChild(&html.Node{Type: html.ElementNode, Data: "div", DataAtom: atom.Div})
+		}
+		return KeepNode
+	}}
+	var sb strings.Builder
+	err := f.Fragment(&sb, strings.NewReader("<section><p>a</p></section>"))
+	if sb.Len() != 0 {
+		t.Errorf("expected no output, got %q", sb.String())
+	}
+	var verr *VerifyError
+	if !errors.As(err, &verr) {
+		t.Fatalf("expected a *VerifyError, got %v", err)
+	}
+	expected := `formatting changed the content at section[1] > p[1]: <div> was removed`
+	if err.Error() != expected {
+		t.Errorf("expected %q, got %q", expected, err.Error())
+	}
+}
@@ -0,0 +1,157 @@
+package htmlformat
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/net/html"
+)
+
+// WhitespaceSensitivity controls which whitespace in the input the Formatter
+// treats as significant when pretty-printing, and so keeps.
+type WhitespaceSensitivity int
+
+const (
+	// DefaultWhitespace writes the elements of InlineElements within the
+	// text around them, keeps text that starts with punctuation on the line
+	// of the element before it, and writes other elements and text on lines
+	// of their own.
+	DefaultWhitespace WhitespaceSensitivity = iota
+	// CSSWhitespace treats the whitespace around and within the elements
+	// that CSS displays inline by default as significant, as if
+	// InlineElements were DefaultInlineElements when it is not set, and
+	// formats block elements freely.
+	CSSWhitespace
+	// StrictWhitespace treats the whitespace around and within every element
+	// as significant. Whitespace is never added where there was none, or
+	// removed where there was some: lines are only broken where the input
+	// has whitespace, and siblings with none between them are written on one
+	// line.
+	StrictWhitespace
+	// IgnoreWhitespace formats freely, writing every element and text on a
+	// line of its own, as if no elements were inline.
+	IgnoreWhitespace
+)
+
+var whitespaceSensitivityNames = []string{
+	DefaultWhitespace: "default",
+	CSSWhitespace:     "css",
+	StrictWhitespace:  "strict",
+	IgnoreWhitespace:  "ignore",
+}
+
+// String returns the name of the whitespace sensitivity: "default", "css",
+// "strict" or "ignore".
+func (s WhitespaceSensitivity) String() string {
+	if s < 0 || int(s) >= len(whitespaceSensitivityNames) {
+		return fmt.Sprintf("WhitespaceSensitivity(%d)", int(s))
+	}
+	return whitespaceSensitivityNames[s]
+}
+
+// Set sets the whitespace sensitivity from its name, so that it can be used
+// as a flag.Value.
+func (s *WhitespaceSensitivity) Set(name string) error {
+	for i, n := range whitespaceSensitivityNames {
+		if n == name {
+			*s = WhitespaceSensitivity(i)
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown whitespace sensitivity %q", name)
+}
+
+// inlineElements returns the names of the elements that are written within
+// the text around them.
+func (f *Formatter) inlineElements() []string {
+	switch {
+	case f.Whitespace == IgnoreWhitespace:
+		return nil
+	case f.Whitespace == CSSWhitespace && f.InlineElements == nil:
+		return DefaultInlineElements
+	}
+	return f.InlineElements
+}
+
+// strictRun returns the number of nodes at the start of nodes that are
+// written together on one line with StrictWhitespace, as there is no
+// whitespace between them, or 0 if the first of them is written on its own
+// lines. Elements whose content does not start and end with whitespace are
+// written on one line, even on their own. The DOCTYPE and the <html>, <head>
+// and <body> elements are always written on lines of their own, as the
+// parser drops or moves the whitespace around their tags.
+func (p *printer) strictRun(nodes []*html.Node) int {
+	if isEmptyTextNode(nodes[0]) || isDocumentLevel(nodes[0]) {
+		return 0
+	}
+	n := 1
+	for n < len(nodes) && !endsWithSpace(nodes[n-1]) && !startsWithSpace(nodes[n]) && !isDocumentLevel(nodes[n]) {
+		n++
+	}
+	if n == 1 && !p.isStrictFlow(nodes[0]) {
+		return 0
+	}
+	return n
+}
+
+// isStrictFlow reports whether the element n is written on one line with
+// StrictWhitespace, as breaking the line after its start tag or before its
+// end tag would add whitespace.
+func (p *printer) isStrictFlow(n *html.Node) bool {
+	if n.Type != html.ElementNode || isDocumentElement(n) || p.hasNoEndTag(n) || p.isPreformattedElement(n) || p.isSpecialContentElement(n) {
+		return false
+	}
+	return n.FirstChild == nil || !startsWithSpace(n.FirstChild) || !endsWithSpace(n.LastChild)
+}
+
+// isDocumentLevel reports whether n is the DOCTYPE or one of the <html>,
+// <head> and <body> elements.
+func isDocumentLevel(n *html.Node) bool {
+	return n.Type == html.DoctypeNode || n.Type == html.ElementNode && isDocumentElement(n)
+}
+
+func startsWithSpace(n *html.Node) bool {
+	r, _ := utf8.DecodeRuneInString(n.Data)
+	return n.Type == html.TextNode && isHTMLSpace(r)
+}
+
+func endsWithSpace(n *html.Node) bool {
+	r, _ := utf8.DecodeLastRuneInString(n.Data)
+	return n.Type == html.TextNode && isHTMLSpace(r)
+}
+
+// htmlSpace holds the characters that are whitespace in HTML. Others that
+// Unicode considers to be whitespace, such as the non-breaking space, are
+// rendered as text.
+const htmlSpace = " \t\n\f\r"
+
+func isHTMLSpace(r rune) bool {
+	return r < utf8.RuneSelf && isSpace(byte(r))
+}
+
+func trimHTMLSpace(s string) string {
+	return strings.Trim(s, htmlSpace)
+}
+
+// keepsTextOnLine reports whether the only child of n is text that is written
+// on the same line as its tags. With StrictWhitespace, only the elements
+// whose content does not start and end with whitespace are written on one
+// line, and those are written by printFlow. The whitespace at the start and
+// end of <html>, <head> and <body> is not significant. n is nil for the text
+// of a fragment.
+func (p *printer) keepsTextOnLine(n *html.Node) bool {
+	return (!p.strictWhitespace(n) || n != nil && isDocumentElement(n) || p.isSpecialContentElement(n)) && hasSingleTextChild(n)
+}
+
+// isFollowedByPunctuation reports whether n is followed by text starting
+// with punctuation, which is kept on the same line as n.
+func (p *printer) isFollowedByPunctuation(n *html.Node) bool {
+	return p.Whitespace != IgnoreWhitespace && isFollowedByPunctuation(n)
+}
+
+// continuesLine reports whether n is text that is kept on the same line as
+// the element before it.
+func (p *printer) continuesLine(n *html.Node) bool {
+	return n.PrevSibling != nil && n.PrevSibling.Type == html.ElementNode && p.isFollowedByPunctuation(n.PrevSibling)
+}
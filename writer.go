@@ -0,0 +1,87 @@
+package htmlformat
+
+import (
+	"bytes"
+	"errors"
+	"io"
+)
+
+// NewWriter returns a writer that formats the HTML written to it with the
+// default settings, and writes it to w when it is closed.
+func NewWriter(w io.Writer) io.WriteCloser {
+	return new(Formatter).NewWriter(w)
+}
+
+// NewWriter returns a writer that formats the HTML written to it, and writes
+// it to w when it is closed, so that the output of html/template or templ
+// can be formatted by wrapping the writer that it is rendered to. The HTML is
+// formatted as a document if it starts with a DOCTYPE or an <html> tag, and
+// as a fragment otherwise. Nothing is written to w if formatting fails, and
+// w is not closed.
+func (f *Formatter) NewWriter(w io.Writer) io.WriteCloser {
+	return &formatWriter{f: f, w: newOutputWriter(w)}
+}
+
+var errWriterClosed = errors.New("htmlformat: write to closed writer")
+
+// formatWriter buffers the HTML written to it until it is closed.
+type formatWriter struct {
+	f      *Formatter
+	w      io.Writer
+	buf    bytes.Buffer
+	closed bool
+}
+
+func (fw *formatWriter) Write(b []byte) (n int, err error) {
+	if fw.closed {
+		return 0, errWriterClosed
+	}
+	if fw.f.MaxBytes > 0 && fw.buf.Len()+len(b) > fw.f.MaxBytes {
+		return 0, &LimitError{Limit: "MaxBytes", Max: fw.f.MaxBytes}
+	}
+	return fw.buf.Write(b)
+}
+
+// Close formats the HTML written so far and writes it to the underlying
+// writer.
+func (fw *formatWriter) Close() (err error) {
+	if fw.closed {
+		return errWriterClosed
+	}
+	fw.closed = true
+	src := fw.buf.Bytes()
+	var out []byte
+	if isDocumentSource(src) {
+		out, err = fw.f.AppendDocument(nil, src)
+	} else {
+		out, err = fw.f.AppendFragment(nil, src)
+	}
+	if err != nil {
+		return err
+	}
+	_, err = fw.w.Write(out)
+	return err
+}
+
+// isDocumentSource reports whether src starts with a DOCTYPE or an <html>
+// tag, after any byte order mark, whitespace and comments.
+func isDocumentSource(src []byte) bool {
+	src = bytes.TrimPrefix(src, []byte("\xef\xbb\xbf"))
+	for {
+		src = bytes.TrimLeft(src, " \t\n\f\r")
+		if !bytes.HasPrefix(src, []byte("<!--")) {
+			break
+		}
+		end := bytes.Index(src, []byte("-->"))
+		if end < 0 {
+			return false
+		}
+		src = src[end+3:]
+	}
+	return hasPrefixFold(src, "<!doctype") || hasPrefixFold(src, "<html") &&
+		(len(src) == 5 || isSpace(src[5]) || src[5] == '>' || src[5] == '/')
+}
+
+func hasPrefixFold(src []byte, prefix string) bool {
+	return len(src) >= len(prefix) && bytes.EqualFold(src[:len(prefix)], []byte(prefix))
+}
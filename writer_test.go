@@ -0,0 +1,71 @@
+package htmlformat
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestWriter(t *testing.T) {
+	tests := []struct {
+		name     string
+		writes   []string
+		expected string
+	}{
+		{
+			name:     "fragments are formatted as fragments",
+			writes:   []string{"<ul><li>", "A</li>", "<li>B</li></ul>"},
+			expected: "<ul>\n <li>A</li>\n <li>B</li>\n</ul>\n",
+		},
+		{
+			name:     "documents are formatted as documents",
+			writes:   []string{"<!-- generated -->\n<!DOCTYPE html>", "<title>x</title><p>y"},
+			expected: "<!-- generated -->\n<!DOCTYPE html>\n<html>\n <head>\n  <title>x</title>\n </head>\n <body>\n  <p>y</p>\n </body>\n</html>\n",
+		},
+		{
+			name:     "elements that start with html are not documents",
+			writes:   []string{"<html-include src=x>y</html-include>"},
+			expected: "<html-include src=\"x\">y</html-include>\n",
+		},
+		{
+			name:     "nothing written is nothing formatted",
+			expected: "",
+		},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			var out bytes.Buffer
+			w := NewWriter(&out)
+			for _, s := range test.writes {
+				if _, err := w.Write([]byte(s)); err != nil {
+					t.Fatalf("failed to write: %v", err)
+				}
+			}
+			if out.Len() != 0 {
+				t.Errorf("expected nothing to be written before Close, got %q", out.String())
+			}
+			if err := w.Close(); err != nil {
+				t.Fatalf("failed to close: %v", err)
+			}
+			if diff := cmp.Diff(test.expected, out.String()); diff != "" {
+				t.Error(diff)
+			}
+		})
+	}
+}
+
+func TestWriterClosed(t *testing.T) {
+	w := NewWriter(new(bytes.Buffer))
+	if err := w.Close(); err != nil {
+		t.Fatalf("failed to close: %v", err)
+	}
+	if _, err := w.Write([]byte("<p>")); !errors.Is(err, errWriterClosed) {
+		t.Errorf("expected errWriterClosed, got %v", err)
+	}
+}
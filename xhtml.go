@@ -0,0 +1,91 @@
+package htmlformat
+
+import (
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// The namespaces that XHTML declares on the <html>, <svg> and <math>
+// elements, and the prefix of XLink attributes.
+const (
+	xhtmlNamespace = "http://www.w3.org/1999/xhtml"
+	svgNamespace   = "http://www.w3.org/2000/svg"
+	mathNamespace  = "http://www.w3.org/1998/Math/MathML"
+	xlinkNamespace = "http://www.w3.org/1999/xlink"
+)
+
+// xhtml returns a copy of f with the settings that XHTML implies.
+func (f *Formatter) xhtml() *Formatter {
+	x := *f
+	x.SelfClose, x.WrapCDATA = true, true
+	x.Quotes = DoubleQuotes
+	x.Booleans = ExplicitBooleans
+	x.Case = LowercaseNames
+	x.NamedEntities = false
+	x.OmitEndTags, x.OmitImplied = false, false
+	if x.DuplicateAttributes == KeepDuplicates {
+		x.DuplicateAttributes = FirstDuplicate
+	}
+	if x.Component != nil && x.Component.UnquotedActions {
+		c := *x.Component
+		c.UnquotedActions = false
+		x.Component = &c
+	}
+	return &x
+}
+
+// withNamespaces returns attrs, the attributes of n, with the declarations of
+// the namespaces that XHTML requires added if they are missing: that of XHTML
+// on <html>, and those of SVG and MathML on the outermost <svg> and <math>
+// elements, with that of XLink if any of their descendants uses it. The input
+// slice is not modified.
+func (p *printer) withNamespaces(n *html.Node, attrs []html.Attribute) []html.Attribute {
+	if !p.XHTML || n.Type != html.ElementNode {
+		return attrs
+	}
+	var add []html.Attribute
+	switch {
+	case n.Namespace == "" && n.DataAtom == atom.Html:
+		add = append(add, html.Attribute{Key: "xmlns", Val: xhtmlNamespace})
+	case n.Namespace == "svg" && n.Data == "svg" && (n.Parent == nil || n.Parent.Namespace != "svg"):
+		add = append(add, html.Attribute{Key: "xmlns", Val: svgNamespace})
+		if usesXLink(n) {
+			add = append(add, html.Attribute{Namespace: "xmlns", Key: "xlink", Val: xlinkNamespace})
+		}
+	case n.Namespace == "math" && n.Data == "math" && (n.Parent == nil || n.Parent.Namespace != "math"):
+		add = append(add, html.Attribute{Key: "xmlns", Val: mathNamespace})
+	}
+	declared := attrs[:0:0]
+	for _, d := range add {
+		if !hasAttribute(attrs, d.Namespace, d.Key) {
+			declared = append(declared, d)
+		}
+	}
+	if len(declared) == 0 {
+		return attrs
+	}
+	return append(declared, attrs...)
+}
+
+func hasAttribute(attrs []html.Attribute, namespace, key string) bool {
+	for _, a := range attrs {
+		if a.Namespace == namespace && a.Key == key {
+			return true
+		}
+	}
+	return false
+}
+
+// usesXLink reports whether n or any of its descendants has an XLink
+// attribute, such as xlink:href.
+func usesXLink(n *html.Node) (uses bool) {
+	_ = walk(n, func(n *html.Node) (bool, error) {
+		for _, a := range n.Attr {
+			if a.Namespace == "xlink" {
+				uses = true
+			}
+		}
+		return !uses, nil
+	}, func(*html.Node) error { return nil })
+	return uses
+}
@@ -0,0 +1,473 @@
+package htmlformat
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// XML formats an XML document, such as an SVG file, a configuration file or
+// an XSL stylesheet, with the default settings.
+func XML(w io.Writer, r io.Reader) (err error) {
+	return new(Formatter).XML(w, r)
+}
+
+// XML formats an XML document with the indentation, newlines, print width,
+// trailing newline and limits of f, pretty-printing or minifying it according
+// to Mode. Elements that contain only other elements, comments and processing
+// instructions have each of them written on its own line, and whitespace
+// between them dropped. The content of elements that contain text or CDATA
+// sections, or that have xml:space="preserve", is written exactly as it is,
+// on the line of their tags. Empty elements are written self-closed, e.g.
+// <a/>. The input must be well-formed, and encoded in UTF-8.
+//
+// RSS and Atom feeds and sitemaps, whose root is <rss>, <feed>, <urlset> or
+// <sitemapindex>, have the whitespace in the text of their URLs, dates,
+// identifiers and titles, such as <loc>, <pubDate> and <guid>, collapsed so
+// that it is written on one line. Other text, such as that of <description>
+// and <content:encoded>, and CDATA sections are kept as they are.
+func (f *Formatter) XML(w io.Writer, r io.Reader) (err error) {
+	return f.newPrinter().xml(w, r)
+}
+
+// xmlKind is the kind of a node of an XML document.
+type xmlKind int
+
+const (
+	xmlElement xmlKind = iota
+	xmlText
+	xmlCDATA
+	xmlComment
+	xmlProcInst
+	xmlDirective
+)
+
+// xmlNode is a node of an XML document, with the names of elements and
+// attributes as they are written in the input, including their prefixes.
+type xmlNode struct {
+	kind     xmlKind
+	name     xml.Name
+	attrs    []xml.Attr
+	data     string
+	children []*xmlNode
+}
+
+// cdataTarget is the target of the processing instructions that stand for
+// CDATA sections while the input is parsed, as encoding/xml does not tell
+// them apart from other text.
+const cdataTarget = "htmlformat-cdata"
+
+func (p *printer) xml(w io.Writer, r io.Reader) (err error) {
+	w = newOutputWriter(w)
+	if p.MaxBytes > 0 {
+		r = &limitReader{r: r, max: p.MaxBytes}
+	}
+	src, err := io.ReadAll(p.trackReading(r))
+	if err != nil {
+		return err
+	}
+	p.detectNewlines(src)
+	p.inputNewline = len(src) > 0 && (src[len(src)-1] == '\n' || src[len(src)-1] == '\r')
+	nodes, err := p.parseXML(src)
+	if err != nil {
+		return err
+	}
+	for _, n := range nodes {
+		if n.kind == xmlElement {
+			p.xmlFeed = feedRoots[n.name.Local]
+			break
+		}
+	}
+	tw, end := p.trailingNewline(w)
+	bw := bufio.NewWriter(tw)
+	if err = p.printXML(bw, nodes, 0); err != nil {
+		return err
+	}
+	if err = bw.Flush(); err != nil {
+		return err
+	}
+	if err = end(); err != nil {
+		return err
+	}
+	p.reportProgress()
+	return nil
+}
+
+// parseXML parses the XML document src into its top-level nodes.
+func (p *printer) parseXML(src []byte) (nodes []*xmlNode, err error) {
+	src, sections := extractXMLCDATA(src)
+	d := xml.NewDecoder(bytes.NewReader(src))
+	root := &xmlNode{}
+	open := []*xmlNode{root}
+	var count int
+	for {
+		tok, err := d.RawToken()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			var se *xml.SyntaxError
+			if errors.As(err, &se) {
+				return nil, &ParseError{Line: se.Line, Err: errors.New(se.Msg)}
+			}
+			return nil, err
+		}
+		if count++; p.MaxNodes > 0 && count > p.MaxNodes {
+			return nil, &LimitError{Limit: "MaxNodes", Max: p.MaxNodes}
+		}
+		parent := open[len(open)-1]
+		var n *xmlNode
+		switch tok := tok.(type) {
+		case xml.StartElement:
+			n = &xmlNode{kind: xmlElement, name: tok.Name, attrs: tok.Copy().Attr}
+			if p.MaxDepth > 0 && len(open) > p.MaxDepth {
+				return nil, &LimitError{Limit: "MaxDepth", Max: p.MaxDepth}
+			}
+			parent.children = append(parent.children, n)
+			open = append(open, n)
+			continue
+		case xml.EndElement:
+			if parent == root || parent.name != tok.Name {
+				line, _ := d.InputPos()
+				return nil, &ParseError{Line: line, Err: errors.New("unexpected end element </" + xmlName(tok.Name) + ">")}
+			}
+			open = open[:len(open)-1]
+			continue
+		case xml.CharData:
+			if last := len(parent.children) - 1; last >= 0 && parent.children[last].kind == xmlText {
+				parent.children[last].data += string(tok)
+				continue
+			}
+			n = &xmlNode{kind: xmlText, data: string(tok)}
+		case xml.Comment:
+			n = &xmlNode{kind: xmlComment, data: string(tok)}
+		case xml.ProcInst:
+			if tok.Target == cdataTarget {
+				i, _ := strconv.Atoi(strings.TrimSpace(string(tok.Inst)))
+				n = &xmlNode{kind: xmlCDATA, data: sections[i]}
+				break
+			}
+			n = &xmlNode{kind: xmlProcInst, name: xml.Name{Local: tok.Target}, data: string(tok.Inst)}
+		case xml.Directive:
+			n = &xmlNode{kind: xmlDirective, data: string(tok)}
+		}
+		parent.children = append(parent.children, n)
+	}
+	if len(open) > 1 {
+		line, _ := d.InputPos()
+		return nil, &ParseError{Line: line, Err: errors.New("unexpected EOF, <" + xmlName(open[len(open)-1].name) + "> is not closed")}
+	}
+	return root.children, nil
+}
+
+// extractXMLCDATA replaces each CDATA section in src with a processing
+// instruction that holds its index in sections, and as many newlines as it
+// has, so that the lines of syntax errors are those of the input.
+func extractXMLCDATA(src []byte) (out []byte, sections []string) {
+	if !bytes.Contains(src, []byte("<![CDATA[")) {
+		return src, nil
+	}
+	var buf bytes.Buffer
+	var last int
+	for i := 0; i < len(src); {
+		j := bytes.IndexByte(src[i:], '<')
+		if j < 0 {
+			break
+		}
+		i += j
+		rest := src[i:]
+		var close string
+		switch {
+		case bytes.HasPrefix(rest, []byte("<![CDATA[")):
+			close = "]]>"
+		case bytes.HasPrefix(rest, []byte("<!--")):
+			close = "-->"
+		case bytes.HasPrefix(rest, []byte("<?")):
+			close = "?>"
+		default:
+			i++
+			continue
+		}
+		end := bytes.Index(rest, []byte(close))
+		if end < 0 {
+			// The decoder reports the unterminated section.
+			break
+		}
+		end += len(close)
+		if close == "]]>" {
+			buf.Write(src[last:i])
+			fmt.Fprintf(&buf, "<?%s %d%s?>", cdataTarget, len(sections), strings.Repeat("\n", bytes.Count(rest[:end], []byte("\n"))))
+			sections = append(sections, string(rest[:end]))
+			last = i + end
+		}
+		i += end
+	}
+	buf.Write(src[last:])
+	return buf.Bytes(), sections
+}
+
+// printXML writes nodes, which are the top-level nodes of a document or the
+// children of an element that contains only elements, comments and
+// processing instructions, indented to level.
+func (p *printer) printXML(w io.Writer, nodes []*xmlNode, level int) (err error) {
+	for _, n := range nodes {
+		if err = p.checkContext(); err != nil {
+			return err
+		}
+		p.wrote(1)
+		if n.kind == xmlText && strings.TrimSpace(n.data) == "" {
+			continue
+		}
+		if err = p.xmlIndent(w, level); err != nil {
+			return err
+		}
+		if n.kind != xmlElement {
+			var sb strings.Builder
+			writeXMLInline(&sb, n)
+			if _, err = write(w, sb.String(), p.xmlNewline()); err != nil {
+				return err
+			}
+			continue
+		}
+		content := xmlContent(n)
+		if err = p.printXMLStartTag(w, n, level, len(content) == 0); err != nil {
+			return err
+		}
+		switch {
+		case len(content) == 0:
+		case isXMLText(n):
+			var sb strings.Builder
+			if text, ok := p.feedText(n); ok {
+				sb.WriteString(xmlTextEscaper.Replace(text))
+			} else {
+				for _, c := range n.children {
+					writeXMLInline(&sb, c)
+				}
+			}
+			sb.WriteString("</" + xmlName(n.name) + ">")
+			if _, err = io.WriteString(w, sb.String()); err != nil {
+				return err
+			}
+		default:
+			if _, err = io.WriteString(w, p.xmlNewline()); err != nil {
+				return err
+			}
+			if err = p.printXML(w, content, level+1); err != nil {
+				return err
+			}
+			if err = p.xmlIndent(w, level); err != nil {
+				return err
+			}
+			if _, err = write(w, "</", xmlName(n.name), ">"); err != nil {
+				return err
+			}
+		}
+		if _, err = io.WriteString(w, p.xmlNewline()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// printXMLStartTag writes the start tag of the element n, which has been
+// indented to level, self-closed if empty is set. If the tag would not fit
+// within the print width, its attributes are written one per line, indented
+// by a further level.
+func (p *printer) printXMLStartTag(w io.Writer, n *xmlNode, level int, empty bool) (err error) {
+	end := ">"
+	if empty {
+		end = "/>"
+	}
+	attrs := make([]string, len(n.attrs))
+	width := level*utf8.RuneCountInString(p.indent()) + utf8.RuneCountInString(xmlName(n.name)) + 1 + len(end)
+	for i, a := range n.attrs {
+		attrs[i] = xmlName(a.Name) + `="` + xmlAttributeEscaper.Replace(a.Value) + `"`
+		width += 1 + utf8.RuneCountInString(attrs[i])
+	}
+	if p.Mode == Minify || p.PrintWidth <= 0 || width <= p.PrintWidth || len(attrs) == 0 {
+		if _, err = write(w, "<", xmlName(n.name)); err != nil {
+			return err
+		}
+		for _, a := range attrs {
+			if _, err = write(w, " ", a); err != nil {
+				return err
+			}
+		}
+		_, err = io.WriteString(w, end)
+		return err
+	}
+	if p.AttributeAlignment == AlignAttributes {
+		align := strings.Repeat(" ", utf8.RuneCountInString(xmlName(n.name))+2)
+		if _, err = write(w, "<", xmlName(n.name), " ", attrs[0]); err != nil {
+			return err
+		}
+		for _, a := range attrs[1:] {
+			if _, err = io.WriteString(w, p.newline()); err != nil {
+				return err
+			}
+			if err = p.printIndent(w, level); err != nil {
+				return err
+			}
+			if _, err = write(w, align, a); err != nil {
+				return err
+			}
+		}
+		_, err = io.WriteString(w, end)
+		return err
+	}
+	if _, err = write(w, "<", xmlName(n.name), p.newline()); err != nil {
+		return err
+	}
+	for i, a := range attrs {
+		if err = p.printIndent(w, level+1); err != nil {
+			return err
+		}
+		if p.BracketSameLine && i == len(attrs)-1 {
+			_, err = write(w, a, end)
+			return err
+		}
+		if _, err = write(w, a, p.newline()); err != nil {
+			return err
+		}
+	}
+	if err = p.printIndent(w, level); err != nil {
+		return err
+	}
+	_, err = io.WriteString(w, end)
+	return err
+}
+
+// xmlIndent indents a line to level when pretty-printing.
+func (p *printer) xmlIndent(w io.Writer, level int) error {
+	if p.Mode == Minify {
+		return nil
+	}
+	return p.printIndent(w, level)
+}
+
+// xmlNewline returns the newline that ends a line when pretty-printing.
+func (p *printer) xmlNewline() string {
+	if p.Mode == Minify {
+		return ""
+	}
+	return p.newline()
+}
+
+// xmlContent returns the children of the element n that are written, which
+// are all of them unless it contains only elements, comments and processing
+// instructions, in which case the whitespace between them is left out.
+func xmlContent(n *xmlNode) (content []*xmlNode) {
+	if isXMLText(n) {
+		return n.children
+	}
+	for _, c := range n.children {
+		if c.kind != xmlText {
+			content = append(content, c)
+		}
+	}
+	return content
+}
+
+// isXMLText reports whether the content of the element n is written exactly
+// as it is, because it has text other than whitespace, or CDATA sections, or
+// because it has xml:space="preserve".
+func isXMLText(n *xmlNode) bool {
+	for _, a := range n.attrs {
+		if a.Name.Space == "xml" && a.Name.Local == "space" {
+			return a.Value == "preserve"
+		}
+	}
+	for _, c := range n.children {
+		if c.kind == xmlCDATA || c.kind == xmlText && strings.TrimSpace(c.data) != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// writeXMLInline writes n and its descendants to sb exactly as they are.
+func writeXMLInline(sb *strings.Builder, n *xmlNode) {
+	switch n.kind {
+	case xmlText:
+		sb.WriteString(xmlTextEscaper.Replace(n.data))
+	case xmlCDATA:
+		sb.WriteString(n.data)
+	case xmlComment:
+		sb.WriteString("<!--" + n.data + "-->")
+	case xmlProcInst:
+		sb.WriteString("<?" + n.name.Local)
+		if n.data != "" {
+			sb.WriteString(" " + n.data)
+		}
+		sb.WriteString("?>")
+	case xmlDirective:
+		sb.WriteString("<!" + n.data + ">")
+	case xmlElement:
+		sb.WriteString("<" + xmlName(n.name))
+		for _, a := range n.attrs {
+			sb.WriteString(" " + xmlName(a.Name) + `="` + xmlAttributeEscaper.Replace(a.Value) + `"`)
+		}
+		if len(n.children) == 0 {
+			sb.WriteString("/>")
+			return
+		}
+		sb.WriteString(">")
+		for _, c := range n.children {
+			writeXMLInline(sb, c)
+		}
+		sb.WriteString("</" + xmlName(n.name) + ">")
+	}
+}
+
+// xmlName returns name as it is written, with its prefix.
+func xmlName(name xml.Name) string {
+	if name.Space != "" {
+		return name.Space + ":" + name.Local
+	}
+	return name.Local
+}
+
+var (
+	xmlTextEscaper      = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;")
+	xmlAttributeEscaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", `"`, "&quot;")
+)
+
+// feedRoots holds the names of the root elements of RSS and Atom feeds and
+// sitemaps.
+var feedRoots = map[string]bool{"rss": true, "feed": true, "urlset": true, "sitemapindex": true}
+
+// feedTextElements holds the names of the elements of feeds and sitemaps
+// whose text is written on one line.
+var feedTextElements = map[string]bool{
+	// Sitemaps.
+	"loc": true, "lastmod": true, "changefreq": true, "priority": true,
+	// RSS.
+	"link": true, "guid": true, "pubDate": true, "lastBuildDate": true,
+	"title": true, "author": true, "category": true, "comments": true,
+	"language": true, "generator": true, "ttl": true, "dc:creator": true,
+	"dc:date": true,
+	// Atom.
+	"id": true, "updated": true, "published": true, "name": true,
+	"email": true, "uri": true,
+}
+
+// feedText returns the text of the element n of a feed or sitemap with its
+// whitespace collapsed, if n is one whose text is written on one line and its
+// only content is text.
+func (p *printer) feedText(n *xmlNode) (string, bool) {
+	if !p.xmlFeed || !feedTextElements[xmlName(n.name)] || len(n.children) != 1 || n.children[0].kind != xmlText {
+		return "", false
+	}
+	for _, a := range n.attrs {
+		if a.Name.Space == "xml" && a.Name.Local == "space" && a.Value == "preserve" {
+			return "", false
+		}
+	}
+	return strings.Join(strings.Fields(n.children[0].data), " "), true
+}
@@ -0,0 +1,133 @@
+package htmlformat
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestXML(t *testing.T) {
+	tests := []struct {
+		name      string
+		formatter Formatter
+		input     string
+		expected  string
+	}{
+		{
+			name:     "elements are indented",
+			input:    `<?xml version="1.0"?><config><server port='80'><host>example.com</host></server><empty></empty></config>`,
+			expected: "<?xml version=\"1.0\"?>\n<config>\n <server port=\"80\">\n  <host>example.com</host>\n </server>\n <empty/>\n</config>\n",
+		},
+		{
+			name:     "whitespace between elements is replaced",
+			input:    "<a>\n\n      <b/>\n\t<!-- c -->\n</a>",
+			expected: "<a>\n <b/>\n <!-- c -->\n</a>\n",
+		},
+		{
+			name:     "mixed content is kept as it is",
+			input:    "<p>a  <b>b</b>\n c &amp; &lt;d&gt;</p>",
+			expected: "<p>a  <b>b</b>\n c &amp; &lt;d&gt;</p>\n",
+		},
+		{
+			name:     "xml:space preserve keeps whitespace between elements",
+			input:    `<a xml:space="preserve"> <b/> </a>`,
+			expected: "<a xml:space=\"preserve\"> <b/> </a>\n",
+		},
+		{
+			name:     "CDATA sections are kept",
+			input:    "<script><![CDATA[if (a < b) {}]]></script>",
+			expected: "<script><![CDATA[if (a < b) {}]]></script>\n",
+		},
+		{
+			name:     "prefixes are kept",
+			input:    `<svg xmlns="http://www.w3.org/2000/svg" xmlns:xlink="http://www.w3.org/1999/xlink"><use xlink:href="#a"/></svg>`,
+			expected: "<svg xmlns=\"http://www.w3.org/2000/svg\" xmlns:xlink=\"http://www.w3.org/1999/xlink\">\n <use xlink:href=\"#a\"/>\n</svg>\n",
+		},
+		{
+			name:      "long start tags have an attribute per line",
+			formatter: Formatter{PrintWidth: 20},
+			input:     `<a><b first="1" second="2"/></a>`,
+			expected:  "<a>\n <b\n  first=\"1\"\n  second=\"2\"\n />\n</a>\n",
+		},
+		{
+			name:      "long start tags can end on the line of their last attribute",
+			formatter: Formatter{PrintWidth: 20, BracketSameLine: true},
+			input:     `<a><b first="1" second="2">c</b></a>`,
+			expected:  "<a>\n <b\n  first=\"1\"\n  second=\"2\">c</b>\n</a>\n",
+		},
+		{
+			name:      "the attributes of long start tags can be aligned",
+			formatter: Formatter{PrintWidth: 20, AttributeAlignment: AlignAttributes},
+			input:     `<a><b first="1" second="2"/></a>`,
+			expected:  "<a>\n <b first=\"1\"\n    second=\"2\"/>\n</a>\n",
+		},
+		{
+			name:     "the text of feed URLs and dates is written on one line",
+			input:    "<urlset><url><loc>\n  https://example.com/a?b=1&amp;c=2\n</loc><lastmod> 2024-01-01 </lastmod></url></urlset>",
+			expected: "<urlset>\n <url>\n  <loc>https://example.com/a?b=1&amp;c=2</loc>\n  <lastmod>2024-01-01</lastmod>\n </url>\n</urlset>\n",
+		},
+		{
+			name:     "feed descriptions and content are kept as they are",
+			input:    "<rss><channel><item><title>\n a  b\n</title><description><![CDATA[<p>c</p>]]></description><content:encoded>\n  d\n\n  e\n</content:encoded></item></channel></rss>",
+			expected: "<rss>\n <channel>\n  <item>\n   <title>a b</title>\n   <description><![CDATA[<p>c</p>]]></description>\n   <content:encoded>\n  d\n\n  e\n</content:encoded>\n  </item>\n </channel>\n</rss>\n",
+		},
+		{
+			name:     "the text of other documents is kept as it is",
+			input:    "<config><title>\n a  b\n</title></config>",
+			expected: "<config>\n <title>\n a  b\n</title>\n</config>\n",
+		},
+		{
+			name:      "output is minified",
+			formatter: Formatter{Mode: Minify},
+			input:     "<a>\n <b>c</b>\n <d/>\n</a>\n",
+			expected:  "<a><b>c</b><d/></a>",
+		},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			var sb strings.Builder
+			if err := test.formatter.XML(&sb, strings.NewReader(test.input)); err != nil {
+				t.Fatalf("failed to format: %v", err)
+			}
+			if diff := cmp.Diff(test.expected, sb.String()); diff != "" {
+				t.Error(diff)
+			}
+		})
+	}
+}
+
+func TestXMLErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+	}{
+		{
+			name:  "mismatched end tag",
+			input: "<a><b></a>",
+		},
+		{
+			name:  "unclosed element",
+			input: "<a><b/>",
+		},
+		{
+			name:  "unterminated CDATA section",
+			input: "<a><![CDATA[b</a>",
+		},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			if err := XML(new(strings.Builder), strings.NewReader(test.input)); err == nil {
+				t.Error("expected an error")
+			}
+		})
+	}
+}